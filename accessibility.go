@@ -0,0 +1,54 @@
+package latex
+
+// AccessibilityMetadata holds the document properties accessibility checkers
+// require at minimum.
+type AccessibilityMetadata struct {
+	// Lang is the natural language of the document, e.g. "en-US".
+	Lang  string
+	Title string
+}
+
+// EnsureAccessibilityMetadata sets the language and title of a PDF and makes
+// viewers display the title instead of the filename, unless the source set
+// them already. It requires qpdf and defaults to the output of the compiled
+// file.
+func (t *CompileTask) EnsureAccessibilityMetadata(file string, metadata AccessibilityMetadata) error {
+	file = t.pdfPath(file)
+	objects, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+
+	catalog, catalogRef := objects.catalog()
+	catalog = copyPdfDict(catalog)
+	catalogChanged := false
+	if _, ok := catalog["/Lang"]; !ok && metadata.Lang != "" {
+		catalog["/Lang"] = pdfTextString(metadata.Lang)
+		catalogChanged = true
+	}
+
+	preferences, preferencesRef := objects.dict(catalog["/ViewerPreferences"])
+	if _, ok := preferences["/DisplayDocTitle"]; !ok {
+		preferences = copyPdfDict(preferences)
+		preferences["/DisplayDocTitle"] = true
+		if preferencesRef != "" {
+			objects.set(preferencesRef, preferences)
+		} else {
+			catalog["/ViewerPreferences"] = preferences
+			catalogChanged = true
+		}
+	}
+	if catalogChanged {
+		objects.set(catalogRef, catalog)
+	}
+
+	if metadata.Title != "" {
+		info, infoRef := objects.info()
+		if pdfStringValue(info["/Title"]) == "" {
+			info = copyPdfDict(info)
+			info["/Title"] = pdfTextString(metadata.Title)
+			objects.set(infoRef, info)
+		}
+	}
+	return t.writePdfObjects(file, objects)
+}
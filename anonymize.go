@@ -0,0 +1,260 @@
+package latex
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// anonymousInfoKeys lists the entries of the PDF information dictionary
+// kept by anonymization, besides the ones set from the sources.
+var anonymousInfoKeys = []string{"/Producer", "/Creator", "/CreationDate", "/ModDate", "/Trapped"}
+
+// AnonymizeConfig configures the anonymization of documents for
+// double-blind review, see AnonymizeSources and BuildAnonymized.
+type AnonymizeConfig struct {
+	// Commands maps commands to the replacement of their argument, e.g.
+	// "author" to "Anonymous". Commands mapped to an empty string are
+	// removed along with their arguments.
+	Commands map[string]string `json:"commands"`
+	// Remove lists environments and sections (by title, compared
+	// case-insensitively) removed with their content.
+	Remove []string `json:"remove"`
+	// Replace maps text, like the names of authors, institutions or grants,
+	// to its replacement.
+	Replace map[string]string `json:"replace"`
+	// StripComments removes comments from the sources, which often name
+	// people, see MinifyTeX.
+	StripComments bool `json:"stripComments"`
+	// Author replaces the authors in the PDF metadata. Other metadata
+	// besides the title, subject, keywords and tool information is removed.
+	Author string `json:"author"`
+	// Variant names the anonymized build, see BuildAnonymized.
+	Variant string `json:"variant"`
+}
+
+// DefaultAnonymizeConfig returns a config removing author blocks of common
+// document classes and acknowledgments.
+func DefaultAnonymizeConfig() AnonymizeConfig {
+	return AnonymizeConfig{
+		Commands: map[string]string{
+			"author":           "Anonymous",
+			"thanks":           "",
+			"affiliation":      "",
+			"affil":            "",
+			"institute":        "",
+			"address":          "",
+			"email":            "",
+			"orcid":            "",
+			"IEEEauthorblockN": "",
+			"IEEEauthorblockA": "",
+		},
+		Remove: []string{
+			"acknowledgments", "acknowledgements", "acknowledgment",
+			"acknowledgement", "acks",
+		},
+		StripComments: true,
+		Author:        "Anonymous",
+		Variant:       "anonymous",
+	}
+}
+
+// LoadAnonymizeConfig reads an anonymization config from a JSON or YAML file
+// (by extension). Fields missing in the file are empty, not the defaults.
+// Unknown fields, like misspelled ones, are errors, so a mistake can't
+// silently leave names in the anonymized output.
+func LoadAnonymizeConfig(file string) (AnonymizeConfig, error) {
+	config := AnonymizeConfig{}
+	err := decodeConfigFile(file, &config)
+	return config, err
+}
+
+// AnonymizeTeX applies config to TeX source.
+func AnonymizeTeX(src []byte, config AnonymizeConfig) []byte {
+	s := string(src)
+	if config.StripComments {
+		s = string(MinifyTeX([]byte(s)))
+	}
+	for _, name := range config.Remove {
+		for {
+			start, _, _, end, ok := texSectionSpan(s, name)
+			if !ok {
+				break
+			}
+			s = s[:start] + s[end:]
+		}
+	}
+	s = anonymizeCommands(s, config.Commands)
+	if len(config.Replace) > 0 {
+		olds := make([]string, 0, len(config.Replace))
+		for old := range config.Replace {
+			if old != "" {
+				olds = append(olds, old)
+			}
+		}
+		// the replacer prefers earlier arguments, so full names win over
+		// parts of them
+		slices.SortFunc(olds, func(a, b string) int {
+			if len(a) != len(b) {
+				return len(b) - len(a)
+			}
+			return strings.Compare(a, b)
+		})
+		replacements := make([]string, 0, 2*len(olds))
+		for _, old := range olds {
+			replacements = append(replacements, old, config.Replace[old])
+		}
+		s = strings.NewReplacer(replacements...).Replace(s)
+	}
+	return []byte(s)
+}
+
+// anonymizeCommands replaces the arguments of commands, removing the
+// commands with an empty replacement. Commands are replaced with their
+// optional argument and one mandatory argument; occurrences without a
+// mandatory argument, like in definitions, are left alone.
+func anonymizeCommands(s string, commands map[string]string) string {
+	if len(commands) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		name, end := texCommandName(s, i)
+		if name == "" {
+			// control symbol like \\ or \%
+			i++
+			continue
+		}
+		replacement, ok := commands[name]
+		if !ok {
+			i = end - 1
+			continue
+		}
+		_, argEnd, ok := texGroup(s, skipTexOptional(s, end))
+		if !ok {
+			i = end - 1
+			continue
+		}
+		b.WriteString(s[last:i])
+		if replacement != "" {
+			b.WriteString(`\` + name + "{" + replacement + "}")
+		}
+		last = argEnd
+		i = argEnd - 1
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// AnonymizeSources applies config to the TeX sources (.tex, .sty, .cls and
+// .ltx files) in the compile directory using AnonymizeTeX. Bibliographies
+// are left alone, self-citations have to be handled by the authors.
+func (t *CompileTask) AnonymizeSources(config AnonymizeConfig) error {
+	return filepath.WalkDir(t.CompileDirInternal(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !slices.Contains(texSourceExtensions, filepath.Ext(path)) {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, AnonymizeTeX(src, config), info.Mode().Perm())
+	})
+}
+
+// BuildAnonymized builds an anonymized variant of a file (defaulting to the
+// compile file) alongside the normal build: the compile directory is
+// copied, anonymized using AnonymizeSources and built there using Build.
+// The metadata of the PDF is then replaced with the one of the anonymized
+// sources, which requires qpdf. The PDF and the log are copied to the
+// compile directory, named after the file and the variant of config, like
+// paper-anonymous.pdf, and returned in the result.
+//
+// Auxiliary files of an earlier build are not copied, as they may contain
+// the names removed.
+func (t *CompileTask) BuildAnonymized(config AnonymizeConfig, file string, args ...string) (*CompileResult, error) {
+	file = t.defaultCompileFilename(file)
+	variant := config.Variant
+	if variant == "" {
+		variant = "anonymous"
+	}
+	original := t.CompileDirInternal()
+	c, remove, err := t.inTempCompileDir("go-latex-anonymized-")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	err = copyTree(original, c.CompileDirInternal())
+	if err != nil {
+		return nil, err
+	}
+	c.ClearLatexTempFiles(c.CompileDirInternal())
+	os.Remove(c.pdfPath(file))
+	err = c.grantAccess(c.CompileDir())
+	if err != nil {
+		return nil, err
+	}
+	err = c.AnonymizeSources(config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.Build(file, args...)
+	if result == nil {
+		return nil, err
+	}
+	base := jobname(file) + "-" + variant
+	target := filepath.Join(original, filepath.Dir(file))
+	log := filepath.Join(target, base+".log")
+	if copyFile(result.Log, log) == nil {
+		result.Log = log
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = c.writeAnonymousMetadata(result.Pdf, config)
+	if err != nil {
+		return result, err
+	}
+	pdf := filepath.Join(target, base+".pdf")
+	err = copyFile(result.Pdf, pdf)
+	if err != nil {
+		return result, err
+	}
+	result.Pdf = pdf
+	return result, nil
+}
+
+// writeAnonymousMetadata replaces the metadata of a PDF compiled from
+// anonymized sources.
+func (t *CompileTask) writeAnonymousMetadata(pdf string, config AnonymizeConfig) error {
+	metadata := PdfMetadata{}
+	if tex := texFileFor(pdf); tex != "" {
+		f, err := ParseFrontMatterFile(tex)
+		if err != nil {
+			return err
+		}
+		source := MetadataFromFrontMatter(f)
+		metadata.Title = source.Title
+		metadata.Subject = source.Subject
+		metadata.Keywords = source.Keywords
+	}
+	if config.Author != "" {
+		metadata.Authors = []string{config.Author}
+	}
+	return t.writePdfMetadata(pdf, metadata, func(key string) bool {
+		return slices.Contains(anonymousInfoKeys, key)
+	})
+}
@@ -0,0 +1,182 @@
+package latex
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SourceArchive returns the archive the sources are extracted from, empty
+// if they are copied from the source directory.
+func (t *CompileTask) SourceArchive() string {
+	return t.sourceArchive
+}
+
+// SetSourceArchive makes CopyToCompileDir extract the sources from a zip
+// file or gzipped tarball (detected by content), like a project uploaded by
+// a user, instead of copying the source directory. If all files of the
+// archive are in one directory its content is extracted. Use an empty path
+// to copy the source directory again.
+//
+// Links and other special files are skipped. Entries with absolute paths or
+// paths leaving the compile directory and archives exceeding the
+// SourceLimits (see SetSourceLimits) are rejected with SourceViolations.
+func (t *CompileTask) SetSourceArchive(path string) {
+	t.sourceArchive = path
+}
+
+// ExtractToCompileDir writes the sources from the source archive (see
+// SetSourceArchive) or the source file system (see SetSourceFS) to the
+// compilation directory like CopyToCompileDir, returning failures instead
+// of panicking, which suits archives uploaded by users. Rejected sources are
+// returned as SourceViolations. Without archive or file system the source
+// directory is copied.
+func (t *CompileTask) ExtractToCompileDir(CompileDir string) error {
+	if t.sourceArchive == "" && t.sourceFS == nil {
+		return t.copySourceDir(CompileDir)
+	}
+	t.SetCompileDir(CompileDir)
+	if t.CompileDir() != t.SourceDir() {
+		trackDir(t.Context(), t.CompileDir())
+	}
+
+	os.RemoveAll(CompileDir)
+	err := os.MkdirAll(t.CompileDirInternal(), 0700)
+	if err != nil {
+		return err
+	}
+	m := newMaterializer(t.CompileDirInternal(), t.sourceLimits)
+	if t.sourceArchive == "" {
+		err = m.finish(materializeFS(t.sourceFS, m))
+		if err != nil {
+			return err
+		}
+		return t.grantAccess(t.CompileDir())
+	}
+	err = m.finish(extractArchive(t.sourceArchive, m))
+	if _, ok := err.(SourceViolations); ok {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", t.sourceArchive, err)
+	}
+	err = liftSingleDir(t.CompileDirInternal())
+	if err != nil {
+		return err
+	}
+	return t.grantAccess(t.CompileDir())
+}
+
+// extractArchive extracts a zip file or gzipped tarball using m.
+func extractArchive(file string, m *materializer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(f, info.Size(), m)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return extractTarGz(r, m)
+	}
+	return errors.New("unknown archive format, expected zip or tar.gz")
+}
+
+func extractZip(r io.ReaderAt, size int64, m *materializer) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			err = m.mkdir(f.Name)
+		} else if mode.IsRegular() {
+			err = extractZipFile(f, m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, m *materializer) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return m.writeFile(f.Name, rc)
+}
+
+func extractTarGz(r io.Reader, m *materializer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = m.mkdir(header.Name)
+		case tar.TypeReg:
+			err = m.writeFile(header.Name, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// liftSingleDir moves the content of the only entry of dir up if it is a
+// directory, as archives of projects often hold the project directory.
+func liftSingleDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return err
+	}
+	// renamed first, it may contain an entry of the same name
+	single, err := os.MkdirTemp(dir, ".lift-")
+	if err != nil {
+		return err
+	}
+	os.Remove(single)
+	err = os.Rename(filepath.Join(dir, entries[0].Name()), single)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadDir(single)
+	if err != nil {
+		return err
+	}
+	for _, entry := range content {
+		err = os.Rename(filepath.Join(single, entry.Name()), filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(single)
+}
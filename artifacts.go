@@ -0,0 +1,159 @@
+package latex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactStore keeps the documents produced by jobs of a Queue. It also
+// remembers which job produced the artifact for an idempotency key.
+type ArtifactStore interface {
+	// Put stores file as the artifact of a job and returns its location.
+	Put(jobID, file string) (string, error)
+	// Get returns the location of the artifact of a job.
+	Get(jobID string) (string, error)
+	// RememberKey records that the job with jobID was run for an idempotency
+	// key.
+	RememberKey(key, jobID string) error
+	// LookupKey returns the job run for an idempotency key.
+	LookupKey(key string) (jobID string, ok bool, err error)
+}
+
+// ErrArtifactNotFound is returned if there is no artifact for a job.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// LogStore is implemented by artifact stores keeping the logs of jobs along
+// with their artifacts, see Queue.
+type LogStore interface {
+	// PutLog stores file as the log of a job and returns its location.
+	PutLog(jobID, file string) (string, error)
+}
+
+// DirArtifactStore is an ArtifactStore keeping artifacts in a directory. It
+// is a LogStore as well.
+type DirArtifactStore struct {
+	dir       string
+	redaction []RedactionRule
+}
+
+// NewDirArtifactStore returns a DirArtifactStore using dir, which is created
+// if necessary.
+func NewDirArtifactStore(dir string) (*DirArtifactStore, error) {
+	for _, sub := range []string{"artifacts", "keys", "logs"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &DirArtifactStore{dir: dir}, nil
+}
+
+// Dir returns the directory of the store.
+func (s *DirArtifactStore) Dir() string {
+	return s.dir
+}
+
+// Put implements ArtifactStore.
+func (s *DirArtifactStore) Put(jobID, file string) (string, error) {
+	target := s.artifactPath(jobID, filepath.Ext(file))
+	temp := target + ".tmp"
+	err := copyFile(file, temp)
+	if err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	return target, os.Rename(temp, target)
+}
+
+// SetRedaction sets the rules applied to logs before they are stored, so
+// personal data from templates isn't retained with them:
+//
+//	store.SetRedaction(latex.RedactEmails, latex.RedactIBANs,
+//		latex.RedactLiterals("customer", data.Name, data.Company))
+//
+// Logs stored before are not changed.
+func (s *DirArtifactStore) SetRedaction(rules ...RedactionRule) {
+	s.redaction = rules
+}
+
+// PutLog implements LogStore, redacting the log, see SetRedaction.
+func (s *DirArtifactStore) PutLog(jobID, file string) (string, error) {
+	log, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	target := s.logPath(jobID)
+	temp := target + ".tmp"
+	err = os.WriteFile(temp, Redact(log, s.redaction...), 0600)
+	if err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	return target, os.Rename(temp, target)
+}
+
+// Log returns the location of the log of a job.
+func (s *DirArtifactStore) Log(jobID string) (string, error) {
+	target := s.logPath(jobID)
+	if _, err := os.Stat(target); err != nil {
+		return "", ErrArtifactNotFound
+	}
+	return target, nil
+}
+
+// Get implements ArtifactStore.
+func (s *DirArtifactStore) Get(jobID string) (string, error) {
+	matches, err := filepath.Glob(s.artifactPath(jobID, ".*"))
+	if err != nil {
+		return "", err
+	}
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".tmp") {
+			return match, nil
+		}
+	}
+	return "", ErrArtifactNotFound
+}
+
+// Open opens the artifact of a job for streaming.
+func (s *DirArtifactStore) Open(jobID string) (*os.File, error) {
+	file, err := s.Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(file)
+}
+
+// RememberKey implements ArtifactStore.
+func (s *DirArtifactStore) RememberKey(key, jobID string) error {
+	return os.WriteFile(s.keyPath(key), []byte(jobID), 0600)
+}
+
+// LookupKey implements ArtifactStore.
+func (s *DirArtifactStore) LookupKey(key string) (string, bool, error) {
+	data, err := os.ReadFile(s.keyPath(key))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+func (s *DirArtifactStore) artifactPath(jobID, ext string) string {
+	return filepath.Join(s.dir, "artifacts", slug(jobID)+ext)
+}
+
+func (s *DirArtifactStore) logPath(jobID string) string {
+	return filepath.Join(s.dir, "logs", slug(jobID)+".log")
+}
+
+func (s *DirArtifactStore) keyPath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, "keys", hex.EncodeToString(hash[:]))
+}
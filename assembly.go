@@ -0,0 +1,284 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AssemblyPart is a document built by its own task as part of an Assembly.
+type AssemblyPart struct {
+	// Name identifies the part in errors and is its title in the outline
+	// and table of contents.
+	Name string
+	Task *CompileTask
+	// Build compiles the part, e.g. by calling CopyToCompileDir and Xelatex.
+	Build func(*CompileTask) error
+	// File is the resulting PDF, relative to the compilation directory of
+	// the task. Defaults to the PDF of the compiled file.
+	File string
+}
+
+// Assembly builds several parts like cover, body and appendix, possibly
+// using different engines, and merges them into one PDF.
+type Assembly struct {
+	Parts []AssemblyPart
+	// Parallel builds the parts concurrently.
+	Parallel bool
+	// Renumber stamps continuous page numbers on the merged document, for
+	// parts without page numbers of their own. RenumberFormat may contain
+	// {page} and {total}, it defaults to "{page}".
+	Renumber       bool
+	RenumberFormat string
+	// Outline creates bookmarks for the merged document, one per part
+	// holding the bookmarks of the part.
+	Outline bool
+	// Toc prepends a table of contents compiled using pdflatex, listing the
+	// parts and their bookmarks up to TocDepth levels (default 2).
+	Toc      bool
+	TocTitle string
+	TocDepth int
+	// PageLabels labels the pages of the merged document including the
+	// table of contents, see SetPageLabels.
+	PageLabels []PageLabel
+}
+
+// Add appends a part to the assembly.
+func (a *Assembly) Add(part AssemblyPart) {
+	a.Parts = append(a.Parts, part)
+}
+
+// Build builds all parts and merges their PDFs into output. Page labels of
+// the parts are removed so page numbering is continuous, unless PageLabels
+// are given. Requires qpdf.
+func (a *Assembly) Build(output string) error {
+	if len(a.Parts) == 0 {
+		return errors.New("assembly has no parts")
+	}
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	files, err := a.buildParts()
+	if err != nil {
+		return err
+	}
+
+	t := NewCompileTask()
+	t.SetSourceDir(filepath.Dir(output))
+	var outline []Bookmark
+	if a.Outline || a.Toc {
+		outline, err = a.outline(&t, files)
+		if err != nil {
+			return err
+		}
+	}
+	if a.Toc {
+		toc, tocPages, err := a.compileToc(outline)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(toc))
+		files = append([]string{toc}, files...)
+		outline = shiftBookmarks(outline, tocPages, 0)
+	}
+
+	args := []string{"--empty", "--remove-page-labels", "--pages"}
+	args = append(args, files...)
+	args = append(args, "--", output)
+	_, err = t.runTool("qpdf", args...)
+	if err != nil {
+		return err
+	}
+	if a.Renumber {
+		err = a.stampPageNumbers(&t, output)
+		if err != nil {
+			return err
+		}
+	}
+	if len(a.PageLabels) > 0 {
+		err = t.SetPageLabels(output, a.PageLabels)
+		if err != nil {
+			return err
+		}
+	}
+	if a.Outline {
+		return t.SetBookmarks(output, outline)
+	}
+	return nil
+}
+
+// outline returns the bookmarks of the merged document: one per part with
+// the bookmarks of the part as children.
+func (a *Assembly) outline(t *CompileTask, files []string) ([]Bookmark, error) {
+	outline := []Bookmark{}
+	offset := 0
+	for i, file := range files {
+		bookmarks, err := t.Bookmarks(file)
+		if err != nil {
+			return nil, err
+		}
+		pages, err := t.PageCount(file)
+		if err != nil {
+			return nil, err
+		}
+		outline = append(outline, Bookmark{
+			Title:    a.Parts[i].Name,
+			Page:     offset + 1,
+			Level:    1,
+			Children: shiftBookmarks(bookmarks, offset, 1),
+		})
+		offset += pages
+	}
+	return outline, nil
+}
+
+// shiftBookmarks returns a copy of bookmarks with their pages and levels
+// moved by the given offsets.
+func shiftBookmarks(bookmarks []Bookmark, pageOffset, levelOffset int) []Bookmark {
+	shifted := make([]Bookmark, len(bookmarks))
+	for i, b := range bookmarks {
+		shifted[i] = b
+		if b.Page > 0 {
+			shifted[i].Page += pageOffset
+		}
+		shifted[i].Level += levelOffset
+		shifted[i].Children = shiftBookmarks(b.Children, pageOffset, levelOffset)
+	}
+	return shifted
+}
+
+// compileToc typesets a table of contents for the outline, taking its own
+// length into account for the page numbers. It returns the PDF, located in a
+// temporary directory, and its number of pages.
+func (a *Assembly) compileToc(outline []Bookmark) (string, int, error) {
+	dir, err := os.MkdirTemp("", "go-latex-toc-")
+	if err != nil {
+		return "", 0, err
+	}
+	t := NewCompileTask()
+	t.SetSourceDir(dir)
+	t.SetCompileFilename("toc.tex")
+
+	depth := a.TocDepth
+	if depth <= 0 {
+		depth = 2
+	}
+	title := a.TocTitle
+	if title == "" {
+		title = "Contents"
+	}
+	tocPages := 1
+	for attempt := 0; attempt < 3; attempt++ {
+		var b strings.Builder
+		b.WriteString("\\documentclass{article}\n\\pagestyle{empty}\n\\begin{document}\n")
+		fmt.Fprintf(&b, "\\section*{%s}\n", escapeLatex(title))
+		for _, bookmark := range flattenBookmarks(outline, depth) {
+			page := ""
+			if bookmark.Page > 0 {
+				page = fmt.Sprint(bookmark.Page + tocPages)
+			}
+			fmt.Fprintf(&b, "\\noindent\\hspace*{%.1fem}%s\\dotfill %s\\par\n",
+				1.5*float64(bookmark.Level-1), escapeLatex(bookmark.Title), page)
+		}
+		b.WriteString("\\end{document}\n")
+		err = os.WriteFile(filepath.Join(dir, "toc.tex"), []byte(b.String()), 0600)
+		if err != nil {
+			break
+		}
+		_, err = t.runTool("pdflatex", "-interaction=nonstopmode", "-halt-on-error", "toc.tex")
+		if err != nil {
+			break
+		}
+		var pages int
+		pages, err = t.PageCount("toc.pdf")
+		if err != nil || pages == tocPages {
+			break
+		}
+		tocPages = pages
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", 0, err
+	}
+	return filepath.Join(dir, "toc.pdf"), tocPages, nil
+}
+
+// buildParts builds the parts and returns the absolute paths of their PDFs.
+func (a *Assembly) buildParts() ([]string, error) {
+	files := make([]string, len(a.Parts))
+	errs := make([]error, len(a.Parts))
+	build := func(i int) {
+		part := a.Parts[i]
+		if part.Task == nil {
+			errs[i] = fmt.Errorf("part %s has no task", part.Name)
+			return
+		}
+		if part.Build != nil {
+			err := part.Build(part.Task)
+			if err != nil {
+				errs[i] = fmt.Errorf("part %s: %w", part.Name, err)
+				return
+			}
+		}
+		files[i] = part.Task.pdfPath(part.File)
+		if _, err := os.Stat(files[i]); err != nil {
+			errs[i] = fmt.Errorf("part %s: %w", part.Name, err)
+		}
+	}
+
+	if a.Parallel {
+		var wg sync.WaitGroup
+		for i := range a.Parts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				build(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range a.Parts {
+			build(i)
+		}
+	}
+	return files, errors.Join(errs...)
+}
+
+// stampPageNumbers overlays page numbers centered at the bottom of every
+// page.
+func (a *Assembly) stampPageNumbers(t *CompileTask, file string) error {
+	o, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+	format := a.RenumberFormat
+	if format == "" {
+		format = "{page}"
+	}
+	pages := o.pages()
+	stamp := simplePdf{}
+	for i, ref := range pages {
+		width, height := o.pageSize(ref)
+		text := strings.NewReplacer("{page}", fmt.Sprint(i+1), "{total}", fmt.Sprint(len(pages))).Replace(format)
+		stamp.addPage(width, height).centeredText(width/2, 28, 9, false, text)
+	}
+
+	stampFile, err := os.CreateTemp(filepath.Dir(file), ".go-latex-stamp-*.pdf")
+	if err != nil {
+		return err
+	}
+	stampFile.Close()
+	defer os.Remove(stampFile.Name())
+	err = stamp.writeFile(stampFile.Name())
+	if err != nil {
+		return err
+	}
+	return t.replaceWith(file, func(output string) error {
+		_, err := t.runTool("qpdf", file, "--overlay", stampFile.Name(), "--to=1-z", "--from=1-z", "--", output)
+		return err
+	})
+}
@@ -0,0 +1,91 @@
+package latex
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// assetTypes maps the content types of assets to their file extensions.
+var assetTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"application/pdf": ".pdf",
+}
+
+// Asset decodes an image carried by template data, like a logo sent along
+// with an API request, into a file of the compile directory and returns its
+// path relative to it. data is a data URI like "data:image/png;base64,..."
+// or plain base64, whitespace is ignored. PNG, JPEG and PDF are supported,
+// detected from the content rather than the declared type. Templates use it
+// as
+//
+//	\includegraphics[width=3cm]{ {{- asset .Logo -}} }
+//
+// Files are named by the hash of their content, so repeated assets are
+// written once. Assets larger than SourceLimits.MaxFileSize are rejected.
+// It is not available in templates restricted by TemplateLimits, as it
+// writes files.
+func (t *CompileTask) Asset(data string) (string, error) {
+	payload := data
+	if strings.HasPrefix(payload, "data:") {
+		header, content, ok := strings.Cut(payload, ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", errors.New("asset is not a base64 data URI")
+		}
+		payload = content
+	}
+	payload = strings.Join(strings.Fields(payload), "")
+	if payload == "" {
+		return "", errors.New("empty asset")
+	}
+
+	limit := t.sourceLimits.withDefaults().MaxFileSize
+	// DecodedLen counts padding, which is up to 2 bytes
+	if int64(base64.StdEncoding.DecodedLen(len(payload))) > limit+2 {
+		return "", SourceViolations{{Path: "asset", Kind: ViolationFileSize, Limit: limit}}
+	}
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		content, err = base64.RawStdEncoding.DecodeString(payload)
+	}
+	if err != nil {
+		return "", fmt.Errorf("asset: %w", err)
+	}
+	if int64(len(content)) > limit {
+		return "", SourceViolations{{Path: "asset", Kind: ViolationFileSize, Limit: limit}}
+	}
+	contentType := http.DetectContentType(content)
+	ext, ok := assetTypes[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported asset type %s", contentType)
+	}
+
+	hash := sha256.Sum256(content)
+	name := "assets/" + hex.EncodeToString(hash[:8]) + ext
+	file := filepath.Join(t.CompileDirInternal(), filepath.FromSlash(name))
+	if _, err := os.Stat(file); err == nil {
+		return name, nil
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(file, content, 0644)
+	if err != nil {
+		return "", err
+	}
+	return name, t.grantAccess(file)
+}
+
+func (t *CompileTask) assetFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"asset": t.Asset,
+	}
+}
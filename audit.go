@@ -0,0 +1,131 @@
+package latex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord documents the generation of a single document.
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Actor identifies who or what generated the document.
+	Actor    string `json:"actor,omitempty"`
+	Document string `json:"document"`
+	// ConfigHash identifies the configuration of the task.
+	ConfigHash string `json:"configHash"`
+	// DataHash identifies the template data, if a template was executed.
+	DataHash   string `json:"dataHash,omitempty"`
+	OutputHash string `json:"outputHash"`
+	// Template identifies the template sources of the document.
+	Template TemplateVersion `json:"template"`
+}
+
+// AuditSink persists audit records.
+type AuditSink interface {
+	Record(record AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to an AuditSink.
+type AuditSinkFunc func(record AuditRecord) error
+
+// Record implements AuditSink.
+func (f AuditSinkFunc) Record(record AuditRecord) error {
+	return f(record)
+}
+
+// JSONLinesAuditSink writes audit records as JSON, one per line.
+type JSONLinesAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesAuditSink returns a JSONLinesAuditSink writing to w.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// Record implements AuditSink.
+func (s *JSONLinesAuditSink) Record(record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(s.w).Encode(record)
+}
+
+// SetAuditSink makes the task record every document delivered by MoveToDest
+// to sink on behalf of actor. Use nil to disable auditing.
+func (t *CompileTask) SetAuditSink(sink AuditSink, actor string) {
+	t.auditSink = sink
+	t.auditActor = actor
+}
+
+// Audit records the generation of a document to the audit sink, if there is
+// one.
+func (t *CompileTask) Audit(document string) error {
+	if t.auditSink == nil {
+		return nil
+	}
+	outputHash, err := fileHash(document)
+	if err != nil {
+		return err
+	}
+	version, err := t.TemplateVersion()
+	if err != nil {
+		return err
+	}
+	return t.auditSink.Record(AuditRecord{
+		Timestamp:  time.Now().UTC(),
+		Actor:      t.auditActor,
+		Document:   document,
+		ConfigHash: t.configHash(),
+		DataHash:   t.dataHash,
+		OutputHash: outputHash,
+		Template:   version,
+	})
+}
+
+// configHash identifies the configuration of the task.
+func (t *CompileTask) configHash() string {
+	config := struct {
+		SourceDir       string
+		CompileFilename string
+		ResolveSymlinks bool
+		RunAs           *Credentials
+		Toolchain       *Toolchain
+		OutputFormats   []OutputFormat
+		Features        []string
+	}{
+		t.sourceDir, t.CompileFilename(), t.resolveSymlinks, t.runAs,
+		t.toolchain, t.outputFormats, t.features.Enabled(),
+	}
+	return jsonHash(config)
+}
+
+// jsonHash returns the SHA-256 of the JSON encoding of v, an empty string if
+// it can't be encoded.
+func jsonHash(v interface{}) string {
+	h := sha256.New()
+	err := json.NewEncoder(h).Encode(v)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fileHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,93 @@
+package latex
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PageSelector selects pages of a document with total pages. Pages are
+// numbered starting at 1.
+type PageSelector func(page, total int) bool
+
+// AllPages selects every page.
+func AllPages(page, total int) bool {
+	return true
+}
+
+// FirstPage selects the first page only.
+func FirstPage(page, total int) bool {
+	return page == 1
+}
+
+// LastPage selects the last page only.
+func LastPage(page, total int) bool {
+	return page == total
+}
+
+// PageNumbers selects the given pages.
+func PageNumbers(pages ...int) PageSelector {
+	return func(page, total int) bool {
+		for _, p := range pages {
+			if p == page {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// selectPages returns the pages selected of a document with total pages.
+func (s PageSelector) selectPages(total int) []int {
+	pages := []int{}
+	for page := 1; page <= total; page++ {
+		if s == nil || s(page, total) {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// SetBackgroundPdf makes MoveToDest stamp the first page of the PDF at path
+// under the selected pages of the document, e.g. a letterhead. Use an empty
+// path to disable it. Requires qpdf.
+func (t *CompileTask) SetBackgroundPdf(path string, pages PageSelector) {
+	t.backgroundPdf = path
+	t.backgroundPages = pages
+}
+
+// BackgroundPdf returns the background PDF, an empty string if none.
+func (t *CompileTask) BackgroundPdf() string {
+	return t.backgroundPdf
+}
+
+// ApplyBackground stamps the background PDF under the selected pages of the
+// PDF file.
+func (t *CompileTask) ApplyBackground(file string) error {
+	if t.backgroundPdf == "" {
+		return nil
+	}
+	file = t.pdfPath(file)
+	background, err := filepath.Abs(t.backgroundPdf)
+	if err != nil {
+		return err
+	}
+	total, err := t.PageCount(file)
+	if err != nil {
+		return err
+	}
+	pages := t.backgroundPages.selectPages(total)
+	if len(pages) == 0 {
+		return nil
+	}
+	to := make([]string, 0, len(pages))
+	for _, page := range pages {
+		to = append(to, fmt.Sprint(page))
+	}
+	return t.replaceWith(file, func(output string) error {
+		_, err := t.runTool("qpdf", file,
+			"--underlay", background, "--to="+strings.Join(to, ","), "--from=", "--repeat=1", "--",
+			output)
+		return err
+	})
+}
@@ -0,0 +1,187 @@
+package latex
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BatchRecord is a single record of a batch run, e.g. one letter of a mail
+// merge.
+type BatchRecord struct {
+	// ID identifies the record across runs.
+	ID   string
+	Data interface{}
+}
+
+// BatchFunc builds the document for a record and returns the path of the
+// produced file.
+type BatchFunc func(ctx context.Context, record BatchRecord) (string, error)
+
+// RecordStatus is the bookkeeping of a record in a batch checkpoint.
+type RecordStatus struct {
+	ID       string `json:"id"`
+	Done     bool   `json:"done"`
+	Artifact string `json:"artifact,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Placeholder reports that Artifact is a placeholder page standing in
+	// for the failed record.
+	Placeholder bool      `json:"placeholder,omitempty"`
+	Attempts    int       `json:"attempts"`
+	Finished    time.Time `json:"finished"`
+}
+
+// Batch runs records and checkpoints their progress to a file, so an
+// interrupted run can be resumed without rebuilding completed records.
+type Batch struct {
+	checkpointFile string
+	placeholderDir string
+
+	mu      sync.Mutex
+	records map[string]*RecordStatus
+	order   []string
+}
+
+// OpenBatch returns a Batch using checkpointFile, resuming from its state if
+// it exists.
+func OpenBatch(checkpointFile string) (*Batch, error) {
+	b := &Batch{
+		checkpointFile: checkpointFile,
+		records:        make(map[string]*RecordStatus),
+	}
+	data, err := os.ReadFile(checkpointFile)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*RecordStatus
+	err = json.Unmarshal(data, &statuses)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		b.records[status.ID] = status
+		b.order = append(b.order, status.ID)
+	}
+	return b, nil
+}
+
+// SetPlaceholderDir makes the batch write a placeholder PDF stating the error
+// to dir for every failing record, so downstream assembly and printing find a
+// file for every record. Failures are reported nevertheless.
+func (b *Batch) SetPlaceholderDir(dir string) {
+	b.placeholderDir = dir
+}
+
+// Run builds all records not completed in an earlier run, including records
+// that failed before. A failing record does not stop the batch, its error is
+// recorded instead. The checkpoint is written after every record. Run returns
+// early with the context's error if ctx is done.
+func (b *Batch) Run(ctx context.Context, records []BatchRecord, fn BatchFunc) error {
+	for _, record := range records {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		if status, ok := b.Status(record.ID); ok && status.Done {
+			continue
+		}
+
+		artifact, err := fn(ctx, record)
+		if err != nil && ctx.Err() != nil {
+			// interrupted, not failed
+			return ctx.Err()
+		}
+
+		b.mu.Lock()
+		status, ok := b.records[record.ID]
+		if !ok {
+			status = &RecordStatus{ID: record.ID}
+			b.records[record.ID] = status
+			b.order = append(b.order, record.ID)
+		}
+		status.Attempts++
+		status.Finished = time.Now()
+		status.Done = err == nil
+		status.Artifact = artifact
+		status.Placeholder = false
+		status.Error = ""
+		if err != nil {
+			status.Error = err.Error()
+			if b.placeholderDir != "" {
+				placeholder := filepath.Join(b.placeholderDir, slug(record.ID)+".pdf")
+				os.MkdirAll(b.placeholderDir, 0700)
+				if WritePlaceholderPdf(placeholder, record.ID, err) == nil {
+					status.Artifact = placeholder
+					status.Placeholder = true
+				}
+			}
+		}
+		err = b.save()
+		b.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns the bookkeeping of a record.
+func (b *Batch) Status(id string) (RecordStatus, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status, ok := b.records[id]
+	if !ok {
+		return RecordStatus{}, false
+	}
+	return *status, true
+}
+
+// Completed returns the number of successfully built records.
+func (b *Batch) Completed() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := 0
+	for _, status := range b.records {
+		if status.Done {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed returns the records whose last attempt failed.
+func (b *Batch) Failed() []RecordStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var failed []RecordStatus
+	for _, id := range b.order {
+		if status := b.records[id]; !status.Done {
+			failed = append(failed, *status)
+		}
+	}
+	return failed
+}
+
+// save writes the checkpoint atomically. b.mu must be held.
+func (b *Batch) save() error {
+	statuses := make([]*RecordStatus, 0, len(b.order))
+	for _, id := range b.order {
+		statuses = append(statuses, b.records[id])
+	}
+	data, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp := b.checkpointFile + ".tmp"
+	err = os.WriteFile(temp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, b.checkpointFile)
+}
@@ -0,0 +1,156 @@
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// jobname returns the TeX job name of a file, which names the auxiliary
+// files written to the compile directory.
+func jobname(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+}
+
+// auxFile returns the path of an auxiliary file of the compilation of file,
+// like its .aux or .bcf.
+func (t *CompileTask) auxFile(file, ext string) string {
+	return filepath.Join(t.CompileDirInternal(), jobname(file)+ext)
+}
+
+// Bibtex runs bibtex on the .aux file of a compiled file (defaulting to the
+// compile file). Failures are returned as *CompileError.
+func (t *CompileTask) Bibtex(file string, args ...string) error {
+	file = t.defaultCompileFilename(file)
+	return t.compileStep("bibtex", file, "bibtex", append(args, jobname(file))...)
+}
+
+// Biber runs biber on the .bcf file of a compiled file (defaulting to the
+// compile file), for documents using biblatex. Failures are returned as
+// *CompileError.
+func (t *CompileTask) Biber(file string, args ...string) error {
+	file = t.defaultCompileFilename(file)
+	return t.compileStep("biber", file, "biber", append(args, jobname(file))...)
+}
+
+// bibliographyTool returns the tool a compiled file needs for its
+// bibliography, "biber", "bibtex" or "" for none. biblatex writes a .bcf
+// file, BibTeX style bibliographies a \bibdata line to the .aux file.
+func (t *CompileTask) bibliographyTool(file string) string {
+	if _, err := os.Stat(t.auxFile(file, ".bcf")); err == nil {
+		return "biber"
+	}
+	aux, err := os.ReadFile(t.auxFile(file, ".aux"))
+	if err == nil && bytes.Contains(aux, []byte(`\bibdata`)) {
+		return "bibtex"
+	}
+	return ""
+}
+
+// AuxiliaryTools returns the tools a compiled file (defaulting to the
+// compile file) needs after an engine run, in the order Build runs them:
+// the bibliography tool ("biber" or "bibtex"), the index processor
+// ("makeindex" or "xindy", see SetIndexOptions), "makeglossaries" and
+// "pythontex". They are detected from the files written by the engine.
+func (t *CompileTask) AuxiliaryTools(file string) []string {
+	file = t.defaultCompileFilename(file)
+	tools := []string{}
+	if tool := t.bibliographyTool(file); tool != "" {
+		tools = append(tools, tool)
+	}
+	if tool := t.indexTool(file); tool != "" {
+		tools = append(tools, tool)
+	}
+	if len(t.glossaryFiles(file)) > 0 {
+		tools = append(tools, "makeglossaries")
+	}
+	if t.needsPythontex(file) {
+		tools = append(tools, "pythontex")
+	}
+	return tools
+}
+
+// runAuxiliaryTool runs a tool returned by AuxiliaryTools.
+func (t *CompileTask) runAuxiliaryTool(tool, file string) error {
+	switch tool {
+	case "biber":
+		return t.Biber(file)
+	case "bibtex":
+		return t.Bibtex(file)
+	case "makeindex":
+		return t.Makeindex(file, t.indexOptions)
+	case "xindy":
+		return t.Xindy(file, t.indexOptions)
+	case "makeglossaries":
+		return t.Makeglossaries(file)
+	case "pythontex":
+		return t.Pythontex(file)
+	}
+	return fmt.Errorf("unknown auxiliary tool %q", tool)
+}
+
+// Build compiles a file (defaulting to the compile file) completely using
+// the engine of the task: after a first run the tools the document needs
+// for its bibliography, index, glossaries and embedded code are run (see
+// AuxiliaryTools), then the engine is rerun until the cross-references are
+// right, see Run. If characters are missing in the fonts, the engine is
+// rerun with fallback fonts, see SetFallbackFonts. Engines doing all of this
+// on their own like Tectonic are run once. Finally the steps set
+// using SetSteps are run. With a budget set (see SetBudget), reruns and
+// optional steps exceeding it are skipped and the result is Degraded. With a remote compiler set, the compiling is done
+// by the compile service instead, see SetRemoteCompiler.
+//
+// If an evidence directory is set, failures are returned as *EvidenceError.
+func (t *CompileTask) Build(file string, args ...string) (*CompileResult, error) {
+	file = t.defaultCompileFilename(file)
+	start := time.Now()
+	result, err := t.build(file, args...)
+	err = t.recordStats(start, result, err)
+	return result, t.withEvidence(file, err)
+}
+
+func (t *CompileTask) build(file string, args ...string) (*CompileResult, error) {
+	if t.remote != nil {
+		return t.buildRemote(file, args...)
+	}
+	clock := t.startBudget()
+	if isSinglePass(engineFor(t.Engine())) {
+		result, err := t.runBudgeted(t.Engine(), file, clock, args...)
+		if err != nil {
+			return result, err
+		}
+		return result, t.runSteps(file, clock, result)
+	}
+
+	start := time.Now()
+	err := t.Compile(file, args...)
+	clock.measure(start)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := t.AuxiliaryTools(file)
+	for _, tool := range tools {
+		err = t.runAuxiliaryTool(tool, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := t.runBudgeted(t.Engine(), file, clock, args...)
+	if result != nil {
+		result.Passes++
+		result.AuxiliaryTools = tools
+	}
+	if err != nil {
+		return result, err
+	}
+	result, err = t.buildWithFallback(file, result, clock, args...)
+	if err != nil {
+		return result, err
+	}
+	return result, t.runSteps(file, clock, result)
+}
@@ -0,0 +1,138 @@
+package latex
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Bookmark is an entry of the outline of a PDF.
+type Bookmark struct {
+	Title string
+	// Page is the page the bookmark points to, starting at 1 (0 if unknown).
+	Page int
+	// Level is the nesting depth, top level bookmarks have level 1.
+	Level    int
+	Children []Bookmark
+}
+
+type qpdfOutline struct {
+	Title            string        `json:"title"`
+	DestPagePosFrom1 int           `json:"destpageposfrom1"`
+	Kids             []qpdfOutline `json:"kids"`
+}
+
+// Bookmarks returns the outline of a PDF using qpdf. It defaults to the
+// output of the compiled file.
+func (t *CompileTask) Bookmarks(file string) ([]Bookmark, error) {
+	var doc struct {
+		Outlines []qpdfOutline `json:"outlines"`
+	}
+	err := t.runToolJSON(&doc, "qpdf", "--json", "--json-key=outlines", t.pdfPath(file))
+	if err != nil {
+		return nil, err
+	}
+	return convertOutlines(doc.Outlines, 1), nil
+}
+
+func convertOutlines(outlines []qpdfOutline, level int) []Bookmark {
+	bookmarks := make([]Bookmark, 0, len(outlines))
+	for _, o := range outlines {
+		bookmarks = append(bookmarks, Bookmark{
+			Title:    o.Title,
+			Page:     o.DestPagePosFrom1,
+			Level:    level,
+			Children: convertOutlines(o.Kids, level+1),
+		})
+	}
+	return bookmarks
+}
+
+// flattenBookmarks returns all bookmarks up to a given level in document order.
+func flattenBookmarks(bookmarks []Bookmark, maxLevel int) []Bookmark {
+	flat := []Bookmark{}
+	for _, b := range bookmarks {
+		if b.Level > maxLevel {
+			continue
+		}
+		flat = append(flat, b)
+		flat = append(flat, flattenBookmarks(b.Children, maxLevel)...)
+	}
+	return flat
+}
+
+// SplitByBookmarks splits a PDF into one file per bookmark of the given level
+// (1 for top level bookmarks like chapters), e.g. for distributing single
+// chapters of a handbook. Each part ranges up to the page before the next
+// bookmark of the same or a higher level, pages in front of the first
+// bookmark are not part of any output. The files are stored in the
+// "chapters" subdirectory of the compilation directory, their paths are
+// returned in document order.
+func (t *CompileTask) SplitByBookmarks(file string, level int) ([]string, error) {
+	file = t.pdfPath(file)
+	bookmarks, err := t.Bookmarks(file)
+	if err != nil {
+		return nil, err
+	}
+	pageCount, err := t.PageCount(file)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []Bookmark{}
+	for _, b := range flattenBookmarks(bookmarks, level) {
+		if b.Page > 0 {
+			parts = append(parts, b)
+		}
+	}
+
+	outputDir := filepath.Join(t.CompileDirInternal(), "chapters")
+	err = t.context().EnsureDirExists(outputDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = t.grantAccess(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	files := []string{}
+	for i, part := range parts {
+		if part.Level != level {
+			// higher level bookmarks only terminate the previous part
+			continue
+		}
+		last := pageCount
+		if i+1 < len(parts) {
+			last = parts[i+1].Page - 1
+		}
+		if last < part.Page {
+			last = part.Page
+		}
+		output := filepath.Join(outputDir, fmt.Sprintf("%s-%02d-%s.pdf", base, len(files)+1, slug(part.Title)))
+		_, err = t.runTool("qpdf", "--empty", "--pages", file, fmt.Sprintf("%d-%d", part.Page, last), "--", output)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, output)
+	}
+	return files, nil
+}
+
+// slug converts a title into a string suitable as part of a filename.
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,205 @@
+package latex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// BuildCache stores compiled documents keyed by a hash of their sources and
+// template data, see BuildCacheKey. Implementations may be shared by many
+// machines.
+type BuildCache interface {
+	// Fetch writes the artifact stored for key to file. It reports false on
+	// cache misses.
+	Fetch(key, file string) (bool, error)
+	// Store saves file as the artifact for key.
+	Store(key, file string) error
+}
+
+// BuildCacheKey derives a cache key from the names and contents of all files
+// below sourceDir, the name of the file to be compiled and the template data
+// (encoded as JSON).
+func BuildCacheKey(sourceDir, compileFilename string, data interface{}) (string, error) {
+	h := sha256.New()
+	err := hashTree(h, sourceDir)
+	if err != nil {
+		return "", err
+	}
+	io.WriteString(h, "\x00"+compileFilename+"\x00")
+	err = json.NewEncoder(h).Encode(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashTree writes the names and contents of all files below dir to w.
+func hashTree(w io.Writer, dir string) error {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		io.WriteString(w, filepath.ToSlash(rel)+"\x00")
+		err = hashFile(w, file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashFile(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// CachedBuild runs build unless cache holds a PDF for the current sources and
+// data already, in which case the PDF is placed in the compilation directory
+// right where build would have created it. Fresh builds are stored in the
+// cache. It reports whether the cache was hit. Failures to fetch, e.g. of a
+// cache on the network, count as misses and are recorded in the timeline.
+func (t *CompileTask) CachedBuild(cache BuildCache, data interface{}, build func(*CompileTask) error) (bool, error) {
+	key, err := BuildCacheKey(t.SourceDir(), t.CompileFilename(), data)
+	if err != nil {
+		return false, err
+	}
+	pdf := filepath.Join(t.CompileDirInternal(), t.CompileFilenamePdf())
+
+	err = os.MkdirAll(filepath.Dir(pdf), 0700)
+	if err != nil {
+		return false, err
+	}
+	if t.fetchCached(cache, key, pdf) {
+		return true, nil
+	}
+
+	err = build(t)
+	if err != nil {
+		return false, err
+	}
+	return false, cache.Store(key, pdf)
+}
+
+// fetchCached fetches the artifact for key from cache to file, reporting
+// whether it was found. The artifact is fetched to a temporary file first,
+// so failed fetches leave no partial file behind. Errors count as misses,
+// they are recorded in the timeline and written to stderr unless the task
+// is quiet.
+func (t *CompileTask) fetchCached(cache BuildCache, key, file string) bool {
+	start := time.Now()
+	temp, err := os.CreateTemp(filepath.Dir(file), ".go-latex-fetch-*")
+	hit := false
+	if err == nil {
+		temp.Close()
+		defer os.Remove(temp.Name())
+		hit, err = cache.Fetch(key, temp.Name())
+	}
+	if err == nil && hit {
+		// temporary files are private
+		err = os.Chmod(temp.Name(), 0644)
+		if err == nil {
+			err = os.Rename(temp.Name(), file)
+		}
+	}
+	if err == nil {
+		return hit
+	}
+	t.recordEvent(TimelineEvent{
+		Name:     "cache fetch",
+		Category: "cache",
+		Args:     []string{key},
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	if t.verbosity != VerbosityNone {
+		fmt.Fprintf(os.Stderr, "build cache: fetching %s failed, building: %v\n", key, err)
+	}
+	return false
+}
+
+// DirCache is a BuildCache storing artifacts in a directory, which may be
+// located on a network file system shared by several machines.
+type DirCache struct {
+	dir string
+}
+
+// NewDirCache returns a DirCache using dir, which is created if necessary.
+func NewDirCache(dir string) (*DirCache, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &DirCache{dir: dir}, nil
+}
+
+// Fetch implements BuildCache.
+func (c *DirCache) Fetch(key, file string) (bool, error) {
+	err := copyFile(filepath.Join(c.dir, key), file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Store implements BuildCache.
+func (c *DirCache) Store(key, file string) error {
+	// copy and rename so concurrent readers never see partial files
+	temp, err := os.CreateTemp(c.dir, "."+key+"-*")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+	err = copyFile(file, temp.Name())
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(c.dir, key))
+}
+
+// copyFile copies a regular file, replacing the destination if it exists.
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
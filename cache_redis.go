@@ -0,0 +1,180 @@
+package latex
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisCache is a BuildCache storing artifacts in Redis.
+type RedisCache struct {
+	// Addr is the host:port of the Redis server.
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is prepended to all keys.
+	Prefix string
+	// TTL sets the expiry of stored artifacts, zero means no expiry.
+	TTL     time.Duration
+	Timeout time.Duration
+}
+
+// NewRedisCache returns a RedisCache for the server at addr.
+func NewRedisCache(addr string) *RedisCache {
+	return &RedisCache{
+		Addr:    addr,
+		Prefix:  "go-latex:",
+		Timeout: 30 * time.Second,
+	}
+}
+
+// Fetch implements BuildCache.
+func (c *RedisCache) Fetch(key, file string) (bool, error) {
+	conn, r, err := c.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	err = redisWriteCommand(conn, "GET", c.Prefix+key)
+	if err != nil {
+		return false, err
+	}
+	line, err := redisReadLine(r)
+	if err != nil {
+		return false, err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return false, fmt.Errorf("unexpected redis reply %q", line)
+	}
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return false, err
+	}
+	if size < 0 {
+		return false, nil
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.CopyN(f, r, size)
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// Store implements BuildCache.
+func (c *RedisCache) Store(key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	conn, r, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := []string{"SET", c.Prefix + key}
+	extra := []string{}
+	if c.TTL > 0 {
+		extra = append(extra, "PX", strconv.FormatInt(c.TTL.Milliseconds(), 10))
+	}
+	// the value is streamed from the file instead of being passed as string
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args)+1+len(extra))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	fmt.Fprintf(w, "$%d\r\n", fi.Size())
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, "\r\n")
+	for _, arg := range extra {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	return redisExpectOK(r)
+}
+
+func (c *RedisCache) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	r := bufio.NewReader(conn)
+	if c.Password != "" {
+		err = redisWriteCommand(conn, "AUTH", c.Password)
+		if err == nil {
+			err = redisExpectOK(r)
+		}
+	}
+	if err == nil && c.DB != 0 {
+		err = redisWriteCommand(conn, "SELECT", strconv.Itoa(c.DB))
+		if err == nil {
+			err = redisExpectOK(r)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, r, nil
+}
+
+func redisWriteCommand(w io.Writer, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func redisReadLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "-") {
+		return "", errors.New("redis: " + line[1:])
+	}
+	return line, nil
+}
+
+func redisExpectOK(r *bufio.Reader) error {
+	line, err := redisReadLine(r)
+	if err != nil {
+		return err
+	}
+	if line != "+OK" {
+		return fmt.Errorf("unexpected redis reply %q", line)
+	}
+	return nil
+}
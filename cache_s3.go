@@ -0,0 +1,166 @@
+package latex
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Cache is a BuildCache storing artifacts in an S3 compatible object
+// storage, addressing buckets path-style.
+type S3Cache struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-central-1.amazonaws.com
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Prefix is prepended to all object keys.
+	Prefix string
+	Client *http.Client
+}
+
+// NewS3Cache returns an S3Cache for a bucket.
+func NewS3Cache(endpoint, region, bucket, accessKey, secretKey string) *S3Cache {
+	return &S3Cache{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Prefix:    "go-latex/",
+		Client:    http.DefaultClient,
+	}
+}
+
+// Fetch implements BuildCache.
+func (c *S3Cache) Fetch(key, file string) (bool, error) {
+	req, err := c.request(http.MethodGet, key, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("s3 GET %s: %s", key, resp.Status)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// Store implements BuildCache.
+func (c *S3Cache) Store(key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := c.request(http.MethodPut, key, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	req.Header.Set("Content-Type", "application/pdf")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 PUT %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// request creates a request signed with AWS signature version 4. The payload
+// is not part of the signature so it can be streamed.
+func (c *S3Cache) request(method, key string, body io.Reader) (*http.Request, error) {
+	path := "/" + s3URIEncode(c.Bucket, false) + "/" + s3URIEncode(c.Prefix+key, true)
+	req, err := http.NewRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + c.SessionToken + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method, path, "", canonicalHeaders, signedHeaders, "UNSIGNED-PAYLOAD",
+	}, "\n")
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, c.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+// s3URIEncode encodes a path as required for signing, keeping slashes if
+// requested.
+func s3URIEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	latex "github.com/jojomi/go-latex"
+	"github.com/jojomi/go-latex/daemon"
+)
+
+var buildCommand = &command{
+	name:    "build",
+	summary: "compile a document including its bibliography",
+	flags: func(fs *flag.FlagSet) func(args []string) (*report, error) {
+		src := fs.String("src", ".", "source `directory` of the document")
+		file := fs.String("file", "main.tex", "TeX `file` to compile, relative to the source directory")
+		engine := fs.String("engine", "pdflatex", "TeX `engine`: "+strings.Join(latex.Engines(), ", "))
+		profile := fs.String("profile", "", "argument `profile` of the engine: "+strings.Join(latex.ArgProfiles(), ", "))
+		out := fs.String("out", "", "output `file` or directory, the current directory by default")
+		timeout := fs.Duration("timeout", 0, "abort if compiling takes longer than `duration`")
+		maxWarnings := fs.Int("max-warnings", -1, "fail the quality gate if there are more than `n` warnings")
+		keep := fs.Bool("keep", false, "keep the compile directory")
+		clean := fs.Bool("clean", false, "remove auxiliary files like .aux and .log from the kept compile directory")
+		data := fs.String("data", "", "render the TeX file as template with the data in the JSON or YAML `file` before compiling")
+		escape := fs.Bool("escape", false, "escape the values inserted by the template, see -data")
+		optimize := fs.String("optimize", "", "optimize the PDF for a `channel`: "+strings.Join(latex.OptimizeChannels, ", "))
+		installPackages := fs.Bool("install-packages", false, "install missing packages using tlmgr and retry")
+		strict := fs.String("warnings-as-errors", "", "comma separated warning `categories` failing the quality gate: "+strings.Join(warningCategories(), ", "))
+		image := fs.String("image", "", "run the TeX tools in the container `image`, e.g. texlive/texlive")
+		evidence := fs.String("evidence", "", "write an evidence bundle to `directory` if the build fails")
+		daemonSocket := fs.String("daemon", "", "run the engine passes in the daemon listening on `socket`")
+		remote := fs.String("remote", "", "compile on the compile service at `url` instead of locally")
+		steps := fs.String("steps", "", "comma separated `steps` to run after compiling: "+strings.Join(latex.Steps(), ", "))
+		return func(args []string) (*report, error) {
+			if len(args) > 0 {
+				return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return build(buildOptions{
+				src:         *src,
+				file:        *file,
+				engine:      *engine,
+				profile:     *profile,
+				out:         *out,
+				timeout:     *timeout,
+				maxWarnings: *maxWarnings,
+				keep:        *keep,
+				clean:       *clean,
+				data:        *data,
+				escape:      *escape,
+				optimize:    *optimize,
+				steps:       *steps,
+				install:     *installPackages,
+				daemon:      *daemonSocket,
+				evidence:    *evidence,
+				image:       *image,
+				remote:      *remote,
+				strict:      *strict,
+			})
+		}
+	},
+}
+
+type buildOptions struct {
+	src, file, engine, out string
+	steps, daemon          string
+	evidence, image        string
+	remote, data, optimize string
+	strict, profile        string
+	timeout                time.Duration
+	maxWarnings            int
+	keep, clean, install   bool
+	escape                 bool
+}
+
+func build(o buildOptions) (*report, error) {
+	stop := latex.HandleInterrupts()
+	defer stop()
+
+	task, err := latex.NewValidCompileTask(
+		latex.WithSourceDir(o.src),
+		latex.WithCompileFilename(o.file),
+		latex.WithEngine(o.engine),
+		latex.WithVerbosity(latex.VerbosityNone),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if o.optimize != "" && !slices.Contains(latex.OptimizeChannels, o.optimize) {
+		return nil, fmt.Errorf("unknown optimization channel %q", o.optimize)
+	}
+	err = task.SetArgProfile(o.profile)
+	if err != nil {
+		return nil, err
+	}
+	task.SetAutoInstallPackages(o.install)
+	task.SetAutoEscape(o.escape)
+	task.SetEvidenceDir(o.evidence)
+	if o.strict != "" {
+		categories := []latex.WarningCategory{}
+		for _, name := range strings.Split(o.strict, ",") {
+			category := latex.WarningCategory(strings.TrimSpace(name))
+			if !slices.Contains(latex.WarningCategories(), category) {
+				return nil, fmt.Errorf("unknown warning category %q", category)
+			}
+			categories = append(categories, category)
+		}
+		task.SetWarningsAsErrors(categories...)
+	}
+	if o.image != "" {
+		task.SetToolchain(&latex.Toolchain{Image: o.image})
+	}
+	if o.daemon != "" {
+		task.SetEngineRunner(daemon.NewClient(o.daemon))
+	}
+	if o.remote != "" {
+		task.SetRemoteCompiler(latex.NewRemoteCompiler(o.remote))
+	}
+	if o.steps != "" {
+		err = task.SetSteps(strings.Split(o.steps, ",")...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+		defer cancel()
+		task.SetContext(ctx)
+	}
+
+	err = task.ExtractToCompileDir("")
+	if !o.keep {
+		defer task.ClearCompileDir()
+	} else if o.clean {
+		defer task.ClearLatexTempFiles(task.CompileDirInternal())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.data != "" {
+		data, err := latex.LoadTemplateData(o.data)
+		if err != nil {
+			return nil, err
+		}
+		templ, file := task.Template("")
+		templ, err = templ.ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		err = task.ExecuteTemplate(templ, data, "", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := &report{}
+	result, err := task.Build("")
+	if result != nil {
+		r.Passes = result.Passes
+		r.Duration = result.Duration.String()
+		r.Errors = result.Errors
+		r.Warnings = result.Warnings
+	}
+	var compileErr *latex.CompileError
+	if errors.As(err, &compileErr) {
+		r.Output = compileErr.Output
+	}
+	var evidenceErr *latex.EvidenceError
+	if errors.As(err, &evidenceErr) {
+		r.Evidence = evidenceErr.Bundle
+	}
+	if err != nil {
+		return r, err
+	}
+
+	if o.maxWarnings >= 0 && len(r.Warnings) > o.maxWarnings {
+		return r, fmt.Errorf("%w: %d warnings, at most %d allowed", errQualityGate, len(r.Warnings), o.maxWarnings)
+	}
+
+	if o.optimize != "" {
+		err = task.Optimize("", o.optimize)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	out := o.out
+	if out == "" {
+		out = "." + string(filepath.Separator)
+	}
+	return r, task.MoveToDest("", out)
+}
+
+// warningCategories returns the names of the warning categories.
+func warningCategories() []string {
+	names := []string{}
+	for _, category := range latex.WarningCategories() {
+		names = append(names, string(category))
+	}
+	return names
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// command is a subcommand of golatex.
+type command struct {
+	name    string
+	summary string
+	// args describes the positional arguments for the usage line.
+	args string
+	// flags defines the flags of the command and returns the function
+	// running it with the remaining arguments.
+	flags func(fs *flag.FlagSet) func(args []string) (*report, error)
+}
+
+// commands lists all subcommands.
+var commands []*command
+
+func init() {
+	// set up here, as some commands are generated from the list
+	commands = []*command{
+		buildCommand,
+		completionCommand,
+		daemonCommand,
+		manCommand,
+		previewCommand,
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of the command along with the function running
+// it.
+func (c *command) flagSet() (*flag.FlagSet, func(args []string) (*report, error), *bool) {
+	fs := flag.NewFlagSet("golatex "+c.name, flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "write a JSON report to stdout")
+	runFunc := c.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: golatex %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs, runFunc, jsonOutput
+}
+
+// execute parses args, runs the command and reports the outcome. It
+// returns the exit code.
+func (c *command) execute(args []string) int {
+	fs, runFunc, jsonOutput := c.flagSet()
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		// the flag package printed the error and the usage, parsing stops
+		// at the invalid flag so -json may follow it
+		if *jsonOutput || jsonRequested(args) {
+			return c.finish(&report{}, err, true)
+		}
+		return exitError
+	}
+
+	r, err := runFunc(fs.Args())
+	if r == nil {
+		r = &report{}
+	}
+	return c.finish(r, err, *jsonOutput)
+}
+
+// finish reports the outcome of the command and returns the exit code.
+func (c *command) finish(r *report, err error, jsonOutput bool) int {
+	r.Command = c.name
+	r.setOutcome(err)
+	if jsonOutput {
+		r.write(os.Stdout)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "golatex %s: %v\n", c.name, err)
+	}
+	return r.ExitCode
+}
+
+// jsonRequested reports whether args contain the -json flag, for arguments
+// which could not be parsed.
+func jsonRequested(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-json", "--json", "-json=true", "--json=true":
+			return true
+		}
+	}
+	return false
+}
+
+// flagList returns the flags of the command, sorted by name.
+func (c *command) flagList() []*flag.Flag {
+	fs, _, _ := c.flagSet()
+	flags := []*flag.Flag{}
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+// isBoolFlag reports whether a flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: golatex <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "golatex <command> -h" for the flags of a command.`)
+}
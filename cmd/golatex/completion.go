@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var completionCommand = &command{
+	name:    "completion",
+	summary: "print a shell completion script for bash, zsh or fish",
+	args:    "bash|zsh|fish",
+	flags: func(fs *flag.FlagSet) func(args []string) (*report, error) {
+		return func(args []string) (*report, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("expected one shell: bash, zsh or fish")
+			}
+			switch args[0] {
+			case "bash":
+				writeBashCompletion(os.Stdout)
+			case "zsh":
+				writeZshCompletion(os.Stdout)
+			case "fish":
+				writeFishCompletion(os.Stdout)
+			default:
+				return nil, fmt.Errorf("unsupported shell %q", args[0])
+			}
+			return nil, nil
+		}
+	},
+}
+
+// flagValueKind returns "directory", "file" or "" depending on what a flag
+// takes, as given by the placeholder in its usage.
+func flagValueKind(f *flag.Flag) string {
+	name, _ := flag.UnquoteUsage(f)
+	switch name {
+	case "directory", "file":
+		return name
+	}
+	return ""
+}
+
+func commandNames() []string {
+	names := []string{}
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return append(names, "help")
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for golatex")
+	fmt.Fprintln(w, "_golatex() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	if [ "$COMP_CWORD" -eq 1 ]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "${COMP_WORDS[1]}" in`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%s)\n", cmd.name)
+		fmt.Fprintln(w, `		case "$prev" in`)
+		names := []string{}
+		for _, f := range cmd.flagList() {
+			names = append(names, "-"+f.Name)
+			switch flagValueKind(f) {
+			case "directory":
+				fmt.Fprintf(w, "\t\t-%s) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n", f.Name)
+			case "file":
+				fmt.Fprintf(w, "\t\t-%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", f.Name)
+			}
+		}
+		fmt.Fprintln(w, "\t\tesac")
+		if cmd.name == "completion" {
+			names = append(names, "bash", "zsh", "fish")
+		}
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _golatex golatex")
+}
+
+// zshQuote escapes a description for _arguments and _describe specs in
+// single quotes.
+var zshQuote = strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`)
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef golatex")
+	fmt.Fprintln(w, "_golatex() {")
+	fmt.Fprintln(w, "\tlocal -a commands")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", cmd.name, zshQuote.Replace(cmd.summary))
+	}
+	fmt.Fprintln(w, "\t\t'help:show the list of commands'")
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tif (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "\t\t_describe 'command' commands")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase $words[2] in")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%s)\n", cmd.name)
+		fmt.Fprintln(w, "\t\t_arguments \\")
+		for _, f := range cmd.flagList() {
+			name, usage := flag.UnquoteUsage(f)
+			spec := fmt.Sprintf("-%s[%s]", f.Name, zshQuote.Replace(usage))
+			switch {
+			case isBoolFlag(f):
+			case flagValueKind(f) == "directory":
+				spec += ":directory:_files -/"
+			case flagValueKind(f) == "file":
+				spec += ":file:_files"
+			default:
+				spec += ":" + name + ":"
+			}
+			fmt.Fprintf(w, "\t\t\t'%s' \\\n", spec)
+		}
+		if cmd.name == "completion" {
+			fmt.Fprintln(w, "\t\t\t'1:shell:(bash zsh fish)'")
+		} else {
+			fmt.Fprintln(w, "\t\t\t'*:file:_files'")
+		}
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, `_golatex "$@"`)
+}
+
+// fishQuote escapes a string for single quotes in fish.
+var fishQuote = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for golatex")
+	fmt.Fprintln(w, "complete -c golatex -f")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c golatex -n __fish_use_subcommand -a %s -d '%s'\n", cmd.name, fishQuote.Replace(cmd.summary))
+	}
+	fmt.Fprintln(w, "complete -c golatex -n __fish_use_subcommand -a help -d 'show the list of commands'")
+	for _, cmd := range commands {
+		condition := "'__fish_seen_subcommand_from " + cmd.name + "'"
+		for _, f := range cmd.flagList() {
+			_, usage := flag.UnquoteUsage(f)
+			line := fmt.Sprintf("complete -c golatex -n %s -o %s -d '%s'", condition, f.Name, fishQuote.Replace(usage))
+			switch {
+			case isBoolFlag(f):
+			case flagValueKind(f) == "directory":
+				line += " -r -a '(__fish_complete_directories)'"
+			case flagValueKind(f) == "file":
+				line += " -r -F"
+			default:
+				line += " -r"
+			}
+			fmt.Fprintln(w, line)
+		}
+		if cmd.name == "completion" {
+			fmt.Fprintf(w, "complete -c golatex -n %s -a 'bash zsh fish'\n", condition)
+		}
+	}
+}
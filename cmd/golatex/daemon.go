@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	latex "github.com/jojomi/go-latex"
+	"github.com/jojomi/go-latex/daemon"
+)
+
+var daemonCommand = &command{
+	name:    "daemon",
+	summary: "serve pre-warmed TeX engines on a local socket, see build -daemon",
+	flags: func(fs *flag.FlagSet) func(args []string) (*report, error) {
+		socket := fs.String("socket", "golatex.sock", "unix `socket` to listen on")
+		engines := fs.String("engines", "pdflatex", "comma separated TeX `engines` to keep warm")
+		workers := fs.Int("workers", 2, "`number` of warm processes per engine")
+		dir := fs.String("dir", "", "working `directory` of the engines, a temporary one by default")
+		return func(args []string) (*report, error) {
+			if len(args) > 0 {
+				return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return nil, serveDaemon(*socket, strings.Split(*engines, ","), *workers, *dir)
+		}
+	},
+}
+
+func serveDaemon(socket string, engines []string, workers int, dir string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pools := []*latex.EnginePool{}
+	defer func() {
+		for _, pool := range pools {
+			pool.Close()
+		}
+	}()
+	for _, engine := range engines {
+		poolDir := dir
+		if poolDir != "" {
+			poolDir = filepath.Join(poolDir, engine)
+		}
+		pool, err := latex.NewEnginePool(engine, workers, poolDir)
+		if err != nil {
+			return err
+		}
+		pools = append(pools, pool)
+	}
+
+	l, err := daemon.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+	server := daemon.New(pools...)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	return server.Serve(l)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	latex "github.com/jojomi/go-latex"
+)
+
+// Exit codes, see the package documentation.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitCompile     = 2
+	exitMissingTool = 3
+	exitQualityGate = 4
+	exitTimeout     = 5
+)
+
+// errQualityGate is returned if a document compiled but failed a check.
+var errQualityGate = errors.New("quality gate failed")
+
+// report is the outcome of a command as written in JSON mode.
+type report struct {
+	Command string `json:"command"`
+	// Status is "ok", "error", "compile_error", "missing_tool",
+	// "quality_gate_failed" or "timeout".
+	Status   string             `json:"status"`
+	ExitCode int                `json:"exitCode"`
+	Message  string             `json:"message,omitempty"`
+	Output   string             `json:"output,omitempty"`
+	Evidence string             `json:"evidence,omitempty"`
+	Passes   int                `json:"passes,omitempty"`
+	Duration string             `json:"duration,omitempty"`
+	Errors   []latex.Diagnostic `json:"errors,omitempty"`
+	Warnings []latex.Diagnostic `json:"warnings,omitempty"`
+}
+
+// setOutcome sets status and exit code for the error a command returned.
+func (r *report) setOutcome(err error) {
+	r.Status, r.ExitCode = classify(err)
+	if err != nil {
+		r.Message = err.Error()
+	}
+}
+
+func (r *report) write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// classify maps an error to its status and exit code.
+func classify(err error) (string, int) {
+	var (
+		compileErr     *latex.CompileError
+		missingToolErr *latex.MissingToolError
+		escalatedErr   *latex.EscalatedWarningsError
+	)
+	switch {
+	case err == nil:
+		return "ok", exitOK
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", exitTimeout
+	case errors.As(err, &missingToolErr):
+		return "missing_tool", exitMissingTool
+	case errors.Is(err, errQualityGate), errors.As(err, &escalatedErr):
+		return "quality_gate_failed", exitQualityGate
+	case errors.As(err, &compileErr):
+		return "compile_error", exitCompile
+	default:
+		return "error", exitError
+	}
+}
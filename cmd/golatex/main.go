@@ -0,0 +1,49 @@
+// Command golatex compiles LaTeX documents using go-latex.
+//
+// Usage:
+//
+//	golatex <command> [flags]
+//
+// Run "golatex help" for the list of commands.
+//
+// Exit codes are stable, so scripts can branch on the kind of failure:
+//
+//	0  success
+//	1  usage or other error
+//	2  compile error
+//	3  missing tool
+//	4  quality gate failed
+//	5  timeout
+//
+// With -json a report of the run is written to stdout instead of messages
+// to stderr, also on failure.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command given by args and returns the exit code.
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitError
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "golatex: unknown command %q\n", name)
+		usage(os.Stderr)
+		return exitError
+	}
+	return cmd.execute(args[1:])
+}
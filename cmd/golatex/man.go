@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var manCommand = &command{
+	name:    "man",
+	summary: "write man pages for golatex and its commands",
+	flags: func(fs *flag.FlagSet) func(args []string) (*report, error) {
+		dir := fs.String("dir", ".", "`directory` to write the pages to")
+		return func(args []string) (*report, error) {
+			if len(args) > 0 {
+				return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return nil, writeManPages(*dir)
+		}
+	},
+}
+
+// exitCodes documents the exit codes in the man pages.
+var exitCodes = []struct {
+	code        int
+	description string
+}{
+	{exitOK, "success"},
+	{exitError, "usage or other error"},
+	{exitCompile, "compile error"},
+	{exitMissingTool, "missing tool"},
+	{exitQualityGate, "quality gate failed"},
+	{exitTimeout, "timeout"},
+}
+
+// writeManPages writes golatex.1 and golatex-<command>.1 for all commands
+// to dir.
+func writeManPages(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	err = writeManFile(filepath.Join(dir, "golatex.1"), writeMainManPage)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range commands {
+		cmd := cmd
+		err = writeManFile(filepath.Join(dir, "golatex-"+cmd.name+".1"), func(w io.Writer) {
+			writeCommandManPage(w, cmd)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeManFile(file string, write func(w io.Writer)) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	write(f)
+	return f.Close()
+}
+
+// roff escapes text for roff.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeMainManPage(w io.Writer) {
+	fmt.Fprintln(w, `.TH GOLATEX 1 "" "golatex" "User Commands"`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `golatex \- compile LaTeX documents`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B golatex
+.I command
+[\fIflags\fR]`)
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, cmd := range commands {
+		fmt.Fprintln(w, ".TP")
+		fmt.Fprintf(w, ".B %s\n", roff(cmd.name))
+		fmt.Fprintf(w, "%s, see \\fBgolatex\\-%s\\fR(1).\n", roff(capitalize(cmd.summary)), roff(cmd.name))
+	}
+	writeManExitStatus(w)
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	names := []string{}
+	for _, cmd := range commands {
+		names = append(names, fmt.Sprintf(`\fBgolatex\-%s\fR(1)`, roff(cmd.name)))
+	}
+	fmt.Fprintln(w, strings.Join(names, ",\n"))
+}
+
+func writeCommandManPage(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, ".TH GOLATEX\\-%s 1 \"\" \"golatex\" \"User Commands\"\n", roff(strings.ToUpper(cmd.name)))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintf(w, "golatex\\-%s \\- %s\n", roff(cmd.name), roff(cmd.summary))
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintf(w, ".B golatex %s\n[\\fIflags\\fR]", roff(cmd.name))
+	if cmd.args != "" {
+		fmt.Fprintf(w, " %s", roff(cmd.args))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, ".SH OPTIONS")
+	for _, f := range cmd.flagList() {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintln(w, ".TP")
+		if name != "" {
+			fmt.Fprintf(w, "\\fB\\-%s\\fR \\fI%s\\fR\n", roff(f.Name), roff(name))
+		} else {
+			fmt.Fprintf(w, "\\fB\\-%s\\fR\n", roff(f.Name))
+		}
+		text := capitalize(usage)
+		if f.DefValue != "" && f.DefValue != "false" {
+			text += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w, roff(text)+".")
+	}
+	writeManExitStatus(w)
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	fmt.Fprintln(w, `\fBgolatex\fR(1)`)
+}
+
+func writeManExitStatus(w io.Writer) {
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	for _, exit := range exitCodes {
+		fmt.Fprintln(w, ".TP")
+		fmt.Fprintf(w, ".B %d\n", exit.code)
+		fmt.Fprintln(w, roff(capitalize(exit.description))+".")
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	latex "github.com/jojomi/go-latex"
+)
+
+var previewCommand = &command{
+	name:    "preview",
+	summary: "render a template with generated sample data and compile it",
+	flags: func(fs *flag.FlagSet) func(args []string) (*report, error) {
+		src := fs.String("src", ".", "source `directory` of the template")
+		file := fs.String("file", "main.tex", "template `file`, relative to the source directory")
+		engine := fs.String("engine", "pdflatex", "TeX `engine`: "+strings.Join(latex.Engines(), ", "))
+		schema := fs.String("schema", "", "generate the data from the JSON Schema in `file` instead of the placeholders")
+		out := fs.String("out", "", "output `file` or directory, the current directory by default")
+		data := fs.String("data", "", "also write the sample data as JSON to `file`")
+		return func(args []string) (*report, error) {
+			if len(args) > 0 {
+				return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return preview(*src, *file, *engine, *schema, *out, *data)
+		}
+	},
+}
+
+func preview(src, file, engine, schemaFile, out, dataFile string) (*report, error) {
+	stop := latex.HandleInterrupts()
+	defer stop()
+
+	task, err := latex.NewValidCompileTask(
+		latex.WithSourceDir(src),
+		latex.WithCompileFilename(file),
+		latex.WithEngine(engine),
+		latex.WithVerbosity(latex.VerbosityNone),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if schemaFile != "" {
+		schema, err := latex.LoadSchema(schemaFile)
+		if err != nil {
+			return nil, err
+		}
+		task.SetTemplateSchema(schema)
+	}
+	if dataFile != "" {
+		data, err := task.SampleData()
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(dataFile, append(encoded, '\n'), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	task.CopyToCompileDir("")
+	defer task.ClearCompileDir()
+	r := &report{}
+	result, err := task.Preview()
+	if result != nil {
+		r.Passes = result.Passes
+		r.Duration = result.Duration.String()
+		r.Errors = result.Errors
+		r.Warnings = result.Warnings
+	}
+	if err != nil {
+		return r, err
+	}
+	if out == "" {
+		out = "." + string(filepath.Separator)
+	}
+	return r, task.MoveToDest("", out)
+}
@@ -0,0 +1,181 @@
+package latex
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiffReport describes the differences between two PDF files.
+type DiffReport struct {
+	PagesA int
+	PagesB int
+	Pages  []PageDiff
+	// TextDiff is a unified diff of the text of both documents.
+	TextDiff string
+}
+
+// PageDiff describes the differences of a single page. Similarities range
+// from 0 (completely different or missing) to 1 (identical).
+type PageDiff struct {
+	Page            int
+	TextSimilarity  float64
+	PixelSimilarity float64
+}
+
+// Identical reports if both documents look the same.
+func (r DiffReport) Identical() bool {
+	return len(r.ChangedPages(1)) == 0 && r.PagesA == r.PagesB
+}
+
+// ChangedPages returns the numbers of all pages with a text or pixel
+// similarity below threshold.
+func (r DiffReport) ChangedPages(threshold float64) []int {
+	pages := []int{}
+	for _, p := range r.Pages {
+		if p.TextSimilarity < threshold || p.PixelSimilarity < threshold {
+			pages = append(pages, p.Page)
+		}
+	}
+	return pages
+}
+
+// comparisonResolution is the resolution in DPI pages are rasterized with for
+// comparison.
+const comparisonResolution = 50
+
+// ComparePdfs compares two PDF files page by page, both by their text
+// (extracted using pdftotext) and by their rasterized pages (rendered using
+// Ghostscript), e.g. to find out if a template change altered existing
+// documents.
+func ComparePdfs(a, b string) (DiffReport, error) {
+	report := DiffReport{}
+	// the tools run in the temporary directory
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return report, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return report, err
+	}
+	tempDir, err := os.MkdirTemp("", "go-latex-compare-")
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(tempDir)
+	t := NewCompileTask()
+	t.SetSourceDir(tempDir)
+
+	textA, err := t.pdfText(absA)
+	if err != nil {
+		return report, err
+	}
+	textB, err := t.pdfText(absB)
+	if err != nil {
+		return report, err
+	}
+	report.TextDiff = unifiedDiff(a, b, strings.Join(textA, "\n"), strings.Join(textB, "\n"), 3)
+
+	imagesA, err := t.rasterize(absA, filepath.Join(tempDir, "a"), comparisonResolution)
+	if err != nil {
+		return report, err
+	}
+	imagesB, err := t.rasterize(absB, filepath.Join(tempDir, "b"), comparisonResolution)
+	if err != nil {
+		return report, err
+	}
+	report.PagesA = len(imagesA)
+	report.PagesB = len(imagesB)
+
+	for page := 1; page <= max(report.PagesA, report.PagesB); page++ {
+		diff := PageDiff{Page: page}
+		if page <= report.PagesA && page <= report.PagesB {
+			diff.TextSimilarity = lineSimilarity(pageLines(textA, page), pageLines(textB, page))
+			diff.PixelSimilarity, err = imageSimilarity(imagesA[page-1], imagesB[page-1])
+			if err != nil {
+				return report, err
+			}
+		}
+		report.Pages = append(report.Pages, diff)
+	}
+	return report, nil
+}
+
+// pdfText extracts the text of all pages of a PDF using pdftotext.
+func (t *CompileTask) pdfText(file string) ([]string, error) {
+	result, err := t.runTool("pdftotext", "-layout", "-enc", "UTF-8", file, "-")
+	if err != nil {
+		return nil, err
+	}
+	// pages are separated by form feeds
+	pages := strings.Split(result.Output(), "\f")
+	if len(pages) > 0 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
+	}
+	return pages, nil
+}
+
+func pageLines(pages []string, page int) []string {
+	if page > len(pages) {
+		return []string{}
+	}
+	return splitLines(pages[page-1])
+}
+
+// rasterize renders all pages of a PDF into grayscale PNG files, returning
+// their paths.
+func (t *CompileTask) rasterize(file, prefix string, resolution int) ([]string, error) {
+	_, err := t.runTool("gs", "-q", "-dNOPAUSE", "-dBATCH", "-dSAFER",
+		"-sDEVICE=pnggray", fmt.Sprintf("-r%d", resolution),
+		"-o", gsOutputPattern(prefix, ".png"), file)
+	if err != nil {
+		return nil, err
+	}
+	return pageFiles(prefix, ".png")
+}
+
+// imageSimilarity returns the ratio of (almost) equal pixels of two images.
+// Pixels outside of the common area count as different.
+func imageSimilarity(fileA, fileB string) (float64, error) {
+	a, err := readPng(fileA)
+	if err != nil {
+		return 0, err
+	}
+	b, err := readPng(fileB)
+	if err != nil {
+		return 0, err
+	}
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	width := min(boundsA.Dx(), boundsB.Dx())
+	height := min(boundsA.Dy(), boundsB.Dy())
+	total := max(boundsA.Dx()*boundsA.Dy(), boundsB.Dx()*boundsB.Dy())
+	if total == 0 {
+		return 1, nil
+	}
+
+	equal := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ga, _, _, _ := a.At(boundsA.Min.X+x, boundsA.Min.Y+y).RGBA()
+			gb, _, _, _ := b.At(boundsB.Min.X+x, boundsB.Min.Y+y).RGBA()
+			diff := int(ga>>8) - int(gb>>8)
+			if diff > -16 && diff < 16 {
+				equal++
+			}
+		}
+	}
+	return float64(equal) / float64(total), nil
+}
+
+func readPng(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
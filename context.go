@@ -0,0 +1,70 @@
+package latex
+
+import "context"
+
+// Context returns the context external tools are run with,
+// context.Background() if none was set.
+func (t *CompileTask) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// SetContext sets the context of this task. When it is cancelled or its
+// deadline passes, running external tools are killed along with their
+// children and all methods running tools fail with the cause of the
+// cancellation, e.g. context.DeadlineExceeded. Use nil to remove it.
+func (t *CompileTask) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
+// withContext returns a copy of the task running tools with ctx, so a
+// context applies to a single call without changing the task, which may be
+// in use concurrently. CPU time and timeline events of the copy are
+// accounted to the task.
+func (t *CompileTask) withContext(ctx context.Context) *CompileTask {
+	c := *t
+	c.ctx = ctx
+	c.accountTo = t.accounting()
+	return &c
+}
+
+// accounting returns the task CPU time and timeline events are accounted to.
+func (t *CompileTask) accounting() *CompileTask {
+	if t.accountTo != nil {
+		return t.accountTo
+	}
+	return t
+}
+
+// PdflatexContext is like Pdflatex, but kills pdflatex when ctx is done.
+func (t *CompileTask) PdflatexContext(ctx context.Context, file string, args ...string) error {
+	return t.withContext(ctx).Pdflatex(file, args...)
+}
+
+// XelatexContext is like Xelatex, but kills xelatex when ctx is done.
+func (t *CompileTask) XelatexContext(ctx context.Context, file string, args ...string) error {
+	return t.withContext(ctx).Xelatex(file, args...)
+}
+
+// LualatexContext is like Lualatex, but kills lualatex when ctx is done.
+func (t *CompileTask) LualatexContext(ctx context.Context, file string, args ...string) error {
+	return t.withContext(ctx).Lualatex(file, args...)
+}
+
+// RunContext is like Run, but kills the engine when ctx is done.
+func (t *CompileTask) RunContext(ctx context.Context, toolname, file string, args ...string) (*CompileResult, error) {
+	return t.withContext(ctx).Run(toolname, file, args...)
+}
+
+// OptimizeContext is like Optimize, but kills the optimizer when ctx is
+// done.
+func (t *CompileTask) OptimizeContext(ctx context.Context, file string, channel string) error {
+	return t.withContext(ctx).Optimize(file, channel)
+}
+
+// RunPassesContext is like RunPasses, but stops when ctx is done.
+func (t *CompileTask) RunPassesContext(ctx context.Context, passes ...Pass) (PassResult, error) {
+	return t.withContext(ctx).RunPasses(passes...)
+}
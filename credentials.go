@@ -0,0 +1,61 @@
+package latex
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Credentials identify the user and group external tools are run as.
+type Credentials struct {
+	Uid uint32
+	Gid uint32
+}
+
+// LookupCredentials returns the credentials of a local user by name, using
+// the primary group of that user.
+func LookupCredentials(username string) (Credentials, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return Credentials{}, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return Credentials{}, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// RunAs returns the credentials external tools are run with, nil if they
+// inherit the ones of the current process.
+func (t *CompileTask) RunAs() *Credentials {
+	return t.runAs
+}
+
+// SetRunAs drops privileges for all spawned processes to the given
+// credentials. This is meant for server deployments running as root. The
+// compile directory is handed over to the unprivileged user and TeX is
+// restricted to reading and writing files below its working directory
+// (besides its own installation). Use nil to disable.
+func (t *CompileTask) SetRunAs(credentials *Credentials) {
+	t.runAs = credentials
+}
+
+// grantAccess hands ownership of a file or directory tree to the user
+// external tools are run as. Nothing happens if privileges are not dropped.
+func (t *CompileTask) grantAccess(name string) error {
+	if t.runAs == nil {
+		return nil
+	}
+	return filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(t.runAs.Uid), int(t.runAs.Gid))
+	})
+}
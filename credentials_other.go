@@ -0,0 +1,15 @@
+//go:build !unix
+
+package latex
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func (t *CompileTask) applyCredentials(cmd *exec.Cmd) error {
+	if t.runAs == nil {
+		return nil
+	}
+	return errors.New("dropping privileges is not supported on this platform")
+}
@@ -0,0 +1,31 @@
+package latex
+
+import "testing"
+
+func TestLookupCredentials(t *testing.T) {
+	_, err := LookupCredentials("no-such-user-go-latex")
+	if err == nil {
+		t.Error("LookupCredentials of an unknown user succeeded")
+	}
+}
+
+func TestEnvironmentRunAs(t *testing.T) {
+	tests := []struct {
+		name  string
+		runAs *Credentials
+		want  bool
+	}{
+		{"inherited", nil, false},
+		{"dropped", &Credentials{Uid: 65534, Gid: 65534}, true},
+		{"root", &Credentials{}, true},
+	}
+	for _, test := range tests {
+		task := NewCompileTask()
+		task.SetRunAs(test.runAs)
+		env := task.environment()
+		restricted := contains(env, "openout_any=p") && contains(env, "openin_any=p")
+		if restricted != test.want {
+			t.Errorf("%s: restricted file access = %v, want %v", test.name, restricted, test.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package latex
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func (t *CompileTask) applyCredentials(cmd *exec.Cmd) error {
+	if t.runAs == nil {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid: t.runAs.Uid,
+		Gid: t.runAs.Gid,
+		// drop all supplementary groups
+		Groups: []uint32{},
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package latex
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestLookupCredentialsRoot(t *testing.T) {
+	if _, err := user.Lookup("root"); err != nil {
+		t.Skip("no root user")
+	}
+	credentials, err := LookupCredentials("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials != (Credentials{}) {
+		t.Errorf("LookupCredentials(root) = %+v, want uid and gid 0", credentials)
+	}
+}
+
+func TestApplyCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		runAs *Credentials
+		want  *syscall.Credential
+	}{
+		{"inherited", nil, nil},
+		{"dropped", &Credentials{Uid: 1000, Gid: 100}, &syscall.Credential{Uid: 1000, Gid: 100, Groups: []uint32{}}},
+	}
+	for _, test := range tests {
+		task := NewCompileTask()
+		task.SetRunAs(test.runAs)
+		cmd := exec.Command("true")
+		if err := task.applyCredentials(cmd); err != nil {
+			t.Fatal(err)
+		}
+		var got *syscall.Credential
+		if cmd.SysProcAttr != nil {
+			got = cmd.SysProcAttr.Credential
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: credential = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGrantAccess(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sub", "document.tex")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	task := NewCompileTask()
+	if err := task.grantAccess(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("grantAccess without credentials = %v, want nil", err)
+	}
+	task.SetRunAs(&Credentials{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())})
+	if err := task.grantAccess(dir); err != nil {
+		t.Errorf("grantAccess to the current user = %v, want nil", err)
+	}
+	if err := task.grantAccess(filepath.Join(dir, "missing")); err == nil {
+		t.Error("grantAccess on a missing file succeeded")
+	}
+}
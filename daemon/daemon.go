@@ -0,0 +1,201 @@
+// Package daemon serves TeX engine passes from pools of pre-warmed engine
+// processes (see latex.EnginePool) over a local socket, so short-lived
+// processes generating many documents don't pay the startup of the engine
+// for every pass.
+//
+// The protocol is one JSON request and one JSON response per connection.
+// Clients and the daemon share the file system, requests name the directory
+// to compile in. Use Client as the engine runner of tasks:
+//
+//	task.SetEngineRunner(daemon.NewClient("/run/golatex.sock"))
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	latex "github.com/jojomi/go-latex"
+)
+
+// Request asks the daemon to run an engine once.
+type Request struct {
+	Engine string `json:"engine"`
+	// Dir is the absolute directory to compile in.
+	Dir  string `json:"dir"`
+	File string `json:"file"`
+}
+
+// Response is the outcome of a Request.
+type Response struct {
+	Output string `json:"output"`
+	// Error is empty if the run succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Listen listens on a unix socket accessible to the current user only,
+// replacing a socket file left behind by an earlier daemon.
+func Listen(socket string) (net.Listener, error) {
+	if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: a daemon is running already", socket)
+		}
+		os.Remove(socket)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Server serves requests from engine pools.
+type Server struct {
+	pools map[string]*latex.EnginePool
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	wg        sync.WaitGroup
+}
+
+// New returns a Server running requests in pools, at most one pool per
+// engine.
+func New(pools ...*latex.EnginePool) *Server {
+	s := &Server{
+		pools:     map[string]*latex.EnginePool{},
+		listeners: map[net.Listener]struct{}{},
+	}
+	for _, pool := range pools {
+		s.pools[pool.Engine()] = pool
+	}
+	return s
+}
+
+// Serve accepts connections on l until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and waits for the running requests.
+// The pools are not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	var errs []error
+	for l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	s.listeners = map[net.Listener]struct{}{}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	var request Request
+	err := json.NewDecoder(conn).Decode(&request)
+	if err != nil {
+		return
+	}
+
+	// the client closing the connection cancels the request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	response := Response{}
+	output, err := s.run(ctx, request)
+	response.Output = output
+	if err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func (s *Server) run(ctx context.Context, request Request) (string, error) {
+	pool, ok := s.pools[request.Engine]
+	if !ok {
+		return "", fmt.Errorf("no engine pool for %s", request.Engine)
+	}
+	if !filepath.IsAbs(request.Dir) {
+		return "", fmt.Errorf("%s: directory must be absolute", request.Dir)
+	}
+	return pool.RunEngine(ctx, request.Engine, request.Dir, request.File)
+}
+
+// Client sends engine runs to a daemon. It implements latex.EngineRunner.
+type Client struct {
+	socket string
+}
+
+// NewClient returns a client of the daemon listening on socket.
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// RunEngine implements latex.EngineRunner.
+func (c *Client) RunEngine(ctx context.Context, engine, dir, file string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	err = json.NewEncoder(conn).Encode(Request{Engine: engine, Dir: dir, File: file})
+	if err != nil {
+		return "", err
+	}
+	var response Response
+	err = json.NewDecoder(conn).Decode(&response)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", context.Cause(ctx)
+		}
+		return "", err
+	}
+	if response.Error != "" {
+		return response.Output, errors.New(response.Error)
+	}
+	return response.Output, nil
+}
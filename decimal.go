@@ -0,0 +1,226 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Monetary amounts must never pass through float64. The template functions
+// in this file work on exact values and accept Decimal, *big.Rat, big.Rat,
+// json.Number, integers, decimal strings and any fmt.Stringer printing a
+// decimal number (like shopspring/decimal's Decimal). Floats are rejected.
+
+// DecodeData decodes JSON template data keeping numbers as json.Number, so
+// amounts are passed on to templates without rounding.
+func DecodeData(r io.Reader) (interface{}, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var data interface{}
+	err := decoder.Decode(&data)
+	return data, err
+}
+
+// ParseDecimal parses a decimal number like "-1234.56" exactly.
+func ParseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/eEpPxX_") {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return r, nil
+}
+
+// Decimal is the result of the decimal template functions. Unlike *big.Rat,
+// which prints as a fraction like "67/20", it prints in decimal notation.
+type Decimal struct {
+	r *big.Rat
+}
+
+// NewDecimal wraps x, which is copied.
+func NewDecimal(x *big.Rat) Decimal {
+	return Decimal{r: new(big.Rat).Set(x)}
+}
+
+// Rat returns the exact value of d.
+func (d Decimal) Rat() *big.Rat {
+	if d.r == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(d.r)
+}
+
+// String prints d in decimal notation, like num does.
+func (d Decimal) String() string {
+	return decimalString(d.Rat())
+}
+
+// toDecimal converts a template value to an exact rational number.
+func toDecimal(v interface{}) (*big.Rat, error) {
+	switch v := v.(type) {
+	case Decimal:
+		return v.Rat(), nil
+	case *big.Rat:
+		if v == nil {
+			return nil, fmt.Errorf("decimal is nil")
+		}
+		return new(big.Rat).Set(v), nil
+	case big.Rat:
+		return new(big.Rat).Set(&v), nil
+	case *big.Int:
+		return new(big.Rat).SetInt(v), nil
+	case json.Number:
+		return ParseDecimal(string(v))
+	case string:
+		return ParseDecimal(v)
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), nil
+	case int32:
+		return new(big.Rat).SetInt64(int64(v)), nil
+	case int64:
+		return new(big.Rat).SetInt64(v), nil
+	case uint:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(uint64(v))), nil
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), nil
+	case float32, float64:
+		return nil, fmt.Errorf("floating point value %v is not allowed for decimals, use a decimal string, json.Number or *big.Rat", v)
+	case fmt.Stringer:
+		return ParseDecimal(v.String())
+	}
+	return nil, fmt.Errorf("cannot use %T as decimal", v)
+}
+
+// FormatDecimal rounds x half away from zero to places decimal places. If
+// thousandsSep is not empty it separates groups of three digits. places must
+// not be negative.
+func FormatDecimal(x *big.Rat, places int, decimalSep, thousandsSep string) string {
+	if places < 0 {
+		panic(fmt.Sprintf("negative decimal places %d", places))
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	n := new(big.Int).Mul(x.Num(), scale)
+	q, r := new(big.Int).QuoRem(n, x.Denom(), new(big.Int))
+	// round half away from zero
+	if r.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(x.Sign())))
+	}
+
+	negative := q.Sign() < 0
+	digits := new(big.Int).Abs(q).String()
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	intPart, fracPart := digits[:len(digits)-places], digits[len(digits)-places:]
+	if thousandsSep != "" {
+		var b strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteString(thousandsSep)
+			}
+			b.WriteRune(c)
+		}
+		intPart = b.String()
+	}
+
+	result := intPart
+	if places > 0 {
+		result += decimalSep + fracPart
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
+
+// decimalFuncs returns the template functions for decimal arithmetic.
+func decimalFuncs() map[string]interface{} {
+	arith := func(op func(z, x, y *big.Rat) *big.Rat) func(a, b interface{}) (Decimal, error) {
+		return func(a, b interface{}) (Decimal, error) {
+			x, err := toDecimal(a)
+			if err != nil {
+				return Decimal{}, err
+			}
+			y, err := toDecimal(b)
+			if err != nil {
+				return Decimal{}, err
+			}
+			return Decimal{r: op(new(big.Rat), x, y)}, nil
+		}
+	}
+	return map[string]interface{}{
+		"decimal": func(v interface{}) (Decimal, error) {
+			x, err := toDecimal(v)
+			if err != nil {
+				return Decimal{}, err
+			}
+			return Decimal{r: x}, nil
+		},
+		"decAdd": arith((*big.Rat).Add),
+		"decSub": arith((*big.Rat).Sub),
+		"decMul": arith((*big.Rat).Mul),
+		"decDiv": func(a, b interface{}) (Decimal, error) {
+			y, err := toDecimal(b)
+			if err != nil {
+				return Decimal{}, err
+			}
+			if y.Sign() == 0 {
+				return Decimal{}, fmt.Errorf("division by zero")
+			}
+			return arith((*big.Rat).Quo)(a, y)
+		},
+		"decSum": func(values ...interface{}) (Decimal, error) {
+			sum := new(big.Rat)
+			for _, value := range flattenValues(values) {
+				x, err := toDecimal(value)
+				if err != nil {
+					return Decimal{}, err
+				}
+				sum.Add(sum, x)
+			}
+			return Decimal{r: sum}, nil
+		},
+		// {{ .Total | formatDecimal 2 }}
+		"formatDecimal": func(places int, v interface{}) (Raw, error) {
+			s, err := formatDecimalValue(v, places, ".", "")
+			return Raw(s), err
+		},
+		// {{ .Total | formatMoney 2 "," "." }}, the separators are TeX
+		"formatMoney": func(places int, decimalSep, thousandsSep string, v interface{}) (Raw, error) {
+			s, err := formatDecimalValue(v, places, decimalSep, thousandsSep)
+			return Raw(s), err
+		},
+	}
+}
+
+// formatDecimalValue converts v and formats it like FormatDecimal, returning
+// an error for negative places instead of panicking.
+func formatDecimalValue(v interface{}, places int, decimalSep, thousandsSep string) (string, error) {
+	if places < 0 {
+		return "", fmt.Errorf("negative decimal places %d", places)
+	}
+	x, err := toDecimal(v)
+	if err != nil {
+		return "", err
+	}
+	return FormatDecimal(x, places, decimalSep, thousandsSep), nil
+}
+
+// flattenValues expands slices of values, so decSum accepts a list as well as
+// single arguments.
+func flattenValues(values []interface{}) []interface{} {
+	result := []interface{}{}
+	for _, value := range values {
+		if list, ok := value.([]interface{}); ok {
+			result = append(result, list...)
+		} else {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package latex
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		value        string
+		places       int
+		decimalSep   string
+		thousandsSep string
+		want         string
+	}{
+		{"0", 2, ".", "", "0.00"},
+		{"1.005", 2, ".", "", "1.01"},
+		{"-1.005", 2, ".", "", "-1.01"},
+		{"1.004", 2, ".", "", "1.00"},
+		{"-0.004", 2, ".", "", "0.00"},
+		{"0.5", 0, ".", "", "1"},
+		{"-0.5", 0, ".", "", "-1"},
+		{"1234567.891", 2, ",", ".", "1.234.567,89"},
+		{"-1234.5", 2, ",", ".", "-1.234,50"},
+		{"123", 0, ".", "'", "123"},
+		{"0.001", 5, ".", "", "0.00100"},
+	}
+	for _, test := range tests {
+		x, err := ParseDecimal(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := FormatDecimal(x, test.places, test.decimalSep, test.thousandsSep)
+		if got != test.want {
+			t.Errorf("FormatDecimal(%s, %d, %q, %q) = %q, want %q", test.value, test.places, test.decimalSep, test.thousandsSep, got, test.want)
+		}
+	}
+}
+
+func TestToDecimal(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+		valid bool
+	}{
+		{"12.50", "25/2", true},
+		{json.Number("0.1"), "1/10", true},
+		{42, "42", true},
+		{int64(-7), "-7", true},
+		{big.NewRat(1, 3), "1/3", true},
+		{NewDecimal(big.NewRat(67, 20)), "67/20", true},
+		{0.1, "", false},
+		{"1e3", "", false},
+		{"1/3", "", false},
+		{"", "", false},
+		{true, "", false},
+	}
+	for _, test := range tests {
+		x, err := toDecimal(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("toDecimal(%#v) error = %v, want valid %v", test.value, err, test.valid)
+			continue
+		}
+		if err == nil && x.RatString() != test.want {
+			t.Errorf("toDecimal(%#v) = %s, want %s", test.value, x.RatString(), test.want)
+		}
+	}
+}
+
+func TestDecimalFuncs(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+		valid    bool
+	}{
+		{`{{ decAdd "1.10" "2.25" }}`, "3.35", true},
+		{`{{ decSub "1" "2.5" }}`, "-1.5", true},
+		{`{{ decMul "1.5" 2 }}`, "3", true},
+		{`{{ decDiv 1 3 }}`, "0.333333", true},
+		{`{{ decDiv 1 0 }}`, "", false},
+		{`{{ decSum .Items }}`, "3.6", true},
+		{`{{ decSum .Items | formatMoney 2 "," "." }}`, "3,60", true},
+		{`{{ formatDecimal -1 "2" }}`, "", false},
+	}
+	data := map[string]interface{}{
+		"Items": []interface{}{json.Number("1.2"), "2.4"},
+	}
+	for _, test := range tests {
+		tpl := template.Must(template.New("").Funcs(decimalFuncs()).Parse(test.template))
+		var b strings.Builder
+		err := tpl.Execute(&b, data)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.template, err, test.valid)
+			continue
+		}
+		if err == nil && b.String() != test.want {
+			t.Errorf("%s = %q, want %q", test.template, b.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package latex
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page is a location within a PDF, e.g. the target of a named destination.
+type Page struct {
+	// Number is the page number starting at 1, 0 if unknown.
+	Number int
+	// Fit is the destination type, e.g. "XYZ" or "Fit".
+	Fit string
+	// Top is the vertical position on the page (for XYZ and FitH), in PDF
+	// units from the bottom.
+	Top float64
+}
+
+// Link is a link annotation within a PDF.
+type Link struct {
+	// Page is the page number the link is placed on.
+	Page int
+	// Rect is the clickable area: left, bottom, right, top.
+	Rect [4]float64
+	// Destination is the named destination for internal links using names.
+	Destination string
+	// Target is the resolved target of internal links.
+	Target Page
+	// URI is the target of external links.
+	URI string
+}
+
+// DestinationURL returns a URL opening the PDF served at pdfURL at a named
+// destination, which is supported by most browsers and viewers.
+func DestinationURL(pdfURL, name string) string {
+	return pdfURL + "#nameddest=" + url.PathEscape(name)
+}
+
+// Destinations returns the named destinations of a PDF (created e.g. by
+// hyperref for sections, like "section.3.2"), so host applications can
+// deep-link into generated documents. It requires qpdf and defaults to the
+// output of the compiled file.
+func (t *CompileTask) Destinations(file string) (map[string]Page, error) {
+	objects, err := t.readPdfObjects(t.pdfPath(file))
+	if err != nil {
+		return nil, err
+	}
+	return objects.destinations(), nil
+}
+
+// Links returns all link annotations of a PDF in page order. It requires qpdf
+// and defaults to the output of the compiled file.
+func (t *CompileTask) Links(file string) ([]Link, error) {
+	objects, err := t.readPdfObjects(t.pdfPath(file))
+	if err != nil {
+		return nil, err
+	}
+	destinations := objects.destinations()
+	pageNumbers := objects.pageNumbers()
+
+	links := []Link{}
+	for index, pageRef := range objects.pages() {
+		page, _ := objects.dict(pageRef)
+		annotations, _ := objects.resolve(page["/Annots"]).([]interface{})
+		for _, a := range annotations {
+			annotation, _ := objects.dict(a)
+			if annotation["/Subtype"] != "/Link" {
+				continue
+			}
+			link := Link{Page: index + 1}
+			rect, _ := objects.resolve(annotation["/Rect"]).([]interface{})
+			for i := 0; i < len(rect) && i < 4; i++ {
+				link.Rect[i] = pdfNumber(rect[i])
+			}
+			dest := annotation["/Dest"]
+			if action, _ := objects.dict(annotation["/A"]); action != nil {
+				switch action["/S"] {
+				case "/GoTo":
+					dest = action["/D"]
+				case "/URI":
+					link.URI = pdfAnyString(action["/URI"])
+				}
+			}
+			if dest != nil {
+				if name := pdfName(objects.resolve(dest)); name != "" {
+					link.Destination = name
+					link.Target = destinations[name]
+				} else {
+					link.Target = objects.destinationPage(dest, pageNumbers)
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// resolve follows a reference to its value.
+func (o *pdfObjects) resolve(v interface{}) interface{} {
+	if ref, ok := v.(string); ok && isPdfRef(ref) {
+		return o.value(ref)
+	}
+	return v
+}
+
+func (o *pdfObjects) pageNumbers() map[string]int {
+	numbers := map[string]int{}
+	for index, ref := range o.pages() {
+		numbers[ref] = index + 1
+	}
+	return numbers
+}
+
+func (o *pdfObjects) destinations() map[string]Page {
+	pageNumbers := o.pageNumbers()
+	destinations := map[string]Page{}
+	catalog, _ := o.catalog()
+
+	// PDF 1.1 style destinations dictionary
+	dests, _ := o.dict(catalog["/Dests"])
+	for name, dest := range dests {
+		destinations[strings.TrimPrefix(name, "/")] = o.destinationPage(dest, pageNumbers)
+	}
+
+	// name tree
+	names, _ := o.dict(catalog["/Names"])
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		node, _ := o.dict(v)
+		if node == nil {
+			return
+		}
+		entries, _ := o.resolve(node["/Names"]).([]interface{})
+		for i := 0; i+1 < len(entries); i += 2 {
+			destinations[pdfAnyString(entries[i])] = o.destinationPage(entries[i+1], pageNumbers)
+		}
+		kids, _ := o.resolve(node["/Kids"]).([]interface{})
+		for _, kid := range kids {
+			walk(kid)
+		}
+	}
+	walk(names["/Dests"])
+	return destinations
+}
+
+// destinationPage converts an explicit destination (an array like
+// [page /XYZ left top zoom], optionally wrapped in a dictionary) into a Page.
+func (o *pdfObjects) destinationPage(dest interface{}, pageNumbers map[string]int) Page {
+	dest = o.resolve(dest)
+	if d, ok := dest.(map[string]interface{}); ok {
+		dest = o.resolve(d["/D"])
+	}
+	array, ok := dest.([]interface{})
+	if !ok || len(array) < 2 {
+		return Page{}
+	}
+	page := Page{Fit: strings.TrimPrefix(pdfName(array[1]), "/")}
+	switch target := array[0].(type) {
+	case string:
+		page.Number = pageNumbers[target]
+	case float64:
+		// remote destinations use page indexes
+		page.Number = int(target) + 1
+	}
+	switch page.Fit {
+	case "XYZ":
+		if len(array) > 3 {
+			page.Top = pdfNumber(array[3])
+		}
+	case "FitH", "FitBH":
+		if len(array) > 2 {
+			page.Top = pdfNumber(array[2])
+		}
+	}
+	return page
+}
+
+func pdfNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// pdfName returns the name of a PDF name object without the leading slash,
+// or the text of a string object. Other values return an empty string.
+func pdfName(v interface{}) string {
+	s, ok := v.(string)
+	if !ok || isPdfRef(s) {
+		return ""
+	}
+	if strings.HasPrefix(s, "/") {
+		return s[1:]
+	}
+	return pdfAnyString(s)
+}
+
+// pdfAnyString decodes text as well as binary strings of qpdf's JSON format.
+func pdfAnyString(v interface{}) string {
+	s, _ := v.(string)
+	switch {
+	case strings.HasPrefix(s, "u:"):
+		return s[2:]
+	case strings.HasPrefix(s, "b:"):
+		var b strings.Builder
+		for i := 2; i+1 < len(s); i += 2 {
+			c, err := strconv.ParseUint(s[i:i+2], 16, 8)
+			if err != nil {
+				return ""
+			}
+			b.WriteByte(byte(c))
+		}
+		return b.String()
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package latex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PdfEncryption configures the encryption of PDFs, see EncryptPdf.
+type PdfEncryption struct {
+	// UserPassword is needed to open the PDF, empty to open it without
+	// password subject to the permissions.
+	UserPassword string
+	// OwnerPassword is needed to lift the restrictions, it must be set.
+	OwnerPassword string
+	// NoPrint prevents printing.
+	NoPrint bool
+	// NoCopy prevents copying text and images.
+	NoCopy bool
+	// NoModify prevents changing the document, including filling in forms,
+	// annotating and assembling.
+	NoModify bool
+	// NoAnnotate prevents adding comments and filling in forms.
+	NoAnnotate bool
+}
+
+// args returns the arguments of qpdf encrypting with 256-bit AES.
+func (e PdfEncryption) args() []string {
+	args := []string{"--encrypt", e.UserPassword, e.OwnerPassword, "256"}
+	if e.NoPrint {
+		args = append(args, "--print=none")
+	}
+	if e.NoCopy {
+		args = append(args, "--extract=n")
+	}
+	if e.NoModify {
+		args = append(args, "--modify=none")
+	}
+	if e.NoAnnotate {
+		args = append(args, "--annotate=n", "--form=n")
+	}
+	return append(args, "--")
+}
+
+// Encryption returns the encryption applied by MoveToDest, nil if none.
+func (t *CompileTask) Encryption() *PdfEncryption {
+	return t.encryption
+}
+
+// SetEncryption makes MoveToDest encrypt PDFs using EncryptPdf as the last
+// step before moving them, after the metadata is stamped. Use nil to move
+// PDFs unencrypted.
+func (t *CompileTask) SetEncryption(encryption *PdfEncryption) {
+	t.encryption = encryption
+}
+
+// EncryptPdf protects a PDF with passwords and restricts its permissions
+// using 256-bit AES encryption, defaulting to the output of the compiled
+// file. The passwords are passed to qpdf in a file, so they don't show up
+// in process listings. Note that the permissions are honored by viewers
+// voluntarily, only the user password protects the content. Encrypted PDFs
+// don't conform to PDF/A.
+func (t *CompileTask) EncryptPdf(file string, encryption PdfEncryption) error {
+	file = t.pdfPath(file)
+	if encryption.OwnerPassword == "" {
+		return errors.New("encryption needs an owner password")
+	}
+	if strings.ContainsAny(encryption.UserPassword+encryption.OwnerPassword, "\r\n") {
+		return errors.New("passwords must not contain line breaks")
+	}
+	return t.replaceWith(file, func(output string) error {
+		argsFile, err := os.CreateTemp(filepath.Dir(file), ".go-latex-encrypt-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(argsFile.Name())
+		args := append([]string{file}, encryption.args()...)
+		args = append(args, output)
+		_, err = argsFile.WriteString(strings.Join(args, "\n") + "\n")
+		closeErr := argsFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = t.grantAccess(argsFile.Name())
+		}
+		if err != nil {
+			return err
+		}
+		_, err = t.runTool("qpdf", "@"+argsFile.Name())
+		return err
+	})
+}
@@ -0,0 +1,219 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// defaultEngine is the TeX engine used if none is set.
+const defaultEngine = "pdflatex"
+
+// Engine is a compiler turning TeX sources into documents.
+type Engine interface {
+	// Name identifies the engine, e.g. in SetEngine.
+	Name() string
+	// Command returns the executable to run.
+	Command() string
+	// Args returns the arguments to compile file, given the arguments of
+	// the caller.
+	Args(file string, args []string) []string
+	// SupportsFormat reports whether the engine can produce documents in a
+	// format like "pdf" or "dvi".
+	SupportsFormat(format string) bool
+}
+
+// CommandEngine is an Engine running an executable with the file to
+// compile as last argument, like the TeX engines do. Use it for wrappers
+// like site-specific launcher scripts.
+type CommandEngine struct {
+	EngineName string
+	// Executable defaults to EngineName.
+	Executable string
+	// DefaultArgs are passed before the arguments of the caller.
+	DefaultArgs []string
+	// Formats lists the supported output formats, "pdf" if empty.
+	Formats []string
+	// QuoteFile passes the file the way the TeX engines of TeX Live expect
+	// it, quoted if it contains spaces.
+	QuoteFile bool
+}
+
+// Name returns the name of the engine.
+func (e *CommandEngine) Name() string {
+	return e.EngineName
+}
+
+// Command returns the executable to run.
+func (e *CommandEngine) Command() string {
+	if e.Executable == "" {
+		return e.EngineName
+	}
+	return e.Executable
+}
+
+// Args returns the default arguments, the arguments of the caller and the
+// file.
+func (e *CommandEngine) Args(file string, args []string) []string {
+	result := append([]string{}, e.DefaultArgs...)
+	result = append(result, args...)
+	if e.QuoteFile {
+		file = texFileArg(file)
+	}
+	return append(result, file)
+}
+
+// SupportsFormat reports whether format is one of the formats of the engine.
+func (e *CommandEngine) SupportsFormat(format string) bool {
+	if len(e.Formats) == 0 {
+		return format == "pdf"
+	}
+	return contains(e.Formats, format)
+}
+
+var engineRegistry = struct {
+	sync.RWMutex
+	engines map[string]Engine
+}{
+	engines: map[string]Engine{
+		"pdflatex": &CommandEngine{EngineName: "pdflatex", Formats: []string{"pdf", "dvi"}, QuoteFile: true},
+		"xelatex":  &CommandEngine{EngineName: "xelatex", Formats: []string{"pdf", "xdv"}, QuoteFile: true},
+		"lualatex": &CommandEngine{EngineName: "lualatex", Formats: []string{"pdf", "dvi"}, QuoteFile: true},
+	},
+}
+
+// RegisterEngine makes an engine available by name to all tasks, replacing
+// a registered engine of the same name including the builtin ones.
+func RegisterEngine(engine Engine) {
+	if engine == nil || engine.Name() == "" {
+		panic("latex: RegisterEngine needs an engine with a name")
+	}
+	engineRegistry.Lock()
+	defer engineRegistry.Unlock()
+	engineRegistry.engines[engine.Name()] = engine
+}
+
+// LookupEngine returns the registered engine with the given name.
+func LookupEngine(name string) (Engine, bool) {
+	engineRegistry.RLock()
+	defer engineRegistry.RUnlock()
+	engine, ok := engineRegistry.engines[name]
+	return engine, ok
+}
+
+// Engines returns the names of all registered engines, sorted.
+func Engines() []string {
+	engineRegistry.RLock()
+	defer engineRegistry.RUnlock()
+	names := []string{}
+	for name := range engineRegistry.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// engineFor returns the registered engine for a tool name, falling back to
+// running the tool as TeX engine.
+func engineFor(name string) Engine {
+	if engine, ok := LookupEngine(name); ok {
+		return engine
+	}
+	return &CommandEngine{EngineName: name}
+}
+
+// Engine returns the name of the TeX engine used by Compile.
+func (t *CompileTask) Engine() string {
+	if t.engine == "" {
+		return defaultEngine
+	}
+	return t.engine
+}
+
+// SetEngine sets the TeX engine used by Compile by name, one of the
+// registered engines (see RegisterEngine).
+func (t *CompileTask) SetEngine(engine string) error {
+	if _, ok := LookupEngine(engine); !ok {
+		return fmt.Errorf("unknown TeX engine %q", engine)
+	}
+	t.engine = engine
+	return nil
+}
+
+// Compile runs the engine of the task with the file (defaulting to the
+// compile file) and arguments supplied. Failures are returned as
+// *CompileError.
+func (t *CompileTask) Compile(file string, args ...string) error {
+	return t.RunEngine(engineFor(t.Engine()), file, args...)
+}
+
+// RunEngine runs an engine with the file (defaulting to the compile file)
+// and arguments supplied, preceded by the ones of the argument profile of
+// the task (see SetArgProfile). The engine does not need to be registered.
+// Failures are returned as *CompileError.
+//
+// If the run fails because files of packages are missing, a
+// *MissingPackageError is returned. With SetAutoInstallPackages the
+// packages are installed using tlmgr and the run is retried instead.
+func (t *CompileTask) RunEngine(engine Engine, file string, args ...string) error {
+	file = t.defaultCompileFilename(file)
+	if e, ok := engine.(*CommandEngine); ok && e.QuoteFile {
+		err := checkTexFilename(file)
+		if err != nil {
+			return err
+		}
+	}
+	if profileArgs := t.profileArgs(engine.Name()); len(profileArgs) > 0 {
+		args = append(append([]string{}, profileArgs...), args...)
+	}
+	installed := map[string]bool{}
+	for {
+		err := t.runPass(engine, file, args)
+		if err == nil {
+			return nil
+		}
+		retry, err := t.handleMissingPackages(file, err, installed)
+		if !retry {
+			return err
+		}
+	}
+}
+
+// runPass runs engine once, using the engine runner of the task if it can.
+func (t *CompileTask) runPass(engine Engine, file string, args []string) error {
+	if t.runner == nil || len(args) > 0 || !isBuiltinEngine(engine) {
+		return t.compileStep(engine.Name(), file, engine.Command(), engine.Args(file, args)...)
+	}
+	output, err := t.runner.RunEngine(t.Context(), engine.Name(), t.context().WorkingDir(), file)
+	if err != nil {
+		result := &toolResult{}
+		result.stdout.WriteString(output)
+		return newCompileError(engine.Name(), file, result, err)
+	}
+	return nil
+}
+
+// compileStep runs a tool of the compilation on behalf of file. Failures are
+// returned as *CompileError named after tool.
+func (t *CompileTask) compileStep(tool, file, name string, args ...string) error {
+	_, err := t.lookPath(name)
+	if err != nil {
+		return err
+	}
+
+	command, err := t.command(name, args...)
+	if err != nil {
+		return err
+	}
+	result, err := t.execute(command, t.verbosity)
+	if err != nil {
+		if t.exitOnError {
+			fmt.Print(result.Output())
+			fmt.Print(result.Error())
+			os.Exit(1)
+		}
+		return newCompileError(tool, file, result, err)
+	}
+	return nil
+}
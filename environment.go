@@ -0,0 +1,174 @@
+package latex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment describes the environment external tools are found and run
+// in, replacing the one of the process, e.g. for hermetic builds using Nix.
+type Environment struct {
+	// Path lists the directories searched for tools, in place of PATH.
+	Path []string
+	// Vars are set for the tools. PATH is derived from Path.
+	Vars map[string]string
+	// Inherit passes the environment variables of the process besides PATH
+	// on to the tools, overridden by Vars.
+	Inherit bool
+}
+
+// NixProfileEnvironment returns an Environment using the tools of a Nix
+// profile, like ~/.nix-profile or the result link of nix build.
+func NixProfileEnvironment(profile string) (*Environment, error) {
+	profile, err := filepath.EvalSymlinks(profile)
+	if err != nil {
+		return nil, err
+	}
+	bin := filepath.Join(profile, "bin")
+	if fi, err := os.Stat(bin); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a Nix profile: no bin directory", profile)
+	}
+	return &Environment{
+		Path: []string{bin},
+		Vars: map[string]string{
+			"NIX_PROFILES": profile,
+		},
+		Inherit: true,
+	}, nil
+}
+
+// LoadEnvironment reads an environment description. Supported are the JSON
+// output of nix print-dev-env --json and files with KEY=VALUE lines (an
+// optional export prefix and shell quoting are allowed), like those written
+// by env or direnv dump. Only the variables in the file are used.
+func LoadEnvironment(file string) (*Environment, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var vars map[string]string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		vars, err = parseNixDevEnv(trimmed)
+	} else {
+		vars, err = parseEnvLines(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	env := &Environment{Vars: vars}
+	if path, ok := vars["PATH"]; ok {
+		env.Path = filepath.SplitList(path)
+		delete(vars, "PATH")
+	}
+	return env, nil
+}
+
+func parseNixDevEnv(data []byte) (map[string]string, error) {
+	var devEnv struct {
+		Variables map[string]struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	err := json.Unmarshal(data, &devEnv)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	for name, v := range devEnv.Variables {
+		if v.Type != "exported" {
+			continue
+		}
+		var value string
+		if json.Unmarshal(v.Value, &value) == nil {
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+func parseEnvLines(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", number)
+		}
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", number, err)
+			}
+			value = unquoted
+		}
+		vars[name] = value
+	}
+	return vars, scanner.Err()
+}
+
+// lookPath finds a tool in the directories of the environment.
+func (e *Environment) lookPath(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) {
+		return exec.LookPath(name)
+	}
+	for _, dir := range e.Path {
+		path, err := exec.LookPath(filepath.Join(dir, name))
+		if err == nil {
+			return path, nil
+		}
+	}
+	return "", &MissingToolError{Tool: name, Searched: e.Path, Hint: "The tool is not part of the configured environment"}
+}
+
+// environ returns the variables in the form of os.Environ.
+func (e *Environment) environ() []string {
+	vars := map[string]string{}
+	if e.Inherit {
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			vars[name] = value
+		}
+	}
+	for name, value := range e.Vars {
+		vars[name] = value
+	}
+	vars["PATH"] = strings.Join(e.Path, string(filepath.ListSeparator))
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Environment returns the environment tools are run in, nil if it is the one
+// of the process.
+func (t *CompileTask) Environment() *Environment {
+	return t.env
+}
+
+// SetEnvironment makes the task find and run tools in env instead of the
+// environment of the process. Use nil to use the process environment.
+func (t *CompileTask) SetEnvironment(env *Environment) {
+	t.env = env
+}
@@ -0,0 +1,88 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jojomi/go-latex/logparse"
+)
+
+// CompileError is returned if a TeX engine run fails.
+type CompileError struct {
+	Tool string
+	File string
+	// ExitCode of the tool, -1 if it didn't exit normally.
+	ExitCode int
+	// Output and Stderr hold what the tool printed.
+	Output string
+	Stderr string
+	Err    error
+}
+
+func (e *CompileError) Error() string {
+	msg := fmt.Sprintf("%s failed on %s", e.Tool, e.File)
+	if e.ExitCode >= 0 {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	}
+	if first := e.FirstError(); first != "" {
+		msg += ": " + first
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// FirstError returns the first TeX error message in the output, like
+// "LaTeX Error: File `foo.sty' not found." with its line number if known.
+func (e *CompileError) FirstError() string {
+	log, err := logparse.ParseLog(strings.NewReader(e.Output))
+	if err != nil {
+		return ""
+	}
+	errs := log.Errors()
+	if len(errs) == 0 {
+		return ""
+	}
+	msg := errs[0].Message
+	if errs[0].Line > 0 {
+		msg += fmt.Sprintf(" (line %d)", errs[0].Line)
+	}
+	return msg
+}
+
+func newCompileError(tool, file string, result *toolResult, err error) *CompileError {
+	e := &CompileError{
+		Tool:     tool,
+		File:     file,
+		ExitCode: -1,
+		Err:      err,
+	}
+	if result != nil {
+		e.Output = result.Output()
+		e.Stderr = result.Error()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+	return e
+}
+
+// ExitOnError reports whether failing TeX runs terminate the process.
+func (t *CompileTask) ExitOnError() bool {
+	return t.exitOnError
+}
+
+// SetExitOnError makes failing TeX runs print their output and terminate the
+// process with exit code 1 instead of returning a *CompileError. This was
+// the default behavior of earlier versions and is meant for simple command
+// line tools.
+func (t *CompileTask) SetExitOnError(exitOnError bool) {
+	t.exitOnError = exitOnError
+}
@@ -0,0 +1,124 @@
+package latex
+
+import (
+	"fmt"
+	"text/template"
+	"text/template/parse"
+)
+
+// escapeFuncName names the function appended to the actions of templates
+// when auto-escaping.
+const escapeFuncName = "_latex_escape"
+
+// Raw is TeX inserted into auto-escaped templates as is, see SetAutoEscape.
+// Use it for data holding markup, like a formatted address block. The
+// template functions returning TeX, like truncate or table, return Raw.
+type Raw string
+
+// AutoEscape reports whether templates escape the values they insert.
+func (t *CompileTask) AutoEscape() bool {
+	return t.autoEscape
+}
+
+// SetAutoEscape makes ExecuteTemplate escape the values inserted by the
+// actions of templates, so data containing characters like & or % can't
+// break the build or inject markup. Values of type Raw, including the results
+// of functions returning TeX like truncate or table, are inserted as is.
+// Strings known to be TeX can be marked using {{ raw .Signature }}. Arguments of translations (the t function)
+// are escaped as well. It must be called before Template.
+//
+// Without auto-escaping values are inserted as is, {{ escape .Name }}
+// escapes a single value.
+func (t *CompileTask) SetAutoEscape(autoEscape bool) {
+	t.autoEscape = autoEscape
+}
+
+// escapeFuncs returns the template functions for escaping, which are always
+// available.
+func escapeFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"raw": func(s string) Raw {
+			return Raw(s)
+		},
+		"escape": func(v interface{}) Raw {
+			return Raw(escapeValue(v))
+		},
+	}
+}
+
+// escapeValue returns the TeX for a value inserted by a template. Raw
+// values are returned as is, others are printed like text/template does and
+// escaped. Missing values are empty.
+func escapeValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case Raw:
+		return string(v)
+	case string:
+		return escapeLatex(v)
+	}
+	return escapeLatex(fmt.Sprint(v))
+}
+
+// escapeArgs escapes the string arguments of a function formatting them.
+func escapeArgs(args []interface{}) []interface{} {
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			escaped[i] = Raw(escapeLatex(s))
+		} else {
+			escaped[i] = arg
+		}
+	}
+	return escaped
+}
+
+// autoEscapeTemplate rewrites the actions of all templates associated with
+// templ to escape their values, like html/template does. Templates already
+// rewritten are left alone.
+func autoEscapeTemplate(templ *template.Template) {
+	templ.Funcs(template.FuncMap{escapeFuncName: escapeValue})
+	for _, associated := range templ.Templates() {
+		if associated.Tree != nil {
+			autoEscapeNode(associated.Tree, associated.Tree.Root)
+		}
+	}
+}
+
+func autoEscapeNode(tree *parse.Tree, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			autoEscapeNode(tree, child)
+		}
+	case *parse.ActionNode:
+		pipe := node.Pipe
+		if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			// assignments print nothing
+			return
+		}
+		last := pipe.Cmds[len(pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == escapeFuncName {
+			// rewritten before
+			return
+		}
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      last.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(escapeFuncName).SetTree(tree).SetPos(last.Pos)},
+		})
+	case *parse.IfNode:
+		autoEscapeNode(tree, node.List)
+		autoEscapeNode(tree, node.ElseList)
+	case *parse.RangeNode:
+		autoEscapeNode(tree, node.List)
+		autoEscapeNode(tree, node.ElseList)
+	case *parse.WithNode:
+		autoEscapeNode(tree, node.List)
+		autoEscapeNode(tree, node.ElseList)
+	}
+}
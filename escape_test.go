@@ -0,0 +1,46 @@
+package latex
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestAutoEscape(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{{ .Name }}`, `R\&D 100\%`},
+		{`{{ raw .Name }}`, `R&D 100%`},
+		{`{{ .Markup }}`, `\textbf{bold}`},
+		{`{{ escape .Name }}`, `R\&D 100\%`},
+		{`{{ truncate 3 .Name }}`, `R\&D\ldots{}`},
+		{`{{ printf "%s!" (truncate 3 .Name) }}`, `R\textbackslash{}\&D\textbackslash{}ldots\{\}!`},
+		{`{{ .Total | formatMoney 2 "{,}" "~" }}`, `1~234{,}50`},
+		{`{{ qty .Total .Unit }}`, `\qty{1234.5}{\textbackslash{}input\{x\}}`},
+		{"{{ qty .Total (raw `\\kilo\\gram`) }}", `\qty{1234.5}{\kilo\gram}`},
+		{`{{ unit "m" }}`, `\unit{m}`},
+		{`{{ with .Name }}{{ . }}{{ end }}`, `R\&D 100\%`},
+		{`{{ $x := .Name }}{{ $x }}`, `R\&D 100\%`},
+	}
+	data := map[string]interface{}{
+		"Name":   "R&D 100%",
+		"Markup": Raw(`\textbf{bold}`),
+		"Total":  "1234.50",
+		"Unit":   `\input{x}`,
+	}
+	for _, test := range tests {
+		tpl := template.Must(template.New("").Funcs(TemplateFuncs()).Parse(test.template))
+		autoEscapeTemplate(tpl)
+		var b strings.Builder
+		err := tpl.Execute(&b, data)
+		if err != nil {
+			t.Errorf("%s failed: %v", test.template, err)
+			continue
+		}
+		if b.String() != test.want {
+			t.Errorf("%s = %q, want %q", test.template, b.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package latex
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxEvidenceFileSize limits the size of the files included in evidence
+// bundles, larger ones like images are listed as skipped.
+const maxEvidenceFileSize = 16 << 20
+
+// versionTimeout bounds asking a tool for its version.
+const versionTimeout = 10 * time.Second
+
+// EvidenceError is returned by Build if it failed and an evidence bundle was
+// written, see SetEvidenceDir.
+type EvidenceError struct {
+	// Bundle is the path of the tarball.
+	Bundle string
+	Err    error
+}
+
+func (e *EvidenceError) Error() string {
+	return fmt.Sprintf("%v (evidence: %s)", e.Err, e.Bundle)
+}
+
+func (e *EvidenceError) Unwrap() error {
+	return e.Err
+}
+
+// EvidenceDir returns the directory evidence bundles are written to, empty
+// if none are written.
+func (t *CompileTask) EvidenceDir() string {
+	return t.evidenceDir
+}
+
+// SetEvidenceDir makes Build write an evidence bundle to dir if it fails,
+// so failures can be investigated without access to the machine compiling.
+// The failure is returned as *EvidenceError referencing the bundle then. Use
+// an empty dir to disable the bundles.
+func (t *CompileTask) SetEvidenceDir(dir string) {
+	t.evidenceDir = dir
+}
+
+// withEvidence writes an evidence bundle for the failure err of file if
+// evidence is enabled and returns the error to report.
+func (t *CompileTask) withEvidence(file string, err error) error {
+	if t.evidenceDir == "" || err == nil {
+		return err
+	}
+	bundle, bundleErr := t.writeEvidenceFile(file, err)
+	if bundleErr != nil {
+		return errors.Join(err, fmt.Errorf("writing evidence: %w", bundleErr))
+	}
+	return &EvidenceError{Bundle: bundle, Err: err}
+}
+
+func (t *CompileTask) writeEvidenceFile(file string, failure error) (string, error) {
+	err := os.MkdirAll(t.evidenceDir, 0700)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(t.evidenceDir, jobname(file)+"-evidence-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	err = t.WriteEvidence(f, failure)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// WriteEvidence writes a gzipped tarball describing the failure of a build
+// to w. It contains:
+//
+//   - error.txt: the failure including the output of a failed tool
+//   - commands.sh: the external tools run by the task, in order
+//   - versions.txt: the versions of these tools
+//   - sources/: the files of the compile directory, which are the rendered
+//     sources along with the logs of the tools
+//
+// The environment of the tools is not included, as it may hold secrets.
+func (t *CompileTask) WriteEvidence(w io.Writer, failure error) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	add := func(name, content string) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(tw, content)
+		return err
+	}
+
+	timeline := t.Timeline()
+	err := add("error.txt", evidenceErrorText(failure))
+	if err == nil {
+		err = add("commands.sh", evidenceScript(timeline))
+	}
+	if err == nil {
+		err = add("versions.txt", t.toolVersions(timeline))
+	}
+	if err == nil {
+		err = addEvidenceSources(tw, t.CompileDirInternal())
+	}
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// evidenceErrorText describes a failure with the output of failed tools.
+func evidenceErrorText(failure error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", failure)
+	var compileErr *CompileError
+	if errors.As(failure, &compileErr) {
+		fmt.Fprintf(&b, "\n--- output of %s\n%s\n--- stderr of %s\n%s", compileErr.Tool, compileErr.Output, compileErr.Tool, compileErr.Stderr)
+	}
+	return b.String()
+}
+
+// evidenceScript returns a shell script repeating the tools of a timeline.
+func evidenceScript(timeline []TimelineEvent) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# Tools run by go-latex in the order they finished, run from sources/.\n")
+	for _, event := range timeline {
+		if event.Category != "tool" {
+			continue
+		}
+		words := []string{shellQuote(event.Name)}
+		for _, arg := range event.Args {
+			words = append(words, shellQuote(arg))
+		}
+		b.WriteString(strings.Join(words, " "))
+		if event.Err != nil {
+			fmt.Fprintf(&b, " # failed: %s", strings.ReplaceAll(event.Err.Error(), "\n", " "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for POSIX shells if needed.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+.,:/@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// toolVersions returns the first line of "--version" of the tools of a
+// timeline.
+func (t *CompileTask) toolVersions(timeline []TimelineEvent) string {
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, event := range timeline {
+		if event.Category != "tool" || seen[event.Name] {
+			continue
+		}
+		seen[event.Name] = true
+		version := "unknown"
+		ctx, cancel := context.WithTimeout(t.Context(), versionTimeout)
+		c := t.withContext(ctx)
+		if command, err := c.command(event.Name, "--version"); err == nil {
+			result, err := c.execute(command, VerbosityNone)
+			if line, _, _ := strings.Cut(strings.TrimSpace(result.Output()), "\n"); err == nil && line != "" {
+				version = line
+			}
+		}
+		cancel()
+		fmt.Fprintf(&b, "%s: %s\n", event.Name, version)
+	}
+	return b.String()
+}
+
+// addEvidenceSources adds the regular files of dir to tw below sources/.
+func addEvidenceSources(tw *tar.Writer, dir string) error {
+	skipped := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxEvidenceFileSize {
+			skipped = append(skipped, filepath.ToSlash(rel))
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = "sources/" + filepath.ToSlash(rel)
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil || len(skipped) == 0 {
+		return err
+	}
+	content := "Files larger than the limit of evidence bundles:\n" + strings.Join(skipped, "\n") + "\n"
+	err = tw.WriteHeader(&tar.Header{Name: "skipped.txt", Mode: 0600, Size: int64(len(content)), ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(tw, content)
+	return err
+}
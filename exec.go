@@ -0,0 +1,239 @@
+package latex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// toolResult holds the captured output of an external tool run.
+type toolResult struct {
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// Output returns what the tool wrote to stdout.
+func (r *toolResult) Output() string {
+	return r.stdout.String()
+}
+
+// Error returns what the tool wrote to stderr.
+func (r *toolResult) Error() string {
+	return r.stderr.String()
+}
+
+// command prepares an external tool invocation inside the current working
+// directory of the task, applying the configured process restrictions.
+func (t *CompileTask) command(name string, args ...string) (*exec.Cmd, error) {
+	return t.commandIn(t.context().WorkingDir(), name, args...)
+}
+
+// commandIn prepares an external tool invocation inside workingDir.
+func (t *CompileTask) commandIn(workingDir, name string, args ...string) (*exec.Cmd, error) {
+	containerized := t.toolchain != nil && t.toolchain.containerized(name)
+	if t.toolchain != nil {
+		name, args = t.toolchain.resolve(name, args, containerRun{
+			workingDir: workingDir,
+			mounts:     []string{t.CompileDir(), os.TempDir()},
+			env:        t.containerEnvironment(),
+			user:       t.runAs,
+		})
+	}
+	if t.scheduling != nil {
+		var err error
+		name, args, err = t.scheduling.wrap(name, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.env != nil {
+		path, err := t.env.lookPath(name)
+		if err != nil {
+			return nil, err
+		}
+		name = path
+	}
+	cmd := exec.CommandContext(t.Context(), name, args...)
+	cmd.Cancel = func() error {
+		killProcessTree(cmd.Process)
+		return nil
+	}
+	cmd.Dir = workingDir
+	cmd.Env = t.environment()
+	if containerized {
+		// the container drops privileges, the runtime needs to reach its
+		// daemon
+		return cmd, nil
+	}
+	if err := t.applyCredentials(cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// lookPath returns the full path of the binary run for a tool, taking the
+// toolchain into account.
+func (t *CompileTask) lookPath(name string) (string, error) {
+	if t.toolchain != nil {
+		name, _ = t.toolchain.resolve(name, nil, containerRun{})
+	}
+	if t.env != nil {
+		return t.env.lookPath(name)
+	}
+	return findTool(name)
+}
+
+// hasCommand reports if a tool is available.
+func (t *CompileTask) hasCommand(name string) bool {
+	_, err := t.lookPath(name)
+	return err == nil
+}
+
+// CheckTools verifies that the given tools are available to the task, taking
+// a configured toolchain into account.
+func (t *CompileTask) CheckTools(names ...string) error {
+	var errs []error
+	for _, name := range names {
+		_, err := t.lookPath(name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// environment returns the environment external tools are run with.
+func (t *CompileTask) environment() []string {
+	env := os.Environ()
+	if t.env != nil {
+		env = t.env.environ()
+	}
+	return append(env, t.toolEnvironment()...)
+}
+
+// toolEnvironment returns the variables the task sets on top of the
+// environment of the tools.
+func (t *CompileTask) toolEnvironment() []string {
+	env := []string{}
+	if t.scheduling != nil {
+		env = append(env, t.scheduling.environment()...)
+	}
+	if t.runAs != nil {
+		// paranoid mode: TeX may only read and write files in the working
+		// directory (and its subdirectories) or its own installation tree
+		env = append(env, "openout_any=p", "openin_any=p")
+	}
+	return env
+}
+
+// containerEnvironment returns the names of the variables passed on to
+// containers: those of the Environment besides PATH and those set by the
+// task.
+func (t *CompileTask) containerEnvironment() []string {
+	names := []string{}
+	if t.env != nil {
+		for name := range t.env.Vars {
+			if name != "PATH" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, kv := range t.toolEnvironment() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// execute runs a prepared command. Depending on verbosity stdout and stderr
+// are passed through to the console, but they are always captured.
+func (t *CompileTask) execute(cmd *exec.Cmd, verbosity VerbosityLevel) (*toolResult, error) {
+	return t.executeTo(cmd, verbosity, nil)
+}
+
+// executeTo is like execute, but streams stdout to w instead of capturing it
+// if w is not nil. Use it for tools with large outputs.
+func (t *CompileTask) executeTo(cmd *exec.Cmd, verbosity VerbosityLevel, w io.Writer) (*toolResult, error) {
+	result := &toolResult{}
+	stdout := io.Writer(&result.stdout)
+	if w != nil {
+		stdout = w
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &result.stderr
+	switch verbosity {
+	case VerbosityNone:
+	case VerbosityMore:
+		fallthrough
+	case VerbosityAll:
+		cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &result.stderr)
+	case VerbosityDefault:
+		fallthrough
+	default:
+		cmd.Stderr = io.MultiWriter(os.Stderr, &result.stderr)
+	}
+	start := time.Now()
+	err := t.run(cmd)
+	t.recordEvent(TimelineEvent{
+		Name:     filepath.Base(cmd.Path),
+		Category: "tool",
+		Args:     cmd.Args[1:],
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	if cmd.ProcessState != nil {
+		accountingMu.Lock()
+		t.accounting().cpuTime += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+		accountingMu.Unlock()
+	}
+	return result, err
+}
+
+// CPUTime returns the CPU time consumed by all external tools run by this
+// task so far.
+func (t *CompileTask) CPUTime() time.Duration {
+	accountingMu.Lock()
+	defer accountingMu.Unlock()
+	return t.accounting().cpuTime
+}
+
+// run starts cmd, confined by the sandbox if there is one, and waits for it
+// to finish. If the context of the task is done, the cause is returned.
+func (t *CompileTask) run(cmd *exec.Cmd) error {
+	ctx := t.Context()
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	// a process group of its own lets cancellation and AbortAll kill the
+	// children of the tool, like gs spawned by TeX
+	setProcessGroup(cmd)
+	var err error
+	if t.sandbox != nil {
+		err = t.sandbox.start(cmd, append([]string{t.CompileDirInternal()}, t.parentDirs...))
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		return diagnoseExec(cmd.Path, err)
+	}
+	trackProcess(cmd.Process)
+	defer untrackProcess(cmd.Process)
+	err = cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fallbackMarker starts the font fallback setup injected into documents.
+const fallbackMarker = "% go-latex font fallback\n"
+
+// missingCharacterPattern matches the warnings about characters missing in
+// a font. LuaTeX adds the code point.
+var missingCharacterPattern = regexp.MustCompile(`^Missing character: There is no (\S+)(?: \(U\+[0-9A-Fa-f]+\))? in font (.*?)!?$`)
+
+// missingCharacter is a character missing in a font of a document.
+type missingCharacter struct {
+	character string
+	font      string
+}
+
+// missingCharacters returns the characters missing according to the
+// warnings, each once per font.
+func missingCharacters(warnings []Diagnostic) []missingCharacter {
+	missing := []missingCharacter{}
+	seen := map[missingCharacter]bool{}
+	for _, d := range warnings {
+		if d.Category != WarningMissingCharacter {
+			continue
+		}
+		match := missingCharacterPattern.FindStringSubmatch(d.Message)
+		if match == nil {
+			continue
+		}
+		c := missingCharacter{character: match[1], font: match[2]}
+		if !seen[c] {
+			seen[c] = true
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// FallbackFonts returns the fonts used for characters missing in the fonts
+// of documents.
+func (t *CompileTask) FallbackFonts() []string {
+	return t.fallbackFonts
+}
+
+// SetFallbackFonts makes Build run lualatex once more if characters are
+// missing in the fonts of the document, e.g. because user data is in an
+// unexpected script, with the given fonts set up as fallback:
+//
+//	task.SetFallbackFonts("Noto Sans CJK SC", "Noto Sans Arabic", "Noto Sans Symbols 2")
+//
+// The fonts are tried in order using the fallback feature of luaotfload,
+// for all fonts loaded using fontspec. Font names may carry luaotfload
+// features, like "Noto Sans Arabic:mode=harf". The characters typeset using
+// the fallback are reported as FallbackCharacters of the result, the ones
+// missing in all fonts remain warnings. Other engines have no fallbacks, so
+// missing characters are reported as warnings only. Call it without fonts to
+// disable fallbacks.
+func (t *CompileTask) SetFallbackFonts(fonts ...string) {
+	t.fallbackFonts = fonts
+}
+
+// fontFallbackSetup returns the TeX code setting up the fallback fonts.
+func (t *CompileTask) fontFallbackSetup() (string, error) {
+	fonts := make([]string, 0, len(t.fallbackFonts))
+	for _, font := range t.fallbackFonts {
+		if strings.ContainsAny(font, "\"\\{}%#\r\n") {
+			return "", fmt.Errorf("invalid fallback font %q", font)
+		}
+		if !strings.Contains(font, ":") {
+			font += ":mode=harf;"
+		}
+		fonts = append(fonts, `"`+font+`"`)
+	}
+	return fallbackMarker +
+		`\directlua{luaotfload.add_fallback("golatexfallback", {` + strings.Join(fonts, ", ") + `})}` + "\n" +
+		`\AddToHook{package/fontspec/after}{\defaultfontfeatures{RawFeature={fallback=golatexfallback}}}` + "\n", nil
+}
+
+// buildWithFallback reruns the engine with the fallback fonts set up if
+// the result of a build of file misses characters, see SetFallbackFonts.
+func (t *CompileTask) buildWithFallback(file string, result *CompileResult, clock *budgetClock, args ...string) (*CompileResult, error) {
+	if len(t.fallbackFonts) == 0 || t.Engine() != "lualatex" {
+		return result, nil
+	}
+	missing := missingCharacters(result.Warnings)
+	if len(missing) == 0 {
+		return result, nil
+	}
+	if !clock.allows(0) {
+		result.skip("fallback")
+		return result, nil
+	}
+	setup, err := t.fontFallbackSetup()
+	if err != nil {
+		return result, err
+	}
+	source := filepath.Join(t.CompileDirInternal(), file)
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return result, err
+	}
+	if strings.HasPrefix(string(content), fallbackMarker) {
+		return result, nil
+	}
+	err = os.WriteFile(source, append([]byte(setup), content...), 0644)
+	if err != nil {
+		return result, err
+	}
+
+	previous := result
+	result, err = t.runBudgeted(t.Engine(), file, clock, args...)
+	if result == nil {
+		return result, err
+	}
+	result.Passes += previous.Passes
+	result.AuxiliaryTools = previous.AuxiliaryTools
+	if previous.Degraded {
+		result.Degraded = true
+		result.Skipped = append(previous.Skipped, result.Skipped...)
+	}
+	remaining := map[string]bool{}
+	for _, c := range missingCharacters(result.Warnings) {
+		remaining[c.character] = true
+	}
+	for _, c := range missing {
+		if !remaining[c.character] && !contains(result.FallbackCharacters, c.character) {
+			result.FallbackCharacters = append(result.FallbackCharacters, c.character)
+		}
+	}
+	return result, err
+}
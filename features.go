@@ -0,0 +1,60 @@
+package latex
+
+import "sort"
+
+// Features enables optional parts of templates by name, like a terms page or
+// a draft watermark. Templates test them using the feature function:
+//
+//	{{ if feature "draftWatermark" }}...{{ end }}
+//
+// Unknown features are disabled.
+type Features map[string]bool
+
+// Enabled returns the names of the enabled features.
+func (f Features) Enabled() []string {
+	names := []string{}
+	for name, enabled := range f {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetFeature enables or disables a feature for the templates of this task.
+func (t *CompileTask) SetFeature(name string, enabled bool) {
+	if t.features == nil {
+		t.features = Features{}
+	}
+	t.features[name] = enabled
+}
+
+// SetFeatures sets the features of this task, replacing all set before. The
+// features are copied, so one set can be the base of several variants.
+func (t *CompileTask) SetFeatures(features Features) {
+	t.features = Features{}
+	for name, enabled := range features {
+		t.features[name] = enabled
+	}
+}
+
+// Feature reports whether a feature is enabled.
+func (t *CompileTask) Feature(name string) bool {
+	return t.features[name]
+}
+
+// Features returns a copy of the features of this task.
+func (t *CompileTask) Features() Features {
+	features := Features{}
+	for name, enabled := range t.features {
+		features[name] = enabled
+	}
+	return features
+}
+
+func (t *CompileTask) featureFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"feature": t.Feature,
+	}
+}
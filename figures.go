@@ -0,0 +1,365 @@
+package latex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// figureFormat is the name of the format file holding the shared
+	// preamble.
+	figureFormat = "go-latex-figures"
+	// figureJob is the name of the document typesetting a figure, which
+	// must not shadow the figures.
+	figureJob = "go-latex-figure"
+)
+
+// FigureFarm compiles a directory of small figures, like TikZ pictures, into
+// cropped PDFs or SVGs for inclusion in other systems, see Run.
+type FigureFarm struct {
+	// Engine is the TeX engine used, defaults to pdflatex.
+	Engine string
+	// ClassOptions are the options of the standalone class, "border=1pt" by
+	// default.
+	ClassOptions string
+	// Preamble is shared by all figures, e.g. to load TikZ and its
+	// libraries. Using pdflatex it is compiled once into a format file,
+	// which saves loading the packages for every figure.
+	Preamble string
+	// Workers is the number of figures compiled concurrently, the number of
+	// CPUs by default.
+	Workers int
+	// Cache, if set, stores the PDFs of figures, so only changed figures are
+	// compiled again.
+	Cache BuildCache
+	// Formats are the formats written, PDF by default.
+	Formats []OutputFormat
+}
+
+// FigureResult is the result of a figure compiled by a FigureFarm.
+type FigureResult struct {
+	// Name is the name of the figure file without extension.
+	Name string
+	// Files are the absolute paths of the files written.
+	Files []string
+	// Cached reports whether the PDF was taken from the cache.
+	Cached bool
+	Err    error
+}
+
+// NewFigureFarm returns a FigureFarm using pdflatex and TikZ.
+func NewFigureFarm() *FigureFarm {
+	return &FigureFarm{
+		Engine:   "pdflatex",
+		Preamble: `\usepackage{tikz}`,
+	}
+}
+
+// Run compiles the figures in sourceDir, which are its .tex files, and writes
+// them to outputDir named like the figures, e.g. plot.pdf and plot.svg. Pages
+// beyond the first get numbered files.
+//
+// Figures hold the body of a document, like a tikzpicture, typeset using the
+// standalone class and the shared preamble. Figures starting with
+// \documentclass are complete documents compiled on their own instead. Other
+// files in sourceDir, like data and images, can be used by all figures, a
+// change to them invalidates all cached figures.
+//
+// The results are sorted by name, all failures are returned joined. Figures
+// not started yet when ctx is done fail with its error, running ones are
+// killed.
+func (f *FigureFarm) Run(ctx context.Context, sourceDir, outputDir string) ([]FigureResult, error) {
+	sourceDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := figureNames(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "go-latex-figures-")
+	if err != nil {
+		return nil, err
+	}
+	trackDir(ctx, dir)
+	defer func() {
+		untrackDir(ctx, dir)
+		os.RemoveAll(dir)
+	}()
+
+	shared := ""
+	if f.Cache != nil {
+		shared, err = hashFigureInputs(sourceDir, names)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the format is dumped on the first cache miss only
+	var formatOnce sync.Once
+	var formatDir string
+	var formatErr error
+	format := func() (string, error) {
+		formatOnce.Do(func() {
+			formatDir, formatErr = f.dumpFormat(ctx, filepath.Join(dir, "format"))
+		})
+		return formatDir, formatErr
+	}
+
+	workers := f.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	results := make([]FigureResult, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = f.figure(ctx, sourceDir, outputDir, filepath.Join(dir, fmt.Sprint(i)), names[i], shared, format)
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	errs := []error{}
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// figureNames returns the names of the figures in dir, sorted.
+func figureNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".tex" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tex"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hashFigureInputs hashes the names and contents of all files below dir
+// except the figures.
+func hashFigureInputs(dir string, names []string) (string, error) {
+	figures := map[string]bool{}
+	for _, name := range names {
+		figures[filepath.Join(dir, name+".tex")] = true
+	}
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !figures[path] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, filepath.ToSlash(rel)+"\x00")
+		err = hashFile(h, file)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (f *FigureFarm) engine() string {
+	if f.Engine == "" {
+		return "pdflatex"
+	}
+	return f.Engine
+}
+
+func (f *FigureFarm) documentClass() string {
+	options := f.ClassOptions
+	if options == "" {
+		options = "border=1pt"
+	}
+	return fmt.Sprintf("\\documentclass[%s]{standalone}\n", options)
+}
+
+// dumpFormat compiles the class and the preamble into a format file in dir
+// and returns dir. Only pdflatex formats are created, as the fonts of the
+// other engines can't be dumped reliably, an empty dir is returned for them.
+func (f *FigureFarm) dumpFormat(ctx context.Context, dir string) (string, error) {
+	if f.engine() != "pdflatex" {
+		return "", nil
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	source := f.documentClass() + f.Preamble + "\n\\dump\n"
+	err = os.WriteFile(filepath.Join(dir, figureFormat+".tex"), []byte(source), 0600)
+	if err != nil {
+		return "", err
+	}
+	t := NewCompileTask()
+	t.SetContext(ctx)
+	t.context().SetWorkingDir(dir)
+	command, err := t.command("pdflatex", "-ini", "-interaction=nonstopmode", "-halt-on-error",
+		"-jobname="+figureFormat, "&pdflatex", figureFormat+".tex")
+	if err != nil {
+		return "", err
+	}
+	result, err := t.execute(command, VerbosityNone)
+	if err != nil {
+		return "", fmt.Errorf("dumping the preamble failed: %w\n%s", err, result.Output())
+	}
+	return dir, nil
+}
+
+// figure compiles a figure in dir and converts it into the formats.
+func (f *FigureFarm) figure(ctx context.Context, sourceDir, outputDir, dir, name, shared string, format func() (string, error)) FigureResult {
+	result := FigureResult{Name: name}
+	fail := func(err error) FigureResult {
+		result.Err = fmt.Errorf("figure %s: %w", name, err)
+		return result
+	}
+	err := context.Cause(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	body, err := os.ReadFile(filepath.Join(sourceDir, name+".tex"))
+	if err != nil {
+		return fail(err)
+	}
+	standalone := strings.HasPrefix(strings.TrimSpace(string(body)), `\documentclass`)
+
+	t := NewCompileTask()
+	t.SetContext(ctx)
+	t.SetCompileDir(dir)
+	work := t.CompileDirInternal()
+	err = os.MkdirAll(work, 0700)
+	if err != nil {
+		return fail(err)
+	}
+	t.context().SetWorkingDir(work)
+	pdf := filepath.Join(work, figureJob+".pdf")
+
+	key := ""
+	if f.Cache != nil {
+		h := sha256.New()
+		io.WriteString(h, strings.Join([]string{f.engine(), f.documentClass(), f.Preamble, shared}, "\x00")+"\x00")
+		h.Write(body)
+		key = hex.EncodeToString(h.Sum(nil))
+		result.Cached = t.fetchCached(f.Cache, key, pdf)
+	}
+	if !result.Cached {
+		err = f.compile(&t, sourceDir, name, standalone, format)
+		if err != nil {
+			return fail(err)
+		}
+		if f.Cache != nil {
+			err = f.Cache.Store(key, pdf)
+			if err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	formats := f.Formats
+	if len(formats) == 0 {
+		formats = []OutputFormat{PDF}
+	}
+	for _, outputFormat := range formats {
+		files, err := t.convert(pdf, outputFormat)
+		if err != nil {
+			return fail(err)
+		}
+		for _, file := range files {
+			target := strings.TrimPrefix(filepath.Base(file), figureJob)
+			if len(files) == 1 {
+				ext := filepath.Ext(target)
+				target = strings.TrimSuffix(strings.TrimSuffix(target, ext), "-1") + ext
+			}
+			target = filepath.Join(outputDir, name+target)
+			err = copyFile(file, target)
+			if err != nil {
+				return fail(err)
+			}
+			result.Files = append(result.Files, target)
+		}
+	}
+	return result
+}
+
+// compile typesets a figure in the working directory of t, finding the
+// figure and the other files in sourceDir using TEXINPUTS.
+func (f *FigureFarm) compile(t *CompileTask, sourceDir, name string, standalone bool, format func() (string, error)) error {
+	source := fmt.Sprintf("\\input{%s.tex}\n", name)
+	args := []string{"-interaction=nonstopmode", "-halt-on-error"}
+	env := []string{"TEXINPUTS=." + string(os.PathListSeparator) + sourceDir + string(os.PathListSeparator)}
+	if !standalone {
+		formatDir, err := format()
+		if err != nil {
+			return err
+		}
+		document := "\\begin{document}\n" + source + "\\end{document}\n"
+		if formatDir != "" {
+			args = append(args, "-fmt="+figureFormat)
+			env = append(env, "TEXFORMATS="+formatDir+string(os.PathListSeparator))
+		} else {
+			document = f.documentClass() + f.Preamble + "\n" + document
+		}
+		source = document
+	}
+	err := os.WriteFile(filepath.Join(t.CompileDirInternal(), figureJob+".tex"), []byte(source), 0600)
+	if err != nil {
+		return err
+	}
+	command, err := t.command(f.engine(), append(args, figureJob+".tex")...)
+	if err != nil {
+		return err
+	}
+	command.Env = append(command.Env, env...)
+	result, err := t.execute(command, VerbosityNone)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", f.engine(), err, result.Output())
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package latex
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateLayouts lists the layouts of dates given as strings to formatDate.
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// TemplateFuncs returns the template functions of this package not tied to
+// a task, for use with templates executed without one:
+//
+//	template.New("letter").Funcs(latex.TemplateFuncs())
+//
+// Templates of a task (see Template) have them as well.
+func TemplateFuncs() template.FuncMap {
+	funcs := template.FuncMap{}
+	sources := []map[string]interface{}{
+		decimalFuncs(),
+		textFuncs(),
+		tableFuncs(),
+		formatFuncs(),
+		escapeFuncs(),
+	}
+	for _, source := range sources {
+		for name, fn := range source {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// toTime converts a template value to a time. Strings are parsed as RFC 3339
+// date and time or as plain date like "2024-03-01".
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range dateLayouts {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", v)
+}
+
+// decimalString prints a decimal exactly, non-terminating fractions with 6
+// places.
+func decimalString(x *big.Rat) string {
+	places, exact := x.FloatPrec()
+	if !exact {
+		places = 6
+	}
+	return x.FloatString(places)
+}
+
+// textLines returns the lines of a value for lines, which is a string
+// holding line breaks or a list of values. Empty lines are skipped.
+func textLines(v interface{}) []string {
+	values := []string{}
+	switch v := v.(type) {
+	case nil:
+	case string:
+		values = strings.Split(strings.ReplaceAll(v, "\r\n", "\n"), "\n")
+	case []string:
+		values = v
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			values = []string{fmt.Sprint(v)}
+			break
+		}
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, fmt.Sprint(rv.Index(i).Interface()))
+		}
+	}
+	lines := []string{}
+	for _, line := range values {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// formatFuncs returns the template functions formatting values. Like
+// textFuncs they take plain text and return TeX as Raw:
+//
+//	{{ formatDate "2 January 2006" .Date }} formats a time.Time or a date
+//	string like "2024-03-01" using a Go time layout.
+//	{{ hyphenate .Product }} turns soft hyphens (U+00AD) into hyphenation
+//	points and allows breaks after hyphens of compound words.
+//	{{ lines .Address }} joins lines using \\, from a string or a list.
+//	{{ num .Weight }}, {{ qty .Weight "kg" }} and {{ unit "m" }} typeset
+//	numbers and units using siunitx (version 3). Numbers are taken exactly
+//	like by formatDecimal. Units are escaped unless they are Raw, so
+//	siunitx markup is passed as {{ qty .Weight (raw `\kilo\gram`) }}.
+func formatFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"formatDate": func(layout string, v interface{}) (Raw, error) {
+			date, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return Raw(escapeLatex(date.Format(layout))), nil
+		},
+		"hyphenate": func(s string) Raw {
+			s = escapeLatex(s)
+			return Raw(strings.NewReplacer("\u00ad", `\-`, "-", `-\hspace{0pt}`).Replace(s))
+		},
+		"lines": func(v interface{}) Raw {
+			lines := textLines(v)
+			for i, line := range lines {
+				lines[i] = escapeLatex(line)
+			}
+			return Raw(strings.Join(lines, `\\`+"\n"))
+		},
+		"num": func(v interface{}) (Raw, error) {
+			x, err := toDecimal(v)
+			if err != nil {
+				return "", err
+			}
+			return Raw(`\num{` + decimalString(x) + `}`), nil
+		},
+		"qty": func(v interface{}, unit interface{}) (Raw, error) {
+			x, err := toDecimal(v)
+			if err != nil {
+				return "", err
+			}
+			return Raw(`\qty{` + decimalString(x) + `}{` + escapeValue(unit) + `}`), nil
+		},
+		"unit": func(unit interface{}) Raw {
+			return Raw(`\unit{` + escapeValue(unit) + `}`)
+		},
+	}
+}
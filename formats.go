@@ -0,0 +1,225 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OutputFormat is a format compiled documents can be converted to.
+type OutputFormat struct {
+	// Name is one of "pdf", "png" or "svg".
+	Name string
+	// Resolution in DPI for raster formats.
+	Resolution int
+	// ICCProfile is the ICC profile of the color space of raster formats,
+	// like a display profile, Ghostscript's sRGB by default.
+	ICCProfile string
+	// ProofProfile is the ICC profile of the print condition simulated by
+	// raster formats, like a FOGRA39 press profile, so previews match the
+	// proof closely enough for approval. Overprinting is simulated as well.
+	ProofProfile string
+	// AntiAliasing is the number of bits of anti-aliasing of text and
+	// graphics in raster formats, 1 (none), 2 or 4 (the default if 0).
+	AntiAliasing int
+}
+
+// Predefined output formats, see PNG for other resolutions.
+var (
+	PDF       = OutputFormat{Name: "pdf"}
+	PNG150dpi = OutputFormat{Name: "png", Resolution: 150}
+	PNG300dpi = OutputFormat{Name: "png", Resolution: 300}
+	SVG       = OutputFormat{Name: "svg"}
+)
+
+// PNG returns the PNG output format with the given resolution.
+func PNG(resolution int) OutputFormat {
+	return OutputFormat{Name: "png", Resolution: resolution}
+}
+
+func (f OutputFormat) String() string {
+	name := f.Name
+	if f.Resolution > 0 {
+		name += fmt.Sprintf("%ddpi", f.Resolution)
+	}
+	if f.ProofProfile != "" {
+		name += "-proof"
+	}
+	return name
+}
+
+// rasterArgs returns the Ghostscript arguments rendering a raster format.
+func (f OutputFormat) rasterArgs() ([]string, error) {
+	bits := f.AntiAliasing
+	switch bits {
+	case 0:
+		bits = 4
+	case 1, 2, 4:
+	default:
+		return nil, fmt.Errorf("anti-aliasing with %d bits, expected 1, 2 or 4", bits)
+	}
+	args := []string{fmt.Sprintf("-dTextAlphaBits=%d", bits), fmt.Sprintf("-dGraphicsAlphaBits=%d", bits)}
+	// Ghostscript runs in the compile directory with -dSAFER, which denies
+	// reading the profiles unless permitted
+	if f.ICCProfile != "" {
+		profile, err := filepath.Abs(f.ICCProfile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--permit-file-read="+profile, "-sOutputICCProfile="+profile)
+	}
+	if f.ProofProfile != "" {
+		profile, err := filepath.Abs(f.ProofProfile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--permit-file-read="+profile, "-sProofProfile="+profile, "-dOverprint=/simulate")
+	}
+	return args, nil
+}
+
+// OutputFormats returns the formats requested for the compiled document.
+func (t *CompileTask) OutputFormats() []OutputFormat {
+	if len(t.outputFormats) == 0 {
+		return []OutputFormat{PDF}
+	}
+	return t.outputFormats
+}
+
+// SetOutputFormats sets the formats the compiled document is needed in, see
+// ConvertOutputs. Defaults to PDF only.
+func (t *CompileTask) SetOutputFormats(formats ...OutputFormat) {
+	t.outputFormats = formats
+}
+
+// ConvertOutputs converts the compiled PDF into all requested output formats.
+// The conversions are run in parallel after the single compilation. The
+// produced files (one per page for PNG and SVG) are stored next to the PDF
+// and returned per format.
+func (t *CompileTask) ConvertOutputs(file string) (map[OutputFormat][]string, error) {
+	file = t.pdfPath(file)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	outputs := make(map[OutputFormat][]string)
+	for _, format := range t.OutputFormats() {
+		wg.Add(1)
+		go func(format OutputFormat) {
+			defer wg.Done()
+			files, err := t.convert(file, format)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("converting to %s: %w", format, err)
+				}
+				return
+			}
+			outputs[format] = files
+		}(format)
+	}
+	wg.Wait()
+	return outputs, firstErr
+}
+
+func (t *CompileTask) convert(file string, format OutputFormat) ([]string, error) {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	switch format.Name {
+	case "pdf":
+		return []string{file}, nil
+	case "png":
+		resolution := format.Resolution
+		if resolution <= 0 {
+			resolution = 150
+		}
+		prefix := fmt.Sprintf("%s-%ddpi", base, resolution)
+		if format.ProofProfile != "" {
+			prefix += "-proof"
+		}
+		rasterArgs, err := format.rasterArgs()
+		if err != nil {
+			return nil, err
+		}
+		args := []string{"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=png16m", fmt.Sprintf("-r%d", resolution)}
+		args = append(args, rasterArgs...)
+		args = append(args, "-o", gsOutputPattern(prefix, ".png"), file)
+		_, err = t.runTool("gs", args...)
+		if err != nil {
+			return nil, err
+		}
+		return pageFiles(prefix, ".png")
+	case "svg":
+		// dvisvgm reads percent signs in the output name as placeholders
+		if t.hasCommand("dvisvgm") && !strings.Contains(base, "%") {
+			_, err := t.runTool("dvisvgm", "--pdf", "--page=1-", "--output="+base+"-%p.svg", file)
+			if err != nil {
+				return nil, err
+			}
+			return pageFiles(base, ".svg")
+		}
+		pageCount, err := t.PageCount(file)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{}
+		for page := 1; page <= pageCount; page++ {
+			output := fmt.Sprintf("%s-%d.svg", base, page)
+			_, err = t.runTool("pdftocairo", "-svg", "-f", fmt.Sprint(page), "-l", fmt.Sprint(page), file, output)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, output)
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("unsupported output format %s", format)
+}
+
+// pageFiles returns the files named prefix, a dash, the page number and ext
+// sorted by their page number. Unlike a glob, it is not confused by
+// wildcard characters in the prefix.
+func pageFiles(prefix, ext string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(prefix))
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(prefix) + "-"
+	files := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		page := strings.TrimSuffix(strings.TrimPrefix(name, base), ext)
+		if page == "" || strings.Trim(page, "0123456789") != "" {
+			continue
+		}
+		files = append(files, filepath.Join(filepath.Dir(prefix), name))
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return trailingNumber(files[i]) < trailingNumber(files[j])
+	})
+	return files, nil
+}
+
+// gsOutputPattern returns the output file pattern of Ghostscript for the
+// pages of prefix, escaping percent signs in the prefix.
+func gsOutputPattern(prefix, ext string) string {
+	return strings.ReplaceAll(prefix, "%", "%%") + "-%d" + ext
+}
+
+func trailingNumber(file string) int {
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	start := len(name)
+	for start > 0 && name[start-1] >= '0' && name[start-1] <= '9' {
+		start--
+	}
+	number := 0
+	fmt.Sscan(name[start:], &number)
+	return number
+}
@@ -0,0 +1,82 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGsOutputPattern(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"/tmp/out/page", "/tmp/out/page-%d.png"},
+		{"/tmp/my out/page", "/tmp/my out/page-%d.png"},
+		{"/tmp/100%/page", "/tmp/100%%/page-%d.png"},
+		{"/tmp/%d%s", "/tmp/%%d%%s-%d.png"},
+		{"/tmp/Übersicht", "/tmp/Übersicht-%d.png"},
+		{"/tmp/报告", "/tmp/报告-%d.png"},
+		{"/tmp/#{}~", "/tmp/#{}~-%d.png"},
+	}
+	for _, test := range tests {
+		if got := gsOutputPattern(test.prefix, ".png"); got != test.want {
+			t.Errorf("gsOutputPattern(%q) = %q, want %q", test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestPageFiles(t *testing.T) {
+	tests := []struct {
+		base  string
+		files []string
+		want  []string
+	}{
+		{
+			base:  "page",
+			files: []string{"page-1.png", "page-10.png", "page-2.png", "page.png", "page-x.png", "page-3.jpg", "other-1.png"},
+			want:  []string{"page-1.png", "page-2.png", "page-10.png"},
+		},
+		{
+			base:  "my page",
+			files: []string{"my page-2.png", "my page-1.png"},
+			want:  []string{"my page-1.png", "my page-2.png"},
+		},
+		{
+			base:  "Übersicht",
+			files: []string{"Übersicht-1.png", "Ubersicht-2.png"},
+			want:  []string{"Übersicht-1.png"},
+		},
+		{
+			base:  "报告",
+			files: []string{"报告-2.png", "报告-1.png", "报告-.png"},
+			want:  []string{"报告-1.png", "报告-2.png"},
+		},
+		{
+			base:  "100%#{}~",
+			files: []string{"100%#{}~-1.png", "100%#{}~-a.png"},
+			want:  []string{"100%#{}~-1.png"},
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, file := range test.files {
+			err := os.WriteFile(filepath.Join(dir, file), nil, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := pageFiles(filepath.Join(dir, test.base), ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{}
+		for _, file := range test.want {
+			want = append(want, filepath.Join(dir, file))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pageFiles(%q) = %q, want %q", test.base, got, want)
+		}
+	}
+}
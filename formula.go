@@ -0,0 +1,176 @@
+package latex
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FormulaRenderer renders single formulas into small, cropped PDFs using the
+// standalone class, e.g. for displaying equations in forums and wikis.
+type FormulaRenderer struct {
+	// Engine is the TeX engine used, defaults to pdflatex.
+	Engine string
+	// Preamble is inserted before \begin{document}, e.g. to load packages.
+	Preamble string
+	// Cache, if set, stores rendered formulas so repeated equations are
+	// returned without spawning TeX.
+	Cache *FormulaCache
+}
+
+// NewFormulaRenderer returns a FormulaRenderer using pdflatex and amsmath.
+func NewFormulaRenderer() *FormulaRenderer {
+	return &FormulaRenderer{
+		Engine:   "pdflatex",
+		Preamble: `\usepackage{amsmath,amssymb}`,
+	}
+}
+
+// Render typesets formula in display math mode and returns the resulting
+// PDF.
+func (r *FormulaRenderer) Render(formula string) ([]byte, error) {
+	key := r.cacheKey(formula)
+	if r.Cache != nil {
+		if pdf, ok := r.Cache.Get(key); ok {
+			return pdf, nil
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "go-latex-formula-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	source := fmt.Sprintf("\\documentclass[preview,border=1pt]{standalone}\n%s\n\\begin{document}\n$\\displaystyle %s$\n\\end{document}\n", r.Preamble, formula)
+	err = os.WriteFile(filepath.Join(dir, "formula.tex"), []byte(source), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewCompileTask()
+	t.SetSourceDir(dir)
+	t.SetCompileFilename("formula.tex")
+	t.context().SetWorkingDir(dir)
+	engine := r.Engine
+	if engine == "" {
+		engine = "pdflatex"
+	}
+	command, err := t.command(engine, "-interaction=nonstopmode", "-halt-on-error", "formula.tex")
+	if err != nil {
+		return nil, err
+	}
+	result, err := t.execute(command, VerbosityNone)
+	if err != nil {
+		return nil, fmt.Errorf("rendering formula failed: %w\n%s", err, result.Output())
+	}
+
+	pdf, err := os.ReadFile(filepath.Join(dir, "formula.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	if r.Cache != nil {
+		r.Cache.Put(key, pdf)
+	}
+	return pdf, nil
+}
+
+// cacheKey identifies a formula independent of insignificant whitespace.
+func (r *FormulaRenderer) cacheKey(formula string) string {
+	normalized := strings.Join([]string{
+		r.Engine,
+		strings.Join(strings.Fields(r.Preamble), " "),
+		strings.Join(strings.Fields(formula), " "),
+	}, "\x00")
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// FormulaCache is a least recently used cache of rendered formulas kept in
+// memory and optionally persisted to a directory.
+type FormulaCache struct {
+	mu       sync.Mutex
+	capacity int
+	dir      string
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type formulaCacheEntry struct {
+	key string
+	pdf []byte
+}
+
+// NewFormulaCache returns a FormulaCache holding up to capacity formulas in
+// memory. If dir is not empty, formulas are stored there as well, surviving
+// evictions and restarts.
+func NewFormulaCache(capacity int, dir string) (*FormulaCache, error) {
+	if dir != "" {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FormulaCache{
+		capacity: capacity,
+		dir:      dir,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}, nil
+}
+
+// Get returns the PDF cached for key.
+func (c *FormulaCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*formulaCacheEntry).pdf, true
+	}
+	if c.dir == "" {
+		return nil, false
+	}
+	pdf, err := os.ReadFile(filepath.Join(c.dir, key+".pdf"))
+	if err != nil {
+		return nil, false
+	}
+	c.add(key, pdf)
+	return pdf, true
+}
+
+// Put stores the PDF for key.
+func (c *FormulaCache) Put(key string, pdf []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*formulaCacheEntry).pdf = pdf
+		c.order.MoveToFront(element)
+	} else {
+		c.add(key, pdf)
+	}
+	if c.dir != "" {
+		// the disk cache is best effort only
+		os.WriteFile(filepath.Join(c.dir, key+".pdf"), pdf, 0600)
+	}
+}
+
+// Len returns the number of formulas held in memory.
+func (c *FormulaCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *FormulaCache) add(key string, pdf []byte) {
+	c.entries[key] = c.order.PushFront(&formulaCacheEntry{key: key, pdf: pdf})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*formulaCacheEntry).key)
+	}
+}
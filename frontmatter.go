@@ -0,0 +1,261 @@
+package latex
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxFrontMatterDepth bounds the nesting of \input files followed by
+// ParseFrontMatterFile.
+const maxFrontMatterDepth = 8
+
+// FrontMatter holds the metadata of a TeX document as found in its sources.
+// Values are TeX source with whitespace collapsed, they are not expanded.
+type FrontMatter struct {
+	Title  string
+	Author string
+	Date   string
+	// Macros holds macros defined without arguments, like
+	// \newcommand\docversion{1.2}, keyed by name without backslash.
+	Macros map[string]string
+	// Meta holds key-value comments of the leading comment block of the main
+	// file, like "% customer: ACME Corp".
+	Meta map[string]string
+}
+
+// Macro returns the definition of a macro, empty if it is not defined.
+func (f *FrontMatter) Macro(name string) string {
+	return f.Macros[strings.TrimPrefix(name, `\`)]
+}
+
+// ParseFrontMatter extracts the metadata from a TeX source without
+// compiling it. Included files are not followed.
+func ParseFrontMatter(r io.Reader) (*FrontMatter, error) {
+	f := newFrontMatter()
+	source, err := readFrontMatterSource(r, f)
+	if err != nil {
+		return nil, err
+	}
+	f.parse(source, nil)
+	return f, nil
+}
+
+// ParseFrontMatterFile is like ParseFrontMatter, but also follows files
+// loaded using \input or \include, as long as they are inside the directory
+// of file.
+func ParseFrontMatterFile(file string) (*FrontMatter, error) {
+	f := newFrontMatter()
+	err := f.parseFile(filepath.Dir(file), file, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// FrontMatter extracts the metadata of a TeX file of the source directory,
+// defaulting to the compile file.
+func (t *CompileTask) FrontMatter(file string) (*FrontMatter, error) {
+	file = t.defaultCompileFilename(file)
+	return ParseFrontMatterFile(filepath.Join(t.SourceDir(), file))
+}
+
+func newFrontMatter() *FrontMatter {
+	return &FrontMatter{
+		Macros: map[string]string{},
+		Meta:   map[string]string{},
+	}
+}
+
+func (f *FrontMatter) parseFile(root, file string, depth int) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	meta := f
+	if depth > 0 {
+		// only the main file has meta comments
+		meta = nil
+	}
+	source, err := readFrontMatterSource(r, meta)
+	if err != nil {
+		return err
+	}
+	f.parse(source, func(name string) {
+		name = texInputName(name)
+		if depth >= maxFrontMatterDepth || name == "" || escapesTree(name) {
+			return
+		}
+		if filepath.Ext(name) == "" {
+			name += ".tex"
+		}
+		// missing and unreadable inputs are ignored like optional files
+		f.parseFile(root, filepath.Join(root, filepath.FromSlash(name)), depth+1)
+	})
+	return nil
+}
+
+var frontMatterMeta = regexp.MustCompile(`^%+\s*([A-Za-z][\w.-]*)\s*:\s*(.*?)\s*$`)
+
+// readFrontMatterSource returns the source without comments. Key-value
+// comments of the leading comment block are recorded in f if it is not nil.
+func readFrontMatterSource(r io.Reader, f *FrontMatter) (string, error) {
+	var b strings.Builder
+	leading := true
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if leading && trimmed != "" && !strings.HasPrefix(trimmed, "%") {
+			leading = false
+		}
+		if leading && f != nil {
+			if m := frontMatterMeta.FindStringSubmatch(trimmed); m != nil {
+				f.Meta[m[1]] = m[2]
+			}
+		}
+		b.WriteString(stripTexComment(line))
+		b.WriteByte('\n')
+	}
+	return b.String(), scanner.Err()
+}
+
+// parse records the metadata commands of source in order, so later
+// definitions win like in TeX. input is called for included files.
+func (f *FrontMatter) parse(source string, input func(name string)) {
+	for i := 0; i < len(source); i++ {
+		if source[i] != '\\' {
+			continue
+		}
+		name, end := texCommandName(source, i)
+		if name == "" {
+			// escaped character
+			i++
+			continue
+		}
+		i = end - 1
+		switch name {
+		case "title", "author", "date":
+			pos := skipTexOptional(source, end)
+			value, groupEnd, ok := texGroup(source, pos)
+			if !ok {
+				continue
+			}
+			i = groupEnd - 1
+			value = collapseSpace(value)
+			switch name {
+			case "title":
+				f.Title = value
+			case "author":
+				f.Author = value
+			case "date":
+				f.Date = value
+			}
+		case "newcommand", "renewcommand", "providecommand", "DeclareRobustCommand", "def", "gdef", "edef", "xdef":
+			pos := skipTexSpace(source, end)
+			if pos < len(source) && source[pos] == '*' {
+				pos = skipTexSpace(source, pos+1)
+			}
+			var macro string
+			if group, groupEnd, ok := texGroup(source, pos); ok {
+				macro, pos = strings.TrimSpace(group), groupEnd
+			} else if pos < len(source) && source[pos] == '\\' {
+				var macroEnd int
+				macro, macroEnd = texCommandName(source, pos)
+				macro, pos = `\`+macro, macroEnd
+			}
+			if !strings.HasPrefix(macro, `\`) || len(macro) < 2 {
+				continue
+			}
+			pos = skipTexSpace(source, pos)
+			// macros with arguments are no metadata
+			value, groupEnd, ok := texGroup(source, pos)
+			if !ok {
+				continue
+			}
+			i = groupEnd - 1
+			if _, exists := f.Macros[macro[1:]]; exists && name == "providecommand" {
+				continue
+			}
+			f.Macros[macro[1:]] = collapseSpace(value)
+		case "input", "include":
+			if input == nil {
+				continue
+			}
+			pos := skipTexSpace(source, end)
+			if group, groupEnd, ok := texGroup(source, pos); ok {
+				i = groupEnd - 1
+				input(strings.TrimSpace(group))
+			} else if name == "input" {
+				// plain TeX syntax: \input file
+				groupEnd := pos
+				for groupEnd < len(source) && !strings.ContainsRune(" \t\n\\{}", rune(source[groupEnd])) {
+					groupEnd++
+				}
+				i = groupEnd - 1
+				input(source[pos:groupEnd])
+			}
+		}
+	}
+}
+
+// texCommandName returns the name of the control word starting with the
+// backslash at i and the position after it. The name is empty for control
+// symbols like \%.
+func texCommandName(s string, i int) (string, int) {
+	end := i + 1
+	for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' || s[end] == '@') {
+		end++
+	}
+	return s[i+1 : end], end
+}
+
+// texGroup returns the content of the brace group starting at i and the
+// position after it.
+func texGroup(s string, i int) (string, int, bool) {
+	if i >= len(s) || s[i] != '{' {
+		return "", i, false
+	}
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[i+1 : j], j + 1, true
+			}
+		}
+	}
+	return "", i, false
+}
+
+// skipTexOptional skips whitespace and an optional argument in brackets.
+func skipTexOptional(s string, i int) int {
+	i = skipTexSpace(s, i)
+	if i < len(s) && s[i] == '[' {
+		if end := strings.IndexByte(s[i:], ']'); end >= 0 {
+			i = skipTexSpace(s, i+end+1)
+		}
+	}
+	return i
+}
+
+func skipTexSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,45 @@
+package latex
+
+import (
+	"os"
+	"regexp"
+)
+
+// glossaryInputPattern matches the glossaries declared in .aux files as
+// \@newglossary{name}{log ext}{output ext}{input ext}.
+var glossaryInputPattern = regexp.MustCompile(`\\@newglossary\{[^}]*\}\{[^}]*\}\{[^}]*\}\{([^}]*)\}`)
+
+// glossaryFiles returns the glossary input files written by the engine for
+// a compiled file which exist in the compile directory, like its .glo and
+// .acn files.
+func (t *CompileTask) glossaryFiles(file string) []string {
+	exts := []string{"glo", "acn"}
+	if aux, err := os.ReadFile(t.auxFile(file, ".aux")); err == nil {
+		for _, m := range glossaryInputPattern.FindAllSubmatch(aux, -1) {
+			if ext := string(m[1]); !contains(exts, ext) {
+				exts = append(exts, ext)
+			}
+		}
+	}
+	files := []string{}
+	for _, ext := range exts {
+		glossary := t.auxFile(file, "."+ext)
+		if _, err := os.Stat(glossary); err == nil {
+			files = append(files, glossary)
+		}
+	}
+	return files
+}
+
+// Makeglossaries runs makeglossaries for a compiled file (defaulting to the
+// compile file) using the glossaries package, falling back to
+// makeglossaries-lite if Perl based makeglossaries is not available.
+// Failures are returned as *CompileError.
+func (t *CompileTask) Makeglossaries(file string, args ...string) error {
+	file = t.defaultCompileFilename(file)
+	tool := "makeglossaries"
+	if !t.hasCommand(tool) && t.hasCommand("makeglossaries-lite") {
+		tool = "makeglossaries-lite"
+	}
+	return t.compileStep(tool, file, tool, append(args, jobname(file))...)
+}
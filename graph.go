@@ -0,0 +1,219 @@
+package latex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GraphNode is a task of a build graph, see RunGraph.
+type GraphNode struct {
+	// Name identifies the node, e.g. "figures" or "chapter-1".
+	Name string
+	Task *CompileTask
+	// Build compiles the task, using Build of the task by default.
+	Build func(*CompileTask) error
+	// File is the output of the node, relative to the compilation directory
+	// of the task. Defaults to the PDF of the compiled file.
+	File string
+	// Inputs maps the names of the nodes this node depends on to the path
+	// their output is copied to, relative to the compilation directory of
+	// the task, e.g. "figures/plot.pdf".
+	Inputs map[string]string
+}
+
+// graphRun is the state of a node while running a graph.
+type graphRun struct {
+	node   GraphNode
+	done   chan struct{}
+	output string
+	err    error
+}
+
+// RunGraph builds the nodes in dependency order: a node is built after all
+// nodes it has as inputs, with their outputs copied into its compilation
+// directory. Independent nodes are built concurrently, at most one per CPU.
+//
+// For every node the sources of the task are copied to a new temporary
+// compilation directory (see CopyToCompileDir), which the caller should
+// clear using ClearCompileDir afterwards. RunGraph returns the absolute
+// paths of the outputs by node name. Nodes whose inputs failed are not
+// built, all failures are returned joined. Nodes not started yet when ctx is
+// done fail with its error, running ones are killed.
+func RunGraph(ctx context.Context, nodes ...GraphNode) (map[string]string, error) {
+	runs, err := graphRuns(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	semaphore := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *graphRun) {
+			defer wg.Done()
+			defer close(run.done)
+			run.err = run.wait(ctx, runs)
+			if run.err != nil {
+				return
+			}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				run.err = fmt.Errorf("node %s: %w", run.node.Name, context.Cause(ctx))
+				return
+			}
+			defer func() { <-semaphore }()
+			run.output, run.err = run.build(ctx, runs)
+		}(run)
+	}
+	wg.Wait()
+
+	outputs := map[string]string{}
+	errs := []error{}
+	for _, node := range nodes {
+		run := runs[node.Name]
+		if run.err != nil {
+			errs = append(errs, run.err)
+			continue
+		}
+		outputs[node.Name] = run.output
+	}
+	return outputs, errors.Join(errs...)
+}
+
+// graphRuns validates the nodes of a graph and returns their runs by name.
+func graphRuns(nodes []GraphNode) (map[string]*graphRun, error) {
+	runs := map[string]*graphRun{}
+	for _, node := range nodes {
+		switch {
+		case node.Name == "":
+			return nil, errors.New("graph node without name")
+		case runs[node.Name] != nil:
+			return nil, fmt.Errorf("duplicate graph node %s", node.Name)
+		case node.Task == nil:
+			return nil, fmt.Errorf("graph node %s has no task", node.Name)
+		}
+		runs[node.Name] = &graphRun{node: node, done: make(chan struct{})}
+	}
+	for _, node := range nodes {
+		for input := range node.Inputs {
+			if runs[input] == nil {
+				return nil, fmt.Errorf("graph node %s: unknown input %s", node.Name, input)
+			}
+		}
+	}
+
+	// detect cycles using a depth-first search
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("graph has a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, input := range sortedInputs(runs[name].node) {
+			err := visit(input, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, node := range nodes {
+		err := visit(node.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// wait waits for the inputs of the node, failing if one of them failed.
+func (r *graphRun) wait(ctx context.Context, runs map[string]*graphRun) error {
+	for _, input := range sortedInputs(r.node) {
+		dependency := runs[input]
+		select {
+		case <-dependency.done:
+		case <-ctx.Done():
+			return fmt.Errorf("node %s: %w", r.node.Name, context.Cause(ctx))
+		}
+		if dependency.err != nil {
+			return fmt.Errorf("node %s: input %s failed", r.node.Name, input)
+		}
+	}
+	return nil
+}
+
+// build prepares the compilation directory of the node and builds it,
+// returning the absolute path of its output.
+func (r *graphRun) build(ctx context.Context, runs map[string]*graphRun) (output string, err error) {
+	t := r.node.Task
+	defer func() {
+		// build functions may panic, e.g. using CopyToCompileDir
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("node %s: %v", r.node.Name, recovered)
+		}
+	}()
+	// the compile dir is set on the task, which the caller clears
+	err = t.ExtractToCompileDir("")
+	if err != nil {
+		return "", fmt.Errorf("node %s: %w", r.node.Name, err)
+	}
+	c := t.withContext(ctx)
+	err = func() error {
+		for _, input := range sortedInputs(r.node) {
+			target := filepath.Join(c.CompileDirInternal(), r.node.Inputs[input])
+			err := os.MkdirAll(filepath.Dir(target), 0755)
+			if err == nil {
+				err = copyFile(runs[input].output, target)
+			}
+			if err == nil {
+				err = c.grantAccess(target)
+			}
+			if err != nil {
+				return fmt.Errorf("input %s: %w", input, err)
+			}
+		}
+		if r.node.Build != nil {
+			return r.node.Build(c)
+		}
+		_, err := c.Build("")
+		return err
+	}()
+	if err != nil {
+		return "", fmt.Errorf("node %s: %w", r.node.Name, err)
+	}
+	output, err = filepath.Abs(t.pdfPath(r.node.File))
+	if err == nil {
+		_, err = os.Stat(output)
+	}
+	if err != nil {
+		return "", fmt.Errorf("node %s: %w", r.node.Name, err)
+	}
+	return output, nil
+}
+
+// sortedInputs returns the names of the inputs of a node, sorted.
+func sortedInputs(node GraphNode) []string {
+	names := make([]string, 0, len(node.Inputs))
+	for name := range node.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,171 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Bundle holds the boilerplate texts of templates per locale. Messages are
+// addressed by dotted IDs like "invoice.total", nested objects in bundle files
+// are flattened accordingly.
+type Bundle struct {
+	fallback string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// NewBundle returns an empty Bundle. Messages missing for a locale are looked
+// up in the fallback locale.
+func NewBundle(fallback string) *Bundle {
+	return &Bundle{
+		fallback: fallback,
+		messages: make(map[string]map[string]string),
+	}
+}
+
+// Add adds messages for a locale, replacing existing ones with the same ID.
+func (b *Bundle) Add(locale string, messages map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.messages[locale] == nil {
+		b.messages[locale] = make(map[string]string)
+	}
+	for id, message := range messages {
+		b.messages[locale][id] = message
+	}
+}
+
+// LoadFile adds the messages in a JSON or YAML file (by extension) for a
+// locale.
+func (b *Bundle) LoadFile(locale, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(data, &v)
+	case ".yaml", ".yml":
+		v, err = parseYAML(data)
+	default:
+		return fmt.Errorf("unsupported bundle format: %s", file)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	messages := make(map[string]string)
+	err = flattenMessages(messages, "", v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	b.Add(locale, messages)
+	return nil
+}
+
+// LoadDir adds the bundle files in dir, which are named after their locale
+// like de.yaml or en-US.json.
+func (b *Bundle) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !contains([]string{".json", ".yaml", ".yml"}, ext) {
+			continue
+		}
+		locale := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		err = b.LoadFile(locale, filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Locales returns the locales with messages.
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	locales := make([]string, 0, len(b.messages))
+	for locale := range b.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Translate returns the message with id for a locale. Regional locales like
+// de-AT fall back to their language, then to the fallback locale. If args are
+// given the message is used as a format string for them.
+func (b *Bundle) Translate(locale, id string, args ...interface{}) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, candidate := range b.localeChain(locale) {
+		message, ok := b.messages[candidate][id]
+		if !ok {
+			continue
+		}
+		if len(args) > 0 {
+			return fmt.Sprintf(message, args...), nil
+		}
+		return message, nil
+	}
+	return "", fmt.Errorf("no message %q for locale %s", id, locale)
+}
+
+func (b *Bundle) localeChain(locale string) []string {
+	chain := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		chain = append(chain, locale[:i])
+	}
+	if b.fallback != "" && !contains(chain, b.fallback) {
+		chain = append(chain, b.fallback)
+	}
+	return chain
+}
+
+func flattenMessages(messages map[string]string, prefix string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			id := key
+			if prefix != "" {
+				id = prefix + "." + key
+			}
+			err := flattenMessages(messages, id, value)
+			if err != nil {
+				return err
+			}
+		}
+	case string:
+		messages[prefix] = v
+	case nil:
+		return fmt.Errorf("message %q is empty", prefix)
+	case []interface{}:
+		return fmt.Errorf("message %q is a list", prefix)
+	default:
+		messages[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// SetLocale makes the messages of bundle for locale available in templates
+// using the t function, e.g. {{ t "invoice.total" }}. It must be called
+// before Template.
+func (t *CompileTask) SetLocale(bundle *Bundle, locale string) {
+	t.bundle = bundle
+	t.locale = locale
+}
+
+// Locale returns the locale used for templates.
+func (t *CompileTask) Locale() string {
+	return t.locale
+}
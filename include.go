@@ -0,0 +1,73 @@
+package latex
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeTex returns the contents of a file of the source tree for inlining
+// it at render time. name is relative to the source directory, paths leaving
+// it are rejected, also via symlinks. Without a source directory the file is
+// read from the compilation directory the sources were extracted to, or from
+// the source file system (see SetSourceFS). Templates use it as
+//
+//	{{ includeTex "snippets/terms.tex" }}
+//
+// It is not available in templates restricted by TemplateLimits.
+func (t *CompileTask) IncludeTex(name string) (string, error) {
+	if name == "" || escapesTree(name) {
+		return "", fmt.Errorf("%s: path outside of the source directory", name)
+	}
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case t.sourceDir != "":
+		data, err = readTreeFile(t.sourceDir, name)
+	case t.compileDir != "":
+		data, err = readTreeFile(t.CompileDirInternal(), name)
+	case t.sourceFS != nil:
+		data, err = fs.ReadFile(t.sourceFS, name)
+	default:
+		return "", fmt.Errorf("%s: no source directory or file system to include from", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readTreeFile reads a file by its relative name inside root, following
+// symlinks, and fails if the result is outside of it.
+func readTreeFile(root, name string) ([]byte, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	file, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s: path outside of the source directory", name)
+	}
+	return os.ReadFile(file)
+}
+
+func (t *CompileTask) includeFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"includeTex": func(name string) (Raw, error) {
+			tex, err := t.IncludeTex(name)
+			return Raw(tex), err
+		},
+	}
+}
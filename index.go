@@ -0,0 +1,73 @@
+package latex
+
+import "os"
+
+// IndexOptions controls the index processor turning the .idx file written
+// by the engine into the .ind file read by the next run.
+type IndexOptions struct {
+	// Tool is "makeindex" (default) or "xindy".
+	Tool string
+	// Style is the style file relative to the compile directory, a .ist
+	// file for makeindex or a .xdy module for xindy.
+	Style string
+	// Language is the sorting language of xindy, e.g. "german-din".
+	Language string
+	// Codepage is the input encoding of xindy, "utf8" if empty.
+	Codepage string
+	// Args are passed to the tool before the .idx file.
+	Args []string
+}
+
+// Makeindex runs makeindex on the .idx file of a compiled file (defaulting
+// to the compile file). Failures are returned as *CompileError.
+func (t *CompileTask) Makeindex(file string, options IndexOptions) error {
+	file = t.defaultCompileFilename(file)
+	args := []string{}
+	if options.Style != "" {
+		args = append(args, "-s", options.Style)
+	}
+	args = append(args, options.Args...)
+	return t.compileStep("makeindex", file, "makeindex", append(args, jobname(file)+".idx")...)
+}
+
+// Xindy runs xindy on the .idx file of a compiled file (defaulting to the
+// compile file). Failures are returned as *CompileError.
+func (t *CompileTask) Xindy(file string, options IndexOptions) error {
+	file = t.defaultCompileFilename(file)
+	codepage := options.Codepage
+	if codepage == "" {
+		codepage = "utf8"
+	}
+	args := []string{"-C", codepage}
+	if options.Style != "" {
+		args = append(args, "-M", options.Style)
+	}
+	if options.Language != "" {
+		args = append(args, "-L", options.Language)
+	}
+	args = append(args, options.Args...)
+	return t.compileStep("xindy", file, "xindy", append(args, jobname(file)+".idx")...)
+}
+
+// IndexOptions returns the options of the index processor run by Build.
+func (t *CompileTask) IndexOptions() IndexOptions {
+	return t.indexOptions
+}
+
+// SetIndexOptions sets the options of the index processor run by Build for
+// documents with an index.
+func (t *CompileTask) SetIndexOptions(options IndexOptions) {
+	t.indexOptions = options
+}
+
+// indexTool returns the index processor a compiled file needs, "makeindex"
+// or "xindy", or "" if it has no index.
+func (t *CompileTask) indexTool(file string) string {
+	if _, err := os.Stat(t.auxFile(file, ".idx")); err != nil {
+		return ""
+	}
+	if t.indexOptions.Tool == "xindy" {
+		return "xindy"
+	}
+	return "makeindex"
+}
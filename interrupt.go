@@ -0,0 +1,164 @@
+package latex
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// inflight tracks running external tools and compile directories so they can
+// be cleaned up on interrupts.
+var inflight = struct {
+	sync.Mutex
+	processes map[*os.Process]struct{}
+	dirs      map[string]struct{}
+}{
+	processes: make(map[*os.Process]struct{}),
+	dirs:      make(map[string]struct{}),
+}
+
+// HandleInterrupts installs a handler for SIGINT and SIGTERM which aborts all
+// running compilations, kills their child processes and removes compile
+// directories created by CopyToCompileDir before exiting. It is meant for
+// command line tools: external tools run in process groups of their own, so
+// the interrupts of the terminal don't reach them directly. Call the
+// returned function to uninstall the handler.
+func HandleInterrupts() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			AbortAll()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// AbortAll kills all running external tools including their children (on
+// Unix, where every tool is started in a process group of its own) and
+// removes all compile directories created by CopyToCompileDir which have not
+// been cleared yet.
+func AbortAll() {
+	inflight.Lock()
+	defer inflight.Unlock()
+	for p := range inflight.processes {
+		killProcessTree(p)
+	}
+	for dir := range inflight.dirs {
+		os.RemoveAll(dir)
+	}
+	inflight.dirs = make(map[string]struct{})
+}
+
+func trackProcess(p *os.Process) {
+	inflight.Lock()
+	defer inflight.Unlock()
+	inflight.processes[p] = struct{}{}
+}
+
+func untrackProcess(p *os.Process) {
+	inflight.Lock()
+	defer inflight.Unlock()
+	delete(inflight.processes, p)
+}
+
+// trackDir tracks a compile directory, globally and in the dirScopes of ctx
+// if any.
+func trackDir(ctx context.Context, dir string) {
+	inflight.Lock()
+	inflight.dirs[dir] = struct{}{}
+	inflight.Unlock()
+	scope, _ := ctx.Value(dirScopeKey{}).(*dirScope)
+	for ; scope != nil; scope = scope.parent {
+		scope.Lock()
+		scope.dirs[dir] = struct{}{}
+		scope.Unlock()
+	}
+}
+
+// untrackDir stops tracking a compile directory, which is about to be
+// removed.
+func untrackDir(ctx context.Context, dir string) {
+	inflight.Lock()
+	delete(inflight.dirs, dir)
+	inflight.Unlock()
+	scope, _ := ctx.Value(dirScopeKey{}).(*dirScope)
+	for ; scope != nil; scope = scope.parent {
+		scope.Lock()
+		_, tracked := scope.dirs[dir]
+		delete(scope.dirs, dir)
+		scope.Unlock()
+		if tracked && scope.removing != nil {
+			scope.removing(dir)
+		}
+	}
+}
+
+// dirScope collects the compile directories of the tasks run with a context,
+// like the jobs of a Queue, so they can be removed without affecting other
+// tasks of the process.
+type dirScope struct {
+	sync.Mutex
+	dirs map[string]struct{}
+	// parent is the scope of the context the scope was derived from, it
+	// tracks the directories as well
+	parent *dirScope
+	// removing is called with directories before they are removed, if set
+	removing func(dir string)
+}
+
+type dirScopeKey struct{}
+
+// withDirScope returns a context whose compile directories are tracked by
+// the returned scope, and by the scope of ctx if any.
+func withDirScope(ctx context.Context) (context.Context, *dirScope) {
+	scope := &dirScope{dirs: make(map[string]struct{})}
+	scope.parent, _ = ctx.Value(dirScopeKey{}).(*dirScope)
+	return context.WithValue(ctx, dirScopeKey{}, scope), scope
+}
+
+// snapshot returns the compile directories tracked by the scope.
+func (s *dirScope) snapshot() []string {
+	s.Lock()
+	defer s.Unlock()
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// removeAll removes the compile directories not cleared yet.
+func (s *dirScope) removeAll() {
+	s.Lock()
+	dirs := s.dirs
+	s.dirs = make(map[string]struct{})
+	s.Unlock()
+	for dir := range dirs {
+		untrackDir(context.Background(), dir)
+		for parent := s.parent; parent != nil; parent = parent.parent {
+			parent.Lock()
+			delete(parent.dirs, dir)
+			parent.Unlock()
+		}
+		os.RemoveAll(dir)
+	}
+}
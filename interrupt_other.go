@@ -0,0 +1,14 @@
+//go:build !unix
+
+package latex
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessTree(p *os.Process) {
+	p.Kill()
+}
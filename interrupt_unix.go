@@ -0,0 +1,24 @@
+//go:build unix
+
+package latex
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessTree kills the process group led by p, falling back to p alone.
+func killProcessTree(p *os.Process) {
+	err := syscall.Kill(-p.Pid, syscall.SIGKILL)
+	if err != nil {
+		p.Kill()
+	}
+}
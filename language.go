@@ -0,0 +1,199 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LanguageSystem is the LaTeX package used for language support.
+type LanguageSystem int
+
+const (
+	// Babel is the usual choice with pdflatex.
+	Babel LanguageSystem = iota
+	// Polyglossia is the usual choice with xelatex and lualatex.
+	Polyglossia
+)
+
+// LanguageAsset is a file of the TeX installation needed to typeset a
+// language.
+type LanguageAsset struct {
+	// Kind is one of "hyphenation", "babel" and "polyglossia".
+	Kind string
+	File string
+	// Package is the TeX Live package containing the file.
+	Package string
+}
+
+type languageSupport struct {
+	hyphenation string
+	babel       string
+	tlLanguage  string
+	collection  string
+}
+
+// languages maps babel and polyglossia language names to their files in TeX
+// Live.
+var languages = map[string]languageSupport{
+	"english":    {"hyph-en-gb.tex", "english.ldf", "english", "collection-langenglish"},
+	"german":     {"hyph-de-1996.tex", "german.ldf", "german", "collection-langgerman"},
+	"ngerman":    {"hyph-de-1996.tex", "ngerman.ldf", "german", "collection-langgerman"},
+	"french":     {"hyph-fr.tex", "french.ldf", "french", "collection-langfrench"},
+	"spanish":    {"hyph-es.tex", "spanish.ldf", "spanish", "collection-langspanish"},
+	"italian":    {"hyph-it.tex", "italian.ldf", "italian", "collection-langitalian"},
+	"portuguese": {"hyph-pt.tex", "portuguese.ldf", "portuguese", "collection-langportuguese"},
+	"dutch":      {"hyph-nl.tex", "dutch.ldf", "dutch", "collection-langeuropean"},
+	"swedish":    {"hyph-sv.tex", "swedish.ldf", "swedish", "collection-langeuropean"},
+	"danish":     {"hyph-da.tex", "danish.ldf", "danish", "collection-langeuropean"},
+	"finnish":    {"hyph-fi.tex", "finnish.ldf", "finnish", "collection-langeuropean"},
+	"norsk":      {"hyph-nb.tex", "norsk.ldf", "norwegian", "collection-langeuropean"},
+	"polish":     {"hyph-pl.tex", "polish.ldf", "polish", "collection-langpolish"},
+	"czech":      {"hyph-cs.tex", "czech.ldf", "czech", "collection-langczechslovak"},
+	"russian":    {"hyph-ru.tex", "russianb.ldf", "russian", "collection-langcyrillic"},
+	"greek":      {"hyph-el-monoton.tex", "greek.ldf", "greek", "collection-langgreek"},
+}
+
+// babelPackages lists babel packages not named after their language.
+var babelPackages = map[string]string{
+	"ngerman":    "babel-german",
+	"portuguese": "babel-portuges",
+	"norwegian":  "babel-norsk",
+}
+
+// MissingLanguageSupportError reports the files missing in the TeX
+// installation to typeset a language.
+type MissingLanguageSupportError struct {
+	Language string
+	Missing  []LanguageAsset
+	// Collections lists the tlmgr collections providing the missing files.
+	Collections []string
+}
+
+func (e *MissingLanguageSupportError) Error() string {
+	missing := make([]string, 0, len(e.Missing))
+	for _, asset := range e.Missing {
+		missing = append(missing, fmt.Sprintf("%s (%s, package %s)", asset.File, asset.Kind, asset.Package))
+	}
+	return fmt.Sprintf("language %s is not supported by the TeX installation, missing %s. Install it using: tlmgr install %s",
+		e.Language, strings.Join(missing, ", "), strings.Join(e.Collections, " "))
+}
+
+// LanguageAssets returns the files needed to typeset a language using the
+// given language system.
+func LanguageAssets(language string, system LanguageSystem) ([]LanguageAsset, error) {
+	support, ok := languages[language]
+	if !ok {
+		return nil, fmt.Errorf("unknown language %s", language)
+	}
+	assets := []LanguageAsset{{
+		Kind:    "hyphenation",
+		File:    support.hyphenation,
+		Package: "hyphen-" + support.tlLanguage,
+	}}
+	switch system {
+	case Babel:
+		pkg, ok := babelPackages[language]
+		if !ok {
+			pkg = "babel-" + support.tlLanguage
+		}
+		assets = append(assets, LanguageAsset{Kind: "babel", File: support.babel, Package: pkg})
+	case Polyglossia:
+		assets = append(assets, LanguageAsset{Kind: "polyglossia", File: "gloss-" + support.tlLanguage + ".ldf", Package: "polyglossia"})
+	}
+	return assets, nil
+}
+
+// VerifyLanguages checks that the hyphenation patterns and language files
+// for the given languages exist in the TeX installation. Missing files are
+// reported as *MissingLanguageSupportError, joined if several languages are
+// affected.
+func (t *CompileTask) VerifyLanguages(system LanguageSystem, languages ...string) error {
+	files := []string{}
+	assets := make(map[string][]LanguageAsset)
+	for _, language := range languages {
+		a, err := LanguageAssets(language, system)
+		if err != nil {
+			return err
+		}
+		assets[language] = a
+		for _, asset := range a {
+			files = append(files, asset.File)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	found, err := t.findTexFiles(files...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, language := range languages {
+		e := &MissingLanguageSupportError{Language: language}
+		for _, asset := range assets[language] {
+			if !found[asset.File] {
+				e.Missing = append(e.Missing, asset)
+			}
+		}
+		if len(e.Missing) == 0 {
+			continue
+		}
+		e.Collections = []string{languageCollection(language, e.Missing)}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// languageCollection returns the collection to install for missing assets,
+// polyglossia is part of collection-xetex instead of the language
+// collections.
+func languageCollection(language string, missing []LanguageAsset) string {
+	for _, asset := range missing {
+		if asset.Kind != "polyglossia" {
+			return languages[language].collection
+		}
+	}
+	return "collection-xetex"
+}
+
+// findTexFiles looks up files in the TeX installation using kpsewhich and
+// reports which of them exist.
+func (t *CompileTask) findTexFiles(files ...string) (map[string]bool, error) {
+	_, err := t.lookPath("kpsewhich")
+	if err != nil {
+		return nil, err
+	}
+	command, err := t.commandIn(t.CompileDirInternal(), "kpsewhich", files...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := t.execute(command, VerbosityNone)
+	// kpsewhich fails if any file is missing
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, line := range strings.Split(result.Output(), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			found[filepath.Base(line)] = true
+		}
+	}
+	return found, nil
+}
+
+// Languages returns the names of the languages known to VerifyLanguages.
+func Languages() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
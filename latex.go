@@ -1,13 +1,18 @@
 package latex
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/jojomi/go-script"
 )
@@ -17,10 +22,64 @@ import (
 type CompileTask struct {
 	scriptContext   *script.Context
 	sourceDir       string
+	sourceArchive   string
+	sourceFS        fs.FS
+	sourceLimits    *SourceLimits
 	compileDir      string
 	compileFilename string
 	resolveSymlinks bool
 	verbosity       VerbosityLevel
+	runAs           *Credentials
+	sandbox         *Sandbox
+	parentDirs      []string
+	cpuTime         time.Duration
+	timeline        []TimelineEvent
+	toolchain       *Toolchain
+	scheduling      *Scheduling
+	outputFormats   []OutputFormat
+	templateLimits  *TemplateLimits
+	templateSchema  *Schema
+	auditSink       AuditSink
+	auditActor      string
+	dataHash        string
+	templateVersion string
+	bundle          *Bundle
+	locale          string
+	signatures      []Signature
+	backgroundPdf   string
+	backgroundPages PageSelector
+	features        Features
+	budget          time.Duration
+	optimizers      []Optimizer
+	exitOnError     bool
+	env             *Environment
+	ctx             context.Context
+	accountTo       *CompileTask
+	engine          string
+	syncMetadata    bool
+	metadata        *PdfMetadata
+	pdfAProfile     string
+	watermark       *Stamp
+	encryption      *PdfEncryption
+	signing         *PdfSigning
+	signer          Signer
+	indexOptions    IndexOptions
+	fallbackFonts   []string
+	steps           []string
+	namingScheme    *NamingScheme
+	variant         string
+	version         string
+	autoInstall     bool
+	runner          EngineRunner
+	evidenceDir     string
+	strictWarnings  []WarningCategory
+	stats           *StatsStore
+	statsTemplate   string
+	remote          *RemoteCompiler
+	autoEscape      bool
+	templateDiff    bool
+	profiles        argProfiles
+	profile         string
 }
 
 type VerbosityLevel uint
@@ -32,7 +91,8 @@ const (
 	VerbosityAll
 )
 
-// NewCompileTask returns a default (empty) CompileTask
+// NewCompileTask returns a default (empty) CompileTask, see
+// NewValidCompileTask for configuring it using options.
 func NewCompileTask() CompileTask {
 	return CompileTask{
 		verbosity: VerbosityDefault,
@@ -73,10 +133,11 @@ func (t *CompileTask) SetSourceDir(sourceDir string) {
 }
 
 // CompileFilename returns the filename to be compiled.
-// Makes sure the filename is ending with .tex.
+// Makes sure the filename is ending with .tex, unless it has another TeX
+// extension like .ltx or .TEX.
 func (t *CompileTask) CompileFilename() string {
 	filename := t.compileFilename
-	if !strings.HasSuffix(filename, ".tex") {
+	if !isTexFile(filename) {
 		return filename + ".tex"
 	}
 	return filename
@@ -111,85 +172,103 @@ func (t *CompileTask) SetCompileDir(CompileDir string) {
 }
 
 // CopyToCompileDir copies the source files to the compilation directory.
+// With a source archive or file system set they are written from there
+// instead, see SetSourceArchive and SetSourceFS. It panics on failures, use
+// ExtractToCompileDir to handle them.
 func (t *CompileTask) CopyToCompileDir(CompileDir string) {
+	err := t.ExtractToCompileDir(CompileDir)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// copySourceDir copies the source directory to the compilation directory.
+func (t *CompileTask) copySourceDir(CompileDir string) error {
 	t.SetCompileDir(CompileDir)
+	if t.CompileDir() != t.SourceDir() {
+		trackDir(t.Context(), t.CompileDir())
+	}
 
 	os.RemoveAll(CompileDir)
 	os.MkdirAll(CompileDir, 0700)
 	sc := t.context()
 	err := sc.CopyDir(t.SourceDir(), t.CompileDirInternal())
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	if t.ResolveSymlinks() {
 		sc.ResolveSymlinks(t.CompileDirInternal())
 	}
+
+	return t.grantAccess(t.CompileDir())
+}
+
+// inTempCompileDir returns a copy of the task compiling in a new temporary
+// directory, so builds on the side don't change the compile directory of the
+// task. Call remove to remove the directory.
+func (t *CompileTask) inTempCompileDir(pattern string) (c *CompileTask, remove func(), err error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	c = t.withContext(t.Context())
+	// the script context holds the working directory
+	c.scriptContext = script.NewContext()
+	c.compileDir = dir
+	// tools may still work with the files of the task copied from
+	c.parentDirs = append(append([]string{}, t.parentDirs...), t.CompileDirInternal())
+	c.context().SetWorkingDir(c.CompileDirInternal())
+	trackDir(c.Context(), dir)
+	return c, func() {
+		untrackDir(c.Context(), dir)
+		os.RemoveAll(dir)
+	}, nil
 }
 
 // ClearCompileDir removes the compilation directory. Suitable to call using
 // defer after CopyToCompileDir. Be careful not to remove your source directory
 // when building there.
 func (t *CompileTask) ClearCompileDir() {
+	untrackDir(t.Context(), t.CompileDir())
 	err := os.RemoveAll(t.CompileDir())
 	if err != nil {
 		panic(err)
 	}
 }
 
-func (t *CompileTask) defaultCompileFilename(filename string) (file string) {
-	if file == "" {
-		file = t.CompileFilename()
+func (t *CompileTask) defaultCompileFilename(filename string) string {
+	if filename == "" {
+		return t.CompileFilename()
 	}
-	return
+	return filename
 }
 
 func (t *CompileTask) texFilenameToPdf(filename string) string {
-	return filename[0:len(filename)-4] + ".pdf"
+	return t.texFilenameToExt(filename, "pdf")
 }
 
-func (t *CompileTask) defaultCompilePdfFilename(filename string) (file string) {
-	file = t.defaultCompileFilename(filename)
-	// replace .tex by .pdf
-	file = t.texFilenameToPdf(file)
-	return
+func (t *CompileTask) texFilenameToExt(filename, ext string) string {
+	return replaceExt(filename, ext)
 }
 
-func (t *CompileTask) latextool(toolname, file string, args ...string) error {
-	sc := t.context()
-	file = t.defaultCompileFilename(file)
-	args = append(args, file)
-
-	//fmt.Println(sc.CommandPath("lualatex"))
-	sc.MustCommandExist(toolname)
-	var execFunction func(script.Command) (*script.ProcessResult, error)
-	switch t.verbosity {
-	case VerbosityNone:
-		execFunction = sc.ExecuteFullySilent
-	case VerbosityMore:
-		fallthrough
-	case VerbosityAll:
-		execFunction = sc.ExecuteDebug
-	case VerbosityDefault:
-		fallthrough
-	default:
-		execFunction = sc.ExecuteSilent
+// defaultCompilePdfFilename returns the PDF of a TeX file, the PDF of the
+// compile file if filename is empty. Other files are returned unchanged.
+func (t *CompileTask) defaultCompilePdfFilename(filename string) string {
+	file := t.defaultCompileFilename(filename)
+	if isTexFile(file) {
+		file = t.texFilenameToPdf(file)
 	}
+	return file
+}
 
-	command := &script.LocalCommand{}
-	command.Add(toolname)
-	command.AddAll(args...)
-	result, err := execFunction(command)
-	if err != nil {
-		fmt.Print(result.Output())
-		fmt.Print(result.Error())
-		os.Exit(1)
-	}
-	return nil
+func (t *CompileTask) latextool(toolname, file string, args ...string) error {
+	return t.RunEngine(engineFor(toolname), file, args...)
 }
 
 // Pdflatex calls pdflatex with the file and arguments supplied. For standard
-// invokation no arguments are needed.
+// invokation no arguments are needed. Failures are returned as
+// *CompileError.
 func (t *CompileTask) Pdflatex(file string, args ...string) error {
 	return t.latextool("pdflatex", file, args...)
 }
@@ -211,7 +290,8 @@ func (t *CompileTask) LillypondBook(latexToolname, file string, args ...string)
 	binName := "lilypond-book"
 	sc := t.context()
 	file = sc.AbsPath(t.defaultCompileFilename(file))
-	tempDir, err := t.context().TempDir()
+	// inside the compile dir, which sandboxed tools may write to
+	tempDir, err := os.MkdirTemp(t.CompileDirInternal(), ".go-latex-lilypond-")
 	if err != nil {
 		return err
 	}
@@ -219,13 +299,21 @@ func (t *CompileTask) LillypondBook(latexToolname, file string, args ...string)
 	args = append(args, fmt.Sprintf("--output=%s", tempDir))
 	args = append(args, file)
 	defer os.RemoveAll(tempDir)
+	err = t.grantAccess(tempDir)
+	if err != nil {
+		return err
+	}
 
-	sc.MustCommandExist(binName)
+	_, err = t.lookPath(binName)
+	if err != nil {
+		return err
+	}
 
-	command := &script.LocalCommand{}
-	command.Add(binName)
-	command.AddAll(args...)
-	_, err = sc.ExecuteFullySilent(command)
+	command, err := t.command(binName, args...)
+	if err != nil {
+		return err
+	}
+	_, err = t.execute(command, VerbosityNone)
 	if err != nil {
 		return err
 	}
@@ -240,7 +328,7 @@ func (t *CompileTask) LillypondBook(latexToolname, file string, args ...string)
 			return err
 		}
 		from := match
-		to := path.Join(t.CompileDirInternal(), filepath.Base(match))
+		to := filepath.Join(t.CompileDirInternal(), filepath.Base(match))
 		//fmt.Println(from, to)
 		if fi.IsDir() {
 			err := sc.CopyDir(from, to)
@@ -257,42 +345,41 @@ func (t *CompileTask) LillypondBook(latexToolname, file string, args ...string)
 	return nil
 }
 
+// OptimizeChannels lists the output types PDFs can be optimized for, see
+// Optimize.
+var OptimizeChannels = []string{"screen", "printer", "prepress", "ebook", "default"}
+
 // Optimize modifies a given PDF to reduce filesize for a certain output type.
-// Valid values for channel are "screen", "printer", "prepress", "ebook",
-// "default".
+// Valid values for channel are listed in OptimizeChannels. The first available optimizer is used, see SetOptimizers. If
+// there is none the file is left alone. Build runs it as the optional step
+// "optimize-<channel>", see SetSteps.
 func (t *CompileTask) Optimize(file string, channel string) error {
-	// minify pdf: http://tex.stackexchange.com/a/41273
-	// http://stackoverflow.com/a/27454451
-	// http://blog.rot13.org/2011/05/optimize-pdf-file-size-using-ghostscript.html
-	if !contains([]string{"screen", "printer", "prepress", "ebook", "default"}, channel) {
+	if !contains(OptimizeChannels, channel) {
 		// TODO err?
 		return nil
 	}
 
 	sc := t.context()
-	if !sc.CommandExists("gs") {
+	optimizer := t.Optimizer()
+	if optimizer == nil {
 		return nil
 	}
 
 	file = t.defaultCompilePdfFilename(file)
-	tempFile, err := sc.TempFile()
+	// inside the compile dir, which sandboxed tools may write to
+	tempFile, err := os.CreateTemp(t.CompileDirInternal(), ".go-latex-optimize-*.pdf")
 	if err != nil {
 		return err
 	}
-	params := []string{
-		"-sDEVICE=pdfwrite",
-		"-dCompatibilityLevel=1.4",
-		fmt.Sprintf("-dPDFSETTINGS=/%s", channel),
-		"-o",
-		tempFile.Name(),
-		file,
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+	err = t.grantAccess(tempFile.Name())
+	if err != nil {
+		return err
 	}
 	sc.SetWorkingDir(t.CompileDirInternal())
 
-	command := &script.LocalCommand{}
-	command.Add("gs")
-	command.AddAll(params...)
-	_, err = sc.ExecuteSilent(command)
+	err = optimizer.Optimize(t, file, tempFile.Name(), channel)
 	if err != nil {
 		return err
 	}
@@ -300,15 +387,62 @@ func (t *CompileTask) Optimize(file string, channel string) error {
 	return nil
 }
 
-// MoveToDest moves a file from compilation directory.
+// MoveToDest moves a file from compilation directory, defaulting to the PDF
+// of the compile file. If to is a directory, the file is named by the
+// naming scheme of the task. The background PDF and the watermark are
+// applied to PDF files before, and their metadata is stamped if set using
+// SetMetadata or synced if enabled using SetSyncMetadata, see StampMetadata.
+// Finally they are encrypted if set using SetEncryption or signed if set
+// using SetSigning.
 func (t *CompileTask) MoveToDest(from, to string) error {
 	from = t.defaultCompilePdfFilename(from)
-	from = path.Join(t.CompileDirInternal(), from)
-	to, err := filepath.Abs(to)
+	to, err := t.destination(from, to)
+	if err != nil {
+		return err
+	}
+	from = filepath.Join(t.CompileDirInternal(), from)
+	to, err = filepath.Abs(to)
 	if err != nil {
 		panic(err)
 	}
-	return t.context().MoveFile(from, to)
+	if strings.HasSuffix(from, ".pdf") {
+		err = t.ApplyBackground(from)
+		if err != nil {
+			return err
+		}
+		if t.watermark != nil {
+			err = t.Stamp(from, *t.watermark)
+			if err != nil {
+				return err
+			}
+		}
+		if t.metadata != nil || (t.syncMetadata && texFileFor(from) != "") {
+			err = t.StampMetadata(from)
+			if err != nil {
+				return err
+			}
+		}
+		if t.encryption != nil && t.signing != nil {
+			return errors.New("signed PDFs can't be encrypted")
+		}
+		if t.encryption != nil {
+			err = t.EncryptPdf(from, *t.encryption)
+			if err != nil {
+				return err
+			}
+		}
+		if t.signing != nil {
+			err = t.SignPdf(from, *t.signing)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = t.context().MoveFile(from, to)
+	if err != nil {
+		return err
+	}
+	return t.Audit(to)
 }
 
 // CompileDir returns the current compilation directory.
@@ -324,7 +458,7 @@ func (t *CompileTask) CompileDirInternal() string {
 	if t.CompileDir() == t.SourceDir() {
 		return t.CompileDir()
 	}
-	return path.Join(t.CompileDir(), "input")
+	return filepath.Join(t.CompileDir(), "input")
 }
 
 // ClearLatexTempFiles removes common temprary LaTeX files in a directory.
@@ -333,7 +467,7 @@ func (t *CompileTask) ClearLatexTempFiles(dir string) {
 	extensions := []string{"aux", "log", "toc", "nav", "ind", "ilg", "idx"}
 	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		for _, ext := range extensions {
-			if strings.HasSuffix(path, "."+ext) {
+			if strings.EqualFold(filepath.Ext(path), "."+ext) {
 				os.Remove(path)
 				return nil
 			}
@@ -346,14 +480,23 @@ func (t *CompileTask) ClearLatexTempFiles(dir string) {
 func (t *CompileTask) Template(baseFilename string) (*template.Template, string) {
 	sc := t.context()
 	baseFilename = sc.AbsPath(t.defaultCompileFilename(baseFilename))
-	templ := template.New("latex")
+	templ := template.New("latex").Funcs(t.templateFuncs())
 	return templ, baseFilename
 }
 
-// ExecuteTemplate executes a template on the source TeX files.
+// ExecuteTemplate executes a template on the source TeX files. See
+// SetTemplateDiff for keeping the template for review.
 func (t *CompileTask) ExecuteTemplate(templ *template.Template, data interface{}, inputFilename string, outputFilename string) error {
 	sc := t.context()
 
+	if t.templateSchema != nil {
+		err := t.templateSchema.Validate(data)
+		if err != nil {
+			return err
+		}
+	}
+	t.dataHash = jsonHash(data)
+
 	useTempFile := outputFilename == ""
 	if useTempFile {
 		tempFile, err := sc.TempFile()
@@ -363,14 +506,26 @@ func (t *CompileTask) ExecuteTemplate(templ *template.Template, data interface{}
 		outputFilename = tempFile.Name()
 	}
 	inputFilename = sc.AbsPath(t.defaultCompileFilename(inputFilename))
+	var source []byte
+	if t.templateDiff {
+		var err error
+		source, err = os.ReadFile(inputFilename)
+		if err != nil {
+			return err
+		}
+	}
 
 	f, err := os.Create(sc.AbsPath(outputFilename))
 	if err != nil {
 		return err
 	}
+	if t.autoEscape {
+		autoEscapeTemplate(templ)
+	}
 	w := io.Writer(f)
-	err = templ.ExecuteTemplate(w, filepath.Base(inputFilename), data)
+	err = t.executeLimited(templ, w, filepath.Base(inputFilename), data)
 	if err != nil {
+		f.Close()
 		return err
 	}
 	f.Close()
@@ -385,10 +540,39 @@ func (t *CompileTask) ExecuteTemplate(templ *template.Template, data interface{}
 		if err != nil {
 			return err
 		}
+		outputFilename = inputFilename
+	}
+	if t.templateDiff {
+		return writeTemplateDiff(source, sc.AbsPath(outputFilename))
 	}
 	return nil
 }
 
+// LoadTemplateData reads the data for a template from a JSON or YAML file (by
+// extension). JSON numbers are read as json.Number, so the decimal
+// functions of templates get them unrounded.
+func LoadTemplateData(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&v)
+	case ".yaml", ".yml":
+		v, err = parseYAML(data)
+	default:
+		return nil, fmt.Errorf("unsupported data format: %s", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return v, nil
+}
+
 // auxiliary
 func contains(s []string, e string) bool {
 	for _, a := range s {
@@ -0,0 +1,67 @@
+package latex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LatexmkOptions controls a latexmk run.
+type LatexmkOptions struct {
+	// ShellEscape allows the engine to run external commands.
+	ShellEscape bool
+	// Interaction is the interaction mode of the engine, "nonstopmode" if
+	// empty. Other modes are "batchmode", "scrollmode" and "errorstopmode".
+	Interaction string
+	// Args are passed to latexmk before the file.
+	Args []string
+}
+
+// Latexmk compiles a file (defaulting to the compile file) using latexmk,
+// which reruns the engine and tools like BibTeX or makeindex as often as
+// needed. The engine of the task is mapped to the matching latexmk mode,
+// other registered engines are run using latexmk's -pdflatex option.
+// Failures are returned as *CompileError.
+func (t *CompileTask) Latexmk(file string, options LatexmkOptions) error {
+	if isSinglePass(engineFor(t.Engine())) {
+		return fmt.Errorf("%s runs all passes itself and can't be driven by latexmk", t.Engine())
+	}
+	args := []string{}
+	switch engine := t.Engine(); engine {
+	case "pdflatex", "xelatex", "lualatex":
+		if registered, _ := LookupEngine(engine); isBuiltinEngine(registered) {
+			args = append(args, latexmkMode(engine))
+			break
+		}
+		fallthrough
+	default:
+		e := engineFor(engine)
+		command := append([]string{e.Command()}, e.Args("%S", []string{"%O"})...)
+		args = append(args, "-pdf", "-pdflatex="+strings.Join(command, " "))
+	}
+
+	interaction := options.Interaction
+	if interaction == "" {
+		interaction = "nonstopmode"
+	}
+	args = append(args, "-interaction="+interaction)
+	if options.ShellEscape {
+		args = append(args, "-shell-escape")
+	}
+	args = append(args, options.Args...)
+	return t.RunEngine(&CommandEngine{EngineName: "latexmk", DefaultArgs: args}, file)
+}
+
+// latexmkMode returns the latexmk option selecting a builtin engine.
+func latexmkMode(engine string) string {
+	if engine == "pdflatex" {
+		return "-pdf"
+	}
+	return "-" + engine
+}
+
+// isBuiltinEngine reports whether e is a builtin engine running the
+// executable of its name without further arguments.
+func isBuiltinEngine(e Engine) bool {
+	c, ok := e.(*CommandEngine)
+	return ok && c.Command() == c.Name() && len(c.DefaultArgs) == 0
+}
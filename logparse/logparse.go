@@ -0,0 +1,297 @@
+// Package logparse parses the log files written by TeX engines into typed
+// entries: errors, warnings, overfull and underfull boxes, missing files
+// and hints that another run is needed.
+//
+// The source file of an entry is derived from the parentheses TeX writes
+// when it opens and closes files, which is a heuristic: unbalanced
+// parentheses in messages can confuse it.
+package logparse
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a log entry.
+type Kind int
+
+const (
+	// Error is a TeX or LaTeX error, which usually stops the run.
+	Error Kind = iota
+	// Warning is a warning of LaTeX, a package or a class.
+	Warning
+	// BadBox is an overfull or underfull box.
+	BadBox
+	// MissingFile is a file TeX could not find. Its message is the file
+	// name.
+	MissingFile
+	// Rerun is a hint that another run is needed, e.g. to get
+	// cross-references right.
+	Rerun
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case BadBox:
+		return "badbox"
+	case MissingFile:
+		return "missing-file"
+	case Rerun:
+		return "rerun"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the kind as its name, e.g. for JSON.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Entry is a message of a log.
+type Entry struct {
+	Kind Kind `json:"kind"`
+	// File is the source file being processed, as written in the log. It
+	// may be empty.
+	File string `json:"file,omitempty"`
+	// Line is the source line, 0 if unknown.
+	Line int `json:"line,omitempty"`
+	// Package names the package or class issuing a warning.
+	Package string `json:"package,omitempty"`
+	Message string `json:"message"`
+}
+
+// Log is a parsed log.
+type Log struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Filter returns the entries of the given kind.
+func (l *Log) Filter(kind Kind) []Entry {
+	entries := []Entry{}
+	for _, e := range l.Entries {
+		if e.Kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Errors returns the errors of the log.
+func (l *Log) Errors() []Entry {
+	return l.Filter(Error)
+}
+
+// Warnings returns the warnings of the log, without bad boxes.
+func (l *Log) Warnings() []Entry {
+	return l.Filter(Warning)
+}
+
+// BadBoxes returns the overfull and underfull boxes of the log.
+func (l *Log) BadBoxes() []Entry {
+	return l.Filter(BadBox)
+}
+
+// MissingFiles returns the names of the files TeX could not find, without
+// duplicates.
+func (l *Log) MissingFiles() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, e := range l.Filter(MissingFile) {
+		if !seen[e.Message] {
+			seen[e.Message] = true
+			names = append(names, e.Message)
+		}
+	}
+	return names
+}
+
+// NeedsRerun reports whether the log asks for another run.
+func (l *Log) NeedsRerun() bool {
+	return len(l.Filter(Rerun)) > 0
+}
+
+// maxPrintLine is the width at which TeX wraps log lines by default.
+const maxPrintLine = 79
+
+var (
+	fileLineError  = regexp.MustCompile(`^(.+\.[A-Za-z]+):(\d+): (.*)$`)
+	warningLine    = regexp.MustCompile(`^(LaTeX|Package|Class)(?: (\S+))? Warning: (.*)$`)
+	inputLine      = regexp.MustCompile(`on input line (\d+)\.?`)
+	badBoxLine     = regexp.MustCompile(`^((?:Over|Under)full \\[hv]box .*?)(?: (?:in paragraph |in alignment )?at lines? (\d+)(?:--\d+)?)?$`)
+	missingPattern = []*regexp.Regexp{
+		regexp.MustCompile("File `([^']+)' not found"),
+		regexp.MustCompile("I can't find file `([^']+)'"),
+		regexp.MustCompile(`^No file (.+)\.$`),
+	}
+	rerunLine = regexp.MustCompile(`(?i)rerun to get|please rerun|please \(re\)run|rerun latex`)
+)
+
+// ParseLog parses a TeX log.
+func ParseLog(r io.Reader) (*Log, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{lines: lines}
+	p.parse()
+	return &Log{Entries: p.entries}, nil
+}
+
+// readLines reads the log, joining lines TeX wrapped at maxPrintLine.
+func readLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	wrapped := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if wrapped {
+			lines[len(lines)-1] += line
+		} else {
+			lines = append(lines, line)
+		}
+		wrapped = len(line) == maxPrintLine
+	}
+	return lines, scanner.Err()
+}
+
+type parser struct {
+	lines   []string
+	files   []string
+	entries []Entry
+}
+
+func (p *parser) file() string {
+	if len(p.files) == 0 {
+		return ""
+	}
+	return p.files[len(p.files)-1]
+}
+
+func (p *parser) add(e Entry) {
+	if e.File == "" {
+		e.File = p.file()
+	}
+	p.entries = append(p.entries, e)
+}
+
+func (p *parser) parse() {
+	for i := 0; i < len(p.lines); i++ {
+		line := p.lines[i]
+		switch {
+		case strings.HasPrefix(line, "! "):
+			e := Entry{Kind: Error, Message: strings.TrimSpace(line[2:])}
+			for _, next := range p.lines[i+1 : min(i+10, len(p.lines))] {
+				if strings.HasPrefix(next, "l.") {
+					number, _, _ := strings.Cut(next[2:], " ")
+					e.Line, _ = strconv.Atoi(number)
+					break
+				}
+			}
+			p.add(e)
+			p.missing(line)
+		case fileLineError.MatchString(line) && !strings.HasPrefix(line, "("):
+			m := fileLineError.FindStringSubmatch(line)
+			number, _ := strconv.Atoi(m[2])
+			p.add(Entry{Kind: Error, File: m[1], Line: number, Message: m[3]})
+			p.missing(line)
+		case warningLine.MatchString(line):
+			m := warningLine.FindStringSubmatch(line)
+			e := Entry{Kind: Warning, Message: m[3]}
+			if m[1] != "LaTeX" {
+				e.Package = m[2]
+			}
+			// continuation lines are indented, for packages prefixed by
+			// the package name in parentheses
+			for i+1 < len(p.lines) {
+				next := p.lines[i+1]
+				trimmed := strings.TrimSpace(next)
+				if e.Package != "" {
+					trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "("+e.Package+")"))
+				}
+				if trimmed == "" || !strings.HasPrefix(next, " ") && !strings.HasPrefix(next, "(") {
+					break
+				}
+				e.Message += " " + trimmed
+				i++
+			}
+			if m := inputLine.FindStringSubmatch(e.Message); m != nil {
+				e.Line, _ = strconv.Atoi(m[1])
+			}
+			p.add(e)
+			p.missing(e.Message)
+			if rerunLine.MatchString(e.Message) {
+				p.add(Entry{Kind: Rerun, Package: e.Package, Line: e.Line, Message: e.Message})
+			}
+		case strings.HasPrefix(line, "Missing character: "):
+			// written with \tracinglostchars > 0, the default of LaTeX
+			p.add(Entry{Kind: Warning, Message: strings.TrimSpace(line)})
+		case badBoxLine.MatchString(line):
+			m := badBoxLine.FindStringSubmatch(line)
+			e := Entry{Kind: BadBox, Message: m[1]}
+			e.Line, _ = strconv.Atoi(m[2])
+			p.add(e)
+		default:
+			p.missing(line)
+			if rerunLine.MatchString(line) {
+				p.add(Entry{Kind: Rerun, Message: strings.TrimSpace(line)})
+			}
+			p.trackFiles(line)
+		}
+	}
+}
+
+// missing records missing files mentioned in a message.
+func (p *parser) missing(message string) {
+	for _, pattern := range missingPattern {
+		if m := pattern.FindStringSubmatch(message); m != nil {
+			p.add(Entry{Kind: MissingFile, Message: m[1]})
+			return
+		}
+	}
+}
+
+// trackFiles follows the files opened and closed in a line. TeX writes
+// "(" followed by the path when opening a file and ")" when closing it.
+func (p *parser) trackFiles(line string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '(':
+			end := i + 1
+			for end < len(line) && !strings.ContainsRune(" ()[]{}\"", rune(line[end])) {
+				end++
+			}
+			name := line[i+1 : end]
+			if looksLikeFile(name) {
+				p.files = append(p.files, name)
+			} else {
+				// keep parentheses balanced
+				p.files = append(p.files, p.file())
+			}
+			i = end - 1
+		case ')':
+			if len(p.files) > 0 {
+				p.files = p.files[:len(p.files)-1]
+			}
+		}
+	}
+}
+
+// looksLikeFile reports whether a token after "(" is a file path.
+func looksLikeFile(name string) bool {
+	if name == "" {
+		return false
+	}
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "../") {
+		return true
+	}
+	dot := strings.LastIndexByte(name, '.')
+	return dot > 0 && dot < len(name)-1 && !strings.ContainsAny(name[dot+1:], ".,;:")
+}
@@ -0,0 +1,253 @@
+package latex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Quota limits the resources a tenant may use. CPU time is accumulated until
+// the usage of the tenant is reset, disk usage is the size of the compile
+// directories of the running builds, concurrency is checked per build. Zero
+// values mean unlimited.
+type Quota struct {
+	MaxConcurrent int
+	MaxCPUTime    time.Duration
+	MaxDiskUsage  int64
+}
+
+// TenantUsage holds the resources used by a tenant.
+type TenantUsage struct {
+	Running   int
+	Builds    int
+	CPUTime   time.Duration
+	DiskUsage int64
+}
+
+// QuotaError is returned if a build is rejected because a tenant exceeded its
+// quota.
+type QuotaError struct {
+	Tenant   string
+	Resource string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s exceeded its %s quota", e.Tenant, e.Resource)
+}
+
+// Manager runs builds on behalf of tenants, enforcing their quotas.
+type Manager struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	defaultQuota Quota
+	quotas       map[string]Quota
+	usage        map[string]*TenantUsage
+	queueing     bool
+}
+
+// NewManager returns a Manager applying defaultQuota to all tenants without
+// an explicit quota.
+func NewManager(defaultQuota Quota) *Manager {
+	m := &Manager{
+		defaultQuota: defaultQuota,
+		quotas:       make(map[string]Quota),
+		usage:        make(map[string]*TenantUsage),
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// SetQuota sets the quota of a single tenant.
+func (m *Manager) SetQuota(tenant string, quota Quota) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quotas[tenant] = quota
+	m.cond.Broadcast()
+}
+
+// SetQueueing determines if builds exceeding the concurrency limit of a tenant
+// wait for a free slot instead of being rejected.
+func (m *Manager) SetQueueing(queueing bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueing = queueing
+}
+
+// Usage returns the current resource usage of a tenant.
+func (m *Manager) Usage(tenant string) TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.tenantUsage(tenant)
+}
+
+// ResetUsage starts a new accounting period for a tenant, clearing the
+// accumulated CPU time.
+func (m *Manager) ResetUsage(tenant string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.tenantUsage(tenant)
+	usage.Builds = 0
+	usage.CPUTime = 0
+	m.cond.Broadcast()
+}
+
+// diskMeasureInterval is the interval the compile directories of running
+// builds are measured at.
+const diskMeasureInterval = time.Second
+
+// Run executes build on behalf of tenant, passing a copy of task which build
+// must use. The CPU time used by the task is accounted to the tenant. The
+// compile directories created by the copy count towards the disk usage of
+// the tenant with the size they had last, measured periodically and before
+// they are cleared, until build returns. Waiting for a free slot (see
+// SetQueueing) ends with the cause of the context of the task when it is
+// done.
+func (m *Manager) Run(tenant string, task *CompileTask, build func(*CompileTask) error) error {
+	err := m.acquire(task.Context(), tenant)
+	if err != nil {
+		return err
+	}
+	ctx, scope := withDirScope(task.Context())
+	meter := &diskMeter{manager: m, tenant: tenant, sizes: map[string]int64{}}
+	scope.removing = meter.measure
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(diskMeasureInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			for _, dir := range scope.snapshot() {
+				meter.measure(dir)
+			}
+		}
+	}()
+
+	cpuBefore := task.CPUTime()
+	defer func() {
+		close(stop)
+		<-stopped
+		for _, dir := range scope.snapshot() {
+			meter.measure(dir)
+		}
+		m.release(tenant, task.CPUTime()-cpuBefore, meter.total())
+	}()
+	return build(task.withContext(ctx))
+}
+
+// diskMeter charges the sizes of the compile directories of a build to the
+// disk usage of its tenant.
+type diskMeter struct {
+	manager *Manager
+	tenant  string
+	// sizes is guarded by the mutex of the manager
+	sizes map[string]int64
+}
+
+// measure updates the size of dir, keeping the last one if it can't be
+// determined.
+func (d *diskMeter) measure(dir string) {
+	size, err := dirSize(dir)
+	if err != nil {
+		return
+	}
+	d.manager.mu.Lock()
+	defer d.manager.mu.Unlock()
+	d.manager.tenantUsage(d.tenant).DiskUsage += size - d.sizes[dir]
+	d.sizes[dir] = size
+}
+
+// total returns the disk usage charged for the build.
+func (d *diskMeter) total() int64 {
+	d.manager.mu.Lock()
+	defer d.manager.mu.Unlock()
+	var total int64
+	for _, size := range d.sizes {
+		total += size
+	}
+	return total
+}
+
+func (m *Manager) acquire(ctx context.Context, tenant string) error {
+	// wake up waiting builds when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.cond.Broadcast()
+	})
+	defer stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		quota := m.quota(tenant)
+		usage := m.tenantUsage(tenant)
+		if quota.MaxCPUTime > 0 && usage.CPUTime >= quota.MaxCPUTime {
+			return &QuotaError{Tenant: tenant, Resource: "CPU time"}
+		}
+		if quota.MaxDiskUsage > 0 && usage.DiskUsage >= quota.MaxDiskUsage {
+			return &QuotaError{Tenant: tenant, Resource: "disk usage"}
+		}
+		if quota.MaxConcurrent <= 0 || usage.Running < quota.MaxConcurrent {
+			usage.Running++
+			return nil
+		}
+		if !m.queueing {
+			return &QuotaError{Tenant: tenant, Resource: "concurrency"}
+		}
+		m.cond.Wait()
+	}
+}
+
+func (m *Manager) release(tenant string, cpuTime time.Duration, diskUsage int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.tenantUsage(tenant)
+	usage.Running--
+	usage.Builds++
+	usage.CPUTime += cpuTime
+	usage.DiskUsage -= diskUsage
+	m.cond.Broadcast()
+}
+
+func (m *Manager) quota(tenant string) Quota {
+	if quota, ok := m.quotas[tenant]; ok {
+		return quota
+	}
+	return m.defaultQuota
+}
+
+func (m *Manager) tenantUsage(tenant string) *TenantUsage {
+	usage, ok := m.usage[tenant]
+	if !ok {
+		usage = &TenantUsage{}
+		m.usage[tenant] = usage
+	}
+	return usage
+}
+
+// dirSize returns the accumulated size of all files in a directory tree.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
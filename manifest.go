@@ -0,0 +1,229 @@
+package latex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Manifest declares the build of a document, so the configuration can be
+// kept next to the TeX sources, see LoadTask. Relative paths are relative
+// to the directory of the manifest.
+type Manifest struct {
+	// Source is the source directory, the directory of the manifest by
+	// default.
+	Source string `json:"source"`
+	// File is the TeX file compiled, relative to the source directory.
+	File   string `json:"file"`
+	Engine string `json:"engine"`
+	// Profile is the argument profile of the engine, see SetArgProfile.
+	Profile string `json:"profile"`
+	// CompileDir is the compile directory, a temporary one by default.
+	CompileDir string `json:"compileDir"`
+	// Data is a JSON or YAML file with the data File is rendered with as
+	// template before compiling. Without data File is compiled as is.
+	Data string `json:"data"`
+	// AutoEscape escapes the data inserted by the template, see
+	// SetAutoEscape.
+	AutoEscape bool `json:"autoEscape"`
+	// TemplateDiff keeps the template and its diff to the rendered TeX in
+	// the compile directory, see SetTemplateDiff.
+	TemplateDiff bool     `json:"templateDiff"`
+	Features     []string `json:"features"`
+	// Steps are run by Build after compiling, see SetSteps.
+	Steps            []string          `json:"steps"`
+	WarningsAsErrors []WarningCategory `json:"warningsAsErrors"`
+	// Optimize is the channel the PDF is optimized for, see Optimize.
+	Optimize string `json:"optimize"`
+	// Budget limits the time of the passes, like "2m", see SetBudget.
+	Budget  string `json:"budget"`
+	Variant string `json:"variant"`
+	Version string `json:"version"`
+	// Metadata is stamped on the PDF when it is moved to its destination,
+	// see SetMetadata. Keys are matched case-insensitively, like "title" or
+	// "authors".
+	Metadata *PdfMetadata `json:"metadata"`
+	// Destination is the file or directory (ending in a slash) the PDF is
+	// moved to, see MoveToDest. Without destination the PDF is left in the
+	// compile directory.
+	Destination string `json:"destination"`
+}
+
+// LoadManifest reads a manifest from a JSON or YAML file (by extension).
+// Unknown fields are errors.
+func LoadManifest(file string) (*Manifest, error) {
+	m := &Manifest{}
+	err := decodeConfigFile(file, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadTask constructs a task from the manifest in file (see Manifest) and
+// returns it with the passes building the document: copying the sources to
+// the compile directory, rendering the template, building, optimizing
+// (optional, so it is skipped if the budget is exhausted) and moving the
+// PDF to its destination. Run them using RunPasses and clear the compile
+// directory afterwards:
+//
+//	task, passes, err := latex.LoadTask("doc/build.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	defer task.ClearCompileDir()
+//	_, err = task.RunPasses(passes...)
+func LoadTask(file string) (*CompileTask, []Pass, error) {
+	m, err := LoadManifest(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	task, passes, err := m.Task(filepath.Dir(file))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return task, passes, nil
+}
+
+// Task constructs a task from the manifest like LoadTask, resolving
+// relative paths against dir.
+func (m *Manifest) Task(dir string) (*CompileTask, []Pass, error) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	source := resolve(m.Source)
+	if source == "" {
+		source = dir
+	}
+	opts := []Option{WithSourceDir(source), WithVerbosity(VerbosityNone)}
+	if m.File != "" {
+		opts = append(opts, WithCompileFilename(m.File))
+	}
+	if m.Engine != "" {
+		opts = append(opts, WithEngine(m.Engine))
+	}
+	task, err := NewValidCompileTask(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = task.SetArgProfile(m.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = task.SetSteps(m.Steps...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, category := range m.WarningsAsErrors {
+		if !slices.Contains(WarningCategories(), category) {
+			return nil, nil, fmt.Errorf("unknown warning category %q", category)
+		}
+	}
+	task.SetWarningsAsErrors(m.WarningsAsErrors...)
+	for _, feature := range m.Features {
+		task.SetFeature(feature, true)
+	}
+	task.SetAutoEscape(m.AutoEscape)
+	task.SetTemplateDiff(m.TemplateDiff)
+	task.SetVariant(m.Variant)
+	task.SetVersion(m.Version)
+	task.SetMetadata(m.Metadata)
+	if m.Budget != "" {
+		budget, err := time.ParseDuration(m.Budget)
+		if err != nil {
+			return nil, nil, fmt.Errorf("budget: %w", err)
+		}
+		task.SetBudget(budget)
+	}
+	if m.Optimize != "" && !contains(OptimizeChannels, m.Optimize) {
+		return nil, nil, fmt.Errorf("unknown optimization channel %q", m.Optimize)
+	}
+
+	passes := []Pass{{
+		Name: "copy",
+		Run: func(t *CompileTask) error {
+			return t.ExtractToCompileDir(resolve(m.CompileDir))
+		},
+	}}
+	if m.Data != "" {
+		data := resolve(m.Data)
+		passes = append(passes, Pass{
+			Name: "render",
+			Run: func(t *CompileTask) error {
+				v, err := LoadTemplateData(data)
+				if err != nil {
+					return err
+				}
+				templ, file := t.Template("")
+				templ, err = templ.ParseFiles(file)
+				if err != nil {
+					return err
+				}
+				return t.ExecuteTemplate(templ, v, "", "")
+			},
+		})
+	}
+	passes = append(passes, Pass{
+		Name: "build",
+		Run: func(t *CompileTask) error {
+			_, err := t.Build("")
+			return err
+		},
+	})
+	if m.Optimize != "" {
+		passes = append(passes, Pass{
+			Name:     "optimize",
+			Optional: true,
+			Run: func(t *CompileTask) error {
+				return t.Optimize("", m.Optimize)
+			},
+		})
+	}
+	if m.Destination != "" {
+		destination := resolve(m.Destination)
+		if strings.HasSuffix(m.Destination, "/") {
+			// directory, named by the naming scheme
+			destination += string(filepath.Separator)
+		}
+		passes = append(passes, Pass{
+			Name: "move",
+			Run: func(t *CompileTask) error {
+				err := os.MkdirAll(filepath.Dir(destination), 0755)
+				if err != nil {
+					return err
+				}
+				return t.MoveToDest("", destination)
+			},
+		})
+	}
+	return task, passes, nil
+}
+
+// decodeConfigFile decodes a JSON or YAML file (by extension) into v,
+// failing on unknown fields.
+func decodeConfigFile(file string, v interface{}) error {
+	data, err := LoadTemplateData(file)
+	if err != nil {
+		return err
+	}
+	// YAML is decoded into generic values, which are converted by way of
+	// JSON
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SourceLimits restricts the materialization of sources from archives and
+// file systems (see SetSourceArchive and SetSourceFS), for projects uploaded
+// by untrusted users. Zero values use the defaults.
+type SourceLimits struct {
+	// MaxFiles bounds the number of files and directories, 5000 by default.
+	MaxFiles int
+	// MaxSize bounds the size of all files in bytes, 256 MiB by default.
+	MaxSize int64
+	// MaxFileSize bounds the size of a file in bytes, 64 MiB by default.
+	MaxFileSize int64
+}
+
+// defaultSourceLimits are used for unset SourceLimits.
+var defaultSourceLimits = SourceLimits{
+	MaxFiles:    5000,
+	MaxSize:     256 << 20,
+	MaxFileSize: 64 << 20,
+}
+
+// ErrSourceLimitExceeded matches SourceViolations (using errors.Is) if
+// sources exceeded the configured SourceLimits.
+var ErrSourceLimitExceeded = errors.New("source limit exceeded")
+
+// withDefaults returns the limits with the defaults for unset values.
+func (l *SourceLimits) withDefaults() SourceLimits {
+	limits := defaultSourceLimits
+	if l == nil {
+		return limits
+	}
+	if l.MaxFiles > 0 {
+		limits.MaxFiles = l.MaxFiles
+	}
+	if l.MaxSize > 0 {
+		limits.MaxSize = l.MaxSize
+	}
+	if l.MaxFileSize > 0 {
+		limits.MaxFileSize = l.MaxFileSize
+	}
+	return limits
+}
+
+// SourceLimits returns the restrictions sources are materialized with, nil
+// for the defaults.
+func (t *CompileTask) SourceLimits() *SourceLimits {
+	return t.sourceLimits
+}
+
+// SetSourceLimits restricts the materialization of sources. Use nil for the
+// defaults.
+func (t *CompileTask) SetSourceLimits(limits *SourceLimits) {
+	t.sourceLimits = limits
+}
+
+// ViolationKind classifies a SourceViolation.
+type ViolationKind string
+
+// Kinds of SourceViolation.
+const (
+	// ViolationUnsafePath is an absolute path or one leaving the compile
+	// directory using "..".
+	ViolationUnsafePath ViolationKind = "unsafe-path"
+	// ViolationFileCount exceeds SourceLimits.MaxFiles, counting files
+	// and directories.
+	ViolationFileCount ViolationKind = "file-count"
+	// ViolationFileSize exceeds SourceLimits.MaxFileSize.
+	ViolationFileSize ViolationKind = "file-size"
+	// ViolationTotalSize exceeds SourceLimits.MaxSize.
+	ViolationTotalSize ViolationKind = "total-size"
+)
+
+// SourceViolation describes a file rejected when materializing sources.
+type SourceViolation struct {
+	// Path is the path of the file as given by the sources.
+	Path string
+	Kind ViolationKind
+	// Limit is the limit exceeded, 0 for unsafe paths.
+	Limit int64
+}
+
+func (v SourceViolation) Error() string {
+	switch v.Kind {
+	case ViolationUnsafePath:
+		return fmt.Sprintf("%s: unsafe path", v.Path)
+	case ViolationFileCount:
+		return fmt.Sprintf("%s: more than %d files and directories", v.Path, v.Limit)
+	case ViolationFileSize:
+		return fmt.Sprintf("%s: larger than %d bytes", v.Path, v.Limit)
+	case ViolationTotalSize:
+		return fmt.Sprintf("%s: more than %d bytes in total", v.Path, v.Limit)
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Kind)
+}
+
+// SourceViolations lists the violations found when materializing sources.
+// Files with unsafe paths are skipped and all of them are reported, while
+// materializing stops at the first file exceeding a limit.
+type SourceViolations []SourceViolation
+
+func (e SourceViolations) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, violation := range e {
+		messages = append(messages, violation.Error())
+	}
+	return "rejected sources: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether a limit was exceeded for ErrSourceLimitExceeded.
+func (e SourceViolations) Is(target error) bool {
+	if target != ErrSourceLimitExceeded {
+		return false
+	}
+	for _, violation := range e {
+		if violation.Kind != ViolationUnsafePath {
+			return true
+		}
+	}
+	return false
+}
+
+// materializer writes source files to a directory within limits, collecting
+// the violations.
+type materializer struct {
+	dir        string
+	limits     SourceLimits
+	entries    int
+	dirs       map[string]bool
+	size       int64
+	violations SourceViolations
+}
+
+func newMaterializer(dir string, limits *SourceLimits) *materializer {
+	return &materializer{
+		dir:    dir,
+		limits: limits.withDefaults(),
+		dirs:   make(map[string]bool),
+	}
+}
+
+// target returns the path a file is written to. Unsafe paths are recorded
+// as violation and reported as not ok.
+func (m *materializer) target(name string) (string, bool) {
+	local := strings.TrimPrefix(strings.ReplaceAll(name, `\`, "/"), "./")
+	local = strings.TrimSuffix(local, "/")
+	if local == "" || local == "." {
+		return m.dir, true
+	}
+	if !filepath.IsLocal(filepath.FromSlash(local)) {
+		m.violations = append(m.violations, SourceViolation{Path: name, Kind: ViolationUnsafePath})
+		return "", false
+	}
+	return filepath.Join(m.dir, filepath.FromSlash(local)), true
+}
+
+func (m *materializer) mkdir(name string) error {
+	path, ok := m.target(name)
+	if !ok {
+		return nil
+	}
+	return m.createDir(name, path)
+}
+
+// createDir creates the directory path and its parents, counting every
+// directory not created before against the limits.
+func (m *materializer) createDir(name, path string) error {
+	for dir := path; dir != m.dir && !m.dirs[dir]; dir = filepath.Dir(dir) {
+		m.dirs[dir] = true
+		err := m.count(name)
+		if err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// count counts a created file or directory against MaxFiles.
+func (m *materializer) count(name string) error {
+	m.entries++
+	if m.entries > m.limits.MaxFiles {
+		return m.exceeded(name, ViolationFileCount, int64(m.limits.MaxFiles))
+	}
+	return nil
+}
+
+// writeFile writes a file, counting its actual size against the limits, as
+// sizes given by archive headers can't be trusted. It returns
+// ErrSourceLimitExceeded if a limit was exceeded, which stops
+// materializing.
+func (m *materializer) writeFile(name string, r io.Reader) error {
+	path, ok := m.target(name)
+	if !ok {
+		return nil
+	}
+	err := m.count(name)
+	if err != nil {
+		return err
+	}
+	err = m.createDir(name, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	limit := min(m.limits.MaxFileSize, m.limits.MaxSize-m.size)
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	closeErr := f.Close()
+	m.size += n
+	switch {
+	case err != nil:
+		return err
+	case closeErr != nil:
+		return closeErr
+	case n > m.limits.MaxFileSize:
+		os.Remove(path)
+		return m.exceeded(name, ViolationFileSize, m.limits.MaxFileSize)
+	case m.size > m.limits.MaxSize:
+		os.Remove(path)
+		return m.exceeded(name, ViolationTotalSize, m.limits.MaxSize)
+	}
+	return nil
+}
+
+func (m *materializer) exceeded(name string, kind ViolationKind, limit int64) error {
+	m.violations = append(m.violations, SourceViolation{Path: name, Kind: kind, Limit: limit})
+	return ErrSourceLimitExceeded
+}
+
+// finish returns the result of materializing given the error stopping it:
+// the violations if there are any, err otherwise.
+func (m *materializer) finish(err error) error {
+	if err != nil && err != ErrSourceLimitExceeded {
+		return err
+	}
+	if len(m.violations) > 0 {
+		return m.violations
+	}
+	return nil
+}
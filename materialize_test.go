@@ -0,0 +1,259 @@
+package latex
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type archiveEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+func zipArchive(t *testing.T, entries []archiveEntry) string {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		name := entry.name
+		if entry.dir {
+			name += "/"
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(entry.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "sources.zip")
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func tarGzArchive(t *testing.T, entries []archiveEntry) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.dir {
+			header = &tar.Header{Name: entry.name + "/", Mode: 0o755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "sources.tar.gz")
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// listFiles returns the slash separated paths of all files and directories
+// in dir.
+func listFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if info.IsDir() {
+			rel += "/"
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtractArchive(t *testing.T) {
+	manyDirs := []archiveEntry{}
+	for i := 0; i < 10; i++ {
+		manyDirs = append(manyDirs, archiveEntry{name: strings.Repeat("d/", i) + "d", dir: true})
+	}
+	tests := []struct {
+		name       string
+		entries    []archiveEntry
+		limits     *SourceLimits
+		violations SourceViolations
+		files      []string
+	}{
+		{
+			name:    "nested",
+			entries: []archiveEntry{{name: "main.tex", content: "x"}, {name: "Kapitel/年度 报告.tex", content: "y"}},
+			files:   []string{"Kapitel/", "Kapitel/年度 报告.tex", "main.tex"},
+		},
+		{
+			name: "unsafe paths",
+			entries: []archiveEntry{
+				{name: "../evil.tex", content: "x"},
+				{name: "/etc/evil", content: "x"},
+				{name: "sub/../../evil", content: "x"},
+				{name: `..\evil`, content: "x"},
+				{name: "..", dir: true},
+				{name: "./ok.tex", content: "y"},
+			},
+			violations: SourceViolations{
+				{Path: "../evil.tex", Kind: ViolationUnsafePath},
+				{Path: "/etc/evil", Kind: ViolationUnsafePath},
+				{Path: "sub/../../evil", Kind: ViolationUnsafePath},
+				{Path: `..\evil`, Kind: ViolationUnsafePath},
+				{Path: "../", Kind: ViolationUnsafePath},
+			},
+			files: []string{"ok.tex"},
+		},
+		{
+			name:       "file count",
+			entries:    []archiveEntry{{name: "a", content: "x"}, {name: "b", content: "x"}, {name: "c", content: "x"}},
+			limits:     &SourceLimits{MaxFiles: 2},
+			violations: SourceViolations{{Path: "c", Kind: ViolationFileCount, Limit: 2}},
+			files:      []string{"a", "b"},
+		},
+		{
+			name:       "directories count",
+			entries:    manyDirs,
+			limits:     &SourceLimits{MaxFiles: 5},
+			violations: SourceViolations{{Path: "d/d/d/d/d/d/", Kind: ViolationFileCount, Limit: 5}},
+		},
+		{
+			name:       "implicit directories count",
+			entries:    []archiveEntry{{name: "a/b/c/d.tex", content: "x"}},
+			limits:     &SourceLimits{MaxFiles: 3},
+			violations: SourceViolations{{Path: "a/b/c/d.tex", Kind: ViolationFileCount, Limit: 3}},
+		},
+		{
+			name:       "file size",
+			entries:    []archiveEntry{{name: "a", content: "1234"}, {name: "b", content: "12345"}},
+			limits:     &SourceLimits{MaxFileSize: 4},
+			violations: SourceViolations{{Path: "b", Kind: ViolationFileSize, Limit: 4}},
+			files:      []string{"a"},
+		},
+		{
+			name:       "total size",
+			entries:    []archiveEntry{{name: "a", content: "1234"}, {name: "b", content: "1234"}, {name: "c", content: "1"}},
+			limits:     &SourceLimits{MaxSize: 8},
+			violations: SourceViolations{{Path: "c", Kind: ViolationTotalSize, Limit: 8}},
+			files:      []string{"a", "b"},
+		},
+	}
+	formats := map[string]func(*testing.T, []archiveEntry) string{"zip": zipArchive, "tar.gz": tarGzArchive}
+	for format, write := range formats {
+		for _, test := range tests {
+			t.Run(format+"/"+test.name, func(t *testing.T) {
+				dir := t.TempDir()
+				m := newMaterializer(dir, test.limits)
+				err := m.finish(extractArchive(write(t, test.entries), m))
+				if test.violations == nil {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				} else {
+					var violations SourceViolations
+					if !errors.As(err, &violations) {
+						t.Fatalf("got error %v, want violations", err)
+					}
+					if !reflect.DeepEqual(violations, test.violations) {
+						t.Errorf("got violations %v, want %v", violations, test.violations)
+					}
+					limited := test.violations[len(test.violations)-1].Kind != ViolationUnsafePath
+					if errors.Is(err, ErrSourceLimitExceeded) != limited {
+						t.Errorf("errors.Is(%v, ErrSourceLimitExceeded) = %v", err, !limited)
+					}
+				}
+				if test.files == nil {
+					return
+				}
+				if files := listFiles(t, dir); !reflect.DeepEqual(files, test.files) {
+					t.Errorf("got files %q, want %q", files, test.files)
+				}
+			})
+		}
+	}
+}
+
+func TestMaterializeFS(t *testing.T) {
+	tests := []struct {
+		name       string
+		fsys       fstest.MapFS
+		limits     *SourceLimits
+		violations SourceViolations
+		files      []string
+	}{
+		{
+			name: "files",
+			fsys: fstest.MapFS{
+				"main.tex":          {Data: []byte("x")},
+				"Übersicht/a b.tex": {Data: []byte("y")},
+				"empty":             {Mode: os.ModeDir},
+				"link":              {Mode: os.ModeSymlink, Data: []byte("/etc/passwd")},
+			},
+			files: []string{"empty/", "main.tex", "Übersicht/", "Übersicht/a b.tex"},
+		},
+		{
+			name: "directories count",
+			fsys: fstest.MapFS{
+				"a":     {Mode: os.ModeDir},
+				"b":     {Mode: os.ModeDir},
+				"c/d/e": {Mode: os.ModeDir},
+			},
+			limits:     &SourceLimits{MaxFiles: 3},
+			violations: SourceViolations{{Path: "c/d", Kind: ViolationFileCount, Limit: 3}},
+		},
+		{
+			name:       "file size",
+			fsys:       fstest.MapFS{"big.tex": {Data: make([]byte, 10)}},
+			limits:     &SourceLimits{MaxFileSize: 9},
+			violations: SourceViolations{{Path: "big.tex", Kind: ViolationFileSize, Limit: 9}},
+			files:      []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := newMaterializer(dir, test.limits)
+			err := m.finish(materializeFS(test.fsys, m))
+			var violations SourceViolations
+			errors.As(err, &violations)
+			if (err != nil && violations == nil) || !reflect.DeepEqual(violations, test.violations) {
+				t.Fatalf("got error %v, want violations %v", err, test.violations)
+			}
+			if test.files == nil {
+				return
+			}
+			if files := listFiles(t, dir); !reflect.DeepEqual(files, test.files) {
+				t.Errorf("got files %q, want %q", files, test.files)
+			}
+		})
+	}
+}
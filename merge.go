@@ -0,0 +1,66 @@
+package latex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// MergeOutputs concatenates the PDFs of the compile files of tasks built
+// before into output, e.g. cover, body and appendix built from different
+// sources, see MergePdfs. Use an Assembly to build the parts as well.
+func MergeOutputs(output string, tasks ...*CompileTask) error {
+	files := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		files = append(files, t.pdfPath(""))
+	}
+	return MergePdfs(output, files...)
+}
+
+// MergePdfs concatenates PDF files into output, replacing pdfunite. Unlike
+// pdfunite it keeps the bookmarks of the files, pointing to their pages in
+// the merged document, and their page labels. Requires qpdf.
+func MergePdfs(output string, files ...string) error {
+	if len(files) == 0 {
+		return errors.New("no PDFs to merge")
+	}
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	t := NewCompileTask()
+	t.SetSourceDir(filepath.Dir(output))
+
+	absFiles := make([]string, 0, len(files))
+	outline := []Bookmark{}
+	offset := 0
+	for _, file := range files {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+		bookmarks, err := t.Bookmarks(file)
+		if err != nil {
+			return err
+		}
+		pages, err := t.PageCount(file)
+		if err != nil {
+			return err
+		}
+		outline = append(outline, shiftBookmarks(bookmarks, offset, 0)...)
+		offset += pages
+		absFiles = append(absFiles, file)
+	}
+
+	args := []string{"--empty", "--pages"}
+	args = append(args, absFiles...)
+	args = append(args, "--", output)
+	_, err = t.runTool("qpdf", args...)
+	if err != nil || len(outline) == 0 {
+		return err
+	}
+	return t.SetBookmarks(output, outline)
+}
@@ -0,0 +1,319 @@
+package latex
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PdfMetadata holds the document properties written to the information
+// dictionary and the XMP metadata of a PDF.
+type PdfMetadata struct {
+	Title    string
+	Authors  []string
+	Subject  string
+	Keywords []string
+	Version  string
+	// Custom holds additional properties. Keys must consist of ASCII
+	// letters and digits, starting with a letter, others are ignored.
+	Custom map[string]string
+}
+
+// MetadataFromFrontMatter converts front matter to PDF metadata. Title and
+// authors are taken from \title and \author (authors separated by \and),
+// version from the macros \docversion or \version, keywords from the macro
+// \keywords. Meta comments fill in missing values ("title", "author",
+// "subject", "keywords" and "version"), all other meta comments become
+// custom properties. TeX markup is removed.
+func MetadataFromFrontMatter(f *FrontMatter) PdfMetadata {
+	first := func(values ...string) string {
+		for _, value := range values {
+			if value != "" {
+				return texToPlain(value)
+			}
+		}
+		return ""
+	}
+	m := PdfMetadata{
+		Title:   first(f.Title, f.Meta["title"]),
+		Subject: first(f.Meta["subject"], f.Macro("subject")),
+		Version: first(f.Macro("docversion"), f.Macro("version"), f.Meta["version"]),
+		Custom:  map[string]string{},
+	}
+
+	author := f.Author
+	if author == "" {
+		author = f.Meta["author"]
+	}
+	for _, name := range regexp.MustCompile(`\\and\b`).Split(author, -1) {
+		if name = texToPlain(name); name != "" {
+			m.Authors = append(m.Authors, name)
+		}
+	}
+
+	for _, keyword := range strings.Split(first(f.Macro("keywords"), f.Meta["keywords"]), ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			m.Keywords = append(m.Keywords, keyword)
+		}
+	}
+
+	for key, value := range f.Meta {
+		switch key {
+		case "title", "author", "subject", "keywords", "version":
+		default:
+			m.Custom[key] = texToPlain(value)
+		}
+	}
+	return m
+}
+
+// SetPdfMetadata writes metadata to the information dictionary and the XMP
+// metadata stream of a PDF, replacing existing values. Existing XMP metadata
+// is replaced as a whole. It requires qpdf and defaults to the output of the
+// compiled file.
+func (t *CompileTask) SetPdfMetadata(file string, metadata PdfMetadata) error {
+	return t.writePdfMetadata(t.pdfPath(file), metadata, nil)
+}
+
+// writePdfMetadata writes metadata to a PDF like SetPdfMetadata. If keep is
+// not nil, only the existing entries of the information dictionary it
+// accepts are kept.
+func (t *CompileTask) writePdfMetadata(file string, metadata PdfMetadata, keep func(key string) bool) error {
+	objects, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+
+	info, infoRef := objects.info()
+	info = copyPdfDict(info)
+	if keep != nil {
+		for key := range info {
+			if !keep(key) {
+				delete(info, key)
+			}
+		}
+	}
+	for key, value := range metadata.properties() {
+		info["/"+key] = pdfTextString(value)
+	}
+	objects.set(infoRef, info)
+
+	xmp := map[string]interface{}{
+		"/Type":    "/Metadata",
+		"/Subtype": "/XML",
+	}
+	catalog, catalogRef := objects.catalog()
+	if ref, ok := catalog["/Metadata"].(string); ok && isPdfRef(ref) {
+		objects.setStream(ref, xmp, metadata.xmp())
+	} else {
+		ref = objects.add(nil)
+		objects.setStream(ref, xmp, metadata.xmp())
+		catalog = copyPdfDict(catalog)
+		catalog["/Metadata"] = ref
+		objects.set(catalogRef, catalog)
+	}
+	return t.writePdfObjects(file, objects)
+}
+
+// SyncPdfMetadata extracts the front matter of the TeX file next to a PDF
+// and writes it to the PDF using SetPdfMetadata. It defaults to the output
+// of the compiled file.
+func (t *CompileTask) SyncPdfMetadata(file string) error {
+	file = t.pdfPath(file)
+	tex := texFileFor(file)
+	if tex == "" {
+		return fmt.Errorf("no TeX source found for %s", file)
+	}
+	f, err := ParseFrontMatterFile(tex)
+	if err != nil {
+		return err
+	}
+	return t.SetPdfMetadata(file, MetadataFromFrontMatter(f))
+}
+
+// Metadata returns the metadata stamped on PDFs, nil if none.
+func (t *CompileTask) Metadata() *PdfMetadata {
+	return t.metadata
+}
+
+// SetMetadata sets the metadata stamped on the PDF by MoveToDest and the
+// step "metadata" (see StampMetadata), so documents get correct properties
+// for document management systems without changing their sources. Use nil
+// to stamp none.
+func (t *CompileTask) SetMetadata(metadata *PdfMetadata) {
+	t.metadata = metadata
+}
+
+// StampMetadata writes the metadata of the task (see SetMetadata) to a PDF
+// using SetPdfMetadata, defaulting to the output of the compiled file. If
+// syncing is enabled (see SetSyncMetadata), the front matter of the TeX
+// file next to the PDF provides the values missing in the metadata of the
+// task. The version defaults to the version of the task.
+func (t *CompileTask) StampMetadata(file string) error {
+	file = t.pdfPath(file)
+	metadata := PdfMetadata{}
+	if tex := texFileFor(file); t.syncMetadata && tex != "" {
+		f, err := ParseFrontMatterFile(tex)
+		if err != nil {
+			return err
+		}
+		metadata = MetadataFromFrontMatter(f)
+	}
+	if t.metadata != nil {
+		metadata = metadata.merge(*t.metadata)
+	}
+	if metadata.Version == "" {
+		metadata.Version = t.version
+	}
+	return t.SetPdfMetadata(file, metadata)
+}
+
+// merge returns m with the non-empty values of other replacing its values.
+func (m PdfMetadata) merge(other PdfMetadata) PdfMetadata {
+	if other.Title != "" {
+		m.Title = other.Title
+	}
+	if len(other.Authors) > 0 {
+		m.Authors = other.Authors
+	}
+	if other.Subject != "" {
+		m.Subject = other.Subject
+	}
+	if len(other.Keywords) > 0 {
+		m.Keywords = other.Keywords
+	}
+	if other.Version != "" {
+		m.Version = other.Version
+	}
+	if len(other.Custom) > 0 {
+		custom := map[string]string{}
+		for key, value := range m.Custom {
+			custom[key] = value
+		}
+		for key, value := range other.Custom {
+			custom[key] = value
+		}
+		m.Custom = custom
+	}
+	return m
+}
+
+// SyncMetadata reports if MoveToDest syncs the PDF metadata with the front
+// matter of the document.
+func (t *CompileTask) SyncMetadata() bool {
+	return t.syncMetadata
+}
+
+// SetSyncMetadata sets if MoveToDest syncs the PDF metadata with the front
+// matter of the document, see SyncPdfMetadata.
+func (t *CompileTask) SetSyncMetadata(syncMetadata bool) {
+	t.syncMetadata = syncMetadata
+}
+
+var customMetadataKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// properties returns the non-empty information dictionary entries.
+func (m PdfMetadata) properties() map[string]string {
+	properties := map[string]string{}
+	for key, value := range m.Custom {
+		if customMetadataKey.MatchString(key) && value != "" {
+			properties[key] = value
+		}
+	}
+	for key, value := range map[string]string{
+		"Title":    m.Title,
+		"Author":   strings.Join(m.Authors, ", "),
+		"Subject":  m.Subject,
+		"Keywords": strings.Join(m.Keywords, ", "),
+		"Version":  m.Version,
+	} {
+		if value != "" {
+			properties[key] = value
+		}
+	}
+	return properties
+}
+
+// xmp returns an XMP packet with the metadata. Information dictionary
+// entries without standard XMP property are stored in the pdfx namespace.
+func (m PdfMetadata) xmp() []byte {
+	var b strings.Builder
+	text := func(s string) string {
+		var e strings.Builder
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:pdfx="http://ns.adobe.com/pdfx/1.3/">` + "\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if m.Title != "" {
+		b.WriteString(`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + text(m.Title) + "</rdf:li></rdf:Alt></dc:title>\n")
+	}
+	if len(m.Authors) > 0 {
+		b.WriteString("<dc:creator><rdf:Seq>")
+		for _, author := range m.Authors {
+			b.WriteString("<rdf:li>" + text(author) + "</rdf:li>")
+		}
+		b.WriteString("</rdf:Seq></dc:creator>\n")
+	}
+	if m.Subject != "" {
+		b.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + text(m.Subject) + "</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if len(m.Keywords) > 0 {
+		b.WriteString("<dc:subject><rdf:Bag>")
+		for _, keyword := range m.Keywords {
+			b.WriteString("<rdf:li>" + text(keyword) + "</rdf:li>")
+		}
+		b.WriteString("</rdf:Bag></dc:subject>\n")
+		b.WriteString("<pdf:Keywords>" + text(strings.Join(m.Keywords, ", ")) + "</pdf:Keywords>\n")
+	}
+
+	properties := m.properties()
+	keys := []string{}
+	for key := range properties {
+		switch key {
+		case "Title", "Author", "Subject", "Keywords":
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString("<pdfx:" + key + ">" + text(properties[key]) + "</pdfx:" + key + ">\n")
+	}
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	// padding allows in-place edits by other tools
+	b.WriteString(strings.Repeat(strings.Repeat(" ", 99)+"\n", 20))
+	b.WriteString(`<?xpacket end="w"?>`)
+	return []byte(b.String())
+}
+
+var (
+	texPlainEscaped = regexp.MustCompile(`\\([{}%&$#_ ])`)
+	texPlainBreak   = regexp.MustCompile(`\\\\(\[[^\]]*\])?|\\newline\b|~`)
+	texPlainCommand = regexp.MustCompile(`\\[A-Za-z@]+\*?`)
+)
+
+// texToPlain removes markup from a short TeX text like a title: line breaks
+// become spaces, commands and braces are dropped while their arguments are
+// kept.
+func texToPlain(s string) string {
+	s = texPlainBreak.ReplaceAllString(s, " ")
+	// protect escaped characters from removal
+	s = texPlainEscaped.ReplaceAllStringFunc(s, func(m string) string {
+		return string(rune(0xe000 + int(m[1])))
+	})
+	s = texPlainCommand.ReplaceAllString(s, "")
+	s = strings.NewReplacer("{", "", "}", "").Replace(s)
+	s = strings.Map(func(r rune) rune {
+		if r >= 0xe000 && r < 0xe080 {
+			return r - 0xe000
+		}
+		return r
+	}, s)
+	return collapseSpace(s)
+}
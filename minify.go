@@ -0,0 +1,247 @@
+package latex
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// verbatimEnvironments lists the environments whose content MinifyTeX
+// leaves alone.
+var verbatimEnvironments = []string{
+	"verbatim", "verbatim*", "Verbatim", "Verbatim*", "BVerbatim", "LVerbatim",
+	"VerbatimOut", "lstlisting", "minted", "alltt", "comment",
+	"filecontents", "filecontents*", "tcblisting",
+}
+
+// verbatimArgCommands lists the commands whose first argument is read
+// verbatim, so % is no comment there.
+var verbatimArgCommands = []string{"url", "href", "path", "nolinkurl"}
+
+// texSourceExtensions lists the extensions of the TeX sources processed by
+// MinifySources and AnonymizeSources.
+var texSourceExtensions = []string{".tex", ".sty", ".cls", ".ltx"}
+
+// magicComment matches comments read by editors and tools, like
+// "% !TEX program = xelatex", which are kept.
+var magicComment = regexp.MustCompile(`^\s*%\s*!(?i:TEX|BIB)\s`)
+
+// MinifyTeX strips the comments from TeX source and collapses its
+// whitespace without changing the typeset result: runs of spaces become one
+// space, leading and trailing spaces of lines are dropped, lines holding
+// only a comment are removed and runs of empty lines become one. A comment
+// directly following text is replaced by a bare % to keep suppressing the
+// line end, other comments are removed. Verbatim environments like
+// lstlisting, \verb and the arguments of \url and \href are left as is, as
+// are magic comments like "% !TEX program = xelatex" and a format line
+// starting with %&.
+//
+// Code changing category codes, e.g. using \obeyspaces or making % a
+// letter, is not taken into account.
+func MinifyTeX(src []byte) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	var b strings.Builder
+	b.Grow(len(src))
+	verbatim := ""
+	blank := false
+	for i, line := range lines {
+		eol := ""
+		if strings.HasSuffix(line, "\n") {
+			line, eol = line[:len(line)-1], "\n"
+			if strings.HasSuffix(line, "\r") {
+				line, eol = line[:len(line)-1], "\r\n"
+			}
+		}
+		head := ""
+		if verbatim != "" {
+			end := `\end{` + verbatim + `}`
+			pos := strings.Index(line, end)
+			if pos < 0 {
+				b.WriteString(line + eol)
+				continue
+			}
+			head, line = line[:pos+len(end)], line[pos+len(end):]
+			verbatim = ""
+		} else if (i == 0 && strings.HasPrefix(line, "%&")) || magicComment.MatchString(line) {
+			b.WriteString(line + eol)
+			blank = false
+			continue
+		}
+
+		minified, commented, env := minifyLine(line)
+		if head == "" {
+			minified = strings.TrimLeft(minified, " ")
+		}
+		minified = head + minified
+		verbatim = env
+		switch {
+		case minified == "" && commented:
+			// comment line, dropped as a whole
+			continue
+		case minified == "" && verbatim == "":
+			if !blank && b.Len() > 0 {
+				b.WriteString(eol)
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		if commented && verbatim == "" {
+			minified += "%"
+		}
+		b.WriteString(minified + eol)
+	}
+	return []byte(b.String())
+}
+
+// minifyLine minifies a line of TeX source outside of verbatim
+// environments. It reports whether a comment was stripped and the verbatim
+// environment started in the line, whose rest is kept as is then.
+func minifyLine(line string) (string, bool, string) {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case ' ', '\t':
+			space = true
+			continue
+		case '%':
+			if space && b.Len() > 0 {
+				// the line end is a space like the one stripped
+				return b.String(), false, ""
+			}
+			return b.String(), true, ""
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		name := controlWord(line[i+1:])
+		if name == "" {
+			// control symbol like \% or \\
+			b.WriteString(line[i:min(i+2, len(line))])
+			i++
+			continue
+		}
+		b.WriteString(`\` + name)
+		i += len(name)
+		rest := line[i+1:]
+		switch {
+		case name == "verb" || name == "lstinline":
+			n := verbArgLength(rest)
+			b.WriteString(rest[:n])
+			i += n
+		case name == "begin":
+			for _, env := range verbatimEnvironments {
+				if strings.HasPrefix(strings.TrimLeft(rest, " "), "{"+env+"}") {
+					b.WriteString(rest)
+					return b.String(), false, env
+				}
+			}
+		case slices.Contains(verbatimArgCommands, name):
+			n := bracedArgLength(rest)
+			b.WriteString(rest[:n])
+			i += n
+		}
+	}
+	return b.String(), false, ""
+}
+
+// controlWord returns the name of the control word s starts with, empty if
+// it doesn't start with a letter.
+func controlWord(s string) string {
+	n := 0
+	for n < len(s) && (s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z') {
+		n++
+	}
+	return s[:n]
+}
+
+// verbArgLength returns the length of the argument of \verb or \lstinline
+// at the start of s, including a star, options and the delimiters. It
+// covers the rest of the line if the argument isn't closed.
+func verbArgLength(s string) int {
+	n := 0
+	if n < len(s) && s[n] == '*' {
+		n++
+	}
+	if n < len(s) && s[n] == '[' {
+		end := strings.IndexByte(s[n:], ']')
+		if end < 0 {
+			return len(s)
+		}
+		n += end + 1
+	}
+	if n >= len(s) {
+		return n
+	}
+	closing := s[n]
+	if closing == '{' {
+		closing = '}'
+	}
+	end := strings.IndexByte(s[n+1:], closing)
+	if end < 0 {
+		return len(s)
+	}
+	return n + 1 + end + 1
+}
+
+// bracedArgLength returns the length of the braced argument at the start of
+// s, including leading spaces, 0 if there is none.
+func bracedArgLength(s string) int {
+	n := len(s) - len(strings.TrimLeft(s, " "))
+	if n >= len(s) || s[n] != '{' {
+		return 0
+	}
+	depth := 0
+	for i := n; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// MinifySources strips the comments and collapses the whitespace of the
+// TeX sources (.tex, .sty, .cls and .ltx files) in the compile directory
+// using MinifyTeX, e.g. before handing the sources to clients which
+// shouldn't see internal comments. Run it after compiling, so diagnostics
+// refer to the original lines, or use the step "minify-sources".
+func (t *CompileTask) MinifySources() error {
+	return filepath.WalkDir(t.CompileDirInternal(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !slices.Contains(texSourceExtensions, filepath.Ext(path)) {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		minified := MinifyTeX(src)
+		if bytes.Equal(minified, src) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, minified, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,139 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxInstalledPackages bounds the number of packages installed for a run,
+// which is retried after each installation as it reports one missing file.
+const maxInstalledPackages = 5
+
+// packageFileExtensions lists the extensions of files provided by TeX
+// packages, as opposed to files written by the document itself.
+var packageFileExtensions = []string{
+	".sty", ".cls", ".clo", ".def", ".fd", ".cfg", ".ldf", ".bst", ".bbx",
+	".cbx", ".lbx", ".tfm", ".enc", ".map", ".pfb", ".otf", ".ttf",
+}
+
+// MissingPackageError is returned by the engine runs if the document needs
+// files which are not installed.
+type MissingPackageError struct {
+	// Files lists the missing files, like "foo.sty".
+	Files []string
+	// Packages lists the TeX Live packages providing the files as found by
+	// tlmgr, empty if tlmgr is not available. The package repository is
+	// only searched with SetAutoInstallPackages, the local installation
+	// otherwise.
+	Packages []string
+	// Err is the failure of the run, usually a *CompileError.
+	Err error
+}
+
+func (e *MissingPackageError) Error() string {
+	msg := "missing " + strings.Join(e.Files, ", ")
+	if len(e.Packages) > 0 {
+		msg += fmt.Sprintf(" (install TeX Live packages: %s)", strings.Join(e.Packages, " "))
+	}
+	return msg
+}
+
+func (e *MissingPackageError) Unwrap() error {
+	return e.Err
+}
+
+// AutoInstallPackages reports if missing packages are installed using
+// tlmgr.
+func (t *CompileTask) AutoInstallPackages() bool {
+	return t.autoInstall
+}
+
+// SetAutoInstallPackages sets if packages missing for a run are installed
+// using tlmgr before the run is retried. tlmgr needs to be able to write to
+// the TeX Live installation and access the package repository, which is
+// searched for the packages providing missing files. This is off by
+// default, as it changes the installation and uses the network.
+func (t *CompileTask) SetAutoInstallPackages(autoInstall bool) {
+	t.autoInstall = autoInstall
+}
+
+// missingPackageFiles returns the package files the log of a failed run of
+// file reports missing.
+func (t *CompileTask) missingPackageFiles(file string) []string {
+	log, err := parseLogFile(t.auxFile(file, ".log"))
+	if err != nil {
+		return nil
+	}
+	files := []string{}
+	for _, name := range log.MissingFiles() {
+		if contains(packageFileExtensions, strings.ToLower(filepath.Ext(name))) {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// packagesProviding finds the TeX Live packages providing files using
+// tlmgr, searching the package repository only if auto install is on.
+func (t *CompileTask) packagesProviding(files []string) ([]string, error) {
+	packages := []string{}
+	for _, name := range files {
+		args := []string{"search", "--file", "/" + name}
+		if t.autoInstall {
+			args = []string{"search", "--global", "--file", "/" + name}
+		}
+		result, err := t.runTool("tlmgr", args...)
+		if err != nil {
+			return nil, err
+		}
+		// matches are listed as "package:" followed by indented paths
+		for _, line := range splitLines(result.Output()) {
+			if strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && !strings.Contains(line, " ") {
+				pkg := strings.TrimSuffix(line, ":")
+				if !contains(packages, pkg) {
+					packages = append(packages, pkg)
+				}
+				break
+			}
+		}
+	}
+	return packages, nil
+}
+
+// handleMissingPackages is called with the failure of a run of file. It
+// returns a *MissingPackageError if files are missing, unless they could be
+// installed, in which case retry is true.
+func (t *CompileTask) handleMissingPackages(file string, runErr error, installed map[string]bool) (retry bool, err error) {
+	var compileErr *CompileError
+	if !errors.As(runErr, &compileErr) {
+		return false, runErr
+	}
+	files := t.missingPackageFiles(file)
+	if len(files) == 0 {
+		return false, runErr
+	}
+	missing := &MissingPackageError{Files: files, Err: runErr}
+	if !t.hasCommand("tlmgr") {
+		return false, missing
+	}
+	missing.Packages, err = t.packagesProviding(files)
+	if err != nil || len(missing.Packages) == 0 || !t.autoInstall || len(installed) >= maxInstalledPackages {
+		return false, missing
+	}
+	for _, pkg := range missing.Packages {
+		if installed[pkg] {
+			// installing didn't help
+			return false, missing
+		}
+	}
+	_, err = t.runTool("tlmgr", append([]string{"install"}, missing.Packages...)...)
+	if err != nil {
+		return false, fmt.Errorf("installing %s: %w", strings.Join(missing.Packages, " "), err)
+	}
+	for _, pkg := range missing.Packages {
+		installed[pkg] = true
+	}
+	return true, nil
+}
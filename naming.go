@@ -0,0 +1,172 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ArtifactName holds the parts of the filename of an artifact.
+type ArtifactName struct {
+	// Jobname is the name of the TeX file without extension.
+	Jobname string
+	// Variant distinguishes builds of the same document, e.g. a language
+	// or "draft". It may be empty.
+	Variant string
+	// Version of the document, it may be empty.
+	Version string
+	// Ext is the extension without dot, like "pdf".
+	Ext string
+}
+
+// NamingScheme controls the filenames of artifacts moved out of the compile
+// directory. It must not be copied or changed after first use, it is safe
+// for concurrent use.
+type NamingScheme struct {
+	// Template is a text/template executed with an ArtifactName.
+	Template string
+
+	parseOnce sync.Once
+	parsed    *template.Template
+	parseErr  error
+}
+
+// DefaultNamingScheme names artifacts like "report-de-1.2.pdf", leaving out
+// empty variants and versions.
+var DefaultNamingScheme = &NamingScheme{
+	Template: "{{.Jobname}}{{with .Variant}}-{{.}}{{end}}{{with .Version}}-{{.}}{{end}}.{{.Ext}}",
+}
+
+// Name returns the filename of an artifact.
+func (n *NamingScheme) Name(name ArtifactName) (string, error) {
+	n.parseOnce.Do(func() {
+		n.parsed, n.parseErr = template.New("name").Option("missingkey=error").Parse(n.Template)
+	})
+	if n.parseErr != nil {
+		return "", n.parseErr
+	}
+	var b strings.Builder
+	err := n.parsed.Execute(&b, name)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// NamingScheme returns the naming scheme of this task.
+func (t *CompileTask) NamingScheme() *NamingScheme {
+	if t.namingScheme == nil {
+		return DefaultNamingScheme
+	}
+	return t.namingScheme
+}
+
+// SetNamingScheme sets the naming scheme for artifacts of this task. Use nil
+// for DefaultNamingScheme.
+func (t *CompileTask) SetNamingScheme(scheme *NamingScheme) {
+	t.namingScheme = scheme
+}
+
+// Variant returns the variant used in artifact names.
+func (t *CompileTask) Variant() string {
+	return t.variant
+}
+
+// SetVariant sets the variant used in artifact names, like a language or
+// "draft".
+func (t *CompileTask) SetVariant(variant string) {
+	t.variant = variant
+}
+
+// Version returns the document version used in artifact names.
+func (t *CompileTask) Version() string {
+	return t.version
+}
+
+// SetVersion sets the document version used in artifact names.
+func (t *CompileTask) SetVersion(version string) {
+	t.version = version
+}
+
+// ArtifactName returns the filename of an artifact of a file (defaulting to
+// the compile file) with the given extension according to the naming
+// scheme of the task.
+func (t *CompileTask) ArtifactName(file, ext string) (string, error) {
+	return t.NamingScheme().Name(ArtifactName{
+		Jobname: jobname(t.defaultCompileFilename(file)),
+		Variant: t.variant,
+		Version: t.version,
+		Ext:     strings.TrimPrefix(ext, "."),
+	})
+}
+
+// destination returns where MoveToDest moves from to: into the directory to
+// named by the naming scheme if to is a directory, to itself otherwise.
+func (t *CompileTask) destination(from, to string) (string, error) {
+	info, err := os.Stat(to)
+	isDir := err == nil && info.IsDir()
+	if !isDir && !strings.HasSuffix(to, string(filepath.Separator)) && !strings.HasSuffix(to, "/") {
+		return to, nil
+	}
+	name, err := t.ArtifactName(from, filepath.Ext(from))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(to, name), nil
+}
+
+// replaceExt replaces the extension of filename by ext (without dot).
+func replaceExt(filename, ext string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + ext
+}
+
+// texExtensions lists the extensions of TeX sources, compared
+// case-insensitively.
+var texExtensions = []string{".tex", ".ltx", ".latex"}
+
+// isTexFile reports whether filename has the extension of a TeX source.
+func isTexFile(filename string) bool {
+	return contains(texExtensions, strings.ToLower(filepath.Ext(filename)))
+}
+
+// texFileFor returns the TeX source next to a compiled file like a PDF,
+// empty if there is none.
+func texFileFor(file string) string {
+	for _, ext := range texExtensions {
+		for _, variant := range []string{ext, strings.ToUpper(ext)} {
+			tex := replaceExt(file, variant[1:])
+			if _, err := os.Stat(tex); err == nil {
+				return tex
+			}
+		}
+	}
+	return ""
+}
+
+// texFilenameSpecials are characters TeX can't read in file names given on
+// the command line, not even quoted.
+const texFilenameSpecials = `%#\{}~"`
+
+// checkTexFilename returns an error if a TeX engine can't be given file on
+// the command line. Spaces and non-ASCII characters are fine.
+func checkTexFilename(file string) error {
+	name := filepath.ToSlash(file)
+	if i := strings.IndexAny(name, texFilenameSpecials); i >= 0 {
+		return fmt.Errorf("%s: TeX can't read file names containing %q", file, name[i:i+1])
+	}
+	return nil
+}
+
+// texFileArg returns file as argument for a TeX engine. TeX ends file names
+// at spaces unless they are quoted, and reads backslashes as commands, so
+// Windows paths use forward slashes.
+func texFileArg(file string) string {
+	name := filepath.ToSlash(file)
+	if strings.ContainsAny(name, " \t") {
+		return `"` + name + `"`
+	}
+	return name
+}
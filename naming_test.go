@@ -0,0 +1,49 @@
+package latex
+
+import "testing"
+
+func TestTexFileArg(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"document.tex", "document.tex"},
+		{"my document.tex", `"my document.tex"`},
+		{"chapters/intro.tex", "chapters/intro.tex"},
+		{"tab\tname.tex", "\"tab\tname.tex\""},
+		{"Übersicht.tex", "Übersicht.tex"},
+		{"größe und maß.tex", `"größe und maß.tex"`},
+		{"报告.tex", "报告.tex"},
+		{"年度 报告.tex", `"年度 报告.tex"`},
+	}
+	for _, test := range tests {
+		if got := texFileArg(test.file); got != test.want {
+			t.Errorf("texFileArg(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestCheckTexFilename(t *testing.T) {
+	tests := []struct {
+		file  string
+		valid bool
+	}{
+		{"document.tex", true},
+		{"my document.tex", true},
+		{"Übersicht.tex", true},
+		{"报告.tex", true},
+		{"chapters/intro.tex", true},
+		{"100%.tex", false},
+		{"issue#1.tex", false},
+		{"{draft}.tex", false},
+		{"draft}.tex", false},
+		{"~backup.tex", false},
+		{`say "hi".tex`, false},
+	}
+	for _, test := range tests {
+		err := checkTexFilename(test.file)
+		if (err == nil) != test.valid {
+			t.Errorf("checkTexFilename(%q) = %v, want valid %v", test.file, err, test.valid)
+		}
+	}
+}
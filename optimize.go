@@ -0,0 +1,130 @@
+package latex
+
+import "fmt"
+
+// Optimizer reduces the file size of PDFs, see Optimize.
+type Optimizer interface {
+	// Name identifies the optimizer.
+	Name() string
+	// Available reports whether the optimizer can be used by the task, e.g.
+	// because its tool is installed.
+	Available(t *CompileTask) bool
+	// Optimize writes an optimized version of input to output. Channel is
+	// one of the values documented at Optimize, optimizers may ignore it.
+	Optimize(t *CompileTask, input, output, channel string) error
+}
+
+// toolOptimizer is an Optimizer running an external tool.
+type toolOptimizer struct {
+	name string
+	tool string
+	args func(input, output, channel string) []string
+}
+
+func (o toolOptimizer) Name() string {
+	return o.name
+}
+
+func (o toolOptimizer) Available(t *CompileTask) bool {
+	return t.hasCommand(o.tool)
+}
+
+func (o toolOptimizer) Optimize(t *CompileTask, input, output, channel string) error {
+	command, err := t.command(o.tool, o.args(input, output, channel)...)
+	if err != nil {
+		return err
+	}
+	result, err := t.execute(command, VerbosityDefault)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", o.tool, err, result.Error())
+	}
+	return nil
+}
+
+var (
+	// GhostscriptOptimizer rewrites PDFs using gs and its PDFSETTINGS for
+	// the channel, downsampling images for screen and ebook.
+	GhostscriptOptimizer Optimizer = toolOptimizer{
+		name: "ghostscript",
+		tool: "gs",
+		args: func(input, output, channel string) []string {
+			// minify pdf: http://tex.stackexchange.com/a/41273
+			// http://stackoverflow.com/a/27454451
+			// http://blog.rot13.org/2011/05/optimize-pdf-file-size-using-ghostscript.html
+			return []string{
+				"-sDEVICE=pdfwrite",
+				"-dCompatibilityLevel=1.4",
+				fmt.Sprintf("-dPDFSETTINGS=/%s", channel),
+				"-o",
+				output,
+				input,
+			}
+		},
+	}
+	// PdfsizeoptOptimizer uses pdfsizeopt, which optimizes images and fonts
+	// losslessly.
+	PdfsizeoptOptimizer Optimizer = toolOptimizer{
+		name: "pdfsizeopt",
+		tool: "pdfsizeopt",
+		args: func(input, output, channel string) []string {
+			return []string{input, output}
+		},
+	}
+	// MutoolOptimizer uses mutool clean to remove unused objects and
+	// compress streams, fonts and images.
+	MutoolOptimizer Optimizer = toolOptimizer{
+		name: "mutool",
+		tool: "mutool",
+		args: func(input, output, channel string) []string {
+			return []string{"clean", "-gggg", "-z", "-i", "-f", input, output}
+		},
+	}
+	// QpdfOptimizer uses qpdf to recompress streams and generate object
+	// streams. For the screen and ebook channels images are recompressed
+	// too. qpdf is Apache licensed.
+	QpdfOptimizer Optimizer = toolOptimizer{
+		name: "qpdf",
+		tool: "qpdf",
+		args: func(input, output, channel string) []string {
+			args := []string{
+				"--object-streams=generate",
+				"--compress-streams=y",
+				"--recompress-flate",
+				"--compression-level=9",
+			}
+			if channel == "screen" || channel == "ebook" {
+				args = append(args, "--optimize-images")
+			}
+			return append(args, input, output)
+		},
+	}
+)
+
+// DefaultOptimizers lists the optimizers in order of preference used if none
+// are set for a task.
+var DefaultOptimizers = []Optimizer{
+	GhostscriptOptimizer,
+	PdfsizeoptOptimizer,
+	MutoolOptimizer,
+	QpdfOptimizer,
+}
+
+// SetOptimizers sets the optimizers used by Optimize in order of preference,
+// e.g. to avoid Ghostscript. The first available one is used.
+func (t *CompileTask) SetOptimizers(optimizers ...Optimizer) {
+	t.optimizers = optimizers
+}
+
+// Optimizer returns the optimizer Optimize uses, nil if none is available.
+func (t *CompileTask) Optimizer() Optimizer {
+	optimizers := t.optimizers
+	if optimizers == nil {
+		optimizers = DefaultOptimizers
+	}
+	for _, optimizer := range optimizers {
+		if optimizer.Available(t) {
+			return optimizer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package latex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Option configures a CompileTask on construction.
+type Option func(t *CompileTask) error
+
+// WithSourceDir sets the directory containing the TeX sources.
+func WithSourceDir(dir string) Option {
+	return func(t *CompileTask) error {
+		t.SetSourceDir(dir)
+		return nil
+	}
+}
+
+// WithSourceFS sets the file system containing the TeX sources, see
+// SetSourceFS.
+func WithSourceFS(fsys fs.FS) Option {
+	return func(t *CompileTask) error {
+		t.SetSourceFS(fsys)
+		return nil
+	}
+}
+
+// WithCompileDir sets the directory used for compilation, a new temporary
+// directory if dir is empty.
+func WithCompileDir(dir string) Option {
+	return func(t *CompileTask) error {
+		t.SetCompileDir(dir)
+		return nil
+	}
+}
+
+// WithCompileFilename sets the name of the TeX file to be compiled.
+func WithCompileFilename(name string) Option {
+	return func(t *CompileTask) error {
+		t.SetCompileFilename(name)
+		return nil
+	}
+}
+
+// WithEngine sets the TeX engine used by Compile.
+func WithEngine(engine string) Option {
+	return func(t *CompileTask) error {
+		return t.SetEngine(engine)
+	}
+}
+
+// WithVerbosity sets the verbosity of external tools.
+func WithVerbosity(verbosity VerbosityLevel) Option {
+	return func(t *CompileTask) error {
+		t.SetVerbosity(verbosity)
+		return nil
+	}
+}
+
+// WithResolveSymlinks sets if symlinks are resolved when copying to the
+// compile directory.
+func WithResolveSymlinks(resolveSymlinks bool) Option {
+	return func(t *CompileTask) error {
+		t.SetResolveSymlinks(resolveSymlinks)
+		return nil
+	}
+}
+
+// WithContext sets the context external tools are run with.
+func WithContext(ctx context.Context) Option {
+	return func(t *CompileTask) error {
+		t.SetContext(ctx)
+		return nil
+	}
+}
+
+// WithEnvironment sets the environment external tools are run with.
+func WithEnvironment(env *Environment) Option {
+	return func(t *CompileTask) error {
+		t.SetEnvironment(env)
+		return nil
+	}
+}
+
+// WithToolchain sets the toolchain external tools are run with.
+func WithToolchain(toolchain *Toolchain) Option {
+	return func(t *CompileTask) error {
+		t.SetToolchain(toolchain)
+		return nil
+	}
+}
+
+// NewValidCompileTask returns a CompileTask configured by opts, failing if
+// an option fails or the resulting configuration is invalid (see
+// Validate).
+func NewValidCompileTask(opts ...Option) (*CompileTask, error) {
+	task := NewCompileTask()
+	t := &task
+	err := t.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *CompileTask) apply(opts []Option) error {
+	for _, opt := range opts {
+		err := opt(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration of the task: the source directory (or
+// the source archive or file system if set) must exist and contain the
+// compile file, and the engine and verbosity must be known.
+func (t *CompileTask) Validate() error {
+	var errs []error
+	if t.sourceArchive != "" {
+		if _, err := os.Stat(t.sourceArchive); err != nil {
+			errs = append(errs, fmt.Errorf("source archive: %w", err))
+		}
+	} else if t.sourceFS != nil {
+		if t.compileFilename != "" {
+			_, err := fs.Stat(t.sourceFS, t.CompileFilename())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("compile file: %w", err))
+			}
+		}
+	} else if t.SourceDir() == "" {
+		errs = append(errs, errors.New("no source directory set"))
+	} else if info, err := os.Stat(t.SourceDir()); err != nil {
+		errs = append(errs, fmt.Errorf("source directory: %w", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("source directory %s is not a directory", t.SourceDir()))
+	} else if t.compileFilename != "" {
+		_, err := os.Stat(filepath.Join(t.SourceDir(), t.CompileFilename()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("compile file: %w", err))
+		}
+	}
+	if _, ok := LookupEngine(t.Engine()); !ok {
+		errs = append(errs, fmt.Errorf("unknown TeX engine %q", t.Engine()))
+	}
+	if t.verbosity > VerbosityAll {
+		errs = append(errs, fmt.Errorf("unknown verbosity %d", t.verbosity))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package latex
+
+// SetBookmarks replaces the outline of a PDF with the given bookmarks, whose
+// levels are taken from their nesting. Requires qpdf.
+func (t *CompileTask) SetBookmarks(file string, bookmarks []Bookmark) error {
+	file = t.pdfPath(file)
+	o, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+	o.setOutline(bookmarks)
+	return t.writePdfObjects(file, o)
+}
+
+// setOutline replaces the document outline. Top level entries are shown
+// expanded.
+func (o *pdfObjects) setOutline(bookmarks []Bookmark) {
+	pages := o.pages()
+	catalog, catalogRef := o.catalog()
+	rootRef := o.add(nil)
+
+	// build returns the first and last entry and the number of entries
+	// visible if the parent is open.
+	var build func(items []Bookmark, parent string) (string, string, int)
+	build = func(items []Bookmark, parent string) (first, last string, visible int) {
+		refs := make([]string, len(items))
+		for i := range items {
+			refs[i] = o.add(nil)
+		}
+		for i, item := range items {
+			entry := map[string]interface{}{
+				"/Title":  pdfTextString(item.Title),
+				"/Parent": parent,
+			}
+			if i > 0 {
+				entry["/Prev"] = refs[i-1]
+			}
+			if i+1 < len(refs) {
+				entry["/Next"] = refs[i+1]
+			}
+			if item.Page >= 1 && item.Page <= len(pages) {
+				entry["/Dest"] = []interface{}{pages[item.Page-1], "/XYZ", nil, nil, nil}
+			}
+			visible++
+			if len(item.Children) > 0 {
+				childFirst, childLast, childVisible := build(item.Children, refs[i])
+				entry["/First"] = childFirst
+				entry["/Last"] = childLast
+				if item.Level <= 1 {
+					entry["/Count"] = childVisible
+					visible += childVisible
+				} else {
+					// negative counts mark closed entries
+					entry["/Count"] = -childVisible
+				}
+			}
+			o.set(refs[i], entry)
+		}
+		if len(refs) == 0 {
+			return "", "", 0
+		}
+		return refs[0], refs[len(refs)-1], visible
+	}
+
+	first, last, count := build(bookmarks, rootRef)
+	root := map[string]interface{}{"/Type": "/Outlines"}
+	if count > 0 {
+		root["/First"] = first
+		root["/Last"] = last
+		root["/Count"] = count
+	}
+	o.set(rootRef, root)
+
+	catalog = copyPdfDict(catalog)
+	catalog["/Outlines"] = rootRef
+	if count > 0 {
+		catalog["/PageMode"] = "/UseOutlines"
+	}
+	o.set(catalogRef, catalog)
+}
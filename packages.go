@@ -0,0 +1,132 @@
+package latex
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PackageInfo describes a class, package or file loaded during compilation
+// as announced in the log.
+type PackageInfo struct {
+	// Kind is "class", "package" or "file".
+	Kind        string
+	Name        string
+	Date        string
+	Version     string
+	Description string
+}
+
+// PackageReport lists the TeX distribution, LaTeX kernel and all packages a
+// document depends on.
+type PackageReport struct {
+	// Engine is the banner of the TeX engine, including the distribution
+	// (e.g. "TeX Live 2023") and the format.
+	Engine   string
+	Kernel   string
+	Packages []PackageInfo
+}
+
+// Package returns the entry of a package or class by name.
+func (r PackageReport) Package(name string) (PackageInfo, bool) {
+	for _, p := range r.Packages {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return PackageInfo{}, false
+}
+
+var (
+	logPackageLine = regexp.MustCompile(`^(Document Class|Package|File): (.*)$`)
+	logDate        = regexp.MustCompile(`^\d{4}[/-]\d{2}[/-]\d{2}$`)
+	logVersion     = regexp.MustCompile(`^v?\d+(\.\d+)*[a-z]*$`)
+)
+
+// ParsePackageUsage reads a LaTeX log and extracts all loaded classes,
+// packages and files with their versions.
+func ParsePackageUsage(r io.Reader) (PackageReport, error) {
+	report := PackageReport{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			report.Engine = strings.TrimSpace(line)
+			first = false
+			continue
+		}
+		if report.Kernel == "" && strings.HasPrefix(line, "LaTeX2e <") {
+			report.Kernel = strings.TrimSpace(line)
+			continue
+		}
+		match := logPackageLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		info := parsePackageInfo(match[2])
+		switch match[1] {
+		case "Document Class":
+			info.Kind = "class"
+		case "Package":
+			info.Kind = "package"
+		default:
+			info.Kind = "file"
+		}
+		if info.Name == "" || seen[info.Kind+info.Name] {
+			continue
+		}
+		seen[info.Kind+info.Name] = true
+		report.Packages = append(report.Packages, info)
+	}
+	return report, scanner.Err()
+}
+
+func parsePackageInfo(s string) PackageInfo {
+	info := PackageInfo{}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return info
+	}
+	info.Name = fields[0]
+	fields = fields[1:]
+	if len(fields) > 0 && logDate.MatchString(fields[0]) {
+		info.Date = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && logVersion.MatchString(fields[0]) {
+		info.Version = fields[0]
+		fields = fields[1:]
+	}
+	info.Description = strings.Join(fields, " ")
+	return info
+}
+
+// PackageUsage parses the log of the last compilation and reports all
+// classes and packages the document depends on, e.g. for auditing or for
+// pinning TeX Live snapshots. Run and Build report the same in
+// CompileResult.Packages.
+func (t *CompileTask) PackageUsage() (PackageReport, error) {
+	return parsePackageUsageFile(t.LogFile())
+}
+
+// parsePackageUsageFile reads the package usage from a log file.
+func parsePackageUsageFile(log string) (PackageReport, error) {
+	f, err := os.Open(log)
+	if err != nil {
+		return PackageReport{}, err
+	}
+	defer f.Close()
+	return ParsePackageUsage(f)
+}
+
+// LogFile returns the path of the log file written when compiling the
+// compile file.
+func (t *CompileTask) LogFile() string {
+	return filepath.Join(t.CompileDirInternal(), t.texFilenameToExt(t.CompileFilename(), "log"))
+}
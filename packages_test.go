@@ -0,0 +1,50 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const packagesLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25 (TeX Live 2023) (preloaded format=pdflatex 2023.5.1)  16 OCT 2026 10:00
+entering extended mode
+LaTeX2e <2022-11-01> patch level 1
+Document Class: article 2022/07/02 v1.4n Standard LaTeX document class
+File: size10.clo 2022/07/02 v1.4n Standard LaTeX file (size option)
+Package: amsmath 2022/04/08 v2.17n AMS math features
+Package: amsmath 2022/04/08 v2.17n AMS math features
+Package: hyperref
+)
+`
+
+func TestCompileResultPackages(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "document.log")
+	if err := os.WriteFile(log, []byte(packagesLog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := &CompileResult{Log: log}
+	result.parseLog()
+	if result.Packages == nil {
+		t.Fatal("Packages is nil")
+	}
+	want := PackageReport{
+		Engine: "This is pdfTeX, Version 3.141592653-2.6-1.40.25 (TeX Live 2023) (preloaded format=pdflatex 2023.5.1)  16 OCT 2026 10:00",
+		Kernel: "LaTeX2e <2022-11-01> patch level 1",
+		Packages: []PackageInfo{
+			{Kind: "class", Name: "article", Date: "2022/07/02", Version: "v1.4n", Description: "Standard LaTeX document class"},
+			{Kind: "file", Name: "size10.clo", Date: "2022/07/02", Version: "v1.4n", Description: "Standard LaTeX file (size option)"},
+			{Kind: "package", Name: "amsmath", Date: "2022/04/08", Version: "v2.17n", Description: "AMS math features"},
+			{Kind: "package", Name: "hyperref"},
+		},
+	}
+	if !reflect.DeepEqual(*result.Packages, want) {
+		t.Errorf("Packages = %+v, want %+v", *result.Packages, want)
+	}
+
+	missing := &CompileResult{Log: filepath.Join(t.TempDir(), "missing.log")}
+	missing.parseLog()
+	if missing.Packages != nil {
+		t.Errorf("Packages of a missing log = %+v, want nil", missing.Packages)
+	}
+}
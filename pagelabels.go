@@ -0,0 +1,101 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PageLabelStyle is the numbering style of a PageLabel.
+type PageLabelStyle string
+
+// Numbering styles of page labels.
+const (
+	PageLabelArabic       PageLabelStyle = "D"
+	PageLabelRomanLower   PageLabelStyle = "r"
+	PageLabelRomanUpper   PageLabelStyle = "R"
+	PageLabelLettersLower PageLabelStyle = "a"
+	PageLabelLettersUpper PageLabelStyle = "A"
+	// PageLabelNone labels the pages with the prefix only.
+	PageLabelNone PageLabelStyle = ""
+)
+
+// PageLabel labels the pages from Page on up to the next label, which
+// viewers show instead of the page index.
+type PageLabel struct {
+	// Page is the first page labelled, starting at 1.
+	Page  int
+	Style PageLabelStyle
+	// Prefix precedes the numbers, like "A-" for appendix pages.
+	Prefix string
+	// Start is the number of the first page, 1 by default.
+	Start int
+}
+
+// SetPageLabels replaces the page labels of a PDF, so the page numbers shown
+// by viewers match the printed folios when the sources can't be changed,
+// e.g. roman numbers for the front matter followed by arabic ones:
+//
+//	task.SetPageLabels("", []latex.PageLabel{
+//		{Page: 1, Style: latex.PageLabelRomanLower},
+//		{Page: 5, Style: latex.PageLabelArabic},
+//		{Page: 120, Style: latex.PageLabelArabic, Prefix: "A-"},
+//	})
+//
+// The labels must be in page order starting at page 1. Use no labels to
+// remove them. It requires qpdf and defaults to the output of the compiled
+// file.
+func (t *CompileTask) SetPageLabels(file string, labels []PageLabel) error {
+	file = t.pdfPath(file)
+	o, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+	err = o.setPageLabels(labels)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return t.writePdfObjects(file, o)
+}
+
+// setPageLabels replaces the page label tree of the catalog.
+func (o *pdfObjects) setPageLabels(labels []PageLabel) error {
+	pages := len(o.pages())
+	nums := []interface{}{}
+	for i, label := range labels {
+		switch {
+		case i == 0 && label.Page != 1:
+			return errors.New("page labels must start at page 1")
+		case i > 0 && label.Page <= labels[i-1].Page:
+			return fmt.Errorf("page label for page %d out of order", label.Page)
+		case label.Page > pages:
+			return fmt.Errorf("page label for page %d of %d", label.Page, pages)
+		case label.Start < 0:
+			return fmt.Errorf("negative start of page label for page %d", label.Page)
+		}
+		entry := map[string]interface{}{}
+		switch label.Style {
+		case PageLabelNone:
+		case PageLabelArabic, PageLabelRomanLower, PageLabelRomanUpper, PageLabelLettersLower, PageLabelLettersUpper:
+			entry["/S"] = "/" + string(label.Style)
+		default:
+			return fmt.Errorf("unknown page label style %q", label.Style)
+		}
+		if label.Prefix != "" {
+			entry["/P"] = pdfTextString(label.Prefix)
+		}
+		if label.Start > 1 {
+			entry["/St"] = label.Start
+		}
+		nums = append(nums, label.Page-1, entry)
+	}
+
+	catalog, catalogRef := o.catalog()
+	catalog = copyPdfDict(catalog)
+	if len(nums) == 0 {
+		delete(catalog, "/PageLabels")
+	} else {
+		catalog["/PageLabels"] = map[string]interface{}{"/Nums": nums}
+	}
+	o.set(catalogRef, catalog)
+	return nil
+}
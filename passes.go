@@ -0,0 +1,103 @@
+package latex
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Pass is a step of a build pipeline, like a LaTeX run or the final
+// optimization.
+type Pass struct {
+	Name string
+	Run  func(*CompileTask) error
+	// Optional passes are skipped if they would exceed the budget.
+	Optional bool
+	// Estimate is the expected duration of the pass. If unset, the longest
+	// pass run so far is used as estimate.
+	Estimate time.Duration
+}
+
+// PassResult reports on a pipeline run by RunPasses.
+type PassResult struct {
+	// Degraded reports that optional passes were skipped to meet the budget.
+	Degraded bool
+	Skipped  []string
+	Duration time.Duration
+}
+
+// Budget returns the wall-clock budget of RunPasses, 0 if unlimited.
+func (t *CompileTask) Budget() time.Duration {
+	return t.budget
+}
+
+// SetBudget limits the wall-clock time of RunPasses, Build and Run. Optional
+// passes are skipped if running them would exceed the budget, so a degraded
+// document is delivered instead of none. For Build and Run these are the
+// extra engine runs for cross-references and fallback fonts and the
+// optional steps (see OptionalStep). Use 0 to disable the limit.
+func (t *CompileTask) SetBudget(budget time.Duration) {
+	t.budget = budget
+}
+
+// budgetClock tracks the time spent by a pipeline against the budget of its
+// task.
+type budgetClock struct {
+	budget  time.Duration
+	start   time.Time
+	longest time.Duration
+}
+
+func (t *CompileTask) startBudget() *budgetClock {
+	return &budgetClock{budget: t.budget, start: time.Now()}
+}
+
+// allows reports whether an optional pass expected to take estimate fits in
+// the budget. Without an estimate the longest pass so far is used.
+func (c *budgetClock) allows(estimate time.Duration) bool {
+	if c.budget <= 0 {
+		return true
+	}
+	if estimate == 0 {
+		estimate = c.longest
+	}
+	return time.Since(c.start)+estimate <= c.budget
+}
+
+// measure records a pass started at start.
+func (c *budgetClock) measure(start time.Time) {
+	if elapsed := time.Since(start); elapsed > c.longest {
+		c.longest = elapsed
+	}
+}
+
+// RunPasses runs the passes in order. It stops at the first failing pass.
+// Required passes are always run, even if the budget is exhausted.
+func (t *CompileTask) RunPasses(passes ...Pass) (PassResult, error) {
+	result := PassResult{}
+	clock := t.startBudget()
+	ctx := t.Context()
+	for _, pass := range passes {
+		if ctx.Err() != nil {
+			result.Duration = time.Since(clock.start)
+			return result, fmt.Errorf("pass %s: %w", pass.Name, context.Cause(ctx))
+		}
+		if pass.Optional && !clock.allows(pass.Estimate) {
+			result.Degraded = true
+			result.Skipped = append(result.Skipped, pass.Name)
+			continue
+		}
+
+		passStart := time.Now()
+		err := t.TraceStep(pass.Name, func() error {
+			return pass.Run(t)
+		})
+		clock.measure(passStart)
+		if err != nil {
+			result.Duration = time.Since(clock.start)
+			return result, fmt.Errorf("pass %s: %w", pass.Name, err)
+		}
+	}
+	result.Duration = time.Since(clock.start)
+	return result, nil
+}
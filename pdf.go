@@ -0,0 +1,200 @@
+package latex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PageArtifact is a single page of a compiled document, stored as separate
+// PDF file.
+type PageArtifact struct {
+	Number int
+	File   string
+}
+
+// runTool runs an external helper tool (e.g. for post-processing) silently
+// within the compilation directory. Output of failed runs is part of the
+// error.
+func (t *CompileTask) runTool(name string, args ...string) (*toolResult, error) {
+	_, err := t.lookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	command, err := t.commandIn(t.CompileDirInternal(), name, args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := t.execute(command, VerbosityNone)
+	if err != nil {
+		return result, fmt.Errorf("%s failed: %w\n%s%s", name, err, result.Output(), result.Error())
+	}
+	return result, nil
+}
+
+// runToolJSON runs a tool silently like runTool and decodes its JSON output
+// into v while it is produced, without holding the output in memory.
+func (t *CompileTask) runToolJSON(v interface{}, name string, args ...string) error {
+	_, err := t.lookPath(name)
+	if err != nil {
+		return err
+	}
+	command, err := t.commandIn(t.CompileDirInternal(), name, args...)
+	if err != nil {
+		return err
+	}
+	r, w := io.Pipe()
+	decoded := make(chan error, 1)
+	go func() {
+		err := json.NewDecoder(r).Decode(v)
+		// drain so the tool doesn't block
+		io.Copy(io.Discard, r)
+		decoded <- err
+	}()
+	result, err := t.executeTo(command, VerbosityNone, w)
+	w.Close()
+	decodeErr := <-decoded
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", name, err, result.Error())
+	}
+	return decodeErr
+}
+
+// WriteOutput streams a PDF from the compilation directory to w, e.g. into
+// an HTTP response, without loading it into memory. It defaults to the PDF
+// of the compiled file.
+func (t *CompileTask) WriteOutput(w io.Writer, file string) (int64, error) {
+	f, err := os.Open(t.pdfPath(file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// pdfPath resolves a PDF filename relative to the compilation directory,
+// defaulting to the PDF of the compiled file.
+func (t *CompileTask) pdfPath(file string) string {
+	file = t.defaultCompilePdfFilename(file)
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(t.CompileDirInternal(), file)
+}
+
+// PageCount returns the number of pages of a PDF file. It defaults to the
+// output of the compiled file.
+func (t *CompileTask) PageCount(file string) (int, error) {
+	file = t.pdfPath(file)
+	var (
+		result *toolResult
+		err    error
+	)
+	switch {
+	case t.hasCommand("qpdf"):
+		result, err = t.runTool("qpdf", "--show-npages", file)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(strings.TrimSpace(result.Output()))
+	case t.hasCommand("pdfinfo"):
+		result, err = t.runTool("pdfinfo", file)
+		if err != nil {
+			return 0, err
+		}
+		for _, line := range strings.Split(result.Output(), "\n") {
+			if strings.HasPrefix(line, "Pages:") {
+				return strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Pages:")))
+			}
+		}
+		return 0, fmt.Errorf("could not determine page count of %s", file)
+	default:
+		result, err = t.runTool("gs", "-q", "-dNODISPLAY", "-dSAFER", "-dBATCH",
+			"--permit-file-read="+file,
+			"-c", fmt.Sprintf("(%s) (r) file runpdfbegin pdfpagecount = quit", psEscape(file)))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(strings.TrimSpace(result.Output()))
+	}
+}
+
+// EmitPages splits a PDF into single page files using Ghostscript, sending
+// every page to ch as soon as it is written so consumers can start working
+// with the first pages while the rest is being processed. ch is closed when
+// all pages have been sent or an error occurred. The pages are stored in the
+// "pages" subdirectory of the compilation directory.
+func (t *CompileTask) EmitPages(file string, ch chan<- PageArtifact) error {
+	defer close(ch)
+	file = t.pdfPath(file)
+
+	outputDir := filepath.Join(t.CompileDirInternal(), "pages")
+	err := t.context().EnsureDirExists(outputDir, 0700)
+	if err != nil {
+		return err
+	}
+	err = t.grantAccess(outputDir)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	changes := watchDir(ctx, outputDir)
+
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	pageFile := func(page int) string {
+		return filepath.Join(outputDir, fmt.Sprintf("%s-%d.pdf", base, page))
+	}
+	// pages of an earlier split would be taken as written
+	for page := 1; ; page++ {
+		if os.Remove(pageFile(page)) != nil {
+			break
+		}
+	}
+	// Ghostscript writes a file per page, replacing %d by the page number
+	output := filepath.Join(outputDir, strings.ReplaceAll(base, "%", "%%")+"-%d.pdf")
+	done := make(chan error, 1)
+	go func() {
+		_, err := t.runTool("gs", "-q", "-dNOPAUSE", "-dBATCH", "-dSAFER",
+			"-sDEVICE=pdfwrite", "-o", output, file)
+		done <- err
+	}()
+
+	// a page is complete once the next one is started or Ghostscript exits
+	next := 1
+	emit := func(finished bool) {
+		for {
+			if _, err := os.Stat(pageFile(next)); err != nil {
+				return
+			}
+			if _, err := os.Stat(pageFile(next + 1)); err != nil && !finished {
+				return
+			}
+			ch <- PageArtifact{Number: next, File: pageFile(next)}
+			next++
+		}
+	}
+	for {
+		select {
+		case <-changes:
+			emit(false)
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+			emit(true)
+			return nil
+		}
+	}
+}
+
+// psEscape escapes a string for use as PostScript string literal.
+func psEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
@@ -0,0 +1,162 @@
+package latex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PdfALevel is a conformance level of PDF/A, the ISO standard for archiving
+// documents.
+type PdfALevel string
+
+// PDF/A conformance levels supported by ConvertPdfA.
+const (
+	PdfA1b PdfALevel = "1b"
+	PdfA2b PdfALevel = "2b"
+	PdfA3b PdfALevel = "3b"
+)
+
+// defaultPdfAProfile is the sRGB profile built into Ghostscript.
+const defaultPdfAProfile = "%rom%iccprofiles/srgb.icc"
+
+// pdfADef is the PostScript prologue declaring the output intent of PDF/A
+// documents, like PDFA_def.ps shipped with Ghostscript. It is formatted with
+// the profile file, its number of components and the output condition.
+const pdfADef = `%%!
+/ICCProfile (%s) def
+[/_objdef {icc_PDFA} /type /stream /OBJ pdfmark
+[{icc_PDFA} <</N %d>> /PUT pdfmark
+[{icc_PDFA} ICCProfile (r) file /PUT pdfmark
+[/_objdef {OutputIntent_PDFA} /type /dict /OBJ pdfmark
+[{OutputIntent_PDFA} <<
+  /Type /OutputIntent
+  /S /GTS_PDFA1
+  /DestOutputProfile {icc_PDFA}
+  /OutputConditionIdentifier (%s)
+>> /PUT pdfmark
+[{Catalog} <</OutputIntents [ {OutputIntent_PDFA} ]>> /PUT pdfmark
+`
+
+// PdfAProfile returns the ICC profile of the output intent of PDF/A
+// documents, empty for Ghostscript's sRGB profile.
+func (t *CompileTask) PdfAProfile() string {
+	return t.pdfAProfile
+}
+
+// SetPdfAProfile sets the ICC profile embedded as output intent by
+// ConvertPdfA, like a FOGRA39 profile for print. Colors are converted to its
+// color space (RGB, CMYK or gray, read from the profile). Use an empty file
+// for Ghostscript's sRGB profile.
+func (t *CompileTask) SetPdfAProfile(file string) {
+	t.pdfAProfile = file
+}
+
+// ConvertPdfA converts a PDF into PDF/A of the given level using Ghostscript,
+// defaulting to the output of the compiled file. The ICC profile (see
+// SetPdfAProfile) is embedded as output intent and all colors are converted
+// to its color space. Content which can't be represented in PDF/A, like
+// transparency in PDF/A-1b, fails the conversion instead of silently
+// producing a plain PDF.
+//
+// Stamp metadata before converting, as changing the PDF afterwards may break
+// its conformance. Use a validator like veraPDF to verify archival copies.
+func (t *CompileTask) ConvertPdfA(file string, level PdfALevel) error {
+	file = t.pdfPath(file)
+	var part string
+	switch level {
+	case PdfA1b:
+		part = "1"
+	case PdfA2b:
+		part = "2"
+	case PdfA3b:
+		part = "3"
+	default:
+		return fmt.Errorf("unsupported PDF/A level %q", level)
+	}
+
+	profile := t.pdfAProfile
+	components, strategy := 3, "RGB"
+	condition := "sRGB"
+	if profile == "" {
+		profile = defaultPdfAProfile
+	} else {
+		var err error
+		profile, err = filepath.Abs(profile)
+		if err != nil {
+			return err
+		}
+		components, strategy, err = iccColorSpace(profile)
+		if err != nil {
+			return err
+		}
+		condition = strings.TrimSuffix(filepath.Base(profile), filepath.Ext(profile))
+	}
+
+	def, err := os.CreateTemp(filepath.Dir(file), ".go-latex-pdfa-*.ps")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(def.Name())
+	_, err = fmt.Fprintf(def, pdfADef, psEscape(profile), components, psEscape(condition))
+	closeErr := def.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = t.grantAccess(def.Name())
+	}
+	if err != nil {
+		return err
+	}
+
+	return t.replaceWith(file, func(output string) error {
+		args := []string{"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-dNOOUTERSAVE",
+			"-sDEVICE=pdfwrite", "-dPDFA=" + part, "-dPDFACompatibilityPolicy=2",
+			"-sColorConversionStrategy=" + strategy,
+		}
+		if level == PdfA1b {
+			args = append(args, "-dCompatibilityLevel=1.4")
+		}
+		if profile != defaultPdfAProfile {
+			args = append(args, "--permit-file-read="+profile)
+		}
+		args = append(args, "-o", output, def.Name(), file)
+		_, err := t.runTool("gs", args...)
+		return err
+	})
+}
+
+// pdfAStep returns the function of the step converting to a PDF/A level,
+// named like "pdfa-2b".
+func pdfAStep(level PdfALevel) func(t *CompileTask, file string) error {
+	return func(t *CompileTask, file string) error {
+		return t.ConvertPdfA(t.texFilenameToPdf(t.defaultCompileFilename(file)), level)
+	}
+}
+
+// iccColorSpace returns the number of components of the color space of an
+// ICC profile and the matching color conversion strategy of Ghostscript.
+func iccColorSpace(profile string) (int, string, error) {
+	f, err := os.Open(profile)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	header := make([]byte, 20)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: not an ICC profile", profile)
+	}
+	switch string(header[16:20]) {
+	case "RGB ":
+		return 3, "RGB", nil
+	case "CMYK":
+		return 4, "CMYK", nil
+	case "GRAY":
+		return 1, "Gray", nil
+	}
+	return 0, "", fmt.Errorf("%s: unsupported color space %q of ICC profile", profile, header[16:20])
+}
@@ -0,0 +1,246 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pdfObjects is the object graph of a PDF as exposed by qpdf's JSON format
+// (version 2). Names are encoded as "/Name", references as "N G R", text
+// strings as "u:text" and binary strings as "b:hex".
+type pdfObjects struct {
+	header  map[string]interface{}
+	objects map[string]interface{}
+	maxID   int
+	// updates collects changed objects keyed like objects
+	updates map[string]interface{}
+}
+
+// readPdfObjects loads the object graph of a PDF (without stream data).
+func (t *CompileTask) readPdfObjects(file string) (*pdfObjects, error) {
+	var doc struct {
+		Qpdf []map[string]interface{} `json:"qpdf"`
+	}
+	err := t.runToolJSON(&doc, "qpdf", "--json=2", "--json-key=qpdf", "--json-stream-data=none", file)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Qpdf) != 2 {
+		return nil, fmt.Errorf("unexpected qpdf JSON output for %s", file)
+	}
+	o := &pdfObjects{
+		header:  doc.Qpdf[0],
+		objects: doc.Qpdf[1],
+		updates: make(map[string]interface{}),
+	}
+	if maxID, ok := o.header["maxobjectid"].(float64); ok {
+		o.maxID = int(maxID)
+	}
+	return o, nil
+}
+
+// value returns the value of an object given by reference ("N G R").
+func (o *pdfObjects) value(ref string) interface{} {
+	key := "obj:" + ref
+	object, ok := o.updates[key]
+	if !ok {
+		object = o.objects[key]
+	}
+	if wrapper, ok := object.(map[string]interface{}); ok {
+		if value, ok := wrapper["value"]; ok {
+			return value
+		}
+		if stream, ok := wrapper["stream"].(map[string]interface{}); ok {
+			return stream["dict"]
+		}
+	}
+	return nil
+}
+
+// dict resolves v (an inline dictionary or a reference to one) into a
+// dictionary. It returns the reference if there is one.
+func (o *pdfObjects) dict(v interface{}) (map[string]interface{}, string) {
+	if ref, ok := v.(string); ok && isPdfRef(ref) {
+		d, _ := o.value(ref).(map[string]interface{})
+		return d, ref
+	}
+	d, _ := v.(map[string]interface{})
+	return d, ""
+}
+
+func (o *pdfObjects) trailer() map[string]interface{} {
+	key := "trailer"
+	object, ok := o.updates[key]
+	if !ok {
+		object = o.objects[key]
+	}
+	if wrapper, ok := object.(map[string]interface{}); ok {
+		d, _ := wrapper["value"].(map[string]interface{})
+		return d
+	}
+	return nil
+}
+
+// catalog returns the document catalog and its reference.
+func (o *pdfObjects) catalog() (map[string]interface{}, string) {
+	return o.dict(o.trailer()["/Root"])
+}
+
+// info returns the document information dictionary and its reference,
+// creating an empty one if there is none yet.
+func (o *pdfObjects) info() (map[string]interface{}, string) {
+	info, ref := o.dict(o.trailer()["/Info"])
+	if ref == "" {
+		info = map[string]interface{}{}
+		ref = o.add(info)
+		trailer := copyPdfDict(o.trailer())
+		trailer["/Info"] = ref
+		o.updates["trailer"] = map[string]interface{}{"value": trailer}
+	}
+	return info, ref
+}
+
+// set records a new value for an object.
+func (o *pdfObjects) set(ref string, value interface{}) {
+	o.updates["obj:"+ref] = map[string]interface{}{"value": value}
+}
+
+// setStream records a new stream object with the given dictionary and
+// (unencoded) data.
+func (o *pdfObjects) setStream(ref string, dict map[string]interface{}, data []byte) {
+	o.updates["obj:"+ref] = map[string]interface{}{
+		"stream": map[string]interface{}{
+			"dict": dict,
+			"data": data,
+		},
+	}
+}
+
+// add records a new object, returning its reference.
+func (o *pdfObjects) add(value interface{}) string {
+	o.maxID++
+	ref := fmt.Sprintf("%d 0 R", o.maxID)
+	o.set(ref, value)
+	return ref
+}
+
+// pages returns the references of all pages in order.
+func (o *pdfObjects) pages() []string {
+	root, _ := o.catalog()
+	pages := []string{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		node, ref := o.dict(v)
+		if node == nil {
+			return
+		}
+		if node["/Type"] == "/Page" {
+			pages = append(pages, ref)
+			return
+		}
+		kids, _ := node["/Kids"].([]interface{})
+		for _, kid := range kids {
+			walk(kid)
+		}
+	}
+	walk(root["/Pages"])
+	return pages
+}
+
+// writePdfObjects applies all recorded updates to file.
+func (t *CompileTask) writePdfObjects(file string, o *pdfObjects) error {
+	if len(o.updates) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"qpdf": []interface{}{
+			map[string]interface{}{"jsonversion": 2},
+			o.updates,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	patchFile, err := os.CreateTemp(filepath.Dir(file), ".qpdf-update-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(patchFile.Name())
+	_, err = patchFile.Write(patch)
+	patchFile.Close()
+	if err != nil {
+		return err
+	}
+	return t.replaceWith(file, func(output string) error {
+		_, err := t.runTool("qpdf", file, output, "--update-from-json="+patchFile.Name())
+		return err
+	})
+}
+
+// replaceWith runs a transformation writing to a temporary file next to file
+// and replaces file with the result if it succeeded.
+func (t *CompileTask) replaceWith(file string, transform func(output string) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(file), ".go-latex-*"+filepath.Ext(file))
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+	err = t.grantAccess(temp.Name())
+	if err != nil {
+		return err
+	}
+	err = transform(temp.Name())
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+func isPdfRef(s string) bool {
+	parts := strings.Fields(s)
+	return len(parts) == 3 && parts[2] == "R"
+}
+
+// pdfText encodes s as PDF text string in qpdf's JSON format.
+func pdfTextString(s string) string {
+	return "u:" + s
+}
+
+// pdfStringValue decodes a text string from qpdf's JSON format.
+func pdfStringValue(v interface{}) string {
+	s, _ := v.(string)
+	if strings.HasPrefix(s, "u:") {
+		return s[2:]
+	}
+	return ""
+}
+
+func copyPdfDict(d map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(d))
+	for key, value := range d {
+		c[key] = value
+	}
+	return c
+}
+
+// pageSize returns the width and height of a page from its (possibly
+// inherited) media box, A4 if there is none.
+func (o *pdfObjects) pageSize(ref string) (float64, float64) {
+	node, _ := o.dict(ref)
+	for depth := 0; node != nil && depth < 32; depth++ {
+		if box, ok := o.resolve(node["/MediaBox"]).([]interface{}); ok && len(box) == 4 {
+			width := pdfNumber(o.resolve(box[2])) - pdfNumber(o.resolve(box[0]))
+			height := pdfNumber(o.resolve(box[3])) - pdfNumber(o.resolve(box[1]))
+			if rotate := int(pdfNumber(o.resolve(node["/Rotate"]))); rotate%180 != 0 {
+				width, height = height, width
+			}
+			return width, height
+		}
+		node, _ = o.dict(node["/Parent"])
+	}
+	return a4Width, a4Height
+}
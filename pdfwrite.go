@@ -0,0 +1,209 @@
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// simplePdf writes minimal PDF documents with text in the standard Helvetica
+// fonts without any external tool, for stamps and placeholder pages.
+type simplePdf struct {
+	pages []*simplePdfPage
+}
+
+type simplePdfPage struct {
+	width, height float64
+	opacity       float64
+	content       bytes.Buffer
+}
+
+// A4 page size in PDF points.
+const (
+	a4Width  = 595.28
+	a4Height = 841.89
+)
+
+func (d *simplePdf) addPage(width, height float64) *simplePdfPage {
+	page := &simplePdfPage{width: width, height: height}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// text draws s with its baseline starting at x, y. Bold selects
+// Helvetica-Bold.
+func (p *simplePdfPage) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfLiteral(s))
+}
+
+// rotatedText draws s centered at x, y, rotated counterclockwise by angle
+// degrees.
+func (p *simplePdfPage) rotatedText(x, y, size, angle float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	offset := helveticaWidth(s, bold) * size / 2
+	// start half the width back along the baseline, a third of the size
+	// below the center
+	x -= offset*cos - size/3*sin
+	y -= offset*sin + size/3*cos
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.4f %.4f %.4f %.4f %.2f %.2f Tm (%s) Tj ET\n",
+		font, size, cos, sin, -sin, cos, x, y, pdfLiteral(s))
+}
+
+// gray sets the gray level of text and fills, 0 is black.
+func (p *simplePdfPage) gray(level float64) {
+	fmt.Fprintf(&p.content, "%.2f g\n", level)
+}
+
+// setOpacity makes the following content translucent, 1 is opaque. Pages
+// have one opacity only.
+func (p *simplePdfPage) setOpacity(opacity float64) {
+	p.opacity = opacity
+	p.content.WriteString("/GS1 gs\n")
+}
+
+// centeredText draws s centered horizontally at x.
+func (p *simplePdfPage) centeredText(x, y, size float64, bold bool, s string) {
+	p.text(x-helveticaWidth(s, bold)*size/2, y, size, bold, s)
+}
+
+// rect draws a rectangle outline.
+func (p *simplePdfPage) rect(x, y, width, height, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", lineWidth, x, y, width, height)
+}
+
+// writeTo writes the PDF document.
+func (d *simplePdf) writeTo(w io.Writer) error {
+	var b bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// objects 1-4 are catalog, page tree and fonts, pages and their content
+	// follow in pairs
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		extGState := ""
+		if page.opacity > 0 {
+			extGState = fmt.Sprintf(" /ExtGState << /GS1 << /ca %.2f /CA %.2f >> >>", page.opacity, page.opacity)
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >>%s >> /Contents %d 0 R >>",
+			page.width, page.height, extGState, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeFile writes the PDF document to file.
+func (d *simplePdf) writeFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = d.writeTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pdfLiteral encodes s in WinAnsiEncoding for a PDF literal string, replacing
+// characters which can't be encoded with a question mark.
+func pdfLiteral(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c, ok := winAnsi(r)
+		if !ok {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 0x20 || c > 0x7e {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// winAnsiSpecials maps the characters of WinAnsiEncoding which differ from
+// Latin-1.
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+func winAnsi(r rune) (byte, bool) {
+	if c, ok := winAnsiSpecials[r]; ok {
+		return c, true
+	}
+	if r == '\t' || (r >= 0x20 && r < 0x7f) || (r >= 0xa0 && r <= 0xff) {
+		return byte(r), true
+	}
+	return 0, false
+}
+
+// helveticaWidth estimates the width of s in Helvetica at size 1. It uses
+// the widths of common characters and an average for the rest, good enough
+// for centering short texts.
+func helveticaWidth(s string, bold bool) float64 {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case r == ' ':
+			width += 0.278
+		case strings.ContainsRune("il.,:;|!'", r):
+			width += 0.25
+		case strings.ContainsRune("fjtrI()[]/-", r):
+			width += 0.33
+		case r >= '0' && r <= '9':
+			width += 0.556
+		case strings.ContainsRune("mwMW", r):
+			width += 0.85
+		case r >= 'A' && r <= 'Z':
+			width += 0.68
+		default:
+			width += 0.54
+		}
+	}
+	if bold {
+		width *= 1.06
+	}
+	return width
+}
@@ -0,0 +1,64 @@
+package latex
+
+import (
+	"strings"
+)
+
+// WritePlaceholderPdf writes a single A4 page PDF to file stating that the
+// document titled title could not be generated, along with a summary of err.
+// It needs no external tools, so it works even if the TeX installation is
+// broken.
+func WritePlaceholderPdf(file, title string, err error) error {
+	doc := simplePdf{}
+	page := doc.addPage(a4Width, a4Height)
+	page.rect(56, 56, a4Width-112, a4Height-112, 1.5)
+	page.centeredText(a4Width/2, a4Height-140, 20, true, "Document not available")
+	y := a4Height - 175.0
+	if title != "" {
+		page.centeredText(a4Width/2, y, 12, false, title)
+		y -= 40
+	}
+	if err != nil {
+		page.text(80, y, 11, true, "Error summary:")
+		y -= 18
+		for _, line := range wrapText(err.Error(), 85, 45) {
+			page.text(80, y, 9, false, line)
+			y -= 12
+		}
+	}
+	return doc.writeFile(file)
+}
+
+// wrapText breaks s into lines of at most width characters, keeping at most
+// maxLines lines.
+func wrapText(s string, width, maxLines int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(strings.TrimSpace(s), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines-1], "...")
+	}
+	return lines
+}
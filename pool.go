@@ -0,0 +1,343 @@
+package latex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by EnginePool.RunEngine after Close.
+var ErrPoolClosed = errors.New("engine pool closed")
+
+// EngineRunner runs the passes of a builtin TeX engine for tasks instead of
+// starting the engine for every pass, see SetEngineRunner. EnginePool runs
+// them in process, the daemon package over a local socket.
+type EngineRunner interface {
+	// RunEngine runs engine on file in dir, returning the output of the
+	// engine. Failed runs return the output along with an error.
+	RunEngine(ctx context.Context, engine, dir, file string) (string, error)
+}
+
+// warmFirstLine is the first line given to pre-warmed engines. The engine
+// loads its format, reads the name of the file from stdin and compiles it in
+// nonstop mode. Reading from the terminal needs scroll mode.
+const warmFirstLine = `{\endlinechar=-1 \global\read16 to\golatexjob}\nonstopmode\input{\golatexjob}`
+
+// EnginePool keeps processes of a TeX engine started ahead of time, with
+// their format loaded and the file name database read, each waiting for a
+// file to compile in a directory of its own. Runs copy the directory of the
+// file there, and the files written by the engine back. Each process
+// compiles one file, a new one is started in its place right away.
+//
+// The pool starts the engines itself, so the toolchain, sandbox and
+// environment of tasks don't apply to them.
+type EnginePool struct {
+	engine  string
+	dir     string
+	tempDir bool
+	ready   chan *warmEngine
+
+	mu      sync.Mutex
+	closed  bool
+	engines map[*warmEngine]struct{}
+	wg      sync.WaitGroup
+}
+
+// warmEngine is an engine process waiting for the name of its file.
+type warmEngine struct {
+	dir    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output bytes.Buffer
+	done   chan error
+	// finished is set once done delivered the end of the process.
+	finished bool
+	err      error
+}
+
+// NewEnginePool starts size processes of a builtin TeX engine like
+// "pdflatex". They work in subdirectories of dir, a temporary directory is
+// used if dir is empty.
+func NewEnginePool(engine string, size int, dir string) (*EnginePool, error) {
+	if size < 1 {
+		return nil, errors.New("engine pool needs at least one engine")
+	}
+	if e, ok := LookupEngine(engine); !ok || !isBuiltinEngine(e) {
+		return nil, fmt.Errorf("engine pool can't run %s, only builtin TeX engines", engine)
+	}
+	if _, err := findTool(engine); err != nil {
+		return nil, err
+	}
+	p := &EnginePool{
+		engine:  engine,
+		dir:     dir,
+		ready:   make(chan *warmEngine, size),
+		engines: map[*warmEngine]struct{}{},
+	}
+	if dir == "" {
+		var err error
+		p.dir, err = os.MkdirTemp("", "go-latex-pool-")
+		if err != nil {
+			return nil, err
+		}
+		p.tempDir = true
+	}
+	for i := 0; i < size; i++ {
+		w, err := p.start(filepath.Join(p.dir, fmt.Sprintf("engine-%d", i)))
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.ready <- w
+	}
+	return p, nil
+}
+
+// Engine returns the name of the engine run by the pool.
+func (p *EnginePool) Engine() string {
+	return p.engine
+}
+
+// start starts an engine process working in dir, which is cleared first.
+func (p *EnginePool) start(dir string) (*warmEngine, error) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	w := &warmEngine{dir: dir, done: make(chan error, 1)}
+	w.cmd = exec.Command(p.engine, "-interaction=scrollmode", warmFirstLine)
+	w.cmd.Dir = dir
+	setProcessGroup(w.cmd)
+	w.cmd.Stdout = &w.output
+	w.cmd.Stderr = &w.output
+	w.stdin, err = w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	err = w.cmd.Start()
+	if err != nil {
+		return nil, diagnoseExec(w.cmd.Path, err)
+	}
+	p.engines[w] = struct{}{}
+	go func() {
+		w.done <- w.cmd.Wait()
+	}()
+	return w, nil
+}
+
+// RunEngine implements EngineRunner. It waits for an engine to become
+// available if all of them are busy.
+func (p *EnginePool) RunEngine(ctx context.Context, engine, dir, file string) (string, error) {
+	if engine != p.engine {
+		return "", fmt.Errorf("engine pool runs %s, not %s", p.engine, engine)
+	}
+	var w *warmEngine
+	select {
+	case w = <-p.ready:
+	case <-ctx.Done():
+		return "", context.Cause(ctx)
+	}
+	if w == nil {
+		return "", ErrPoolClosed
+	}
+	if w.err != nil {
+		// the replacement of an earlier engine failed to start
+		p.replace(w)
+		return "", w.err
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return "", ErrPoolClosed
+	}
+	p.wg.Add(1)
+	p.mu.Unlock()
+	defer p.wg.Done()
+	defer p.replace(w)
+
+	err := copyTree(dir, w.dir)
+	if err != nil {
+		return "", err
+	}
+	copied, err := fileTimes(w.dir)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(w.stdin, filepath.ToSlash(file)+"\n")
+	w.stdin.Close()
+	if err == nil {
+		select {
+		case err = <-w.done:
+			w.finished = true
+		case <-ctx.Done():
+			killProcessTree(w.cmd.Process)
+			<-w.done
+			w.finished = true
+			return w.output.String(), context.Cause(ctx)
+		}
+	}
+	copyErr := copyChangedFiles(w.dir, dir, copied)
+	if err == nil {
+		err = copyErr
+	}
+	return w.output.String(), err
+}
+
+// replace stops a used engine and makes a new one available in its place.
+// Failures to start it are returned by the run taking it.
+func (p *EnginePool) replace(used *warmEngine) {
+	p.mu.Lock()
+	delete(p.engines, used)
+	p.mu.Unlock()
+	if used.cmd != nil && !used.finished {
+		killProcessTree(used.cmd.Process)
+		<-used.done
+	}
+	w, err := p.start(used.dir)
+	if errors.Is(err, ErrPoolClosed) {
+		return
+	}
+	if err != nil {
+		w = &warmEngine{dir: used.dir, err: err}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		if w.cmd != nil {
+			killProcessTree(w.cmd.Process)
+		}
+		return
+	}
+	p.ready <- w
+}
+
+// Close stops the waiting engines and waits for running ones. The directory
+// of the pool is removed if it is temporary.
+func (p *EnginePool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	for w := range p.engines {
+		killProcessTree(w.cmd.Process)
+	}
+	close(p.ready)
+	p.mu.Unlock()
+	if p.tempDir {
+		return os.RemoveAll(p.dir)
+	}
+	return nil
+}
+
+// EngineRunner returns the runner of the passes of builtin engines, nil if
+// they are started for every pass.
+func (t *CompileTask) EngineRunner() EngineRunner {
+	return t.runner
+}
+
+// SetEngineRunner makes the passes of builtin TeX engines without further
+// arguments run by r, e.g. an *EnginePool or a daemon client. Passes are
+// run in nonstop mode then.
+func (t *CompileTask) SetEngineRunner(r EngineRunner) {
+	t.runner = r
+}
+
+// copyTree copies the files and directories in from into to.
+func copyTree(from, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0700)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		return nil
+	})
+}
+
+// fileState identifies a version of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// fileTimes returns the state of the regular files in dir by relative path.
+func fileTimes(dir string) (map[string]fileState, error) {
+	states := map[string]fileState{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		states[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return states, err
+}
+
+// copyChangedFiles copies the files in from which are new or changed
+// compared to before to the same relative path in to.
+func copyChangedFiles(from, to string, before map[string]fileState) error {
+	after, err := fileTimes(from)
+	if err != nil {
+		return err
+	}
+	for rel, state := range after {
+		if previous, ok := before[rel]; ok && previous.equal(state) {
+			continue
+		}
+		target := filepath.Join(to, rel)
+		err = os.MkdirAll(filepath.Dir(target), 0700)
+		if err != nil {
+			return err
+		}
+		err = copyFile(filepath.Join(from, rel), target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package latex
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// texLiveEngines lists the engines the builtin argument profiles are
+// defined for.
+var texLiveEngines = []string{"pdflatex", "xelatex", "lualatex"}
+
+// argProfiles maps profile names to the arguments per engine name. The
+// empty engine name holds the arguments for engines without own entry.
+type argProfiles map[string]map[string][]string
+
+func (p argProfiles) set(name, engine string, args []string) {
+	if p[name] == nil {
+		p[name] = map[string][]string{}
+	}
+	p[name][engine] = append([]string{}, args...)
+}
+
+// args returns the arguments of a profile for an engine and whether the
+// profile is defined.
+func (p argProfiles) args(name, engine string) ([]string, bool) {
+	profile, ok := p[name]
+	if !ok {
+		return nil, false
+	}
+	if args, ok := profile[engine]; ok {
+		return args, true
+	}
+	return profile[""], true
+}
+
+var profileRegistry = struct {
+	sync.RWMutex
+	profiles argProfiles
+}{
+	profiles: argProfiles{},
+}
+
+func init() {
+	for _, engine := range texLiveEngines {
+		RegisterArgProfile("ci", engine, "-interaction=nonstopmode", "-halt-on-error", "-file-line-error")
+		RegisterArgProfile("debug", engine, "-interaction=nonstopmode", "-file-line-error", "-synctex=1", "-recorder")
+		RegisterArgProfile("release", engine, "-interaction=batchmode", "-halt-on-error")
+	}
+}
+
+// RegisterArgProfile defines the arguments of a named profile, like "ci",
+// for an engine, making it available to all tasks (see SetArgProfile). An
+// empty engine defines the arguments for engines without own definition in
+// the profile. Definitions replace earlier ones for the same profile and
+// engine, including the builtin profiles "ci", "debug" and "release" of
+// pdflatex, xelatex and lualatex.
+func RegisterArgProfile(name, engine string, args ...string) {
+	if name == "" {
+		panic("latex: RegisterArgProfile needs a profile name")
+	}
+	profileRegistry.Lock()
+	defer profileRegistry.Unlock()
+	profileRegistry.profiles.set(name, engine, args)
+}
+
+// ArgProfiles returns the names of all registered argument profiles,
+// sorted.
+func ArgProfiles() []string {
+	profileRegistry.RLock()
+	defer profileRegistry.RUnlock()
+	names := []string{}
+	for name := range profileRegistry.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefineArgProfile defines the arguments of a named profile for an engine
+// for this task only, taking precedence over the registered profiles (see
+// RegisterArgProfile) of the same name.
+func (t *CompileTask) DefineArgProfile(name, engine string, args ...string) {
+	if t.profiles == nil {
+		t.profiles = argProfiles{}
+	}
+	t.profiles.set(name, engine, args)
+}
+
+// ArgProfile returns the name of the argument profile used, empty if none.
+func (t *CompileTask) ArgProfile() string {
+	return t.profile
+}
+
+// SetArgProfile selects the argument profile passed to all engine runs
+// before the arguments of the caller, defined using DefineArgProfile or
+// RegisterArgProfile. Use an empty name to pass no profile arguments.
+func (t *CompileTask) SetArgProfile(name string) error {
+	if name != "" {
+		if _, ok := t.profiles[name]; !ok {
+			profileRegistry.RLock()
+			_, ok = profileRegistry.profiles[name]
+			profileRegistry.RUnlock()
+			if !ok {
+				return fmt.Errorf("unknown argument profile %q", name)
+			}
+		}
+	}
+	t.profile = name
+	return nil
+}
+
+// profileArgs returns the arguments of the selected profile for an engine.
+func (t *CompileTask) profileArgs(engine string) []string {
+	if t.profile == "" {
+		return nil
+	}
+	if args, ok := t.profiles.args(t.profile, engine); ok {
+		return args
+	}
+	profileRegistry.RLock()
+	defer profileRegistry.RUnlock()
+	args, _ := profileRegistry.profiles.args(t.profile, engine)
+	return args
+}
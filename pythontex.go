@@ -0,0 +1,18 @@
+package latex
+
+import "os"
+
+// Pythontex runs pythontex for a compiled file (defaulting to the compile
+// file) using the pythontex package, executing the code embedded in the
+// document. Failures are returned as *CompileError.
+func (t *CompileTask) Pythontex(file string, args ...string) error {
+	file = t.defaultCompileFilename(file)
+	return t.compileStep("pythontex", file, "pythontex", append(args, jobname(file))...)
+}
+
+// needsPythontex reports whether a compiled file has code for pythontex,
+// which the engine writes to the .pytxcode file.
+func (t *CompileTask) needsPythontex(file string) bool {
+	_, err := os.Stat(t.auxFile(file, ".pytxcode"))
+	return err == nil
+}
@@ -0,0 +1,473 @@
+package latex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Job is a unit of work processed by a Queue.
+type Job struct {
+	ID string `json:"id"`
+	// IdempotencyKey identifies retries of the same request. Submitting a job
+	// with the key of a job that is running or succeeded before returns the
+	// earlier job instead of compiling twice.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// Priority determines the order of execution, higher values first. Jobs
+	// with PriorityBatch or lower are preempted to make room for jobs with a
+	// higher priority.
+	Priority int `json:"priority,omitempty"`
+	// Payload is passed to the handler, e.g. template data.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Common job priorities.
+const (
+	PriorityBatch       = -10
+	PriorityNormal      = 0
+	PriorityInteractive = 10
+)
+
+// JobHandler builds the document for a job and returns the path of the
+// produced file, which is then moved to the artifact store. The context is
+// cancelled with cause ErrPreempted when the job is preempted, the handler
+// should return soon after. Preempted jobs are run again later. Set the
+// context on tasks before CopyToCompileDir, see SetContext, so Shutdown can
+// stop them and remove their compile directories.
+//
+// If the store is a LogStore, the log next to the file (named like it with
+// extension .log) is stored as well, also if the build failed when the
+// handler returns the path of the file along with the error. Handlers
+// moving the PDF using MoveToDest leave no log next to it, return the PDF
+// in the compile directory (see CompileResult.Pdf) to keep the log.
+type JobHandler func(ctx context.Context, job Job) (string, error)
+
+// JobResult is the outcome of a job.
+type JobResult struct {
+	JobID string
+	// Artifact is the location of the produced document in the store.
+	Artifact string
+	// Log is the location of the log in the store, empty if not stored.
+	Log string
+	Err error
+	// LogErr is the error storing the log, it doesn't fail the job.
+	LogErr error
+	// Reused reports that the artifact was produced by an earlier job with
+	// the same idempotency key.
+	Reused bool
+}
+
+// Ticket tracks a submitted job.
+type Ticket struct {
+	Job    Job
+	done   chan struct{}
+	result JobResult
+	// preempted is guarded by the queue's mutex.
+	preempted bool
+}
+
+// Done returns a channel closed when the job has finished.
+func (t *Ticket) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the job has finished or ctx is done.
+func (t *Ticket) Wait(ctx context.Context) (JobResult, error) {
+	select {
+	case <-t.done:
+		return t.result, nil
+	case <-ctx.Done():
+		return JobResult{}, ctx.Err()
+	}
+}
+
+func (t *Ticket) finish(result JobResult) {
+	t.result = result
+	close(t.done)
+}
+
+var (
+	// ErrQueueClosed is returned when submitting jobs to a closed Queue.
+	ErrQueueClosed = errors.New("queue is closed")
+	// ErrQueueFull is returned when the maximum number of pending jobs is
+	// reached.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrPreempted is the cancellation cause of preempted jobs.
+	ErrPreempted = errors.New("job preempted")
+)
+
+// Queue processes jobs with a fixed number of workers, storing the produced
+// documents in an ArtifactStore.
+type Queue struct {
+	handler    JobHandler
+	store      ArtifactStore
+	numWorkers int
+	maxPending int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Ticket
+	running map[*Ticket]context.CancelCauseFunc
+	// byKey holds the unfinished jobs by idempotency key, finished ones are
+	// found in the store
+	byKey map[string]*Ticket
+	// finishedKeys counts the jobs removed from byKey, so Submit notices
+	// jobs finishing while it looks up the store
+	finishedKeys int
+	active       map[string]*Ticket
+	closed       bool
+	ctx          context.Context
+	cancel       context.CancelCauseFunc
+	dirs         *dirScope
+	// failures holds the results of the last maxFailures failed jobs, oldest
+	// first in failureIDs
+	failures   map[string]JobResult
+	failureIDs []string
+	// unfinished collects jobs interrupted by a shutdown
+	unfinished []Job
+	workers    sync.WaitGroup
+}
+
+// NewQueue returns a Queue running handler on workers goroutines. Up to
+// maxPending jobs wait for execution, 0 means unlimited.
+func NewQueue(workers, maxPending int, handler JobHandler, store ArtifactStore) *Queue {
+	q := &Queue{
+		handler:    handler,
+		store:      store,
+		numWorkers: workers,
+		maxPending: maxPending,
+		running:    make(map[*Ticket]context.CancelCauseFunc),
+		byKey:      make(map[string]*Ticket),
+		active:     make(map[string]*Ticket),
+		failures:   make(map[string]JobResult),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	ctx, dirs := withDirScope(context.Background())
+	q.ctx, q.cancel = context.WithCancelCause(ctx)
+	q.dirs = dirs
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit enqueues a job. A random ID is assigned if it has none. If a job
+// with the same idempotency key is running or has succeeded before, its
+// ticket is returned instead. If all workers are busy, a running job with a
+// batch priority lower than the job's priority is preempted.
+func (q *Queue) Submit(job Job) (*Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return nil, ErrQueueClosed
+		}
+		if job.IdempotencyKey == "" {
+			break
+		}
+		if ticket, ok := q.byKey[job.IdempotencyKey]; ok {
+			return ticket, nil
+		}
+		// the store may be slow, don't block the queue meanwhile
+		finishedKeys := q.finishedKeys
+		q.mu.Unlock()
+		ticket, err := q.reuse(job)
+		q.mu.Lock()
+		if ticket != nil || err != nil {
+			return ticket, err
+		}
+		if q.finishedKeys == finishedKeys {
+			break
+		}
+		// a job finished meanwhile, it may have been the one with the key
+	}
+
+	if q.maxPending > 0 && len(q.pending) >= q.maxPending {
+		return nil, ErrQueueFull
+	}
+	if job.ID == "" {
+		job.ID = newJobID()
+	}
+	ticket := &Ticket{Job: job, done: make(chan struct{})}
+	if job.IdempotencyKey != "" {
+		q.byKey[job.IdempotencyKey] = ticket
+	}
+	q.active[job.ID] = ticket
+	q.enqueue(ticket, false)
+	q.preempt(job.Priority)
+	return ticket, nil
+}
+
+// reuse returns a finished ticket for the artifact stored for the
+// idempotency key of job, nil if there is none.
+func (q *Queue) reuse(job Job) (*Ticket, error) {
+	jobID, ok, err := q.store.LookupKey(job.IdempotencyKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	artifact, err := q.store.Get(jobID)
+	if errors.Is(err, ErrArtifactNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ticket := &Ticket{Job: job, done: make(chan struct{})}
+	ticket.Job.ID = jobID
+	ticket.finish(JobResult{JobID: jobID, Artifact: artifact, Reused: true})
+	return ticket, nil
+}
+
+// enqueue inserts a ticket after all pending jobs of the same or a higher
+// priority, or before those of the same priority if front is set.
+func (q *Queue) enqueue(ticket *Ticket, front bool) {
+	prio := ticket.Job.Priority
+	i := 0
+	for i < len(q.pending) {
+		p := q.pending[i].Job.Priority
+		if p < prio || (front && p == prio) {
+			break
+		}
+		i++
+	}
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = ticket
+	q.cond.Signal()
+}
+
+// preempt cancels the running batch job with the lowest priority if there is
+// no idle worker for a job of priority prio.
+func (q *Queue) preempt(prio int) {
+	if len(q.running) < q.numWorkers {
+		return
+	}
+	var (
+		victim *Ticket
+		cancel context.CancelCauseFunc
+	)
+	for ticket, c := range q.running {
+		p := ticket.Job.Priority
+		if p > PriorityBatch || p >= prio || ticket.preempted {
+			continue
+		}
+		if victim == nil || p < victim.Job.Priority {
+			victim, cancel = ticket, c
+		}
+	}
+	if victim != nil {
+		victim.preempted = true
+		cancel(ErrPreempted)
+	}
+}
+
+// Store returns the artifact store of the queue, e.g. to register it with a
+// RetentionManager.
+func (q *Queue) Store() ArtifactStore {
+	return q.store
+}
+
+// Lookup returns the ticket of a pending or running job.
+func (q *Queue) Lookup(id string) (*Ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ticket, ok := q.active[id]
+	return ticket, ok
+}
+
+// maxFailures bounds the failed jobs a Queue remembers, see Failure.
+const maxFailures = 1000
+
+// Failure returns the result of a failed job, which is remembered for the
+// last 1000 failed jobs.
+func (q *Queue) Failure(id string) (JobResult, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	result, ok := q.failures[id]
+	return result, ok
+}
+
+// rememberFailure records the result of a failed job for Failure.
+func (q *Queue) rememberFailure(result JobResult) {
+	if _, ok := q.failures[result.JobID]; !ok {
+		q.failureIDs = append(q.failureIDs, result.JobID)
+	}
+	q.failures[result.JobID] = result
+	if len(q.failureIDs) > maxFailures {
+		delete(q.failures, q.failureIDs[0])
+		q.failureIDs = q.failureIDs[1:]
+	}
+}
+
+// Len returns the number of pending and running jobs.
+func (q *Queue) Len() (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), len(q.running)
+}
+
+// Close stops accepting jobs, cancels running jobs and waits for the workers
+// to exit. Pending jobs are not processed.
+func (q *Queue) Close() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Shutdown(ctx)
+}
+
+// Shutdown stops accepting jobs and waits for running jobs to finish until
+// ctx is done. Then the remaining jobs are cancelled, which kills the tools
+// of tasks using the context passed to the handler, and the compile
+// directories of these tasks not cleared yet are removed. Other tasks of the
+// process are not affected.
+//
+// Pending jobs and jobs interrupted are returned, e.g. to persist them using
+// SaveJobs and resubmit them after a restart. Their tickets finish with
+// ErrQueueClosed. The error is the one of ctx if the grace period expired.
+func (q *Queue) Shutdown(ctx context.Context) ([]Job, error) {
+	q.mu.Lock()
+	q.closed = true
+	pending := q.pending
+	q.pending = nil
+	for _, ticket := range pending {
+		delete(q.active, ticket.Job.ID)
+		if ticket.Job.IdempotencyKey != "" {
+			delete(q.byKey, ticket.Job.IdempotencyKey)
+		}
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	for _, ticket := range pending {
+		ticket.finish(JobResult{JobID: ticket.Job.ID, Err: ErrQueueClosed})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		q.cancel(ErrQueueClosed)
+		<-done
+	}
+	q.dirs.removeAll()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(pending)+len(q.unfinished))
+	for _, ticket := range pending {
+		jobs = append(jobs, ticket.Job)
+	}
+	jobs = append(jobs, q.unfinished...)
+	q.unfinished = nil
+	return jobs, err
+}
+
+// SaveJobs writes jobs to file as JSON.
+func SaveJobs(file string, jobs []Job) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+// LoadJobs reads jobs written by SaveJobs. A missing file yields no jobs.
+func LoadJobs(file string) ([]Job, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	err = json.Unmarshal(data, &jobs)
+	return jobs, err
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		ticket := q.pending[0]
+		q.pending = q.pending[1:]
+		ctx, cancel := context.WithCancelCause(q.ctx)
+		ticket.preempted = false
+		q.running[ticket] = cancel
+		q.mu.Unlock()
+
+		result := q.process(ctx, ticket.Job)
+		cause := context.Cause(ctx)
+		interrupted := result.Err != nil &&
+			(errors.Is(cause, ErrPreempted) || errors.Is(cause, ErrQueueClosed))
+		cancel(nil)
+
+		q.mu.Lock()
+		delete(q.running, ticket)
+		if interrupted && !q.closed {
+			q.enqueue(ticket, true)
+			q.mu.Unlock()
+			continue
+		}
+		if interrupted {
+			q.unfinished = append(q.unfinished, ticket.Job)
+			result.Err = ErrQueueClosed
+		}
+		delete(q.active, ticket.Job.ID)
+		if result.Err != nil && !interrupted {
+			q.rememberFailure(result)
+		}
+		if ticket.Job.IdempotencyKey != "" {
+			// failed jobs may be retried, succeeded ones are found in the
+			// store
+			delete(q.byKey, ticket.Job.IdempotencyKey)
+			q.finishedKeys++
+		}
+		q.mu.Unlock()
+		ticket.finish(result)
+	}
+}
+
+func (q *Queue) process(ctx context.Context, job Job) JobResult {
+	result := JobResult{JobID: job.ID}
+	file, err := q.handler(ctx, job)
+	if logs, ok := q.store.(LogStore); ok && file != "" {
+		log := strings.TrimSuffix(file, filepath.Ext(file)) + ".log"
+		if _, statErr := os.Stat(log); statErr == nil {
+			result.Log, result.LogErr = logs.PutLog(job.ID, log)
+		}
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Artifact, result.Err = q.store.Put(job.ID, file)
+	if result.Err == nil && job.IdempotencyKey != "" {
+		result.Err = q.store.RememberKey(job.IdempotencyKey, job.ID)
+	}
+	return result
+}
+
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,130 @@
+package latex
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxLogLine is the length TeX wraps log lines at (max_print_line).
+const maxLogLine = 79
+
+// RedactionRule replaces sensitive data like names, emails or IBANs in logs
+// before they are stored, see Redact.
+type RedactionRule struct {
+	// Name identifies the rule, e.g. "email".
+	Name    string
+	Pattern *regexp.Regexp
+	// Replacement replaces matches, "[redacted]" by default. It is used
+	// literally.
+	Replacement string
+}
+
+// Common redaction rules. Use RedactLiterals for the names of people and
+// other values known from template data.
+var (
+	RedactEmails = RedactionRule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	// RedactIBANs matches IBANs with or without spaces between the groups.
+	RedactIBANs = RedactionRule{
+		Name:    "iban",
+		Pattern: regexp.MustCompile(`\b[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+	}
+)
+
+// RedactLiterals returns a rule redacting the given values, like the names of
+// customers, case-sensitively. Empty values are ignored.
+func RedactLiterals(name string, values ...string) RedactionRule {
+	quoted := []string{}
+	for _, value := range values {
+		if value != "" {
+			quoted = append(quoted, regexp.QuoteMeta(value))
+		}
+	}
+	// prefer the longest match, e.g. full names over first names
+	sort.Slice(quoted, func(i, j int) bool {
+		return len(quoted[i]) > len(quoted[j])
+	})
+	rule := RedactionRule{Name: name}
+	if len(quoted) > 0 {
+		rule.Pattern = regexp.MustCompile(strings.Join(quoted, "|"))
+	}
+	return rule
+}
+
+func (r RedactionRule) replacement() string {
+	if r.Replacement == "" {
+		return "[redacted]"
+	}
+	return r.Replacement
+}
+
+// redactionSpan is a match of a rule in an unwrapped log.
+type redactionSpan struct {
+	start, end  int
+	replacement string
+}
+
+// Redact applies the rules to a TeX log. As TeX wraps log lines, values
+// split across lines at the wrapping column are redacted as well, the line
+// break is removed along with them.
+func Redact(log []byte, rules ...RedactionRule) []byte {
+	joined, offsets := unwrapLog(log)
+	spans := []redactionSpan{}
+	for _, rule := range rules {
+		if rule.Pattern == nil {
+			continue
+		}
+		for _, match := range rule.Pattern.FindAllIndex(joined, -1) {
+			if match[0] < match[1] {
+				spans = append(spans, redactionSpan{match[0], match[1], rule.replacement()})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return log
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var b bytes.Buffer
+	previous, end := 0, 0
+	for _, span := range spans {
+		if span.start < end {
+			// overlaps a redacted span, extend it
+			end = max(end, span.end)
+			previous = offsets[end-1] + 1
+			continue
+		}
+		b.Write(log[previous:offsets[span.start]])
+		b.WriteString(span.replacement)
+		end = span.end
+		previous = offsets[end-1] + 1
+	}
+	b.Write(log[previous:])
+	return b.Bytes()
+}
+
+// unwrapLog joins the lines of a log wrapped by TeX. It returns the joined
+// log and the offset in log of each of its bytes.
+func unwrapLog(log []byte) ([]byte, []int) {
+	joined := make([]byte, 0, len(log))
+	offsets := make([]int, 0, len(log))
+	lineStart := 0
+	for i, c := range log {
+		if c == '\n' {
+			line := i - lineStart
+			lineStart = i + 1
+			if line == maxLogLine {
+				continue
+			}
+		}
+		joined = append(joined, c)
+		offsets = append(offsets, i)
+	}
+	return joined, offsets
+}
@@ -0,0 +1,254 @@
+package latex
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxRemoteLogSize limits the size of the log read from a failed remote
+// compilation.
+const maxRemoteLogSize = 16 << 20
+
+// remoteTool names the compile service in errors, its endpoint may hold
+// credentials.
+const remoteTool = "compile service"
+
+// Archive formats of RemoteCompiler uploads.
+const (
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// RemoteCompiler offloads builds to an HTTP compile service. Build POSTs the
+// compile directory as an archive to the endpoint, with the query parameters
+// engine, file (the compile file relative to the archive root) and arg
+// (repeated, the engine arguments). The service answers with the PDF on
+// success, or a non-2xx status with the TeX log (or an error message) as
+// body on failure.
+type RemoteCompiler struct {
+	// Endpoint is the URL the archives are POSTed to.
+	Endpoint string
+	// Format is the archive format uploaded, ArchiveTarGz or ArchiveZip.
+	Format string
+	// Header is added to the requests, e.g. for authorization.
+	Header http.Header
+	Client *http.Client
+}
+
+// NewRemoteCompiler returns a RemoteCompiler uploading tar.gz archives to
+// endpoint.
+func NewRemoteCompiler(endpoint string) *RemoteCompiler {
+	return &RemoteCompiler{
+		Endpoint: endpoint,
+		Format:   ArchiveTarGz,
+		Header:   http.Header{},
+		Client:   http.DefaultClient,
+	}
+}
+
+// RemoteCompiler returns the compile service builds are offloaded to, nil
+// if they run locally.
+func (t *CompileTask) RemoteCompiler() *RemoteCompiler {
+	return t.remote
+}
+
+// SetRemoteCompiler makes Build compile on the service rc instead of running
+// the TeX tools locally. The PDF is written to the compile directory, so
+// moving it and the steps work as for local builds. Use nil to compile
+// locally again.
+func (t *CompileTask) SetRemoteCompiler(rc *RemoteCompiler) {
+	t.remote = rc
+}
+
+// buildRemote compiles file on the remote compile service.
+func (t *CompileTask) buildRemote(file string, args ...string) (*CompileResult, error) {
+	result := &CompileResult{
+		Pdf: t.auxFile(file, ".pdf"),
+		Log: t.auxFile(file, ".log"),
+	}
+	start := time.Now()
+	err := t.remote.compile(t, file, args, result)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	return result, t.runSteps(file, t.startBudget(), result)
+}
+
+func (rc *RemoteCompiler) compile(t *CompileTask, file string, args []string, result *CompileResult) error {
+	query := url.Values{}
+	query.Set("engine", t.Engine())
+	query.Set("file", filepath.ToSlash(file))
+	for _, arg := range args {
+		query.Add("arg", arg)
+	}
+	endpoint, err := url.Parse(rc.Endpoint)
+	if err != nil {
+		return err
+	}
+	for key, values := range endpoint.Query() {
+		query[key] = append(values, query[key]...)
+	}
+	endpoint.RawQuery = query.Encode()
+
+	contentType := "application/gzip"
+	write := writeTarGz
+	switch rc.Format {
+	case "", ArchiveTarGz:
+	case ArchiveZip:
+		contentType = "application/zip"
+		write = writeZip
+	default:
+		return fmt.Errorf("unknown archive format %q", rc.Format)
+	}
+	body, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(write(writer, t.CompileDirInternal()))
+	}()
+	defer body.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, endpoint.String(), body)
+	if err != nil {
+		return err
+	}
+	for key, values := range rc.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/pdf")
+	client := rc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// drop the URL
+			err = urlErr.Err
+		}
+		return &CompileError{Tool: remoteTool, File: file, ExitCode: -1, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		output, _ := io.ReadAll(io.LimitReader(resp.Body, maxRemoteLogSize))
+		err = os.WriteFile(result.Log, output, 0600)
+		if err == nil {
+			result.parseLog()
+		}
+		return &CompileError{
+			Tool:     remoteTool,
+			File:     file,
+			ExitCode: -1,
+			Output:   string(output),
+			Err:      errors.New(resp.Status),
+		}
+	}
+	if mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";"); mediaType != "" && mediaType != "application/pdf" && mediaType != "application/octet-stream" {
+		return fmt.Errorf("compile service returned %s instead of a PDF", mediaType)
+	}
+	result.Passes = 1
+	f, err := os.Create(result.Pdf)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(result.Pdf)
+	}
+	return err
+}
+
+// archiveFiles calls add for the regular files of dir with their slash
+// separated path relative to dir.
+func archiveFiles(dir string, add func(name string, info fs.FileInfo, path string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return add(filepath.ToSlash(rel), info, path)
+	})
+}
+
+// writeTarGz writes the regular files of dir as gzipped tarball to w.
+func writeTarGz(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := archiveFiles(dir, func(name string, info fs.FileInfo, path string) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(tw, path)
+	})
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeZip writes the regular files of dir as zip archive to w.
+func writeZip(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	err := archiveFiles(dir, func(name string, info fs.FileInfo, path string) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(fw, path)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyFileTo copies the content of file to w.
+func copyFileTo(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,159 @@
+package latex
+
+import (
+	"os"
+	"time"
+
+	"github.com/jojomi/go-latex/logparse"
+)
+
+// maxRerunPasses bounds the passes of Run.
+const maxRerunPasses = 4
+
+// Diagnostic is an error or warning found in a TeX log.
+type Diagnostic struct {
+	// Severity is "error" or "warning".
+	Severity string `json:"severity"`
+	// File is the source file, if known.
+	File string `json:"file,omitempty"`
+	// Package names the package issuing a warning, empty for LaTeX itself.
+	Package string `json:"package,omitempty"`
+	Message string `json:"message"`
+	// Line is the input line, 0 if unknown.
+	Line int `json:"line,omitempty"`
+	// Category classifies warnings, also the ones escalated to errors.
+	Category WarningCategory `json:"category,omitempty"`
+}
+
+// CompileResult describes the outcome of Run.
+type CompileResult struct {
+	Pdf      string
+	Log      string
+	Duration time.Duration
+	// Passes is the number of engine runs.
+	Passes int
+	// AuxiliaryTools lists the tools run by Build between the engine runs,
+	// see AuxiliaryTools.
+	AuxiliaryTools []string
+	// FallbackCharacters lists the characters missing in the fonts of the
+	// document which were typeset using the fallback fonts, see
+	// SetFallbackFonts.
+	FallbackCharacters []string
+	// Degraded reports that engine reruns or optional steps were skipped
+	// to meet the budget, see SetBudget. Skipped names them, "rerun" for
+	// engine runs.
+	Degraded bool
+	Skipped  []string
+	Errors   []Diagnostic
+	Warnings []Diagnostic
+	// ParsedLog holds all entries of the log including missing files and
+	// rerun hints, nil if the log could not be read.
+	ParsedLog *logparse.Log
+	// Packages lists the TeX distribution and the classes and packages
+	// loaded, nil if the log could not be read.
+	Packages *PackageReport
+}
+
+// Run runs a TeX engine like pdflatex on file (defaulting to the compile
+// file) and reports the produced files and the diagnostics of the log. The
+// engine is rerun while the log asks for it, e.g. to get cross-references
+// right, unless that would exceed the budget (see SetBudget). On failure
+// the result is returned along with a *CompileError.
+func (t *CompileTask) Run(toolname, file string, args ...string) (*CompileResult, error) {
+	return t.runBudgeted(toolname, file, t.startBudget(), args...)
+}
+
+func (t *CompileTask) runBudgeted(toolname, file string, clock *budgetClock, args ...string) (*CompileResult, error) {
+	file = t.defaultCompileFilename(file)
+	// the engine writes to the root of the compile dir
+	result := &CompileResult{
+		Pdf: t.auxFile(file, ".pdf"),
+		Log: t.auxFile(file, ".log"),
+	}
+
+	start := time.Now()
+	var err error
+	for result.Passes < maxRerunPasses {
+		result.Passes++
+		passStart := time.Now()
+		err = t.latextool(toolname, file, args...)
+		clock.measure(passStart)
+		if err != nil || !logRequestsRerun(result.Log) {
+			break
+		}
+		if !clock.allows(0) {
+			result.skip("rerun")
+			break
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.parseLog()
+	if err == nil {
+		err = t.escalateWarnings(result)
+	}
+	return result, err
+}
+
+// skip records a pass skipped to meet the budget.
+func (result *CompileResult) skip(name string) {
+	result.Degraded = true
+	result.Skipped = append(result.Skipped, name)
+}
+
+// parseLog reads the diagnostics and the package usage of the log of the
+// result, if it can be read.
+func (result *CompileResult) parseLog() {
+	parsed, err := parseLogFile(result.Log)
+	if err != nil {
+		return
+	}
+	result.ParsedLog = parsed
+	packages, err := parsePackageUsageFile(result.Log)
+	if err == nil {
+		result.Packages = &packages
+	}
+	for _, d := range diagnostics(parsed) {
+		if d.Severity == "error" {
+			result.Errors = append(result.Errors, d)
+		} else {
+			result.Warnings = append(result.Warnings, d)
+		}
+	}
+}
+
+// logRequestsRerun reports whether a log asks for another run.
+func logRequestsRerun(log string) bool {
+	parsed, err := parseLogFile(log)
+	return err == nil && parsed.NeedsRerun()
+}
+
+// parseLogFile parses a TeX log file.
+func parseLogFile(log string) (*logparse.Log, error) {
+	f, err := os.Open(log)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return logparse.ParseLog(f)
+}
+
+// diagnostics converts the entries of a parsed log. Bad boxes are
+// warnings.
+func diagnostics(log *logparse.Log) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, e := range log.Entries {
+		d := Diagnostic{File: e.File, Package: e.Package, Message: e.Message, Line: e.Line}
+		switch e.Kind {
+		case logparse.Error:
+			d.Severity = "error"
+		case logparse.Warning, logparse.BadBox:
+			d.Severity = "warning"
+			d.Category = warningCategory(e)
+		default:
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
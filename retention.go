@@ -0,0 +1,295 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy determines which files are pruned. Files older than MaxAge
+// are removed first, then the oldest files until at most MaxFiles files of
+// at most MaxTotalSize bytes in total remain. Zero values disable a limit.
+type RetentionPolicy struct {
+	MaxAge       time.Duration
+	MaxTotalSize int64
+	MaxFiles     int
+}
+
+// PruneResult reports what was pruned.
+type PruneResult struct {
+	Files int
+	Bytes int64
+}
+
+// Pruner removes stored files according to a retention policy.
+type Pruner interface {
+	Prune(policy RetentionPolicy) (PruneResult, error)
+}
+
+// DirPruner prunes the files below a directory, e.g. one holding logs.
+type DirPruner string
+
+// Prune implements Pruner.
+func (d DirPruner) Prune(policy RetentionPolicy) (PruneResult, error) {
+	return pruneDir(string(d), policy)
+}
+
+type prunableFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func pruneDir(dir string, policy RetentionPolicy) (PruneResult, error) {
+	result := PruneResult{}
+	files := []prunableFile{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, prunableFile{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	// newest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	var total int64
+	kept := 0
+	now := time.Now()
+	for _, file := range files {
+		keep := (policy.MaxAge <= 0 || now.Sub(file.modTime) <= policy.MaxAge) &&
+			(policy.MaxFiles <= 0 || kept < policy.MaxFiles) &&
+			(policy.MaxTotalSize <= 0 || total+file.size <= policy.MaxTotalSize)
+		if keep {
+			kept++
+			total += file.size
+			continue
+		}
+		err := os.Remove(file.path)
+		if err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		result.Files++
+		result.Bytes += file.size
+	}
+	return result, nil
+}
+
+// Prune removes artifacts according to policy, along with the idempotency
+// keys of removed artifacts. Retried requests for them are built again. Logs
+// are pruned separately using the same policy.
+func (s *DirArtifactStore) Prune(policy RetentionPolicy) (PruneResult, error) {
+	result, err := pruneDir(filepath.Join(s.dir, "artifacts"), policy)
+	if err != nil {
+		return result, err
+	}
+	logs, err := pruneDir(filepath.Join(s.dir, "logs"), policy)
+	result.Files += logs.Files
+	result.Bytes += logs.Bytes
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	keys, err := os.ReadDir(filepath.Join(s.dir, "keys"))
+	if err != nil {
+		return result, err
+	}
+	for _, key := range keys {
+		path := filepath.Join(s.dir, "keys", key.Name())
+		jobID, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if _, err := s.Get(string(jobID)); err == ErrArtifactNotFound {
+			os.Remove(path)
+		}
+	}
+	return result, nil
+}
+
+// RetentionManager prunes artifact stores and log directories periodically,
+// so long-running servers need no external cron jobs.
+type RetentionManager struct {
+	interval time.Duration
+	// OnError is called with errors of background pruning, if set.
+	OnError func(err error)
+
+	mu      sync.Mutex
+	targets []retentionTarget
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type retentionTarget struct {
+	pruner Pruner
+	policy RetentionPolicy
+}
+
+// NewRetentionManager returns a RetentionManager pruning every interval once
+// started.
+func NewRetentionManager(interval time.Duration) *RetentionManager {
+	return &RetentionManager{interval: interval}
+}
+
+// Add registers a pruner with its policy.
+func (m *RetentionManager) Add(pruner Pruner, policy RetentionPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.targets = append(m.targets, retentionTarget{pruner, policy})
+}
+
+// PruneNow prunes all registered targets immediately.
+func (m *RetentionManager) PruneNow() (PruneResult, error) {
+	m.mu.Lock()
+	targets := append([]retentionTarget{}, m.targets...)
+	m.mu.Unlock()
+	total := PruneResult{}
+	for _, target := range targets {
+		result, err := target.pruner.Prune(target.policy)
+		total.Files += result.Files
+		total.Bytes += result.Bytes
+		if err != nil {
+			return total, fmt.Errorf("pruning failed: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// Start prunes in the background until Stop is called.
+func (m *RetentionManager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.loop(m.stop, m.done)
+}
+
+// Stop stops background pruning.
+func (m *RetentionManager) Stop() {
+	m.mu.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (m *RetentionManager) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := m.PruneNow()
+			if err != nil && m.OnError != nil {
+				m.OnError(err)
+			}
+		}
+	}
+}
+
+// RotatingFile is a log file, e.g. for a JSONLinesAuditSink, which is rotated
+// once it exceeds MaxSize bytes. Rotated files are named like the file with
+// a numeric suffix, only MaxBackups of them are kept.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens or creates a RotatingFile for appending.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write implements io.Writer. Writes are never split across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if f.maxBackups > 0 {
+		err = os.Rename(f.path, f.path+".1")
+	} else {
+		err = os.Remove(f.path)
+	}
+	if err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
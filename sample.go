@@ -0,0 +1,432 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// sampleListLength is the number of items generated for lists.
+const sampleListLength = 3
+
+// decimalFuncNames lists the template functions taking decimals, whose
+// arguments are sampled as numbers.
+var decimalFuncNames = []string{"decimal", "decAdd", "decSub", "decMul", "decDiv", "decSum", "formatDecimal", "formatMoney"}
+
+var (
+	loremWords   = strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua ut enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat")
+	sampleNames  = []string{"Erika Mustermann", "Jane Doe", "Max Mustermann", "John Smith", "Anna Schmidt"}
+	sampleCities = []string{"Berlin", "Hamburg", "Vienna", "Zurich", "Munich"}
+)
+
+// sampleField is the structure of a value inferred from template
+// placeholders.
+type sampleField struct {
+	// fields holds the fields of objects and of the items of lists.
+	fields map[string]*sampleField
+	list   bool
+	// item is the element of lists.
+	item *sampleField
+	// boolean is set for conditions, value for fields which are printed or
+	// passed to functions.
+	boolean bool
+	value   bool
+	number  bool
+}
+
+func newSampleField() *sampleField {
+	return &sampleField{fields: map[string]*sampleField{}}
+}
+
+// field returns the nested field at path, creating it if needed.
+func (f *sampleField) field(path []string) *sampleField {
+	for _, name := range path {
+		child, ok := f.fields[name]
+		if !ok {
+			child = newSampleField()
+			f.fields[name] = child
+		}
+		f = child
+	}
+	return f
+}
+
+// SampleData returns plausible data for the template files in the source
+// directory (defaulting to the compile file) so templates can be previewed
+// without production data. The structure is inferred from the placeholders: fields used in range
+// become lists of a few items, fields used in if become true, fields passed
+// to decimal functions become numbers. Other values are derived from the
+// field name, like dates for "...Date" or e-mail addresses for "...Email",
+// and lorem ipsum otherwise. If a template schema is set, the data is
+// generated from it instead.
+//
+// Values are derived from the field names, so repeated calls return the
+// same data.
+func (t *CompileTask) SampleData(files ...string) (map[string]interface{}, error) {
+	if t.templateSchema != nil {
+		data, ok := t.templateSchema.Sample().(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("template schema doesn't describe an object")
+		}
+		return data, nil
+	}
+	if len(files) == 0 {
+		files = []string{t.defaultCompileFilename("")}
+	}
+	root := newSampleField()
+	for _, file := range files {
+		source, err := os.ReadFile(filepath.Join(t.SourceDir(), file))
+		if err != nil {
+			return nil, err
+		}
+		templ, err := template.New(file).Funcs(t.templateFuncs()).Parse(string(source))
+		if err != nil {
+			return nil, err
+		}
+		for _, defined := range templ.Templates() {
+			if defined.Tree != nil {
+				w := sampleWalker{vars: map[string]*sampleField{"$": root}}
+				w.walk(defined.Tree.Root, root)
+			}
+		}
+	}
+	data, ok := root.sample("").(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("templates don't use the data as an object")
+	}
+	return data, nil
+}
+
+// Preview renders the compile file in the compile directory using
+// SampleData and builds it.
+func (t *CompileTask) Preview() (*CompileResult, error) {
+	data, err := t.SampleData()
+	if err != nil {
+		return nil, err
+	}
+	templ, file := t.Template("")
+	templ, err = templ.ParseFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	err = t.ExecuteTemplate(templ, data, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return t.Build("")
+}
+
+// sampleWalker collects the fields used by a template.
+type sampleWalker struct {
+	vars map[string]*sampleField
+}
+
+func (w *sampleWalker) walk(node parse.Node, dot *sampleField) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			w.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		w.pipe(node.Pipe, dot, false)
+	case *parse.IfNode:
+		if f := w.pipe(node.Pipe, dot, true); f != nil {
+			f.boolean = true
+		}
+		w.walk(node.List, dot)
+		w.walk(node.ElseList, dot)
+	case *parse.WithNode:
+		inner := w.pipe(node.Pipe, dot, true)
+		if inner == nil {
+			inner = newSampleField()
+		}
+		w.walk(node.List, inner)
+		w.walk(node.ElseList, dot)
+	case *parse.RangeNode:
+		item := newSampleField()
+		if list := w.pipe(node.Pipe, dot, true); list != nil {
+			list.list = true
+			if list.item == nil {
+				list.item = item
+			}
+			item = list.item
+		}
+		if decl := node.Pipe.Decl; len(decl) > 0 {
+			w.vars[decl[len(decl)-1].Ident[0]] = item
+		}
+		w.walk(node.List, item)
+		w.walk(node.ElseList, dot)
+	case *parse.TemplateNode:
+		if node.Pipe != nil {
+			w.pipe(node.Pipe, dot, false)
+		}
+	}
+}
+
+// pipe records the fields used by a pipeline and returns the field the
+// pipeline evaluates to if it is a plain field. The pipelines of control
+// structures like if don't use plain fields as values.
+func (w *sampleWalker) pipe(pipe *parse.PipeNode, dot *sampleField, control bool) *sampleField {
+	if pipe == nil {
+		return nil
+	}
+	numeric := false
+	for _, cmd := range pipe.Cmds {
+		if len(cmd.Args) > 0 {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && contains(decimalFuncNames, ident.Ident) {
+				numeric = true
+			}
+		}
+	}
+	var result *sampleField
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			f := w.arg(arg, dot)
+			if f == nil {
+				continue
+			}
+			plain := len(pipe.Cmds) == 1 && len(cmd.Args) == 1
+			if plain {
+				result = f
+			}
+			if !control || !plain {
+				f.value = true
+			}
+			if numeric {
+				f.number = true
+			}
+		}
+	}
+	if len(pipe.Decl) == 1 && result != nil {
+		w.vars[pipe.Decl[0].Ident[0]] = result
+	}
+	return result
+}
+
+// arg returns the field an argument refers to, nil if it is no field.
+func (w *sampleWalker) arg(arg parse.Node, dot *sampleField) *sampleField {
+	switch arg := arg.(type) {
+	case *parse.FieldNode:
+		return dot.field(arg.Ident)
+	case *parse.VariableNode:
+		base, ok := w.vars[arg.Ident[0]]
+		if !ok {
+			return nil
+		}
+		return base.field(arg.Ident[1:])
+	case *parse.DotNode:
+		return dot
+	case *parse.PipeNode:
+		w.pipe(arg, dot, false)
+	}
+	return nil
+}
+
+// sample generates a value for the field named name.
+func (f *sampleField) sample(name string) interface{} {
+	switch {
+	case f.list:
+		items := make([]interface{}, sampleListLength)
+		for i := range items {
+			items[i] = f.item.sample(fmt.Sprintf("%s[%d]", name, i))
+		}
+		return items
+	case len(f.fields) > 0 || name == "":
+		object := map[string]interface{}{}
+		for field, child := range f.fields {
+			object[field] = child.sample(joinSchemaPath(name, field))
+		}
+		return object
+	case f.number:
+		return sampleDecimal(name, 0, 1000)
+	case f.boolean && !f.value:
+		return true
+	}
+	return sampleString(name)
+}
+
+// sampleRand returns a random source seeded by path, so samples are stable.
+func sampleRand(path string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// sampleLeafName returns the name of the innermost field of a path like
+// "items[2].price".
+func sampleLeafName(path string) string {
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		path = path[:i]
+	}
+	return strings.ToLower(path)
+}
+
+// sampleString returns a plausible string for a field, based on its name.
+func sampleString(path string) interface{} {
+	r := sampleRand(path)
+	name := sampleLeafName(path)
+	has := func(words ...string) bool {
+		for _, word := range words {
+			if strings.Contains(name, word) {
+				return true
+			}
+		}
+		return false
+	}
+	// short words only match at the end, "age" is no "message"
+	ends := func(words ...string) bool {
+		for _, word := range words {
+			if strings.HasSuffix(name, word) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("date", "day", "deadline", "due"):
+		date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.Intn(365))
+		return date.Format("2006-01-02")
+	case has("count", "qty", "quantity", "pages") || name == "age":
+		return 1 + r.Intn(9)
+	case has("year"):
+		return 2020 + r.Intn(6)
+	case has("price", "amount", "total", "cost", "balance") || ends("sum", "fee", "tax", "vat"):
+		return sampleDecimal(path, 0, 1000)
+	case has("percent") || ends("rate"):
+		return sampleDecimal(path, 0, 100)
+	case has("email", "mail"):
+		return "jane.doe@example.com"
+	case has("phone", "fax", "mobile"):
+		return fmt.Sprintf("+49 30 %07d", r.Intn(10000000))
+	case has("url", "website", "link"):
+		return "https://example.com"
+	case has("iban"):
+		return "DE89370400440532013000"
+	case has("zip", "postcode", "postal"):
+		return fmt.Sprintf("%05d", r.Intn(100000))
+	case has("city", "town"):
+		return sampleCities[r.Intn(len(sampleCities))]
+	case has("street", "address"):
+		return fmt.Sprintf("Musterstraße %d", 1+r.Intn(120))
+	case has("name", "author", "customer", "person", "contact"):
+		return sampleNames[r.Intn(len(sampleNames))]
+	case has("text", "description", "body", "note", "comment", "abstract"):
+		return sampleLorem(r, 20+r.Intn(20), true)
+	case has("title", "subject", "heading"):
+		return sampleLorem(r, 2+r.Intn(3), true)
+	case has("number", "code") || ends("id", "no"):
+		return fmt.Sprintf("%s-%05d", strings.ToUpper(loremWords[r.Intn(len(loremWords))][:2]), r.Intn(100000))
+	}
+	return sampleLorem(r, 2+r.Intn(4), false)
+}
+
+// sampleDecimal returns a decimal with two places in [min, max) as
+// json.Number, which the decimal functions accept.
+func sampleDecimal(path string, min, max int) json.Number {
+	r := sampleRand(path)
+	cents := min*100 + r.Intn((max-min)*100)
+	return json.Number(fmt.Sprintf("%d.%02d", cents/100, cents%100))
+}
+
+// sampleLorem returns words of lorem ipsum, capitalized like a sentence if
+// requested.
+func sampleLorem(r *rand.Rand, words int, sentence bool) string {
+	parts := make([]string, words)
+	for i := range parts {
+		parts[i] = loremWords[r.Intn(len(loremWords))]
+	}
+	text := strings.Join(parts, " ")
+	if sentence {
+		text = strings.ToUpper(text[:1]) + text[1:]
+	}
+	return text
+}
+
+// Sample generates plausible data matching the schema, see
+// CompileTask.SampleData.
+func (s *Schema) Sample() interface{} {
+	return s.sample("")
+}
+
+func (s *Schema) sample(path string) interface{} {
+	if s == nil {
+		return sampleString(path)
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	typ := ""
+	if len(s.Type) > 0 {
+		typ = s.Type[0]
+	}
+	if typ == "" && len(s.Properties) > 0 {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		object := map[string]interface{}{}
+		for name, property := range s.Properties {
+			object[name] = property.sample(joinSchemaPath(path, name))
+		}
+		return object
+	case "array":
+		n := sampleListLength
+		if s.MinItems != nil && n < *s.MinItems {
+			n = *s.MinItems
+		}
+		if s.MaxItems != nil && n > *s.MaxItems {
+			n = *s.MaxItems
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = s.Items.sample(fmt.Sprintf("%s[%d]", path, i))
+		}
+		return items
+	case "boolean":
+		return true
+	case "integer", "number":
+		low, high := 0.0, 1000.0
+		if s.Minimum != nil {
+			low = *s.Minimum
+		}
+		if s.Maximum != nil {
+			high = *s.Maximum
+		} else if s.Minimum != nil {
+			high = low + 1000
+		}
+		value := low + sampleRand(path).Float64()*(high-low)
+		if typ == "integer" {
+			return int64(value)
+		}
+		return json.Number(fmt.Sprintf("%.2f", value))
+	case "null":
+		return nil
+	}
+	value := sampleString(path)
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	if s.MinLength != nil {
+		for len([]rune(text)) < *s.MinLength {
+			text += " " + sampleLorem(sampleRand(path+text), 1, false)
+		}
+	}
+	if s.MaxLength != nil && len([]rune(text)) > *s.MaxLength {
+		text = string([]rune(text)[:*s.MaxLength])
+	}
+	return text
+}
@@ -0,0 +1,73 @@
+package latex
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// Sandbox configures the confinement of external tools. It is currently
+// enforced on Linux only, using Landlock for file system access and a seccomp
+// filter denying syscalls TeX never needs. This is meant as defense in depth
+// when compiling untrusted documents.
+type Sandbox struct {
+	// ReadOnly lists paths (and everything below) tools may read and execute.
+	ReadOnly []string
+	// ReadWrite lists paths tools may modify. The working directory and
+	// the compile directory of the task are always writable.
+	ReadWrite []string
+	// AllowNetwork permits the creation of sockets.
+	AllowNetwork bool
+	// BestEffort runs tools unconfined instead of failing if the kernel or
+	// platform lacks support for the sandbox.
+	BestEffort bool
+}
+
+// DefaultSandbox returns a Sandbox granting read access to the system
+// libraries, the configuration files TeX and Ghostscript use and the TeX
+// installation, and write access to the TeX caches only.
+func DefaultSandbox() *Sandbox {
+	s := &Sandbox{
+		ReadOnly: []string{
+			"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/opt",
+			"/nix/store", "/var/lib/texmf", "/dev/urandom",
+			"/etc/texmf", "/etc/fonts", "/etc/ghostscript", "/etc/papersize",
+			"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+			"/etc/localtime", "/etc/nsswitch.conf", "/etc/passwd", "/etc/group",
+		},
+		ReadWrite: []string{
+			"/dev/null",
+		},
+	}
+	for _, variable := range []string{"TEXMFROOT", "TEXMFHOME", "TEXMFDIST"} {
+		if value := kpsewhichVar(variable); value != "" {
+			s.ReadOnly = append(s.ReadOnly, value)
+		}
+	}
+	for _, variable := range []string{"TEXMFVAR", "TEXMFSYSVAR", "TEXMFCONFIG"} {
+		if value := kpsewhichVar(variable); value != "" {
+			s.ReadWrite = append(s.ReadWrite, value)
+		}
+	}
+	return s
+}
+
+// Sandbox returns the sandbox external tools are confined with, nil if none.
+func (t *CompileTask) Sandbox() *Sandbox {
+	return t.sandbox
+}
+
+// SetSandbox confines all spawned processes as configured. Use nil to
+// disable.
+func (t *CompileTask) SetSandbox(sandbox *Sandbox) {
+	t.sandbox = sandbox
+}
+
+// kpsewhichVar returns the value of a kpathsea variable, or an empty string if
+// it can't be determined.
+func kpsewhichVar(name string) string {
+	out, err := exec.Command("kpsewhich", "-var-value", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,218 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	landlockAccessExecute    = 1 << 0
+	landlockAccessWriteFile  = 1 << 1
+	landlockAccessReadFile   = 1 << 2
+	landlockAccessReadDir    = 1 << 3
+	landlockAccessRemoveDir  = 1 << 4
+	landlockAccessRemoveFile = 1 << 5
+	landlockAccessMakeChar   = 1 << 6
+	landlockAccessMakeDir    = 1 << 7
+	landlockAccessMakeReg    = 1 << 8
+	landlockAccessMakeSock   = 1 << 9
+	landlockAccessMakeFifo   = 1 << 10
+	landlockAccessMakeBlock  = 1 << 11
+	landlockAccessMakeSym    = 1 << 12
+	landlockAccessRefer      = 1 << 13
+	landlockAccessTruncate   = 1 << 14
+
+	landlockAccessFile = landlockAccessExecute | landlockAccessWriteFile |
+		landlockAccessReadFile | landlockAccessTruncate
+	landlockAccessRead = landlockAccessExecute | landlockAccessReadFile |
+		landlockAccessReadDir
+
+	prSetNoNewPrivs = 38
+	prSetSeccomp    = 22
+
+	seccompModeFilter = 2
+	seccompRetAllow   = 0x7fff0000
+	seccompRetErrno   = 0x00050000
+	seccompRetKill    = 0x80000000
+
+	oPath = 0x200000
+)
+
+type landlockRulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// landlockPathBeneathAttr is packed in the kernel ABI, the trailing padding
+// of the Go struct is never read.
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// start launches cmd confined by the sandbox. Landlock domains and seccomp
+// filters apply to the calling thread and are inherited by its children, so
+// the restrictions are installed on a dedicated OS thread that spawns the
+// process and is discarded afterwards.
+func (s *Sandbox) start(cmd *exec.Cmd, writable []string) error {
+	errs := make(chan error, 1)
+	go func() {
+		// never unlocked, the tainted thread exits along with the goroutine
+		runtime.LockOSThread()
+		err := s.restrictThread(append([]string{cmd.Dir}, writable...))
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- cmd.Start()
+	}()
+	return <-errs
+}
+
+var errSandboxUnsupported = errors.New("sandbox not supported by the kernel")
+
+func (s *Sandbox) restrictThread(writable []string) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno != 0 {
+		return fmt.Errorf("could not set no_new_privs: %w", errno)
+	}
+	err := s.landlock(writable)
+	if err != nil && !s.ignorable(err) {
+		return err
+	}
+	err = s.seccomp()
+	if err != nil && !s.ignorable(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *Sandbox) ignorable(err error) bool {
+	return s.BestEffort && errors.Is(err, errSandboxUnsupported)
+}
+
+func (s *Sandbox) landlock(writable []string) error {
+	abi, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return fmt.Errorf("%w: landlock: %v", errSandboxUnsupported, errno)
+	}
+	handled := uint64(landlockAccessExecute | landlockAccessWriteFile |
+		landlockAccessReadFile | landlockAccessReadDir | landlockAccessRemoveDir |
+		landlockAccessRemoveFile | landlockAccessMakeChar | landlockAccessMakeDir |
+		landlockAccessMakeReg | landlockAccessMakeSock | landlockAccessMakeFifo |
+		landlockAccessMakeBlock | landlockAccessMakeSym)
+	if abi >= 2 {
+		handled |= landlockAccessRefer
+	}
+	if abi >= 3 {
+		handled |= landlockAccessTruncate
+	}
+
+	attr := landlockRulesetAttr{handledAccessFS: handled}
+	fd, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("could not create landlock ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	for _, path := range s.ReadOnly {
+		if err := landlockAllow(int(fd), path, landlockAccessRead&handled); err != nil {
+			return err
+		}
+	}
+	for _, path := range append(writable, s.ReadWrite...) {
+		if err := landlockAllow(int(fd), path, handled); err != nil {
+			return err
+		}
+	}
+
+	_, _, errno = syscall.RawSyscall(sysLandlockRestrictSelf, fd, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("could not enforce landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// landlockAllow adds a rule for path, silently skipping paths that don't
+// exist on this system.
+func landlockAllow(rulesetFd int, path string, access uint64) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		access &= landlockAccessFile
+	}
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open %s for landlock: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	attr := landlockPathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	_, _, errno := syscall.RawSyscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("could not add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+func (s *Sandbox) seccomp() error {
+	if seccompAuditArch == 0 {
+		return fmt.Errorf("%w: seccomp filter for %s", errSandboxUnsupported, runtime.GOARCH)
+	}
+	denied := append([]uint32{}, seccompDenied...)
+	if !s.AllowNetwork {
+		denied = append(denied, seccompNetwork...)
+	}
+
+	filter := []syscall.SockFilter{
+		// kill processes using a different syscall ABI
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, seccompAuditArch, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKill),
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 0),
+		// the x32 ABI is flagged in the syscall number
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, 0x40000000, 0, 1),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKill),
+	}
+	for _, nr := range denied {
+		filter = append(filter,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, 1),
+			bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		)
+	}
+	filter = append(filter, bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow))
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("%w: seccomp: %v", errSandboxUnsupported, errno)
+	}
+	return nil
+}
+
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -0,0 +1,32 @@
+package latex
+
+const seccompAuditArch = 0xc000003e
+
+var seccompDenied = []uint32{
+	101, // ptrace
+	165, // mount
+	166, // umount2
+	155, // pivot_root
+	161, // chroot
+	167, // swapon
+	168, // swapoff
+	169, // reboot
+	246, // kexec_load
+	320, // kexec_file_load
+	175, // init_module
+	313, // finit_module
+	176, // delete_module
+	321, // bpf
+	298, // perf_event_open
+	272, // unshare
+	308, // setns
+	248, // add_key
+	249, // request_key
+	250, // keyctl
+	310, // process_vm_readv
+	311, // process_vm_writev
+}
+
+var seccompNetwork = []uint32{
+	41, // socket
+}
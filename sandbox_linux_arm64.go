@@ -0,0 +1,32 @@
+package latex
+
+const seccompAuditArch = 0xc00000b7
+
+var seccompDenied = []uint32{
+	117, // ptrace
+	40,  // mount
+	39,  // umount2
+	41,  // pivot_root
+	51,  // chroot
+	224, // swapon
+	225, // swapoff
+	142, // reboot
+	104, // kexec_load
+	294, // kexec_file_load
+	105, // init_module
+	273, // finit_module
+	106, // delete_module
+	280, // bpf
+	241, // perf_event_open
+	97,  // unshare
+	268, // setns
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	270, // process_vm_readv
+	271, // process_vm_writev
+}
+
+var seccompNetwork = []uint32{
+	198, // socket
+}
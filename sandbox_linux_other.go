@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package latex
+
+// seccomp filters are only provided for amd64 and arm64
+const seccompAuditArch = 0
+
+var seccompDenied, seccompNetwork []uint32
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package latex
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func (s *Sandbox) start(cmd *exec.Cmd, writable []string) error {
+	if !s.BestEffort {
+		return errors.New("sandboxing is not supported on this platform")
+	}
+	return cmd.Start()
+}
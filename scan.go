@@ -0,0 +1,176 @@
+package latex
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ScanFinding describes a potentially dangerous construct in a TeX source.
+type ScanFinding struct {
+	File    string
+	Line    int
+	Command string
+	Reason  string
+}
+
+func (f ScanFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", f.File, f.Line, f.Command, f.Reason)
+}
+
+// Scanner checks TeX sources for constructs that are dangerous when compiling
+// untrusted documents. Commands and packages are given without backslash.
+type Scanner struct {
+	DenyCommands  []string
+	AllowCommands []string
+	DenyPackages  []string
+	AllowPackages []string
+	// Extensions lists the file extensions that are scanned.
+	Extensions []string
+}
+
+// NewScanner returns a Scanner with sensible default deny lists.
+func NewScanner() *Scanner {
+	return &Scanner{
+		DenyCommands: []string{
+			"ShellEscape", "directlua", "luadirect", "luaexec", "latelua",
+			"immediateShellEscape", "pdfshellescape",
+		},
+		DenyPackages: []string{
+			"shellesc", "minted", "pythontex", "sagetex", "bashful",
+			"gnuplottex", "luacode", "write18", "shell-escape",
+		},
+		Extensions: []string{".tex", ".sty", ".cls", ".ltx", ".def", ".latex"},
+	}
+}
+
+// ScanForDangerousCommands scans all TeX sources in dir using the default
+// Scanner.
+func ScanForDangerousCommands(dir string) ([]ScanFinding, error) {
+	return NewScanner().Scan(dir)
+}
+
+var (
+	scanWrite18  = regexp.MustCompile(`\\write\s*18\b`)
+	scanPipe     = regexp.MustCompile(`\\(input|include|openin\s*\\?\w*\s*=?)\s*\{?\s*"?\|`)
+	scanOpenout  = regexp.MustCompile(`\\openout\s*\\?\w+\s*=?\s*\{?\s*"?([^\s{}"]+)`)
+	scanFileRead = regexp.MustCompile(`\\(input|include|InputIfFileExists|IfFileExists|includegraphics|includepdf|lstinputlisting|verbatiminput)\s*(?:\[[^\]]*\])?\s*\{\s*"?([^{}"]+)`)
+	scanPackage  = regexp.MustCompile(`\\(usepackage|RequirePackage)\s*(?:\[[^\]]*\])?\s*\{([^}]*)\}`)
+	scanCommand  = regexp.MustCompile(`\\([A-Za-z@]+)`)
+)
+
+// Scan walks dir and returns all findings, ordered by file and line.
+func (s *Scanner) Scan(dir string) ([]ScanFinding, error) {
+	findings := []ScanFinding{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !contains(s.Extensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fileFindings, err := s.scanFile(path, rel)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, fileFindings...)
+		return nil
+	})
+	return findings, err
+}
+
+func (s *Scanner) scanFile(path, name string) ([]ScanFinding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	findings := []ScanFinding{}
+	add := func(line int, command, reason string) {
+		findings = append(findings, ScanFinding{File: name, Line: line, Command: command, Reason: reason})
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := stripTexComment(scanner.Text())
+
+		if match := scanWrite18.FindString(line); match != "" && !contains(s.AllowCommands, "write18") {
+			add(lineNumber, match, "shell escape")
+		}
+		for _, match := range scanPipe.FindAllString(line, -1) {
+			add(lineNumber, match, "piped input executes a shell command")
+		}
+		for _, match := range scanOpenout.FindAllStringSubmatch(line, -1) {
+			if escapesTree(match[1]) {
+				add(lineNumber, match[0], "writes outside of the source tree")
+			}
+		}
+		for _, match := range scanFileRead.FindAllStringSubmatch(line, -1) {
+			if escapesTree(match[2]) {
+				add(lineNumber, match[0], "reads outside of the source tree")
+			}
+		}
+		for _, match := range scanPackage.FindAllStringSubmatch(line, -1) {
+			for _, pkg := range strings.Split(match[2], ",") {
+				pkg = strings.TrimSpace(pkg)
+				if contains(s.DenyPackages, pkg) && !contains(s.AllowPackages, pkg) {
+					add(lineNumber, match[0], fmt.Sprintf("package %s is not allowed", pkg))
+				}
+			}
+		}
+		for _, match := range scanCommand.FindAllStringSubmatch(line, -1) {
+			if contains(s.DenyCommands, match[1]) && !contains(s.AllowCommands, match[1]) {
+				add(lineNumber, match[0], "command is not allowed")
+			}
+		}
+	}
+	return findings, scanner.Err()
+}
+
+// stripTexComment removes everything from the first unescaped % on.
+func stripTexComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '%':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// texInputName returns the file name of an \input or \include argument,
+// without the quotes needed for names with spaces.
+func texInputName(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		name = name[1 : len(name)-1]
+	}
+	return name
+}
+
+// escapesTree reports if a path used in TeX refers to a location outside of
+// the directory it is used in.
+func escapesTree(name string) bool {
+	name = texInputName(name)
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "~") || filepath.VolumeName(name) != "" {
+		return true
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTexInputName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"intro", "intro"},
+		{" intro ", "intro"},
+		{`"my chapter"`, "my chapter"},
+		{` "my chapter" `, "my chapter"},
+		{`"Übersicht"`, "Übersicht"},
+		{"报告", "报告"},
+		{`"年度 报告"`, "年度 报告"},
+		{`"unterminated`, `"unterminated`},
+		{`"`, `"`},
+		{`""`, ""},
+		{"100%", "100%"},
+		{"a#b{c}~d", "a#b{c}~d"},
+	}
+	for _, test := range tests {
+		if got := texInputName(test.name); got != test.want {
+			t.Errorf("texInputName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		scanner func(s *Scanner)
+		want    []string
+	}{
+		{"clean", `\documentclass{article}\input{intro}`, nil, nil},
+		{"write18", `\immediate\write18{rm -rf /}`, nil, []string{"shell escape"}},
+		{"write18 allowed", `\write18{ls}`, func(s *Scanner) { s.AllowCommands = []string{"write18"} }, nil},
+		{"write18 commented", `% \write18{ls}`, nil, nil},
+		{"escaped percent", `50\% \write18{ls}`, nil, []string{"shell escape"}},
+		{"piped input", `\input{|"cat /etc/passwd"}`, nil, []string{"piped input executes a shell command"}},
+		{"piped openin", `\openin\f="|ls"`, nil, []string{"piped input executes a shell command"}},
+		{"openout in tree", `\openout\f=out.txt`, nil, nil},
+		{"openout absolute", `\openout\f=/etc/profile`, nil, []string{"writes outside of the source tree"}},
+		{"openout parent", `\openout\f=../x.tex`, nil, []string{"writes outside of the source tree"}},
+		{"input parent", `\input{../../secret}`, nil, []string{"reads outside of the source tree"}},
+		{"input home", `\include{~/notes}`, nil, []string{"reads outside of the source tree"}},
+		{"graphics absolute", `\includegraphics[width=3cm]{/etc/logo}`, nil, []string{"reads outside of the source tree"}},
+		{"input backslash parent", `\input{sub\..\..\x}`, nil, []string{"reads outside of the source tree"}},
+		{"dotted name", `\input{a..b}`, nil, nil},
+		{"denied package", `\usepackage[cache=false]{minted}`, nil, []string{"package minted is not allowed"}},
+		{"package list", `\usepackage{amsmath, shellesc}`, nil, []string{"package shellesc is not allowed"}},
+		{"allowed package", `\RequirePackage{minted}`, func(s *Scanner) { s.AllowPackages = []string{"minted"} }, nil},
+		{"denied command", `\directlua{os.execute("ls")}`, nil, []string{"command is not allowed"}},
+		{"custom command", `\foo`, func(s *Scanner) { s.DenyCommands = append(s.DenyCommands, "foo") }, []string{"command is not allowed"}},
+		{"command prefix", `\directluax`, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "document.tex"), []byte(test.source+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s := NewScanner()
+			if test.scanner != nil {
+				test.scanner(s)
+			}
+			findings, err := s.Scan(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(findings) != len(test.want) {
+				t.Fatalf("got findings %v, want reasons %q", findings, test.want)
+			}
+			for i, finding := range findings {
+				if finding.Reason != test.want[i] || finding.File != "document.tex" || finding.Line != 1 {
+					t.Errorf("finding %d = %v, want document.tex:1 (%s)", i, finding, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScannerFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"document.tex":        "\\documentclass{article}\n\n\\write18{ls}\n",
+		"chapters/intro.TEX":  "\\directlua{}\n",
+		"style/custom.sty":    "\\RequirePackage{shellesc}\n",
+		"notes.txt":           "\\write18{ls}\n",
+		"images/figure.latex": "\\input{/etc/passwd}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	findings, err := ScanForDangerousCommands(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.FromSlash("chapters/intro.TEX") + ":1: \\directlua (command is not allowed)",
+		"document.tex:3: \\write18 (shell escape)",
+		filepath.FromSlash("images/figure.latex") + ":1: \\input{/etc/passwd (reads outside of the source tree)",
+		filepath.FromSlash("style/custom.sty") + ":1: \\RequirePackage{shellesc} (package shellesc is not allowed)",
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("got findings %v, want %q", findings, want)
+	}
+	for i, finding := range findings {
+		if finding.String() != want[i] {
+			t.Errorf("finding %d = %q, want %q", i, finding.String(), want[i])
+		}
+	}
+}
+
+func TestEscapesTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		escapes bool
+	}{
+		{"intro", false},
+		{"chapters/intro.tex", false},
+		{`"my chapter"`, false},
+		{`"Kapitel/Übersicht und Maß"`, false},
+		{`"年度 报告/第一章"`, false},
+		{"a..b", false},
+		{"/etc/passwd", true},
+		{`"/etc/my passwd"`, true},
+		{`"../年度 报告"`, true},
+		{`"Übersicht/../../x"`, true},
+		{`sub\..\x`, true},
+		{"~/notes", true},
+		{` "~/my notes" `, true},
+	}
+	for _, test := range tests {
+		if got := escapesTree(test.name); got != test.escapes {
+			t.Errorf("escapesTree(%q) = %v, want %v", test.name, got, test.escapes)
+		}
+	}
+}
+
+func TestScannerNonASCIIPaths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Projekt Übersicht 报告")
+	file := filepath.Join(dir, "Kapitel 1", "年度 报告.tex")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := `\input{"Größe und Maß"}` + "\n" + `\input{"../../geheim sache"}` + "\n"
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	findings, err := ScanForDangerousCommands(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join("Kapitel 1", "年度 报告.tex") + `:2: \input{"../../geheim sache (reads outside of the source tree)`
+	if len(findings) != 1 || findings[0].String() != want {
+		t.Fatalf("got findings %v, want %q", findings, want)
+	}
+}
+
+func TestReadTexSourceQuotedInputs(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Arbeit 年度")
+	files := map[string]string{
+		"main.tex":                      `\input{"Kapitel/Übersicht und Maß"} \include{ "报告 一" } \input{"../outside"}`,
+		"Kapitel/Übersicht und Maß.tex": "Umlaute % comment\n",
+		"报告 一.tex":                      "CJK",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source, err := readTexSource(root, filepath.Join(root, "main.tex"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Umlaute \n CJK\n \\input{\"../outside\"}\n"
+	if source != want {
+		t.Errorf("readTexSource() = %q, want %q", source, want)
+	}
+}
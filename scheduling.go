@@ -0,0 +1,79 @@
+package latex
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Scheduling controls the priority of external tools, so background
+// document generation doesn't starve latency-sensitive services on the same
+// host. Zero values keep the defaults.
+type Scheduling struct {
+	// Nice is the niceness the tools run with, from -20 (highest priority) to
+	// 19 (lowest).
+	Nice int
+	// IOClass is the I/O scheduling class as understood by ionice: 1
+	// (realtime), 2 (best-effort) or 3 (idle).
+	IOClass int
+	// IOLevel is the priority within the best-effort and realtime classes,
+	// from 0 (highest) to 7 (lowest).
+	IOLevel int
+	// CPUs restricts the tools to the given CPU cores.
+	CPUs []int
+	// MaxThreads caps the number of threads of tools using OpenMP.
+	MaxThreads int
+}
+
+// wrap prefixes a command with the wrapper tools applying the settings.
+func (s *Scheduling) wrap(name string, args []string) (string, []string, error) {
+	prefix := []string{}
+	if len(s.CPUs) > 0 {
+		// a mask instead of a CPU list works with BusyBox' taskset too
+		mask := new(big.Int)
+		for _, cpu := range s.CPUs {
+			mask.SetBit(mask, cpu, 1)
+		}
+		prefix = append(prefix, "taskset", "0x"+mask.Text(16))
+	}
+	if s.IOClass != 0 {
+		prefix = append(prefix, "ionice", "-c", strconv.Itoa(s.IOClass))
+		if s.IOClass != 3 {
+			prefix = append(prefix, "-n", strconv.Itoa(s.IOLevel))
+		}
+	}
+	if s.Nice != 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(s.Nice))
+	}
+	if len(prefix) == 0 {
+		return name, args, nil
+	}
+	for _, wrapper := range []string{"taskset", "ionice", "nice"} {
+		if contains(prefix, wrapper) {
+			if _, err := findTool(wrapper); err != nil {
+				return "", nil, fmt.Errorf("scheduling settings require %s: %w", wrapper, err)
+			}
+		}
+	}
+	return prefix[0], append(append(prefix[1:], name), args...), nil
+}
+
+// environment returns the environment variables applying the settings.
+func (s *Scheduling) environment() []string {
+	if s.MaxThreads <= 0 {
+		return nil
+	}
+	return []string{"OMP_NUM_THREADS=" + strconv.Itoa(s.MaxThreads)}
+}
+
+// Scheduling returns the scheduling settings of external tools, nil if
+// defaults are used.
+func (t *CompileTask) Scheduling() *Scheduling {
+	return t.scheduling
+}
+
+// SetScheduling sets niceness, I/O priority and CPU affinity of all external
+// tools run by this task. Use nil to use the defaults.
+func (t *CompileTask) SetScheduling(scheduling *Scheduling) {
+	t.scheduling = scheduling
+}
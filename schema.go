@@ -0,0 +1,268 @@
+package latex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a JSON Schema describing the data a template expects. The
+// keywords type, properties, required, additionalProperties, items, enum,
+// minimum, maximum, minLength, maxLength, pattern, minItems and maxItems are
+// supported.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes holds the allowed types, given as string or array of strings.
+type schemaTypes []string
+
+func (s *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*s = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	err := json.Unmarshal(data, &multiple)
+	*s = multiple
+	return err
+}
+
+// FieldError describes a single violation of a Schema.
+type FieldError struct {
+	// Path locates the field, e.g. "items[2].price". It is empty for the
+	// root value.
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors lists all violations found when validating data.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Error())
+	}
+	return "invalid template data: " + strings.Join(messages, "; ")
+}
+
+// ParseSchema parses a JSON Schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := &Schema{}
+	err := json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.compile()
+}
+
+// LoadSchema reads a JSON Schema from a file.
+func LoadSchema(file string) (*Schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(data)
+}
+
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		var err error
+		s.pattern, err = regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+	}
+	for _, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return err
+		}
+	}
+	return s.Items.compile()
+}
+
+// Validate checks data against the schema. Data is converted as if encoded
+// to JSON, so structs are validated by their JSON field names. The returned
+// error is of type ValidationErrors if data doesn't match.
+func (s *Schema) Validate(data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return err
+	}
+	errs := ValidationErrors{}
+	s.validate("", value, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, value interface{}, errs *ValidationErrors) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		fail("must be of type %s", strings.Join(s.Type, " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !schemaEnumContains(s.Enum, value) {
+		fail("must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Path: joinSchemaPath(path, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if ok {
+				property.validate(joinSchemaPath(path, name), v[name], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Path: joinSchemaPath(path, name), Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+func (s *Schema) matchesType(value interface{}) bool {
+	for _, typ := range s.Type {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case json.Number:
+			if typ == "number" {
+				return true
+			}
+			if _, err := v.Int64(); err == nil && typ == "integer" {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaEnumContains(enum []interface{}, value interface{}) bool {
+	encoded, _ := json.Marshal(value)
+	for _, candidate := range enum {
+		c, _ := json.Marshal(candidate)
+		if bytes.Equal(c, encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// TemplateSchema returns the schema template data is validated against, nil
+// if none.
+func (t *CompileTask) TemplateSchema() *Schema {
+	return t.templateSchema
+}
+
+// SetTemplateSchema makes ExecuteTemplate validate all data against schema
+// before rendering, so malformed input is rejected with per-field errors
+// instead of producing half-rendered documents. Use nil to disable.
+func (t *CompileTask) SetTemplateSchema(schema *Schema) {
+	t.templateSchema = schema
+}
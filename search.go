@@ -0,0 +1,126 @@
+package latex
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// SearchDocument is the text and metadata of a compiled document as fed to
+// search engines like Elasticsearch or Meilisearch.
+type SearchDocument struct {
+	// ID defaults to the name of the PDF without extension.
+	ID       string            `json:"id"`
+	File     string            `json:"file"`
+	Title    string            `json:"title,omitempty"`
+	Authors  []string          `json:"authors,omitempty"`
+	Subject  string            `json:"subject,omitempty"`
+	Keywords []string          `json:"keywords,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Abstract string            `json:"abstract,omitempty"`
+	Pages    int               `json:"pages"`
+	// Text is the text of all pages, separated by form feeds.
+	Text string `json:"text"`
+}
+
+// SearchDocument extracts the text of a compiled PDF (using pdftotext) along
+// with the front matter and abstract of the TeX file next to it, if there is
+// one. It defaults to the output of the compiled file.
+func (t *CompileTask) SearchDocument(file string) (*SearchDocument, error) {
+	file = t.pdfPath(file)
+	pages, err := t.pdfText(file)
+	if err != nil {
+		return nil, err
+	}
+	for i, page := range pages {
+		pages[i] = strings.TrimSpace(page)
+	}
+	doc := &SearchDocument{
+		ID:    strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		File:  file,
+		Pages: len(pages),
+		Text:  strings.Join(pages, "\f"),
+	}
+
+	tex := texFileFor(file)
+	if tex == "" {
+		return doc, nil
+	}
+	frontMatter, err := ParseFrontMatterFile(tex)
+	if err != nil {
+		return nil, err
+	}
+	metadata := MetadataFromFrontMatter(frontMatter)
+	doc.Title = metadata.Title
+	doc.Authors = metadata.Authors
+	doc.Subject = metadata.Subject
+	doc.Keywords = metadata.Keywords
+	doc.Version = metadata.Version
+	doc.Meta = metadata.Custom
+	source, err := readTexSource(filepath.Dir(tex), tex, 0)
+	if err != nil {
+		return nil, err
+	}
+	if abstract, ok := texSection(source, "abstract"); ok {
+		doc.Abstract = abstract
+	} else if abstract, ok := pdfSection(pages, "abstract"); ok {
+		doc.Abstract = abstract
+	}
+	return doc, nil
+}
+
+// SearchFeedFormat is the format of a search feed.
+type SearchFeedFormat int
+
+const (
+	// SearchFeedNDJSON writes one document per line.
+	SearchFeedNDJSON SearchFeedFormat = iota
+	// SearchFeedJSON writes a JSON array of documents, as accepted by
+	// Meilisearch.
+	SearchFeedJSON
+	// SearchFeedBulk writes the request body of Elasticsearch's bulk API.
+	SearchFeedBulk
+)
+
+// SearchFeed writes documents for ingestion by search engines.
+type SearchFeed struct {
+	Format SearchFeedFormat
+	// Index names the target index of SearchFeedBulk, it may be empty if
+	// the index is part of the request URL.
+	Index string
+}
+
+// Write writes docs to w.
+func (f SearchFeed) Write(w io.Writer, docs ...*SearchDocument) error {
+	switch f.Format {
+	case SearchFeedNDJSON, SearchFeedBulk:
+		encoder := json.NewEncoder(w)
+		for _, doc := range docs {
+			if f.Format == SearchFeedBulk {
+				action := map[string]string{"_id": doc.ID}
+				if f.Index != "" {
+					action["_index"] = f.Index
+				}
+				err := encoder.Encode(map[string]interface{}{"index": action})
+				if err != nil {
+					return err
+				}
+			}
+			err := encoder.Encode(doc)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case SearchFeedJSON:
+		if docs == nil {
+			docs = []*SearchDocument{}
+		}
+		return json.NewEncoder(w).Encode(docs)
+	default:
+		return errors.New("unknown search feed format")
+	}
+}
@@ -0,0 +1,194 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrSectionNotFound is returned by ExtractSection if the document has no
+// section of the given name.
+var ErrSectionNotFound = errors.New("section not found")
+
+// sectionLevels ranks the sectioning commands, lower is higher.
+var sectionLevels = map[string]int{
+	"part":          0,
+	"chapter":       1,
+	"section":       2,
+	"subsection":    3,
+	"subsubsection": 4,
+	"paragraph":     5,
+}
+
+var (
+	texSectionCommand  = regexp.MustCompile(`\\(part|chapter|section|subsection|subsubsection|paragraph)\*?\s*(?:\[[^\]]*\])?\s*\{`)
+	texSectionEnd      = regexp.MustCompile(`\\(end\{document\}|bibliography\{|printbibliography|appendix\b)`)
+	pdfNumberedHeading = regexp.MustCompile(`^\s*(\d+(\.\d+)*|[IVX]+\.?|[A-Z]\.)\s+\S`)
+)
+
+// ExtractSection returns the plain text of a named part of the compiled
+// document, like an abstract, for search indexes and catalogs. name is
+// either an environment (\begin{abstract}) or the title of a sectioning
+// command, compared case-insensitively. The TeX sources (in the compile
+// directory if present, the source directory otherwise) are searched first,
+// then the text of the compiled PDF. Paragraphs are separated by empty
+// lines.
+func (t *CompileTask) ExtractSection(name string) (string, error) {
+	file := t.defaultCompileFilename("")
+	for _, dir := range []string{t.CompileDir(), t.SourceDir()} {
+		if dir == "" {
+			continue
+		}
+		source, err := readTexSource(dir, filepath.Join(dir, file), 0)
+		if err != nil {
+			continue
+		}
+		if text, ok := texSection(source, name); ok {
+			return text, nil
+		}
+		break
+	}
+
+	pdf := t.pdfPath("")
+	if _, err := os.Stat(pdf); err == nil {
+		pages, err := t.pdfText(pdf)
+		if err != nil {
+			return "", err
+		}
+		if text, ok := pdfSection(pages, name); ok {
+			return text, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrSectionNotFound)
+}
+
+// readTexSource returns the source of file without comments, with files
+// loaded by \input and \include inlined as long as they are inside root.
+func readTexSource(root, file string, depth int) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	source, err := readFrontMatterSource(f, nil)
+	if err != nil || depth >= maxFrontMatterDepth {
+		return source, err
+	}
+	return texInputPattern.ReplaceAllStringFunc(source, func(match string) string {
+		name := texInputName(texInputPattern.FindStringSubmatch(match)[1])
+		if name == "" || escapesTree(name) {
+			return match
+		}
+		if filepath.Ext(name) == "" {
+			name += ".tex"
+		}
+		included, err := readTexSource(root, filepath.Join(root, filepath.FromSlash(name)), depth+1)
+		if err != nil {
+			return match
+		}
+		return included
+	}), nil
+}
+
+var texInputPattern = regexp.MustCompile(`\\(?:input|include)\s*\{([^{}]*)\}`)
+
+// texSection finds an environment or section named name in source and
+// returns its plain text.
+func texSection(source, name string) (string, bool) {
+	_, start, end, _, ok := texSectionSpan(source, name)
+	if !ok {
+		return "", false
+	}
+	return texParagraphs(source[start:end]), true
+}
+
+// texSectionSpan finds the first environment or section named name in
+// source. It returns the positions of the environment or section command,
+// of its content, of the end of its content and of its end. Sections end
+// at the next section of the same or a higher level or at the end of the
+// document body.
+func texSectionSpan(source, name string) (int, int, int, int, bool) {
+	if begin := "\\begin{" + name + "}"; strings.Contains(source, begin) {
+		start := strings.Index(source, begin)
+		contentStart := start + len(begin)
+		end := "\\end{" + name + "}"
+		contentEnd := strings.Index(source[contentStart:], end)
+		if contentEnd < 0 {
+			return 0, 0, 0, 0, false
+		}
+		contentEnd += contentStart
+		return start, contentStart, contentEnd, contentEnd + len(end), true
+	}
+
+	for _, loc := range texSectionCommand.FindAllStringSubmatchIndex(source, -1) {
+		title, titleEnd, ok := texGroup(source, loc[1]-1)
+		if !ok || !strings.EqualFold(texToPlain(title), strings.TrimSpace(name)) {
+			continue
+		}
+		level := sectionLevels[source[loc[2]:loc[3]]]
+		end := len(source)
+		for _, next := range texSectionCommand.FindAllStringSubmatchIndex(source[titleEnd:], -1) {
+			if sectionLevels[source[titleEnd+next[2]:titleEnd+next[3]]] <= level {
+				end = titleEnd + next[0]
+				break
+			}
+		}
+		if m := texSectionEnd.FindStringIndex(source[titleEnd:end]); m != nil {
+			end = titleEnd + m[0]
+		}
+		return loc[0], titleEnd, end, end, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// texParagraphs converts TeX to plain text, keeping paragraphs.
+func texParagraphs(s string) string {
+	// headings of subsections start new paragraphs
+	s = texSectionCommand.ReplaceAllString(s, "\n\n$0")
+	paragraphs := []string{}
+	for _, paragraph := range regexp.MustCompile(`\n\s*\n|\\par\b`).Split(s, -1) {
+		if text := texToPlain(paragraph); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// pdfSection finds a heading named name in the text of a PDF and returns
+// the text following it up to the next numbered heading or the end of the
+// page.
+func pdfSection(pages []string, name string) (string, bool) {
+	heading := regexp.MustCompile(`(?i)^\s*(?:\d+(?:\.\d+)*\.?\s+)?` + regexp.QuoteMeta(strings.TrimSpace(name)) + `\s*$`)
+	for _, page := range pages {
+		lines := splitLines(page)
+		for i, line := range lines {
+			if !heading.MatchString(line) {
+				continue
+			}
+			paragraphs := []string{}
+			current := []string{}
+			flush := func() {
+				if len(current) > 0 {
+					paragraphs = append(paragraphs, collapseSpace(strings.Join(current, " ")))
+					current = nil
+				}
+			}
+			for _, next := range lines[i+1:] {
+				if pdfNumberedHeading.MatchString(next) && len(strings.Fields(next)) <= 8 {
+					break
+				}
+				if strings.TrimSpace(next) == "" {
+					flush()
+					continue
+				}
+				current = append(current, strings.TrimSpace(next))
+			}
+			flush()
+			return strings.Join(paragraphs, "\n\n"), true
+		}
+	}
+	return "", false
+}
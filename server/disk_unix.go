@@ -0,0 +1,14 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	latex "github.com/jojomi/go-latex"
+)
+
+// checkTimeout bounds the time of a single health check.
+const checkTimeout = 5 * time.Second
+
+// Check is a named health check reported by /healthz.
+type Check struct {
+	Name string
+	// Readiness makes the check part of /readyz as well.
+	Readiness bool
+	Func      func(ctx context.Context) error
+}
+
+// AddCheck adds a health check.
+func (s *Server) AddCheck(check Check) {
+	s.checks = append(s.checks, check)
+}
+
+// SetReady changes the readiness reported by /readyz, e.g. to take the
+// server out of load balancing while it drains.
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// ToolCheck reports tools missing for task, e.g. pdflatex. It honors the
+// toolchain of the task.
+func ToolCheck(task *latex.CompileTask, tools ...string) Check {
+	return Check{
+		Name: "toolchain",
+		Func: func(ctx context.Context) error {
+			return task.CheckTools(tools...)
+		},
+	}
+}
+
+// DiskSpaceCheck reports less than minFree bytes available in dir.
+func DiskSpaceCheck(dir string, minFree uint64) Check {
+	return Check{
+		Name: "disk",
+		Func: func(ctx context.Context) error {
+			free, err := freeSpace(dir)
+			if err != nil {
+				return err
+			}
+			if free < minFree {
+				return fmt.Errorf("only %d bytes free in %s, need %d", free, dir, minFree)
+			}
+			return nil
+		},
+	}
+}
+
+// QueueCheck reports the queue as saturated if more than maxPending jobs are
+// waiting. It is a readiness check too.
+func QueueCheck(queue *latex.Queue, maxPending int) Check {
+	return Check{
+		Name:      "queue",
+		Readiness: true,
+		Func: func(ctx context.Context) error {
+			pending, _ := queue.Len()
+			if pending > maxPending {
+				return fmt.Errorf("queue saturated: %d jobs pending", pending)
+			}
+			return nil
+		},
+	}
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// runChecks runs the checks selected by filter and reports whether all
+// passed.
+func (s *Server) runChecks(r *http.Request, filter func(Check) bool) (healthResponse, bool) {
+	response := healthResponse{Status: "ok", Checks: map[string]string{}}
+	ok := true
+	for _, check := range s.checks {
+		if !filter(check) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := check.Func(ctx)
+		cancel()
+		if err != nil {
+			ok = false
+			response.Checks[check.Name] = err.Error()
+		} else {
+			response.Checks[check.Name] = "ok"
+		}
+	}
+	if !ok {
+		response.Status = "failing"
+	}
+	return response, ok
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	response, ok := s.runChecks(r, func(Check) bool { return true })
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready"})
+		return
+	}
+	response, ok := s.runChecks(r, func(c Check) bool { return c.Readiness })
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
@@ -0,0 +1,206 @@
+// Package server exposes a latex.Queue over HTTP.
+//
+// Jobs are submitted by POSTing their JSON payload to /jobs. An
+// Idempotency-Key header makes retried requests return the job submitted
+// first instead of compiling twice, a priority query parameter sets the job
+// priority, up to the maximum set using SetMaxPriority. With wait=true the
+// request blocks until the job has finished. The status of a job is served
+// at /jobs/{id}, the artifact of a finished job at /jobs/{id}/artifact.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	latex "github.com/jojomi/go-latex"
+)
+
+// maxPayloadSize limits the size of job payloads.
+const maxPayloadSize = 10 << 20
+
+// Server serves a job queue and its health endpoints.
+type Server struct {
+	queue       *latex.Queue
+	checks      []Check
+	ready       atomic.Bool
+	maxPriority int
+	mux         *http.ServeMux
+}
+
+// New returns a Server for queue. It is ready to accept jobs right away.
+func New(queue *latex.Queue) *Server {
+	s := &Server{
+		queue:       queue,
+		maxPriority: latex.PriorityNormal,
+		mux:         http.NewServeMux(),
+	}
+	s.ready.Store(true)
+	s.mux.HandleFunc("POST /jobs", s.submit)
+	s.mux.HandleFunc("GET /jobs/{id}", s.status)
+	s.mux.HandleFunc("GET /jobs/{id}/artifact", s.artifact)
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.HandleFunc("GET /readyz", s.readyz)
+	return s
+}
+
+// SetMaxPriority sets the highest priority clients may request, higher ones
+// are lowered to it. It is latex.PriorityNormal by default, so clients can't
+// preempt other jobs. Raise it only if the server is reachable by trusted
+// clients alone. It must be called before serving.
+func (s *Server) SetMaxPriority(priority int) {
+	s.maxPriority = priority
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Drain prepares the server for exiting: it reports not ready, stops
+// accepting jobs, gives running jobs until ctx is done to finish and saves
+// the jobs left to persistFile if it is not empty. Resubmit them on the next
+// start using latex.LoadJobs. Call it after shutting down the HTTP server.
+func (s *Server) Drain(ctx context.Context, persistFile string) error {
+	s.SetReady(false)
+	jobs, err := s.queue.Shutdown(ctx)
+	if persistFile != "" {
+		saveErr := latex.SaveJobs(persistFile, jobs)
+		if saveErr != nil {
+			return saveErr
+		}
+	}
+	return err
+}
+
+type jobResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Reused bool   `json:"reused,omitempty"`
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(payload) > maxPayloadSize {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.New("payload too large"))
+		return
+	}
+	if !json.Valid(payload) {
+		writeError(w, http.StatusBadRequest, errors.New("payload is not valid JSON"))
+		return
+	}
+	job := latex.Job{
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		Payload:        payload,
+	}
+	if priority := r.URL.Query().Get("priority"); priority != "" {
+		job.Priority, err = strconv.Atoi(priority)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid priority"))
+			return
+		}
+		job.Priority = min(job.Priority, s.maxPriority)
+	}
+
+	ticket, err := s.queue.Submit(job)
+	switch {
+	case errors.Is(err, latex.ErrQueueFull), errors.Is(err, latex.ErrQueueClosed):
+		w.Header().Set("Retry-After", "10")
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		result, err := ticket.Wait(r.Context())
+		if err != nil {
+			return
+		}
+		writeJSON(w, http.StatusOK, resultResponse(result))
+		return
+	}
+	select {
+	case <-ticket.Done():
+		result, _ := ticket.Wait(r.Context())
+		writeJSON(w, http.StatusOK, resultResponse(result))
+	default:
+		writeJSON(w, http.StatusAccepted, jobResponse{ID: ticket.Job.ID, Status: "queued"})
+	}
+}
+
+func resultResponse(result latex.JobResult) jobResponse {
+	response := jobResponse{ID: result.JobID, Status: "done", Reused: result.Reused}
+	if result.Err != nil {
+		response.Status = "failed"
+		response.Error = result.Err.Error()
+	}
+	return response
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if ticket, ok := s.queue.Lookup(id); ok {
+		writeJSON(w, http.StatusOK, jobResponse{ID: ticket.Job.ID, Status: "queued"})
+		return
+	}
+	if result, ok := s.queue.Failure(id); ok {
+		writeJSON(w, http.StatusOK, resultResponse(result))
+		return
+	}
+	_, err := s.queue.Store().Get(id)
+	if errors.Is(err, latex.ErrArtifactNotFound) {
+		writeError(w, http.StatusNotFound, errors.New("unknown job"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobResponse{ID: id, Status: "done"})
+}
+
+func (s *Server) artifact(w http.ResponseWriter, r *http.Request) {
+	file, err := s.queue.Store().Get(r.PathValue("id"))
+	if errors.Is(err, latex.ErrArtifactNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,176 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PdfSigning configures the digital signature of PDFs, see SignPdf.
+type PdfSigning struct {
+	// PKCS12 is the file holding the certificate and private key of the
+	// signer, usually ending in .p12 or .pfx.
+	PKCS12 string
+	// Password decrypts the PKCS#12 file, empty if it is not encrypted.
+	Password string
+	// Field is the name of the signature field, "Signature" by default. An
+	// existing empty field is filled, otherwise an invisible one is added.
+	Field string
+	// Reason, Location and ContactInfo are shown by viewers, e.g. "Invoice
+	// issued" and "Berlin".
+	Reason      string
+	Location    string
+	ContactInfo string
+	// TimestampURL is the RFC 3161 time stamp authority proving the time of
+	// signing, none by default.
+	TimestampURL string
+	// PAdES creates a PAdES baseline signature as required for advanced
+	// electronic signatures in the EU.
+	PAdES bool
+}
+
+// field returns the name of the signature field.
+func (s PdfSigning) field() string {
+	if s.Field == "" {
+		return "Signature"
+	}
+	return s.Field
+}
+
+// Signer digitally signs PDFs, see SignPdf.
+type Signer interface {
+	// Name identifies the signer.
+	Name() string
+	// Available reports whether the signer can be used by the task, e.g.
+	// because its tool is installed.
+	Available(t *CompileTask) bool
+	// Sign writes a signed version of input to output. The password of the
+	// PKCS#12 file is read from passwordFile instead of signing.Password.
+	Sign(t *CompileTask, input, output, passwordFile string, signing PdfSigning) error
+}
+
+// toolSigner is a Signer running an external tool.
+type toolSigner struct {
+	name string
+	tool string
+	args func(input, output, passwordFile string, signing PdfSigning) []string
+}
+
+func (s toolSigner) Name() string {
+	return s.name
+}
+
+func (s toolSigner) Available(t *CompileTask) bool {
+	return t.hasCommand(s.tool)
+}
+
+func (s toolSigner) Sign(t *CompileTask, input, output, passwordFile string, signing PdfSigning) error {
+	_, err := t.runTool(s.tool, s.args(input, output, passwordFile, signing)...)
+	return err
+}
+
+// PyHankoSigner signs PDFs using pyHanko, which supports time stamps and
+// PAdES.
+var PyHankoSigner Signer = toolSigner{
+	name: "pyhanko",
+	tool: "pyhanko",
+	args: func(input, output, passwordFile string, signing PdfSigning) []string {
+		args := []string{"sign", "addsig", "--field", signing.field()}
+		if signing.Reason != "" {
+			args = append(args, "--reason", signing.Reason)
+		}
+		if signing.Location != "" {
+			args = append(args, "--location", signing.Location)
+		}
+		if signing.ContactInfo != "" {
+			args = append(args, "--contact-info", signing.ContactInfo)
+		}
+		if signing.TimestampURL != "" {
+			args = append(args, "--timestamp-url", signing.TimestampURL)
+		}
+		if signing.PAdES {
+			args = append(args, "--use-pades")
+		}
+		return append(args, "pkcs12", "--passfile", passwordFile, input, output, signing.PKCS12)
+	},
+}
+
+// Signing returns the signature applied by MoveToDest, nil if none.
+func (t *CompileTask) Signing() *PdfSigning {
+	return t.signing
+}
+
+// SetSigning makes MoveToDest sign PDFs using SignPdf as the last step before
+// moving them, after the metadata is stamped. Signing can't be combined with
+// SetEncryption, as encrypting breaks the signature. Use nil to move PDFs
+// unsigned.
+func (t *CompileTask) SetSigning(signing *PdfSigning) {
+	t.signing = signing
+}
+
+// SetSigner sets the signer used by SignPdf, PyHankoSigner by default.
+func (t *CompileTask) SetSigner(signer Signer) {
+	t.signer = signer
+}
+
+// Signer returns the signer used by SignPdf.
+func (t *CompileTask) Signer() Signer {
+	if t.signer == nil {
+		return PyHankoSigner
+	}
+	return t.signer
+}
+
+// SignPdf digitally signs a PDF with the certificate of a PKCS#12 file,
+// defaulting to the output of the compiled file, e.g. for invoices and
+// contracts. The password is passed to the signer in a file, so it doesn't
+// show up in process listings. Any later change of the PDF invalidates the
+// signature, so sign last.
+//
+// The signer runs as the current user outside of the sandbox and toolchain
+// (see SetRunAs, SetSandbox and SetToolchain), so the private key and the
+// password are never readable by the user TeX runs as.
+func (t *CompileTask) SignPdf(file string, signing PdfSigning) error {
+	file = t.pdfPath(file)
+	if signing.PKCS12 == "" {
+		return errors.New("signing needs a PKCS#12 file")
+	}
+	pkcs12, err := filepath.Abs(signing.PKCS12)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(pkcs12)
+	if err != nil {
+		return err
+	}
+	signing.PKCS12 = pkcs12
+	if strings.ContainsAny(signing.Password, "\r\n") {
+		return errors.New("password must not contain line breaks")
+	}
+	signer := t.Signer()
+	unconfined := t.withContext(t.Context())
+	unconfined.runAs, unconfined.sandbox, unconfined.toolchain = nil, nil, nil
+	if !signer.Available(unconfined) {
+		return fmt.Errorf("signer %s is not available", signer.Name())
+	}
+	return unconfined.replaceWith(file, func(output string) error {
+		// private to the current user, unlike the compile directory
+		passwordFile, err := os.CreateTemp("", "go-latex-sign-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(passwordFile.Name())
+		_, err = passwordFile.WriteString(signing.Password)
+		closeErr := passwordFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		signing.Password = ""
+		return signer.Sign(unconfined, file, output, passwordFile.Name(), signing)
+	})
+}
@@ -0,0 +1,139 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Signature places a signature or initials image in the document. Templates
+// need to load the tikz package.
+type Signature struct {
+	// Anchor names the position in the template, see the signature template
+	// function.
+	Anchor string
+	// Image is a PNG, JPEG, PDF or SVG file, SVGs are converted to PDF using
+	// rsvg-convert or inkscape.
+	Image string
+	// Width is a TeX dimension, defaults to 4cm.
+	Width string
+	// Pages places the image on the given pages instead of at the anchor,
+	// e.g. for initials. AllPages places it on every page. X and Y are TeX
+	// dimensions measured from the top left corner of the page.
+	Pages    []int
+	AllPages bool
+	X, Y     string
+}
+
+// AddSignature adds a signature to be placed in templates. It must be called
+// before executing the template.
+func (t *CompileTask) AddSignature(signature Signature) {
+	t.signatures = append(t.signatures, signature)
+}
+
+// Signatures returns the signatures added to the task.
+func (t *CompileTask) Signatures() []Signature {
+	return t.signatures
+}
+
+func (s Signature) onPages() bool {
+	return s.AllPages || len(s.Pages) > 0
+}
+
+func (s Signature) width() string {
+	if s.Width == "" {
+		return "4cm"
+	}
+	return s.Width
+}
+
+// signatureFuncs returns the template functions placing signatures:
+//
+//	{{ signature "client" }} places the image of the anchor at the current
+//	position, with its bottom left corner on the baseline. Without a
+//	signature for the anchor nothing is printed, so the same template
+//	renders the unsigned document.
+//	{{ signatureOverlays }} belongs to the preamble and places the
+//	signatures with pages.
+func (t *CompileTask) signatureFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"signature": func(anchor string) (Raw, error) {
+			for i, s := range t.signatures {
+				if s.Anchor != anchor || s.onPages() {
+					continue
+				}
+				image, err := t.signatureImage(i)
+				if err != nil {
+					return "", err
+				}
+				return Raw(fmt.Sprintf(`\tikz[remember picture,overlay]\node[anchor=south west,inner sep=0pt] at (0,0) {\includegraphics[width=%s]{%s}};`,
+					s.width(), image)), nil
+			}
+			return "", nil
+		},
+		"signatureOverlays": func() (Raw, error) {
+			var b strings.Builder
+			for i, s := range t.signatures {
+				if !s.onPages() {
+					continue
+				}
+				image, err := t.signatureImage(i)
+				if err != nil {
+					return "", err
+				}
+				node := fmt.Sprintf(`\tikz[remember picture,overlay]\node[anchor=north west,inner sep=0pt] at ([xshift=%s,yshift=-%s]current page.north west) {\includegraphics[width=%s]{%s}};`,
+					texDimension(s.X), texDimension(s.Y), s.width(), image)
+				b.WriteString(`\AddToHook{shipout/foreground}{`)
+				if s.AllPages {
+					b.WriteString(node)
+				} else {
+					for _, page := range s.Pages {
+						fmt.Fprintf(&b, `\ifnum\ReadonlyShipoutCounter=%d %s\fi`, page, node)
+					}
+				}
+				b.WriteString("}\n")
+			}
+			return Raw(b.String()), nil
+		},
+	}
+}
+
+func texDimension(d string) string {
+	if d == "" {
+		return "0pt"
+	}
+	return d
+}
+
+// signatureImage copies the image of a signature to the compilation
+// directory, converting SVGs to PDF, and returns its name relative to it.
+func (t *CompileTask) signatureImage(index int) (string, error) {
+	s := t.signatures[index]
+	ext := strings.ToLower(filepath.Ext(s.Image))
+	if !contains([]string{".png", ".jpg", ".jpeg", ".pdf", ".svg"}, ext) {
+		return "", fmt.Errorf("unsupported signature image %s", s.Image)
+	}
+	dir := filepath.Join(t.CompileDirInternal(), "signatures")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("signature-%d", index)
+	if ext != ".svg" {
+		err = copyFile(s.Image, filepath.Join(dir, name+ext))
+		return "signatures/" + name + ext, err
+	}
+
+	target := filepath.Join(dir, name+".pdf")
+	source, err := filepath.Abs(s.Image)
+	if err != nil {
+		return "", err
+	}
+	if t.hasCommand("rsvg-convert") {
+		_, err = t.runTool("rsvg-convert", "--format=pdf", "--output="+target, source)
+	} else {
+		_, err = t.runTool("inkscape", "--export-type=pdf", "--export-filename="+target, source)
+	}
+	return "signatures/" + name + ".pdf", err
+}
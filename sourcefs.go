@@ -0,0 +1,58 @@
+package latex
+
+import (
+	"io/fs"
+	"text/template"
+)
+
+// SourceFS returns the file system the sources are materialized from, nil if
+// they are copied from the source directory.
+func (t *CompileTask) SourceFS() fs.FS {
+	return t.sourceFS
+}
+
+// SetSourceFS makes CopyToCompileDir write the files of fsys to the compile
+// directory instead of copying the source directory, e.g. for templates
+// embedded into the binary using embed.FS. Use fs.Sub to select a
+// directory:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	sources, _ := fs.Sub(templates, "templates")
+//	task.SetSourceFS(sources)
+//
+// Links and other special files are skipped, the SourceLimits apply (see
+// SetSourceLimits). A source archive set takes precedence. Use nil to copy
+// the source directory again.
+func (t *CompileTask) SetSourceFS(fsys fs.FS) {
+	t.sourceFS = fsys
+}
+
+// TemplateFS parses the templates matching the patterns in fsys (see
+// template.ParseFS) with the template functions of this task, like
+// Template for templates on disk. Execute them using ExecuteTemplate after
+// CopyToCompileDir.
+func (t *CompileTask) TemplateFS(fsys fs.FS, patterns ...string) (*template.Template, error) {
+	return template.New("latex").Funcs(t.templateFuncs()).ParseFS(fsys, patterns...)
+}
+
+// materializeFS writes the regular files of fsys using m.
+func materializeFS(fsys fs.FS, m *materializer) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			return m.mkdir(path)
+		case !d.Type().IsRegular():
+			return nil
+		}
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return m.writeFile(path, f)
+	})
+}
@@ -0,0 +1,220 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StampPosition is the position of the text of a Stamp.
+type StampPosition string
+
+// Positions of stamp texts.
+const (
+	// StampDiagonal centers the text along the diagonal of the page from
+	// the bottom left to the top right.
+	StampDiagonal StampPosition = "diagonal"
+	StampCenter   StampPosition = "center"
+	StampTop      StampPosition = "top"
+	StampBottom   StampPosition = "bottom"
+)
+
+// Stamp is a watermark placed over pages, like "DRAFT" on previews or the
+// name of the customer on licensed copies, see Stamp.
+type Stamp struct {
+	// Text is stamped in gray Helvetica Bold, characters outside of
+	// Windows-1252 are replaced by question marks.
+	Text string
+	// Overlay is a PDF whose first page is stamped instead of a text. It is
+	// centered on the pages and shrunk to fit, Position and Size don't apply.
+	Overlay string
+	// Position defaults to StampDiagonal.
+	Position StampPosition
+	// Size is the font size in points. By default texts span most of the
+	// diagonal or width of the page, or are 12 points at the top or bottom.
+	Size float64
+	// Opacity ranges from 0 (invisible) to 1 (opaque), 0.3 if 0.
+	Opacity float64
+	// Pages selects the pages stamped, all pages if nil.
+	Pages PageSelector
+}
+
+// stampGState is the name of the graphics state of overlay stamps.
+const stampGState = "/GoLatexStamp"
+
+// Watermark returns the stamp applied by MoveToDest, nil if none.
+func (t *CompileTask) Watermark() *Stamp {
+	return t.watermark
+}
+
+// SetWatermark makes MoveToDest stamp PDFs after applying the background PDF,
+// e.g. for marking preview builds as drafts. Use nil for final builds.
+func (t *CompileTask) SetWatermark(stamp *Stamp) {
+	t.watermark = stamp
+}
+
+// Stamp places a text or the first page of an overlay PDF over the selected
+// pages of a PDF, defaulting to the output of the compiled file:
+//
+//	task.Stamp("", latex.Stamp{Text: "DRAFT"})
+//
+// Unlike the background PDF, stamps are visible on top of images and filled
+// areas. It requires qpdf.
+func (t *CompileTask) Stamp(file string, stamp Stamp) error {
+	file = t.pdfPath(file)
+	switch {
+	case (stamp.Text == "") == (stamp.Overlay == ""):
+		return errors.New("stamp needs either a text or an overlay")
+	case stamp.Opacity < 0 || stamp.Opacity > 1:
+		return fmt.Errorf("stamp opacity %g out of range", stamp.Opacity)
+	}
+	opacity := stamp.Opacity
+	if opacity == 0 {
+		opacity = 0.3
+	}
+
+	o, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+	refs := o.pages()
+	pages := stamp.Pages.selectPages(len(refs))
+	if len(pages) == 0 {
+		return nil
+	}
+	to := make([]string, 0, len(pages))
+	for _, page := range pages {
+		to = append(to, fmt.Sprint(page))
+	}
+
+	stampFile, err := os.CreateTemp(filepath.Dir(file), ".go-latex-stamp-*.pdf")
+	if err != nil {
+		return err
+	}
+	stampFile.Close()
+	defer os.Remove(stampFile.Name())
+	from := "--from=1-z"
+	if stamp.Text != "" {
+		d := simplePdf{}
+		for _, page := range pages {
+			width, height := o.pageSize(refs[page-1])
+			stamp.draw(d.addPage(width, height), opacity)
+		}
+		err = d.writeFile(stampFile.Name())
+	} else {
+		from = "--from="
+		err = t.translucentOverlay(stamp.Overlay, stampFile.Name(), opacity)
+	}
+	if err != nil {
+		return err
+	}
+	return t.replaceWith(file, func(output string) error {
+		_, err := t.runTool("qpdf", file,
+			"--overlay", stampFile.Name(), "--to="+strings.Join(to, ","), from, "--repeat=1", "--",
+			output)
+		return err
+	})
+}
+
+// draw draws the text of the stamp on a page.
+func (s Stamp) draw(p *simplePdfPage, opacity float64) {
+	p.setOpacity(opacity)
+	p.gray(0.5)
+	width := helveticaWidth(s.Text, true)
+	size := s.Size
+	switch s.Position {
+	case StampDiagonal, "":
+		diagonal := math.Hypot(p.width, p.height)
+		if size == 0 {
+			size = math.Min(0.7*diagonal/width, 160)
+		}
+		angle := math.Atan2(p.height, p.width) * 180 / math.Pi
+		p.rotatedText(p.width/2, p.height/2, size, angle, true, s.Text)
+	case StampCenter:
+		if size == 0 {
+			size = math.Min(0.8*p.width/width, 160)
+		}
+		p.rotatedText(p.width/2, p.height/2, size, 0, true, s.Text)
+	case StampTop:
+		if size == 0 {
+			size = 12
+		}
+		p.centeredText(p.width/2, p.height-28-size, size, true, s.Text)
+	case StampBottom:
+		if size == 0 {
+			size = 12
+		}
+		p.centeredText(p.width/2, 28, size, true, s.Text)
+	}
+}
+
+// translucentOverlay writes a copy of the overlay PDF to file, with the
+// content of its first page drawn using the given opacity.
+func (t *CompileTask) translucentOverlay(overlay, file string, opacity float64) error {
+	err := copyFile(overlay, file)
+	if err != nil {
+		return err
+	}
+	if opacity == 1 {
+		return nil
+	}
+	o, err := t.readPdfObjects(file)
+	if err != nil {
+		return err
+	}
+	refs := o.pages()
+	if len(refs) == 0 {
+		return fmt.Errorf("%s: no pages", overlay)
+	}
+	page, pageRef := o.dict(refs[0])
+	page = copyPdfDict(page)
+
+	resources, resourcesRef := o.dict(o.inherited(pageRef, "/Resources"))
+	resources = copyPdfDict(resources)
+	states, statesRef := o.dict(resources["/ExtGState"])
+	states = copyPdfDict(states)
+	states[stampGState] = map[string]interface{}{"/ca": opacity, "/CA": opacity}
+	if statesRef != "" {
+		o.set(statesRef, states)
+	} else {
+		resources["/ExtGState"] = states
+	}
+	if resourcesRef != "" {
+		o.set(resourcesRef, resources)
+	} else {
+		page["/Resources"] = resources
+	}
+
+	contents := []interface{}{}
+	switch v := o.resolve(page["/Contents"]).(type) {
+	case []interface{}:
+		contents = append(contents, v...)
+	default:
+		if page["/Contents"] != nil {
+			contents = append(contents, page["/Contents"])
+		}
+	}
+	begin := o.add(nil)
+	o.setStream(begin, map[string]interface{}{}, []byte("q "+stampGState+" gs\n"))
+	end := o.add(nil)
+	o.setStream(end, map[string]interface{}{}, []byte("\nQ\n"))
+	page["/Contents"] = append(append([]interface{}{begin}, contents...), end)
+	o.set(pageRef, page)
+	return t.writePdfObjects(file, o)
+}
+
+// inherited returns the value of an inheritable page attribute, looking it
+// up in the parents of the page if necessary.
+func (o *pdfObjects) inherited(ref, key string) interface{} {
+	node, _ := o.dict(ref)
+	for depth := 0; node != nil && depth < 32; depth++ {
+		if v, ok := node[key]; ok {
+			return v
+		}
+		node, _ = o.dict(node["/Parent"])
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package latex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BuildRecord is the outcome of one build, as kept by a StatsStore.
+type BuildRecord struct {
+	Time time.Time `json:"time"`
+	// Template names the template built, see SetStatsStore.
+	Template string `json:"template"`
+	// Version is the version declared by the template, if any.
+	Version  string        `json:"version,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed,omitempty"`
+	// Warnings counts the warnings of the build by category.
+	Warnings map[WarningCategory]int `json:"warnings,omitempty"`
+}
+
+// TemplateStats aggregates the builds of a template in a period.
+type TemplateStats struct {
+	Template string `json:"template"`
+	// Start is the beginning of the period, the time of the first build if
+	// the stats are not bucketed.
+	Start        time.Time               `json:"start"`
+	Builds       int                     `json:"builds"`
+	Failures     int                     `json:"failures"`
+	MeanDuration time.Duration           `json:"mean_duration"`
+	MaxDuration  time.Duration           `json:"max_duration"`
+	Warnings     map[WarningCategory]int `json:"warnings,omitempty"`
+}
+
+// FailureRate returns the share of failed builds, 0 if there were none.
+func (s TemplateStats) FailureRate() float64 {
+	if s.Builds == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Builds)
+}
+
+// WarningsPerBuild returns the average number of warnings of a build.
+func (s TemplateStats) WarningsPerBuild() float64 {
+	if s.Builds == 0 {
+		return 0
+	}
+	total := 0
+	for _, n := range s.Warnings {
+		total += n
+	}
+	return float64(total) / float64(s.Builds)
+}
+
+func (s *TemplateStats) add(r BuildRecord) {
+	if s.Builds == 0 || r.Time.Before(s.Start) {
+		s.Start = r.Time
+	}
+	s.MeanDuration = (s.MeanDuration*time.Duration(s.Builds) + r.Duration) / time.Duration(s.Builds+1)
+	s.Builds++
+	if r.Failed {
+		s.Failures++
+	}
+	s.MaxDuration = max(s.MaxDuration, r.Duration)
+	for category, n := range r.Warnings {
+		if s.Warnings == nil {
+			s.Warnings = map[WarningCategory]int{}
+		}
+		s.Warnings[category] += n
+	}
+}
+
+// StatsStore collects build records and aggregates them per template, so
+// templates getting slower or failing more often can be spotted. Records
+// are appended to a JSON lines file, which is read back on opening the
+// store. It is safe for concurrent use.
+type StatsStore struct {
+	mu      sync.RWMutex
+	file    *os.File
+	records map[string][]BuildRecord
+}
+
+// OpenStatsStore opens the stats store kept in file, creating it if needed.
+// Use an empty file for a store held in memory only.
+func OpenStatsStore(file string) (*StatsStore, error) {
+	s := &StatsStore{records: map[string][]BuildRecord{}}
+	if file == "" {
+		return s, nil
+	}
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return nil, err
+	}
+	s.file, err = os.OpenFile(file, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(s.file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r BuildRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			// partially written record of a crashed process
+			continue
+		}
+		s.records[r.Template] = append(s.records[r.Template], r)
+	}
+	if err := scanner.Err(); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	for _, records := range s.records {
+		slices.SortStableFunc(records, func(a, b BuildRecord) int {
+			return a.Time.Compare(b.Time)
+		})
+	}
+	return s, nil
+}
+
+// Record adds a build record to the store.
+func (s *StatsStore) Record(r BuildRecord) error {
+	if r.Template == "" {
+		return errors.New("build record without template")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = s.file.Write(append(line, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	records := s.records[r.Template]
+	i := len(records)
+	for i > 0 && records[i-1].Time.After(r.Time) {
+		i--
+	}
+	s.records[r.Template] = slices.Insert(records, i, r)
+	return nil
+}
+
+// Templates returns the names of the templates with records, sorted.
+func (s *StatsStore) Templates() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	templates := make([]string, 0, len(s.records))
+	for template := range s.records {
+		templates = append(templates, template)
+	}
+	slices.Sort(templates)
+	return templates
+}
+
+// Records returns the records of template since the given time, oldest
+// first.
+func (s *StatsStore) Records(template string, since time.Time) []BuildRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := s.records[template]
+	i, _ := slices.BinarySearchFunc(records, since, func(r BuildRecord, since time.Time) int {
+		return r.Time.Compare(since)
+	})
+	return slices.Clone(records[i:])
+}
+
+// Stats aggregates the builds of template since the given time.
+func (s *StatsStore) Stats(template string, since time.Time) TemplateStats {
+	stats := TemplateStats{Template: template}
+	for _, r := range s.Records(template, since) {
+		stats.add(r)
+	}
+	return stats
+}
+
+// Trend aggregates the builds of template since the given time in buckets
+// of the given length, starting at since. Buckets without builds are
+// included, so the trend has no gaps.
+func (s *StatsStore) Trend(template string, since time.Time, bucket time.Duration) []TemplateStats {
+	if bucket <= 0 {
+		return nil
+	}
+	trend := []TemplateStats{}
+	for _, r := range s.Records(template, since) {
+		i := int(r.Time.Sub(since) / bucket)
+		for len(trend) <= i {
+			trend = append(trend, TemplateStats{
+				Template: template,
+				Start:    since.Add(time.Duration(len(trend)) * bucket),
+			})
+		}
+		start := trend[i].Start
+		trend[i].add(r)
+		trend[i].Start = start
+	}
+	return trend
+}
+
+// Close closes the file of the store.
+func (s *StatsStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// StatsStore returns the store builds are recorded to, nil if none.
+func (t *CompileTask) StatsStore() *StatsStore {
+	return t.stats
+}
+
+// SetStatsStore makes Build record the duration, the outcome and the
+// warnings of each build to store under the name template. If template is
+// empty, the name of the source directory is used. Failing to record makes
+// Build fail. Use a nil store to stop recording.
+func (t *CompileTask) SetStatsStore(store *StatsStore, template string) {
+	t.stats = store
+	t.statsTemplate = template
+}
+
+// recordStats records a build started at start with outcome err to the
+// stats store, if there is one, and returns the error to report.
+func (t *CompileTask) recordStats(start time.Time, result *CompileResult, err error) error {
+	if t.stats == nil {
+		return err
+	}
+	r := BuildRecord{
+		Time:     start.UTC(),
+		Template: t.statsTemplate,
+		Version:  t.templateVersion,
+		Duration: time.Since(start),
+		Failed:   err != nil,
+	}
+	if r.Template == "" {
+		r.Template = filepath.Base(t.SourceDir())
+	}
+	if result != nil && len(result.Warnings) > 0 {
+		r.Warnings = map[WarningCategory]int{}
+		for _, d := range result.Warnings {
+			category := d.Category
+			if category == "" {
+				category = WarningOther
+			}
+			r.Warnings[category]++
+		}
+	}
+	recordErr := t.stats.Record(r)
+	if recordErr != nil {
+		return errors.Join(err, fmt.Errorf("recording build stats: %w", recordErr))
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Step is a named step of a build pipeline, like a bibliography tool or a
+// company-specific stamping tool. Steps are registered by name, so they can
+// be configured for a task (see SetSteps) and used by the CLI.
+type Step interface {
+	Name() string
+	// Run runs the step for a compiled file, given relative to the compile
+	// directory.
+	Run(t *CompileTask, file string) error
+}
+
+// StepFunc adapts a function to a Step.
+type StepFunc struct {
+	StepName string
+	Func     func(t *CompileTask, file string) error
+}
+
+// Name returns the name of the step.
+func (s StepFunc) Name() string {
+	return s.StepName
+}
+
+// Run calls the function of the step.
+func (s StepFunc) Run(t *CompileTask, file string) error {
+	return s.Func(t, file)
+}
+
+// ExecStep is a Step running an external program, which allows shipping
+// steps as separate executables. The program is run in the compile
+// directory with the environment variables GOLATEX_COMPILE_DIR,
+// GOLATEX_FILE (the TeX file) and GOLATEX_PDF (the PDF) set.
+type ExecStep struct {
+	StepName string
+	Command  string
+	Args     []string
+}
+
+// Name returns the name of the step.
+func (s *ExecStep) Name() string {
+	return s.StepName
+}
+
+// Run runs the program. Failures are returned as *CompileError.
+func (s *ExecStep) Run(t *CompileTask, file string) error {
+	file = t.defaultCompileFilename(file)
+	_, err := t.lookPath(s.Command)
+	if err != nil {
+		return err
+	}
+	command, err := t.commandIn(t.CompileDirInternal(), s.Command, s.Args...)
+	if err != nil {
+		return err
+	}
+	command.Env = append(command.Env,
+		"GOLATEX_COMPILE_DIR="+t.CompileDirInternal(),
+		"GOLATEX_FILE="+file,
+		"GOLATEX_PDF="+t.pdfPath(file),
+	)
+	result, err := t.execute(command, t.verbosity)
+	if err != nil {
+		return newCompileError(s.StepName, file, result, err)
+	}
+	return nil
+}
+
+// OptionalStep marks a step as optional, Build skips it if running it
+// would exceed the budget of the task, see SetBudget.
+func OptionalStep(step Step) Step {
+	return optionalStep{step}
+}
+
+type optionalStep struct {
+	Step
+}
+
+func (s optionalStep) Optional() bool {
+	return true
+}
+
+func isOptionalStep(step Step) bool {
+	optional, ok := step.(interface{ Optional() bool })
+	return ok && optional.Optional()
+}
+
+var stepRegistry = struct {
+	sync.RWMutex
+	steps map[string]Step
+}{
+	steps: map[string]Step{},
+}
+
+func init() {
+	for _, step := range []Step{
+		StepFunc{"bibtex", func(t *CompileTask, file string) error { return t.Bibtex(file) }},
+		StepFunc{"biber", func(t *CompileTask, file string) error { return t.Biber(file) }},
+		StepFunc{"makeindex", func(t *CompileTask, file string) error { return t.Makeindex(file, t.indexOptions) }},
+		StepFunc{"xindy", func(t *CompileTask, file string) error { return t.Xindy(file, t.indexOptions) }},
+		StepFunc{"makeglossaries", func(t *CompileTask, file string) error { return t.Makeglossaries(file) }},
+		StepFunc{"pythontex", func(t *CompileTask, file string) error { return t.Pythontex(file) }},
+		StepFunc{"metadata", func(t *CompileTask, file string) error {
+			return t.StampMetadata(t.texFilenameToPdf(t.defaultCompileFilename(file)))
+		}},
+		StepFunc{"sign", func(t *CompileTask, file string) error {
+			if t.signing == nil {
+				return errors.New("no signing set")
+			}
+			return t.SignPdf(t.texFilenameToPdf(t.defaultCompileFilename(file)), *t.signing)
+		}},
+		StepFunc{"pdfa-1b", pdfAStep(PdfA1b)},
+		StepFunc{"pdfa-2b", pdfAStep(PdfA2b)},
+		StepFunc{"pdfa-3b", pdfAStep(PdfA3b)},
+		StepFunc{"minify-sources", func(t *CompileTask, file string) error { return t.MinifySources() }},
+	} {
+		RegisterStep(step)
+	}
+	for _, channel := range OptimizeChannels {
+		channel := channel
+		RegisterStep(OptionalStep(StepFunc{"optimize-" + channel, func(t *CompileTask, file string) error {
+			return t.Optimize(t.texFilenameToPdf(t.defaultCompileFilename(file)), channel)
+		}}))
+	}
+}
+
+// RegisterStep makes a step available by name to all tasks, replacing a
+// registered step of the same name.
+func RegisterStep(step Step) {
+	if step == nil || step.Name() == "" {
+		panic("latex: RegisterStep needs a step with a name")
+	}
+	stepRegistry.Lock()
+	defer stepRegistry.Unlock()
+	stepRegistry.steps[step.Name()] = step
+}
+
+// LookupStep returns the registered step with the given name.
+func LookupStep(name string) (Step, bool) {
+	stepRegistry.RLock()
+	defer stepRegistry.RUnlock()
+	step, ok := stepRegistry.steps[name]
+	return step, ok
+}
+
+// Steps returns the names of all registered steps, sorted.
+func Steps() []string {
+	stepRegistry.RLock()
+	defer stepRegistry.RUnlock()
+	names := []string{}
+	for name := range stepRegistry.steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunStep runs a registered step for a compiled file (defaulting to the
+// compile file).
+func (t *CompileTask) RunStep(name, file string) error {
+	step, ok := LookupStep(name)
+	if !ok {
+		return fmt.Errorf("unknown step %q", name)
+	}
+	return t.TraceStep(name, func() error {
+		return step.Run(t, t.defaultCompileFilename(file))
+	})
+}
+
+// runSteps runs the steps set using SetSteps, skipping optional ones which
+// would exceed the budget.
+func (t *CompileTask) runSteps(file string, clock *budgetClock, result *CompileResult) error {
+	for _, name := range t.steps {
+		if step, ok := LookupStep(name); ok && isOptionalStep(step) && !clock.allows(0) {
+			result.skip(name)
+			continue
+		}
+		start := time.Now()
+		err := t.RunStep(name, file)
+		clock.measure(start)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Steps returns the names of the steps Build runs after compiling.
+func (t *CompileTask) Steps() []string {
+	return t.steps
+}
+
+// SetSteps sets registered steps Build runs in order after the final
+// engine run, e.g. for stamping the PDF.
+func (t *CompileTask) SetSteps(names ...string) error {
+	for _, name := range names {
+		if _, ok := LookupStep(name); !ok {
+			return fmt.Errorf("unknown step %q", name)
+		}
+	}
+	t.steps = names
+	return nil
+}
@@ -0,0 +1,91 @@
+package latex
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// streamFilename is the name of the TeX file written by CompileReader if no
+// compile file is set.
+const streamFilename = "document.tex"
+
+// CompileReader compiles the TeX source read from r using Build in a new
+// temporary compile directory and writes the PDF to w, for documents
+// generated on the fly without any file handling:
+//
+//	var pdf bytes.Buffer
+//	_, err := task.CompileReader(ctx, strings.NewReader(tex), &pdf)
+//
+// The source is written as the compile file (document.tex if none is set)
+// next to the sources of the task if any are set, so images or classes can
+// be provided using SetSourceDir, SetSourceArchive or SetSourceFS. The
+// compile directory is removed afterwards, so the file paths of the result
+// are empty. The engine is killed when ctx is done, a nil ctx keeps the
+// context of the task.
+func (t *CompileTask) CompileReader(ctx context.Context, r io.Reader, w io.Writer) (*CompileResult, error) {
+	if ctx == nil {
+		ctx = t.Context()
+	}
+	return t.withContext(ctx).compileReader(r, w)
+}
+
+func (t *CompileTask) compileReader(r io.Reader, w io.Writer) (*CompileResult, error) {
+	file := streamFilename
+	if t.compileFilename != "" {
+		file = t.CompileFilename()
+	}
+	c, remove, err := t.inTempCompileDir("go-latex-stream-")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	if c.sourceArchive != "" || c.sourceFS != nil {
+		err = c.ExtractToCompileDir(c.CompileDir())
+	} else {
+		err = os.MkdirAll(c.CompileDirInternal(), 0700)
+		if err == nil && c.sourceDir != "" {
+			err = copyTree(c.sourceDir, c.CompileDirInternal())
+		}
+		if err == nil {
+			err = c.grantAccess(c.CompileDir())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = writeStream(filepath.Join(c.CompileDirInternal(), file), r)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.Build(file)
+	if result != nil {
+		pdf := result.Pdf
+		result.Pdf, result.Log = "", ""
+		if err == nil {
+			err = copyFileTo(w, pdf)
+		}
+	}
+	return result, err
+}
+
+// writeStream writes the content of r to file.
+func writeStream(file string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
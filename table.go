@@ -0,0 +1,133 @@
+package latex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table describes a table generated from data. Long tables use the longtable
+// package, striped ones need xcolor loaded with the table option.
+type Table struct {
+	Columns []TableColumn
+	// Rows hold plain text cells which are escaped, unless RawCells is set.
+	Rows     [][]string
+	RawCells bool
+	Caption  string
+	// Striped colors every other row using StripeColor, defaults to
+	// gray!10.
+	Striped     bool
+	StripeColor string
+	// LongtableThreshold is the number of rows above which longtable is used
+	// so the table breaks across pages, repeating the header. Defaults to 25.
+	LongtableThreshold int
+	// BreakHintEvery encourages page breaks in long tables after every n
+	// rows, e.g. to keep groups of rows together.
+	BreakHintEvery int
+	// ContinuedText is shown below the table on pages but the last, defaults
+	// to "Continued on next page".
+	ContinuedText string
+}
+
+// TableColumn is a column of a Table.
+type TableColumn struct {
+	Header string
+	// Align is a column specifier like l, r, c or p{3cm}, defaults to l.
+	Align string
+}
+
+// IsLong reports whether the table is typeset using longtable.
+func (tb Table) IsLong() bool {
+	threshold := tb.LongtableThreshold
+	if threshold <= 0 {
+		threshold = 25
+	}
+	return len(tb.Rows) > threshold
+}
+
+// Latex returns the TeX source of the table.
+func (tb Table) Latex() string {
+	var b strings.Builder
+	spec := make([]string, 0, len(tb.Columns))
+	headers := make([]string, 0, len(tb.Columns))
+	for _, column := range tb.Columns {
+		align := column.Align
+		if align == "" {
+			align = "l"
+		}
+		spec = append(spec, align)
+		headers = append(headers, `\textbf{`+escapeLatex(column.Header)+`}`)
+	}
+	header := strings.Join(headers, " & ") + ` \\`
+
+	if tb.Striped {
+		color := tb.StripeColor
+		if color == "" {
+			color = "gray!10"
+		}
+		// rows are counted from the header
+		fmt.Fprintf(&b, "\\rowcolors{2}{%s}{white}\n", color)
+	}
+
+	if tb.IsLong() {
+		continued := tb.ContinuedText
+		if continued == "" {
+			continued = "Continued on next page"
+		}
+		fmt.Fprintf(&b, "\\begin{longtable}{%s}\n", strings.Join(spec, ""))
+		if tb.Caption != "" {
+			fmt.Fprintf(&b, "\\caption{%s} \\\\\n", escapeLatex(tb.Caption))
+		}
+		fmt.Fprintf(&b, "\\hline\n%s\n\\hline\n\\endfirsthead\n", header)
+		fmt.Fprintf(&b, "\\hline\n%s\n\\hline\n\\endhead\n", header)
+		fmt.Fprintf(&b, "\\hline\n\\multicolumn{%d}{r}{\\emph{%s}} \\\\\n\\endfoot\n", len(tb.Columns), escapeLatex(continued))
+		b.WriteString("\\hline\n\\endlastfoot\n")
+		tb.writeRows(&b)
+		b.WriteString("\\end{longtable}\n")
+		return b.String()
+	}
+
+	if tb.Caption != "" {
+		b.WriteString("\\begin{table}[htbp]\n\\centering\n")
+		fmt.Fprintf(&b, "\\caption{%s}\n", escapeLatex(tb.Caption))
+	}
+	fmt.Fprintf(&b, "\\begin{tabular}{%s}\n\\hline\n%s\n\\hline\n", strings.Join(spec, ""), header)
+	tb.writeRows(&b)
+	b.WriteString("\\hline\n\\end{tabular}\n")
+	if tb.Caption != "" {
+		b.WriteString("\\end{table}\n")
+	}
+	return b.String()
+}
+
+func (tb Table) writeRows(b *strings.Builder) {
+	long := tb.IsLong()
+	for i, row := range tb.Rows {
+		cells := make([]string, len(tb.Columns))
+		for j := range cells {
+			if j >= len(row) {
+				continue
+			}
+			cells[j] = row[j]
+			if !tb.RawCells {
+				cells[j] = escapeLatex(row[j])
+			}
+		}
+		b.WriteString(strings.Join(cells, " & "))
+		b.WriteString(` \\`)
+		if long && tb.BreakHintEvery > 0 && (i+1)%tb.BreakHintEvery == 0 && i+1 < len(tb.Rows) {
+			b.WriteString(` \pagebreak[2]`)
+		}
+		b.WriteString("\n")
+	}
+}
+
+// tableFuncs returns the template functions for tables:
+//
+//	{{ table .Items }} typesets a Table.
+func tableFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"table": func(tb Table) Raw {
+			return Raw(tb.Latex())
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package latex
+
+// TectonicEngine compiles documents using Tectonic, a self-contained TeX
+// engine which downloads the packages a document needs on demand. It runs
+// reruns and BibTeX on its own, so Build runs it only once. It is
+// registered as "tectonic" with default settings.
+type TectonicEngine struct {
+	// OnlyCached disables downloading packages, for offline builds using a
+	// warmed up cache.
+	OnlyCached bool
+	// Untrusted disables insecure features like shell escape, for
+	// documents from untrusted sources.
+	Untrusted bool
+	// Bundle is the URL or path of the package bundle, empty for the
+	// default one.
+	Bundle string
+}
+
+func init() {
+	RegisterEngine(&TectonicEngine{})
+}
+
+// Name returns "tectonic".
+func (e *TectonicEngine) Name() string {
+	return "tectonic"
+}
+
+// Command returns the executable of Tectonic.
+func (e *TectonicEngine) Command() string {
+	return "tectonic"
+}
+
+// Args returns the arguments compiling file. The log is kept for the
+// diagnostics of Run.
+func (e *TectonicEngine) Args(file string, args []string) []string {
+	result := []string{"--keep-logs", "--synctex"}
+	if e.OnlyCached {
+		result = append(result, "--only-cached")
+	}
+	if e.Untrusted {
+		result = append(result, "--untrusted")
+	}
+	if e.Bundle != "" {
+		result = append(result, "--bundle", e.Bundle)
+	}
+	result = append(result, args...)
+	return append(result, file)
+}
+
+// SupportsFormat reports whether Tectonic can produce format.
+func (e *TectonicEngine) SupportsFormat(format string) bool {
+	return format == "pdf" || format == "xdv"
+}
+
+// SinglePass reports that Tectonic reruns itself as needed.
+func (e *TectonicEngine) SinglePass() bool {
+	return true
+}
+
+// isSinglePass reports whether an engine runs all passes itself.
+func isSinglePass(engine Engine) bool {
+	e, ok := engine.(interface{ SinglePass() bool })
+	return ok && e.SinglePass()
+}
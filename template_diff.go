@@ -0,0 +1,41 @@
+package latex
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// templateDiffContext is the number of context lines of template diffs.
+const templateDiffContext = 3
+
+// TemplateDiff reports whether ExecuteTemplate keeps the template along with
+// a diff to the rendered TeX.
+func (t *CompileTask) TemplateDiff() bool {
+	return t.templateDiff
+}
+
+// SetTemplateDiff makes ExecuteTemplate keep a copy of the template next to
+// the rendered TeX, named like letter.tex.tmpl, along with a unified diff
+// from the template to the rendered TeX named like letter.tex.diff. This
+// lets reviewers verify exactly what data was substituted, e.g. into a
+// contract. Both files stay in the compile directory and are part of
+// evidence bundles.
+func (t *CompileTask) SetTemplateDiff(keep bool) {
+	t.templateDiff = keep
+}
+
+// writeTemplateDiff writes the template source next to the rendered file
+// along with the diff between them.
+func writeTemplateDiff(source []byte, rendered string) error {
+	output, err := os.ReadFile(rendered)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(rendered+".tmpl", source, 0644)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(rendered)
+	diff := unifiedDiff(name+".tmpl", name, string(source), string(output), templateDiffContext)
+	return os.WriteFile(rendered+".diff", []byte(diff), 0644)
+}
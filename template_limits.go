@@ -0,0 +1,324 @@
+package latex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// TemplateLimits restricts template execution, for templates written by
+// untrusted authors. Functions accessing files are never available in
+// restricted mode, the builtin call function is disabled and printf rejects
+// widths and precisions above maxPrintfWidth.
+type TemplateLimits struct {
+	// Timeout bounds the execution time of a template.
+	Timeout time.Duration
+	// MaxOutputSize bounds the size of the rendered output in bytes.
+	MaxOutputSize int64
+	// MaxIterations bounds the number of range iterations and template
+	// calls, 1,000,000 if 0. Loops without output can't be stopped by the
+	// other limits.
+	MaxIterations int64
+	// AllowedFuncs lists the template functions available besides the
+	// builtins.
+	AllowedFuncs []string
+}
+
+// ErrTemplateLimitExceeded is returned if a template exceeds the configured
+// TemplateLimits.
+var ErrTemplateLimitExceeded = errors.New("template limit exceeded")
+
+// Names of the functions charging the iteration budget of restricted
+// templates.
+const (
+	rangeBudgetFuncName = "_golatex_range"
+	callBudgetFuncName  = "_golatex_call"
+)
+
+// fileAccessFuncs lists the template functions which access files.
+var fileAccessFuncs = []string{"includeTex", "asset"}
+
+// maxPrintfWidth bounds the widths and precisions of printf in restricted
+// templates, fmt allocates them up front.
+const maxPrintfWidth = 1000
+
+// TemplateLimits returns the restrictions templates are executed with, nil
+// if unrestricted.
+func (t *CompileTask) TemplateLimits() *TemplateLimits {
+	return t.templateLimits
+}
+
+// SetTemplateLimits restricts the templates executed by this task. It must be
+// called before Template. Use nil to lift the restrictions.
+func (t *CompileTask) SetTemplateLimits(limits *TemplateLimits) {
+	t.templateLimits = limits
+}
+
+// templateFuncs returns the functions available in templates of this task.
+func (t *CompileTask) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{}
+	sources := []map[string]interface{}{
+		TemplateFuncs(),
+		t.signatureFuncs(),
+		t.featureFuncs(),
+		t.includeFuncs(),
+		t.assetFuncs(),
+	}
+	for _, source := range sources {
+		for name, fn := range source {
+			funcs[name] = fn
+		}
+	}
+	if t.bundle != nil {
+		bundle, locale := t.bundle, t.locale
+		autoEscape := t.autoEscape
+		funcs["t"] = func(id string, args ...interface{}) (Raw, error) {
+			if autoEscape {
+				args = escapeArgs(args)
+			}
+			message, err := bundle.Translate(locale, id, args...)
+			return Raw(message), err
+		}
+	}
+	if t.templateLimits == nil {
+		for name, fn := range escapeFuncs() {
+			funcs[name] = fn
+		}
+		return funcs
+	}
+	for name := range funcs {
+		if !contains(t.templateLimits.AllowedFuncs, name) || contains(fileAccessFuncs, name) {
+			delete(funcs, name)
+		}
+	}
+	for name, fn := range escapeFuncs() {
+		funcs[name] = fn
+	}
+	funcs["call"] = func(fn interface{}, args ...interface{}) (interface{}, error) {
+		return nil, errors.New("call is not allowed in restricted templates")
+	}
+	funcs["printf"] = func(format string, args ...interface{}) (string, error) {
+		err := checkPrintfFormat(format)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(format, args...), nil
+	}
+	return funcs
+}
+
+// checkPrintfFormat rejects formats with widths or precisions above
+// maxPrintfWidth and ones taken from the arguments (*).
+func checkPrintfFormat(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) {
+			c := format[i]
+			switch {
+			case c == '*':
+				return fmt.Errorf("%w: printf width from arguments", ErrTemplateLimitExceeded)
+			case c == '[':
+				// explicit argument index
+				for i < len(format) && format[i] != ']' {
+					i++
+				}
+				i++
+				continue
+			case c == '.' || c >= '0' && c <= '9':
+				n := 0
+				if c == '.' {
+					i++
+				}
+				for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+					if n = n*10 + int(format[i]-'0'); n > maxPrintfWidth {
+						return fmt.Errorf("%w: printf width above %d", ErrTemplateLimitExceeded, maxPrintfWidth)
+					}
+					i++
+				}
+				continue
+			}
+			// the verb
+			break
+		}
+	}
+	return nil
+}
+
+// executeLimited executes a template honoring the configured limits.
+func (t *CompileTask) executeLimited(templ *template.Template, w io.Writer, name string, data interface{}) error {
+	limits := t.templateLimits
+	if limits == nil {
+		return templ.ExecuteTemplate(w, name, data)
+	}
+
+	limited, err := limitTemplate(templ, limits)
+	if err != nil {
+		return err
+	}
+	lw := &limitedWriter{w: w, limit: limits.MaxOutputSize}
+	if limits.Timeout > 0 {
+		lw.deadline = time.Now().Add(limits.Timeout)
+	}
+	budget := &iterationBudget{left: limits.MaxIterations, deadline: lw.deadline}
+	if budget.left <= 0 {
+		budget.left = 1000000
+	}
+	limited.Funcs(template.FuncMap{
+		rangeBudgetFuncName: budget.chargeRange,
+		callBudgetFuncName:  budget.chargeCall,
+	})
+	// the budget bounds the execution, so this returns once it stopped
+	return limited.ExecuteTemplate(lw, name, data)
+}
+
+// limitTemplate returns a copy of templ whose range actions and template
+// calls charge an iterationBudget, see TemplateLimits.MaxIterations.
+func limitTemplate(templ *template.Template, limits *TemplateLimits) (*template.Template, error) {
+	limited, err := templ.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// install placeholders, the budget is set per execution
+	limited.Funcs(template.FuncMap{
+		rangeBudgetFuncName: (*iterationBudget)(nil).chargeRange,
+		callBudgetFuncName:  (*iterationBudget)(nil).chargeCall,
+	})
+	for _, associated := range limited.Templates() {
+		if associated.Tree == nil {
+			continue
+		}
+		tree := associated.Tree.Copy()
+		limitNode(tree, tree.Root)
+		_, err := limited.AddParseTree(associated.Name(), tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return limited, nil
+}
+
+// limitNode rewrites the range actions and template calls below node to
+// charge the iteration budget.
+func limitNode(tree *parse.Tree, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			limitNode(tree, child)
+		}
+	case *parse.IfNode:
+		limitNode(tree, node.List)
+		limitNode(tree, node.ElseList)
+	case *parse.RangeNode:
+		node.Pipe.Cmds = append(node.Pipe.Cmds, budgetCommand(tree, rangeBudgetFuncName, node.Pipe.Pos))
+		limitNode(tree, node.List)
+		limitNode(tree, node.ElseList)
+	case *parse.WithNode:
+		limitNode(tree, node.List)
+		limitNode(tree, node.ElseList)
+	case *parse.TemplateNode:
+		if node.Pipe == nil {
+			node.Pipe = &parse.PipeNode{NodeType: parse.NodePipe, Pos: node.Pos, Line: node.Line}
+		}
+		node.Pipe.Cmds = append(node.Pipe.Cmds, budgetCommand(tree, callBudgetFuncName, node.Pos))
+	}
+}
+
+func budgetCommand(tree *parse.Tree, name string, pos parse.Pos) *parse.CommandNode {
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pos,
+		Args:     []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(pos)},
+	}
+}
+
+// iterationBudget bounds the range iterations and template calls of an
+// execution of a restricted template.
+type iterationBudget struct {
+	left     int64
+	deadline time.Time
+}
+
+// charge takes n iterations from the budget.
+func (b *iterationBudget) charge(n int64) error {
+	if b == nil {
+		return errors.New("template executed without iteration budget")
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return fmt.Errorf("%w: deadline passed", ErrTemplateLimitExceeded)
+	}
+	if n < 0 || atomic.AddInt64(&b.left, -n) < 0 {
+		return fmt.Errorf("%w: too many iterations", ErrTemplateLimitExceeded)
+	}
+	return nil
+}
+
+// chargeRange charges the iterations of a range over value and returns it.
+func (b *iterationBudget) chargeRange(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return value, nil
+		}
+		v = v.Elem()
+	}
+	var n int64
+	switch v.Kind() {
+	case reflect.Invalid:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = max(v.Int(), 0)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = int64(min(v.Uint(), math.MaxInt64))
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		n = int64(v.Len())
+	default:
+		// channels and iterator functions have no known length
+		return nil, fmt.Errorf("range over %s is not allowed in restricted templates", v.Type())
+	}
+	return value, b.charge(n)
+}
+
+// chargeCall charges a template call and returns its argument.
+func (b *iterationBudget) chargeCall(args ...interface{}) (interface{}, error) {
+	err := b.charge(1)
+	if len(args) == 0 {
+		return nil, err
+	}
+	return args[len(args)-1], err
+}
+
+// limitedWriter fails writes exceeding a size limit or a deadline, which
+// aborts template execution.
+type limitedWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	deadline time.Time
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		return 0, fmt.Errorf("%w: deadline passed", ErrTemplateLimitExceeded)
+	}
+	if l.limit > 0 && l.written+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("%w: output too large", ErrTemplateLimitExceeded)
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
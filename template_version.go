@@ -0,0 +1,69 @@
+package latex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// TemplateVersion identifies the template sources that produced a document.
+type TemplateVersion struct {
+	// Version is declared by the template author, e.g. "2.1".
+	Version string `json:"version,omitempty"`
+	// Fingerprint is a hash of the names and contents of all files in the
+	// source directory.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SetTemplateVersion declares the version of the template in the source
+// directory.
+func (t *CompileTask) SetTemplateVersion(version string) {
+	t.templateVersion = version
+}
+
+// TemplateVersion returns the declared version and the fingerprint of the
+// template in the source directory.
+func (t *CompileTask) TemplateVersion() (TemplateVersion, error) {
+	h := sha256.New()
+	err := hashTree(h, t.SourceDir())
+	if err != nil {
+		return TemplateVersion{}, err
+	}
+	return TemplateVersion{
+		Version:     t.templateVersion,
+		Fingerprint: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// HistoricalRender is a document generated earlier along with its template
+// data, e.g. taken from the audit log.
+type HistoricalRender struct {
+	ID   string
+	Data interface{}
+	// Pdf is the document generated back then.
+	Pdf string
+}
+
+// RerenderResult compares a historical document with its re-rendering.
+type RerenderResult struct {
+	ID string
+	// Pdf is the newly rendered document.
+	Pdf    string
+	Report DiffReport
+	Err    error
+}
+
+// Rerender renders the data of historical documents again using build, which
+// usually uses a new template version, and compares the results with the
+// documents generated before for regression review.
+func Rerender(renders []HistoricalRender, build func(data interface{}) (string, error)) []RerenderResult {
+	results := make([]RerenderResult, 0, len(renders))
+	for _, render := range renders {
+		result := RerenderResult{ID: render.ID}
+		result.Pdf, result.Err = build(render.Data)
+		if result.Err == nil {
+			result.Report, result.Err = ComparePdfs(render.Pdf, result.Pdf)
+		}
+		results = append(results, result)
+	}
+	return results
+}
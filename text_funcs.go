@@ -0,0 +1,76 @@
+package latex
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latexReplacer escapes characters with special meaning in TeX.
+var latexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`^`, `\textasciicircum{}`,
+	`_`, `\_`,
+	`%`, `\%`,
+	`~`, `\textasciitilde{}`,
+)
+
+// escapeLatex escapes s for use as text in a TeX document.
+func escapeLatex(s string) string {
+	return latexReplacer.Replace(s)
+}
+
+// truncateText shortens s to at most max characters, preferring to cut at a
+// word boundary in the last third. It reports whether s was shortened.
+func truncateText(s string, max int) (string, bool) {
+	runes := []rune(s)
+	if max < 0 || len(runes) <= max {
+		return s, false
+	}
+	cut := max
+	for i := max; i > max*2/3; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace), true
+}
+
+// textFuncs returns the template functions for user supplied strings. They
+// take plain text and return TeX as Raw, so their results are not escaped
+// again:
+//
+//	{{ truncate 40 .Name }} shortens to 40 characters followed by an
+//	ellipsis if needed.
+//	{{ seqsplit .IBAN }} allows line breaks between any characters of long
+//	tokens, requires the seqsplit package.
+//	{{ url .Website }} typesets a URL breaking at safe points, requires the
+//	url or hyperref package.
+func textFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"truncate": func(max int, s string) Raw {
+			s, truncated := truncateText(s, max)
+			s = escapeLatex(s)
+			if truncated {
+				s += `\ldots{}`
+			}
+			return Raw(s)
+		},
+		"seqsplit": func(s string) Raw {
+			return Raw(`\seqsplit{` + escapeLatex(s) + `}`)
+		},
+		"url": func(s string) Raw {
+			if strings.ContainsAny(s, "{}\\^") {
+				// not safe inside \url, break anywhere instead
+				return Raw(`\seqsplit{` + escapeLatex(s) + `}`)
+			}
+			s = strings.NewReplacer("%", `\%`, "#", `\#`).Replace(s)
+			return Raw(`\url{` + s + `}`)
+		},
+	}
+}
@@ -0,0 +1,258 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Toolchain pins the TeX distribution used by a task, so documents compiled
+// months apart remain comparable. The TeX tools are taken from a local TeX
+// Live installation of the requested year (as installed from the historic
+// repository, see HistoricRepository) or run inside a container image.
+//
+// A toolchain with just an Image runs the TeX tools in that image, which
+// works on hosts without TeX installed:
+//
+//	task.SetToolchain(&latex.Toolchain{Image: "texlive/texlive:latest"})
+//
+// Containers get the variables set by the task, those of its Environment
+// except PATH included, but not the ones of the process. They run as the
+// user set by SetRunAs, the current user by default, while the container
+// runtime itself keeps the privileges of the process.
+type Toolchain struct {
+	// Year is the TeX Live release, e.g. 2023.
+	Year int
+	// Root is the directory TeX Live releases are installed to, each in a
+	// subdirectory named by its year. Defaults to /usr/local/texlive.
+	Root string
+	// Image is the container image providing the tools. If it is empty and
+	// there is no local installation of Year, texlive/texlive:TL<Year>-historic
+	// is used.
+	Image string
+	// Runtime is the container runtime, defaults to docker. Podman takes the
+	// same options.
+	Runtime string
+	// Mounts are further host directories made available to containers at
+	// the same path, e.g. shared fonts or images. The working and compile
+	// directories are always mounted.
+	Mounts []string
+	// Limits restricts the resources of containers.
+	Limits ContainerLimits
+}
+
+// ContainerLimits restricts the resources of the containers running the
+// tools. Zero values keep the defaults of the runtime.
+type ContainerLimits struct {
+	// CPUs is the number of CPUs, e.g. 1.5.
+	CPUs float64
+	// Memory in bytes.
+	Memory int64
+	// Pids limits the number of processes.
+	Pids int
+	// Network is the network mode, e.g. "none" to keep documents from
+	// reaching the network.
+	Network string
+}
+
+// args returns the options of the container runtime applying the limits.
+func (l ContainerLimits) args() []string {
+	args := []string{}
+	if l.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(l.CPUs, 'f', -1, 64))
+	}
+	if l.Memory > 0 {
+		// no swap beyond the limit
+		memory := strconv.FormatInt(l.Memory, 10)
+		args = append(args, "--memory", memory, "--memory-swap", memory)
+	}
+	if l.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(l.Pids))
+	}
+	if l.Network != "" {
+		args = append(args, "--network", l.Network)
+	}
+	return args
+}
+
+// texTools lists the tools provided by a TeX distribution which are subject to
+// toolchain pinning.
+var texTools = []string{
+	"tex", "latex", "pdftex", "pdflatex", "xetex", "xelatex", "luatex",
+	"lualatex", "luahbtex", "lualatex-dev", "bibtex", "bibtex8", "bibtexu",
+	"biber", "makeindex", "xindy", "texindy", "makeglossaries", "kpsewhich",
+	"tlmgr", "latexmk", "dvipdfmx", "dvips", "dvisvgm", "pythontex",
+	"mktexlsr", "fmtutil",
+}
+
+// HistoricRepository returns the URL of the frozen tlmgr repository of the
+// pinned release, suitable for install-tl -repository.
+func (tc *Toolchain) HistoricRepository() string {
+	return fmt.Sprintf("https://ftp.math.utah.edu/pub/tex/historic/systems/texlive/%d/tlnet-final", tc.Year)
+}
+
+// BinDir returns the binary directory of the local installation of the
+// pinned release, an empty string if there is none.
+func (tc *Toolchain) BinDir() string {
+	if tc.Year == 0 {
+		return ""
+	}
+	root := tc.Root
+	if root == "" {
+		root = "/usr/local/texlive"
+	}
+	dir := filepath.Join(root, fmt.Sprint(tc.Year), "bin", texLivePlatform())
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return ""
+	}
+	return dir
+}
+
+// ContainerImage returns the image the tools are run in, an empty string if a
+// local installation is used.
+func (tc *Toolchain) ContainerImage() string {
+	if tc.Image != "" {
+		return tc.Image
+	}
+	if tc.Year == 0 || tc.BinDir() != "" {
+		return ""
+	}
+	return fmt.Sprintf("texlive/texlive:TL%d-historic", tc.Year)
+}
+
+func (tc *Toolchain) containerRuntime() string {
+	if tc.Runtime != "" {
+		return tc.Runtime
+	}
+	return "docker"
+}
+
+// containerRun describes how a tool is run in a container.
+type containerRun struct {
+	workingDir string
+	// mounts are bound at the same path.
+	mounts []string
+	// env names the variables passed on, the container runtime takes their
+	// values from its own environment.
+	env []string
+	// user is the user the tool is run as, nil for the current one.
+	user *Credentials
+}
+
+// containerized reports whether a tool is run in a container.
+func (tc *Toolchain) containerized(name string) bool {
+	return contains(texTools, name) && tc.ContainerImage() != ""
+}
+
+// resolve maps a TeX tool invocation to the binary and arguments actually
+// run. Container invocations are set up as described by run.
+func (tc *Toolchain) resolve(name string, args []string, run containerRun) (string, []string) {
+	if !contains(texTools, name) {
+		return name, args
+	}
+	if image := tc.ContainerImage(); image != "" {
+		workingDir := run.workingDir
+		if abs, err := filepath.Abs(workingDir); err == nil && workingDir != "" {
+			workingDir = abs
+		}
+		containerArgs := []string{"run", "--rm", "-i"}
+		mounted := map[string]bool{}
+		for _, mount := range append(append([]string{workingDir}, run.mounts...), tc.Mounts...) {
+			if mount == "" {
+				continue
+			}
+			// sources of bind mounts need to be absolute
+			if abs, err := filepath.Abs(mount); err == nil {
+				mount = abs
+			}
+			if !mounted[mount] {
+				mounted[mount] = true
+				containerArgs = append(containerArgs, "--mount", bindMount(mount))
+			}
+		}
+		containerArgs = append(containerArgs, tc.Limits.args()...)
+		for _, name := range run.env {
+			containerArgs = append(containerArgs, "-e", name)
+		}
+		switch {
+		case run.user != nil:
+			containerArgs = append(containerArgs, "--user", fmt.Sprintf("%d:%d", run.user.Uid, run.user.Gid))
+		case runtime.GOOS != "windows":
+			containerArgs = append(containerArgs, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+		}
+		containerArgs = append(containerArgs, "-w", workingDir, image, name)
+		return tc.containerRuntime(), append(containerArgs, args...)
+	}
+	if dir := tc.BinDir(); dir != "" {
+		return filepath.Join(dir, name), args
+	}
+	return name, args
+}
+
+// bindMount returns the --mount option binding dir at the same path. Unlike
+// -v it allows colons in paths, fields with commas or quotes are quoted as
+// CSV.
+func bindMount(dir string) string {
+	fields := []string{"type=bind", "source=" + dir, "target=" + dir}
+	for i, field := range fields {
+		if strings.ContainsAny(field, ",\"") {
+			fields[i] = `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// texLivePlatform returns the name TeX Live uses for the current platform.
+func texLivePlatform() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	case "386":
+		arch = "i386"
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return "universal-darwin"
+	case "windows":
+		return "windows"
+	}
+	if isMusl() {
+		return arch + "-linuxmusl"
+	}
+	return arch + "-" + runtime.GOOS
+}
+
+// Toolchain returns the pinned toolchain, nil if the tools in PATH are used.
+func (t *CompileTask) Toolchain() *Toolchain {
+	return t.toolchain
+}
+
+// SetToolchain pins the TeX distribution used for compilation. Use nil to use
+// the tools found in PATH.
+func (t *CompileTask) SetToolchain(toolchain *Toolchain) {
+	t.toolchain = toolchain
+}
+
+// VerifyToolchain checks that the TeX tools run by this task actually stem
+// from the pinned release.
+func (t *CompileTask) VerifyToolchain() error {
+	if t.toolchain == nil || t.toolchain.Year == 0 {
+		return nil
+	}
+	result, err := t.runTool("pdftex", "--version")
+	if err != nil {
+		return err
+	}
+	expected := fmt.Sprintf("TeX Live %d", t.toolchain.Year)
+	if !strings.Contains(result.Output(), expected) {
+		firstLine := strings.SplitN(result.Output(), "\n", 2)[0]
+		return fmt.Errorf("toolchain mismatch: expected %s, got %q", expected, firstLine)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package latex
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestBindMount(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/tmp/build", "type=bind,source=/tmp/build,target=/tmp/build"},
+		{"/tmp/my build", "type=bind,source=/tmp/my build,target=/tmp/my build"},
+		{"/tmp/Übersicht", "type=bind,source=/tmp/Übersicht,target=/tmp/Übersicht"},
+		{"/tmp/报告", "type=bind,source=/tmp/报告,target=/tmp/报告"},
+		{"/tmp/a,b", `type=bind,"source=/tmp/a,b","target=/tmp/a,b"`},
+		{`/tmp/say "hi"`, `type=bind,"source=/tmp/say ""hi""","target=/tmp/say ""hi"""`},
+		{"/tmp/100%#{}~", "type=bind,source=/tmp/100%#{}~,target=/tmp/100%#{}~"},
+	}
+	for _, test := range tests {
+		if got := bindMount(test.dir); got != test.want {
+			t.Errorf("bindMount(%q) = %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestToolchainResolveContainer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are not absolute on Windows")
+	}
+	tc := &Toolchain{Image: "texlive/texlive:latest", Limits: ContainerLimits{Network: "none"}}
+	uid := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	tests := []struct {
+		name string
+		tool string
+		run  containerRun
+		want []string
+	}{
+		{
+			name: "not a TeX tool",
+			tool: "qpdf",
+			run:  containerRun{workingDir: "/work"},
+			want: []string{"qpdf", "a.pdf"},
+		},
+		{
+			name: "defaults",
+			tool: "pdflatex",
+			run:  containerRun{workingDir: "/work", mounts: []string{"/work", "/tmp/compile dir"}},
+			want: []string{"docker", "run", "--rm", "-i",
+				"--mount", "type=bind,source=/work,target=/work",
+				"--mount", "type=bind,source=/tmp/compile dir,target=/tmp/compile dir",
+				"--network", "none", "--user", uid,
+				"-w", "/work", "texlive/texlive:latest", "pdflatex", "a.pdf"},
+		},
+		{
+			name: "environment and user",
+			tool: "pdflatex",
+			run: containerRun{
+				workingDir: "/work",
+				env:        []string{"SOURCE_DATE_EPOCH", "openout_any"},
+				user:       &Credentials{Uid: 1000, Gid: 100},
+			},
+			want: []string{"docker", "run", "--rm", "-i",
+				"--mount", "type=bind,source=/work,target=/work",
+				"--network", "none", "-e", "SOURCE_DATE_EPOCH", "-e", "openout_any",
+				"--user", "1000:100",
+				"-w", "/work", "texlive/texlive:latest", "pdflatex", "a.pdf"},
+		},
+	}
+	for _, test := range tests {
+		name, args := tc.resolve(test.tool, []string{"a.pdf"}, test.run)
+		if got := append([]string{name}, args...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: resolve() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestContainerEnvironment(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        *Environment
+		runAs      *Credentials
+		scheduling *Scheduling
+		want       []string
+	}{
+		{"none", nil, nil, nil, []string{}},
+		{
+			name: "environment",
+			env:  &Environment{Vars: map[string]string{"TEXMFHOME": "/texmf", "PATH": "/bin", "LANG": "C"}, Inherit: true},
+			want: []string{"LANG", "TEXMFHOME"},
+		},
+		{
+			name:       "task",
+			env:        &Environment{Vars: map[string]string{"openout_any": "a"}},
+			runAs:      &Credentials{Uid: 1000},
+			scheduling: &Scheduling{MaxThreads: 2},
+			want:       []string{"openout_any", "OMP_NUM_THREADS", "openin_any"},
+		},
+	}
+	for _, test := range tests {
+		task := NewCompileTask()
+		task.SetEnvironment(test.env)
+		task.SetRunAs(test.runAs)
+		task.SetScheduling(test.scheduling)
+		if got := task.containerEnvironment(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: containerEnvironment() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
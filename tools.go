@@ -0,0 +1,237 @@
+package latex
+
+import (
+	"bufio"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// MissingToolError reports an external tool which could not be found.
+type MissingToolError struct {
+	Tool string
+	// Searched lists the directories searched besides PATH.
+	Searched []string
+	// Hint suggests how to install the tool on this system.
+	Hint string
+}
+
+func (e *MissingToolError) Error() string {
+	msg := fmt.Sprintf("command %s is not available. Please make sure it is installed and accessible", e.Tool)
+	if len(e.Searched) > 0 {
+		msg += fmt.Sprintf(" (searched PATH and %s)", strings.Join(e.Searched, ", "))
+	}
+	if e.Hint != "" {
+		msg += ". " + e.Hint
+	}
+	return msg
+}
+
+// findTool looks up a tool in PATH, then in the bin directories of TeX Live
+// installations not added to PATH, which is common in minimal containers.
+func findTool(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return path, nil
+	}
+	dirs := []string{}
+	if contains(texTools, name) {
+		dirs = texLiveBinDirs()
+		for _, dir := range dirs {
+			path, err := exec.LookPath(filepath.Join(dir, name))
+			if err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", &MissingToolError{Tool: name, Searched: dirs, Hint: installHint(name)}
+}
+
+// texLiveBinDirs returns the bin directories of TeX Live installations in
+// their default locations matching this platform, newest first.
+func texLiveBinDirs() []string {
+	dirs := []string{}
+	for _, platform := range texLivePlatforms() {
+		for _, root := range []string{"/usr/local/texlive", "/opt/texlive"} {
+			matches, _ := filepath.Glob(filepath.Join(root, "*", "bin", platform))
+			sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+			dirs = append(dirs, matches...)
+		}
+	}
+	return dirs
+}
+
+// texLivePlatforms returns the TeX Live platform names usable on this
+// system in order of preference. On musl systems glibc builds are listed
+// last, they only run with a compatibility layer like gcompat.
+func texLivePlatforms() []string {
+	platform := texLivePlatform()
+	if strings.HasSuffix(platform, "-linuxmusl") {
+		return []string{platform, strings.TrimSuffix(platform, "musl")}
+	}
+	return []string{platform}
+}
+
+var (
+	muslOnce sync.Once
+	muslLibc bool
+)
+
+// isMusl reports whether this is a Linux system using musl libc, like Alpine.
+func isMusl() bool {
+	muslOnce.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		matches, _ := filepath.Glob("/lib/ld-musl-*.so.1")
+		muslLibc = len(matches) > 0
+	})
+	return muslLibc
+}
+
+// linuxDistribution returns the ID from /etc/os-release, like alpine or
+// debian.
+func linuxDistribution() string {
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`)
+		}
+	}
+	return ""
+}
+
+// toolPackages maps tools to the packages providing them by distribution.
+var toolPackages = map[string]map[string]string{
+	"alpine": {
+		"gs": "ghostscript", "qpdf": "qpdf", "pdfinfo": "poppler-utils",
+		"pdftotext": "poppler-utils", "pdftocairo": "poppler-utils",
+		"rsvg-convert": "rsvg-convert", "mutool": "mupdf-tools",
+		"inkscape": "inkscape", "taskset": "util-linux-misc",
+		"ionice": "util-linux-misc", "perl": "perl",
+	},
+	"debian": {
+		"gs": "ghostscript", "qpdf": "qpdf", "pdfinfo": "poppler-utils",
+		"pdftotext": "poppler-utils", "pdftocairo": "poppler-utils",
+		"rsvg-convert": "librsvg2-bin", "mutool": "mupdf-tools",
+		"inkscape": "inkscape", "taskset": "util-linux", "ionice": "util-linux",
+		"perl": "perl", "latexmk": "latexmk", "biber": "biber",
+		"xindy": "xindy",
+	},
+}
+
+// installHint suggests how to install a tool on this system.
+func installHint(name string) string {
+	distribution := linuxDistribution()
+	if distribution == "ubuntu" {
+		distribution = "debian"
+	}
+	pkg := toolPackages[distribution][name]
+	switch {
+	case pkg != "" && distribution == "alpine":
+		return fmt.Sprintf("Install it using: apk add %s", pkg)
+	case pkg != "":
+		return fmt.Sprintf("Install it using: apt-get install %s", pkg)
+	case contains(texTools, name) && distribution == "alpine":
+		return "TeX tools are provided by the texlive packages: apk add texlive (or texlive-full)"
+	case contains(texTools, name):
+		return "Install TeX Live, or add the bin directory of an existing installation to PATH"
+	}
+	return ""
+}
+
+// elfMachines maps Go architectures to ELF machine types.
+var elfMachines = map[string]elf.Machine{
+	"386":     elf.EM_386,
+	"amd64":   elf.EM_X86_64,
+	"arm":     elf.EM_ARM,
+	"arm64":   elf.EM_AARCH64,
+	"ppc64le": elf.EM_PPC64,
+	"riscv64": elf.EM_RISCV,
+	"s390x":   elf.EM_S390,
+}
+
+// diagnoseExec explains why a tool which exists could not be started: it was
+// built for another architecture, its dynamic loader is missing (a glibc
+// build on musl) or the interpreter of a script is missing (like perl for
+// latexmk on minimal images).
+func diagnoseExec(path string, err error) error {
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ENOEXEC) {
+		return err
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		return err
+	}
+	if interpreter := scriptInterpreter(path); interpreter != "" {
+		if _, statErr := os.Stat(interpreter); statErr != nil {
+			return fmt.Errorf("cannot run %s: its interpreter %s is missing: %w", path, interpreter, err)
+		}
+		return err
+	}
+
+	f, elfErr := elf.Open(path)
+	if elfErr != nil {
+		return err
+	}
+	defer f.Close()
+	if machine, ok := elfMachines[runtime.GOARCH]; ok && f.Machine != machine {
+		return fmt.Errorf("cannot run %s: it is built for %s, but this system is %s: %w", path, f.Machine, runtime.GOARCH, err)
+	}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		_, readErr := prog.ReadAt(data, 0)
+		if readErr != nil {
+			break
+		}
+		loader := strings.TrimRight(string(data), "\x00")
+		if _, statErr := os.Stat(loader); statErr == nil {
+			break
+		}
+		hint := ""
+		if isMusl() && strings.Contains(loader, "ld-linux") {
+			hint = " (it is built for glibc, but this system uses musl: install gcompat or use a musl build)"
+		}
+		return fmt.Errorf("cannot run %s: its dynamic loader %s is missing%s: %w", path, loader, hint, err)
+	}
+	return err
+}
+
+// scriptInterpreter returns the interpreter named in the shebang line of a
+// script, an empty string for other files.
+func scriptInterpreter(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return ""
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
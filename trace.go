@@ -0,0 +1,109 @@
+package latex
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimelineEvent records the execution of a single build step.
+type TimelineEvent struct {
+	Name     string
+	Category string
+	Args     []string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// accountingMu guards the accounting data (CPU time, timeline) of all tasks,
+// which may be updated by concurrently running steps.
+var accountingMu sync.Mutex
+
+// Timeline returns all steps executed by this task so far, in the order they
+// finished.
+func (t *CompileTask) Timeline() []TimelineEvent {
+	accountingMu.Lock()
+	defer accountingMu.Unlock()
+	return append([]TimelineEvent{}, t.accounting().timeline...)
+}
+
+// ResetTimeline discards all recorded steps.
+func (t *CompileTask) ResetTimeline() {
+	accountingMu.Lock()
+	defer accountingMu.Unlock()
+	t.accounting().timeline = nil
+}
+
+// TraceStep runs fn and records it as a step in the timeline. External tools
+// are recorded automatically, TraceStep allows grouping them or adding custom
+// steps.
+func (t *CompileTask) TraceStep(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	t.recordEvent(TimelineEvent{
+		Name:     name,
+		Category: "step",
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	return err
+}
+
+func (t *CompileTask) recordEvent(event TimelineEvent) {
+	accountingMu.Lock()
+	defer accountingMu.Unlock()
+	a := t.accounting()
+	a.timeline = append(a.timeline, event)
+}
+
+type chromeTraceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	Pid       int               `json:"pid"`
+	Tid       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteChromeTrace exports the timeline in the Chrome trace event format,
+// which can be inspected using chrome://tracing, Perfetto or speedscope.
+func (t *CompileTask) WriteChromeTrace(w io.Writer) error {
+	timeline := t.Timeline()
+	var origin time.Time
+	for _, event := range timeline {
+		if origin.IsZero() || event.Start.Before(origin) {
+			origin = event.Start
+		}
+	}
+
+	events := make([]chromeTraceEvent, 0, len(timeline))
+	for _, event := range timeline {
+		args := map[string]string{}
+		if len(event.Args) > 0 {
+			args["args"] = strings.Join(event.Args, " ")
+		}
+		if event.Err != nil {
+			args["error"] = event.Err.Error()
+		}
+		events = append(events, chromeTraceEvent{
+			Name:      event.Name,
+			Category:  event.Category,
+			Phase:     "X",
+			Timestamp: event.Start.Sub(origin).Microseconds(),
+			Duration:  event.Duration.Microseconds(),
+			Pid:       1,
+			Tid:       1,
+			Args:      args,
+		})
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
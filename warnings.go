@@ -0,0 +1,109 @@
+package latex
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jojomi/go-latex/logparse"
+)
+
+// WarningCategory classifies the warnings of TeX logs.
+type WarningCategory string
+
+// Warning categories. Warnings matching none of the others are
+// WarningOther.
+const (
+	// WarningMissingCharacter is a character missing in the font, which is
+	// left out of the document.
+	WarningMissingCharacter WarningCategory = "missing-character"
+	// WarningFontSubstitution is a font (shape or size) replaced by
+	// another one.
+	WarningFontSubstitution WarningCategory = "font-substitution"
+	// WarningUndefinedReference is a reference or citation without target.
+	WarningUndefinedReference WarningCategory = "undefined-reference"
+	// WarningBadBox is an overfull or underfull box.
+	WarningBadBox WarningCategory = "badbox"
+	WarningOther  WarningCategory = "other"
+)
+
+// WarningCategories lists all warning categories.
+func WarningCategories() []WarningCategory {
+	return []WarningCategory{
+		WarningMissingCharacter, WarningFontSubstitution,
+		WarningUndefinedReference, WarningBadBox, WarningOther,
+	}
+}
+
+var (
+	undefinedReferencePattern = regexp.MustCompile("^(?:Reference|Citation|Hyper reference) `[^']*' (?:on page \\S+ )?undefined|^There were undefined (?:references|citations)|^The following entry could not be found")
+	fontSubstitutionPattern   = regexp.MustCompile("^Font shape `[^']*' (?:undefined|in size .* not available)|^Some font shapes were not available|^Size substitutions with differences")
+)
+
+// warningCategory classifies a log entry of kind warning or bad box.
+func warningCategory(e logparse.Entry) WarningCategory {
+	switch {
+	case e.Kind == logparse.BadBox:
+		return WarningBadBox
+	case strings.HasPrefix(e.Message, "Missing character"):
+		return WarningMissingCharacter
+	case fontSubstitutionPattern.MatchString(e.Message):
+		return WarningFontSubstitution
+	case undefinedReferencePattern.MatchString(e.Message):
+		return WarningUndefinedReference
+	}
+	return WarningOther
+}
+
+// EscalatedWarningsError is returned by Run if the log has warnings of
+// categories set using SetWarningsAsErrors.
+type EscalatedWarningsError struct {
+	Warnings []Diagnostic
+}
+
+func (e *EscalatedWarningsError) Error() string {
+	first := e.Warnings[0]
+	msg := fmt.Sprintf("%d warnings treated as errors, first: %s", len(e.Warnings), first.Message)
+	if first.Line > 0 && !strings.Contains(first.Message, "input line") {
+		msg += fmt.Sprintf(" (line %d)", first.Line)
+	}
+	return msg
+}
+
+// WarningsAsErrors returns the warning categories treated as errors.
+func (t *CompileTask) WarningsAsErrors() []WarningCategory {
+	return t.strictWarnings
+}
+
+// SetWarningsAsErrors makes Run fail with *EscalatedWarningsError if the log
+// of the last pass has warnings of the given categories. They are reported
+// as errors of the result then. Call it without categories to keep all
+// warnings warnings.
+func (t *CompileTask) SetWarningsAsErrors(categories ...WarningCategory) {
+	t.strictWarnings = categories
+}
+
+// escalateWarnings turns the warnings of the categories treated as errors
+// into errors of result.
+func (t *CompileTask) escalateWarnings(result *CompileResult) error {
+	if len(t.strictWarnings) == 0 {
+		return nil
+	}
+	warnings := []Diagnostic{}
+	escalated := []Diagnostic{}
+	for _, d := range result.Warnings {
+		if slices.Contains(t.strictWarnings, d.Category) {
+			d.Severity = "error"
+			escalated = append(escalated, d)
+		} else {
+			warnings = append(warnings, d)
+		}
+	}
+	if len(escalated) == 0 {
+		return nil
+	}
+	result.Warnings = warnings
+	result.Errors = append(result.Errors, escalated...)
+	return &EscalatedWarningsError{Warnings: escalated}
+}
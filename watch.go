@@ -0,0 +1,177 @@
+package latex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchInterval is the time files must stay unchanged before a build, and
+// the time between two checks of the source directory when polling.
+const watchInterval = 250 * time.Millisecond
+
+// Watch builds the compile file (see Build) right away and whenever files
+// in the source directory change, until ctx is done. Each result is passed
+// to onResult. Before building, new and changed files are copied to the
+// compile directory and deleted ones removed there. If the task compiles in
+// its source directory, a temporary compile directory is used instead,
+// which is removed when Watch returns.
+//
+// On Linux changes are detected using inotify, so the source directory is
+// only scanned after a change. Elsewhere the modification times and sizes of
+// all files are polled four times a second, which costs a walk of the whole
+// tree each time, so keep large unrelated files out of the source
+// directory there. A burst of changes, like saving all files of an editor,
+// leads to one build once the files stay unchanged for a quarter of a
+// second.
+func (t *CompileTask) Watch(ctx context.Context, onResult func(*CompileResult, error)) error {
+	if t.CompileDir() == t.SourceDir() {
+		previous := t.compileDir
+		t.SetCompileDir("")
+		trackDir(ctx, t.CompileDir())
+		defer func() {
+			t.ClearCompileDir()
+			t.compileDir = previous
+			t.context().SetWorkingDir(t.CompileDirInternal())
+		}()
+		err := t.grantAccess(t.CompileDir())
+		if err != nil {
+			return err
+		}
+	}
+
+	changes := watchDir(ctx, t.SourceDir())
+	synced, err := fileTimes(t.SourceDir())
+	if err != nil {
+		return err
+	}
+	err = syncFiles(t.SourceDir(), t.CompileDirInternal(), nil, synced)
+	if err != nil {
+		return err
+	}
+	build := func() {
+		result, err := t.BuildContext(ctx, "")
+		if ctx.Err() == nil {
+			onResult(result, err)
+		}
+	}
+	build()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+		if !settle(ctx, changes) {
+			return nil
+		}
+		current, err := fileTimes(t.SourceDir())
+		if err != nil {
+			// files removed while checking, try again
+			continue
+		}
+		if sameFiles(current, synced) {
+			continue
+		}
+		err = syncFiles(t.SourceDir(), t.CompileDirInternal(), synced, current)
+		if err != nil {
+			return err
+		}
+		synced = current
+		build()
+	}
+}
+
+// settle waits until there are no changes for watchInterval. It returns
+// false if ctx is done before.
+func settle(ctx context.Context, changes <-chan struct{}) bool {
+	quiet := time.NewTimer(watchInterval)
+	defer quiet.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changes:
+			quiet.Reset(watchInterval)
+		case <-quiet.C:
+			return true
+		}
+	}
+}
+
+// pollDir signals changes below dir found by comparing the modification
+// times and sizes of all files every watchInterval.
+func pollDir(ctx context.Context, dir string) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	seen, _ := fileTimes(dir)
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := fileTimes(dir)
+			if err != nil || sameFiles(current, seen) {
+				continue
+			}
+			seen = current
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes
+}
+
+// BuildContext is like Build, but kills the running tool when ctx is done.
+func (t *CompileTask) BuildContext(ctx context.Context, file string, args ...string) (*CompileResult, error) {
+	return t.withContext(ctx).Build(file, args...)
+}
+
+// sameFiles reports whether two states of a directory are equal.
+func sameFiles(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for rel, state := range a {
+		other, ok := b[rel]
+		if !ok || !other.equal(state) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncFiles copies the files of from which are new or changed in after
+// compared to before to to, and removes the ones missing in after there.
+func syncFiles(from, to string, before, after map[string]fileState) error {
+	for rel, state := range after {
+		if previous, ok := before[rel]; ok && previous.equal(state) {
+			continue
+		}
+		target := filepath.Join(to, rel)
+		err := os.MkdirAll(filepath.Dir(target), 0700)
+		if err != nil {
+			return err
+		}
+		err = copyFile(filepath.Join(from, rel), target)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for rel := range before {
+		if _, ok := after[rel]; !ok {
+			err := os.Remove(filepath.Join(to, rel))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package latex
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events signalling changes of source files.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// watchDir signals changes below dir using inotify, falling back to polling
+// if inotify is not available, e.g. because the limit of watches is
+// reached.
+func watchDir(ctx context.Context, dir string) <-chan struct{} {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return pollDir(ctx, dir)
+	}
+	// a non-blocking file uses the runtime poller, so closing it ends reads
+	f := os.NewFile(uintptr(fd), "inotify")
+	w := &inotifyWatcher{fd: fd, dirs: map[int32]string{}}
+	err = w.addTree(dir)
+	if err != nil {
+		f.Close()
+		return pollDir(ctx, dir)
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			w.handle(buf[:n])
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes
+}
+
+// inotifyWatcher watches a directory tree, inotify watches are not
+// recursive.
+type inotifyWatcher struct {
+	fd   int
+	dirs map[int32]string
+}
+
+// addTree watches dir and its subdirectories.
+func (w *inotifyWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			return err
+		}
+		w.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// handle watches directories created or moved in according to the events
+// in buf.
+func (w *inotifyWatcher) handle(buf []byte) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			return
+		}
+		name := string(buf[syscall.SizeofInotifyEvent:end])
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		switch {
+		case event.Mask&syscall.IN_IGNORED != 0:
+			delete(w.dirs, event.Wd)
+		case event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			if parent, ok := w.dirs[event.Wd]; ok {
+				// files created before the watch are found by the rescan
+				w.addTree(filepath.Join(parent, name))
+			}
+		}
+		buf = buf[end:]
+	}
+}
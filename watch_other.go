@@ -0,0 +1,10 @@
+//go:build !linux
+
+package latex
+
+import "context"
+
+// watchDir signals changes below dir by polling, see pollDir.
+func watchDir(ctx context.Context, dir string) <-chan struct{} {
+	return pollDir(ctx, dir)
+}
@@ -0,0 +1,500 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file implements the subset of YAML needed for configuration files and
+// string bundles: block mappings and sequences, plain and quoted scalars,
+// literal (|) and folded (>) block scalars, quoted scalars spanning lines,
+// flow sequences of scalars and comments. Anchors, tags and multiple documents are not supported.
+
+type yamlLine struct {
+	num    int
+	indent int
+	// text has comments and surrounding whitespace removed, raw is the line
+	// without indentation as used in block scalars.
+	text string
+	raw  string
+}
+
+// parseYAML parses a YAML document into maps, slices, strings, bools and
+// json.Number values, like LoadTemplateData does for JSON, so amounts reach
+// the decimal functions unrounded.
+func parseYAML(data []byte) (interface{}, error) {
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	i := nextYAMLLine(lines, 0)
+	if i == len(lines) {
+		return map[string]interface{}{}, nil
+	}
+	v, i, err := parseYAMLBlock(lines, i, lines[i].indent)
+	if err != nil {
+		return nil, err
+	}
+	if i < len(lines) {
+		return nil, yamlError(lines[i], "unexpected indentation")
+	}
+	return v, nil
+}
+
+func yamlLines(data string) ([]yamlLine, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	lines := []yamlLine{}
+	for n, raw := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(trimmed)
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", n+1)
+		}
+		text := strings.TrimSpace(stripYAMLComment(trimmed))
+		if n == 0 && text == "---" {
+			text = ""
+		}
+		lines = append(lines, yamlLine{num: n + 1, indent: indent, text: text, raw: trimmed})
+	}
+	return lines, nil
+}
+
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// nextYAMLLine skips blank lines.
+func nextYAMLLine(lines []yamlLine, i int) int {
+	for i < len(lines) && lines[i].text == "" {
+		i++
+	}
+	return i
+}
+
+func yamlError(line yamlLine, msg string) error {
+	return fmt.Errorf("yaml line %d: %s", line.num, msg)
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLListItem(lines[i].text) {
+		return parseYAMLList(lines, i, indent)
+	}
+	return parseYAMLMap(lines, i, indent)
+}
+
+func parseYAMLList(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	list := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLListItem(lines[i].text) {
+		line := lines[i]
+		item := strings.TrimSpace(line.text[1:])
+		var (
+			v   interface{}
+			err error
+		)
+		switch {
+		case item == "":
+			v, i, err = parseYAMLNested(lines, i+1, indent, true)
+		case yamlKeyEnd(item) >= 0 || isYAMLListItem(item):
+			// a collection starting on the line of the item
+			offset := len(line.raw) - len(strings.TrimLeft(line.raw[1:], " "))
+			lines[i] = yamlLine{num: line.num, indent: indent + offset, text: item, raw: line.raw[offset:]}
+			v, i, err = parseYAMLBlock(lines, i, indent+offset)
+		default:
+			item, i, err = foldYAMLQuoted(lines, i, item)
+			if err == nil {
+				v, err = parseYAMLScalar(line, item)
+			}
+			i++
+		}
+		if err != nil {
+			return nil, i, err
+		}
+		list = append(list, v)
+		i = nextYAMLLine(lines, i)
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, yamlError(lines[i], "unexpected indentation")
+	}
+	return list, i, nil
+}
+
+func parseYAMLMap(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	m := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, i, yamlError(line, "expected key")
+		}
+		key, err := yamlKey(line.text[:end])
+		if err != nil {
+			return nil, i, yamlError(line, err.Error())
+		}
+		if _, ok := m[key]; ok {
+			return nil, i, yamlError(line, fmt.Sprintf("duplicate key %q", key))
+		}
+		rest := strings.TrimSpace(line.text[end+1:])
+		var v interface{}
+		switch {
+		case rest == "":
+			v, i, err = parseYAMLNested(lines, i+1, indent, false)
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			v, i, err = parseYAMLBlockScalar(lines, i+1, indent, rest)
+		default:
+			rest, i, err = foldYAMLQuoted(lines, i, rest)
+			if err == nil {
+				v, err = parseYAMLScalar(line, rest)
+			}
+			i++
+		}
+		if err != nil {
+			return nil, i, err
+		}
+		m[key] = v
+		i = nextYAMLLine(lines, i)
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, yamlError(lines[i], "unexpected indentation")
+	}
+	return m, i, nil
+}
+
+// parseYAMLNested parses the value of a key or list item continuing on the
+// next lines, which is null if there are none.
+func parseYAMLNested(lines []yamlLine, i, indent int, inList bool) (interface{}, int, error) {
+	i = nextYAMLLine(lines, i)
+	if i == len(lines) {
+		return nil, i, nil
+	}
+	next := lines[i]
+	if next.indent > indent {
+		return parseYAMLBlock(lines, i, next.indent)
+	}
+	if !inList && next.indent == indent && isYAMLListItem(next.text) {
+		// sequences may have the indentation of their key
+		return parseYAMLList(lines, i, indent)
+	}
+	return nil, i, nil
+}
+
+func parseYAMLBlockScalar(lines []yamlLine, i, indent int, header string) (interface{}, int, error) {
+	folded := header[0] == '>'
+	chomp := strings.TrimLeft(header[1:], "0123456789")
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, i, yamlError(lines[i-1], "invalid block scalar header")
+	}
+	blockIndent := -1
+	content := []string{}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line.raw) == "" {
+			content = append(content, "")
+			continue
+		}
+		if blockIndent < 0 {
+			if line.indent <= indent {
+				break
+			}
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			break
+		}
+		content = append(content, strings.Repeat(" ", line.indent-blockIndent)+line.raw)
+	}
+	// trailing blank lines belong to the chomping, not to the next key
+	trailing := 0
+	for len(content) > 0 && content[len(content)-1] == "" {
+		content = content[:len(content)-1]
+		trailing++
+	}
+	i -= trailing
+
+	var b strings.Builder
+	for n, text := range content {
+		if n > 0 {
+			if folded && text != "" && content[n-1] != "" && !strings.HasPrefix(text, " ") {
+				b.WriteString(" ")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString(text)
+	}
+	s := b.String()
+	switch chomp {
+	case "":
+		if len(content) > 0 {
+			s += "\n"
+		}
+	case "+":
+		s += strings.Repeat("\n", trailing+1)
+	}
+	return s, i, nil
+}
+
+// yamlKeyEnd returns the position of the colon ending the key of a mapping
+// entry, -1 if text is not one.
+func yamlKeyEnd(text string) int {
+	if text == "" || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return -1
+	}
+	start := 0
+	if quote := text[0]; quote == '"' || quote == '\'' {
+		start = -1
+		for i := 1; i < len(text); i++ {
+			if quote == '"' && text[i] == '\\' {
+				i++
+			} else if text[i] == quote {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return -1
+		}
+	}
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	v, err := parseYAMLScalar(yamlLine{}, key)
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		return "", fmt.Errorf("null keys are not supported")
+	}
+	return fmt.Sprint(v), nil
+}
+
+// yamlQuotedEnd returns the position of the quote ending the quoted scalar
+// at the start of s, -1 if it is not terminated.
+func yamlQuotedEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// foldYAMLQuoted joins a quoted scalar starting with first on line i which
+// continues on the following lines. Line breaks are folded into spaces,
+// empty lines into line breaks, and escaped line breaks of double-quoted
+// scalars are removed. It returns the scalar and the index of its last
+// line.
+func foldYAMLQuoted(lines []yamlLine, i int, first string) (string, int, error) {
+	if first == "" || (first[0] != '"' && first[0] != '\'') || yamlQuotedEnd(first) >= 0 {
+		return first, i, nil
+	}
+	start := lines[i]
+	s := first
+	breaks := 0
+	for i++; i < len(lines); i++ {
+		text := strings.Trim(lines[i].raw, " \t")
+		if text == "" {
+			breaks++
+			continue
+		}
+		trailing := len(s) - len(strings.TrimRight(s, "\\"))
+		switch {
+		case first[0] == '"' && trailing%2 == 1:
+			// escaped line break
+			s = s[:len(s)-1] + strings.Repeat("\n", breaks)
+		case breaks > 0:
+			s += strings.Repeat("\n", breaks)
+		default:
+			s += " "
+		}
+		s += text
+		breaks = 0
+		if end := yamlQuotedEnd(s); end >= 0 {
+			return strings.TrimSpace(stripYAMLComment(s)), i, nil
+		}
+	}
+	return "", i, yamlError(start, "unterminated quoted string")
+}
+
+// yamlEscapes maps the single character escapes of double-quoted scalars.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n",
+	'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`,
+	'/': "/", '\\': `\`, 'N': "\u0085", '_': "\u00a0", 'L': "\u2028",
+	'P': "\u2029",
+}
+
+// unescapeYAML resolves the escape sequences of a double-quoted scalar.
+func unescapeYAML(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", false
+		}
+		if escaped, ok := yamlEscapes[s[i]]; ok {
+			b.WriteString(escaped)
+			continue
+		}
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+		if digits == 0 || i+digits >= len(s) {
+			return "", false
+		}
+		r, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+		if err != nil {
+			return "", false
+		}
+		b.WriteRune(rune(r))
+		i += digits
+	}
+	return b.String(), true
+}
+
+// splitYAMLFlow splits the items of a flow sequence at commas outside of
+// quotes and nested sequences.
+func splitYAMLFlow(s string) []string {
+	items := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if end := yamlQuotedEnd(s[i:]); end >= 0 {
+				i += end
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(items, s[start:])
+}
+
+func parseYAMLScalar(line yamlLine, s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		if yamlQuotedEnd(s) != len(s)-1 {
+			return nil, yamlError(line, "invalid double-quoted string")
+		}
+		v, ok := unescapeYAML(s[1 : len(s)-1])
+		if !ok {
+			return nil, yamlError(line, "invalid escape in double-quoted string")
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if yamlQuotedEnd(s) != len(s)-1 {
+			return nil, yamlError(line, "invalid single-quoted string")
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, yamlError(line, "invalid flow sequence")
+		}
+		list := []interface{}{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return list, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			v, err := parseYAMLScalar(line, strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case s == "{}":
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, yamlError(line, "flow mappings are not supported")
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!"):
+		return nil, yamlError(line, "anchors, aliases and tags are not supported")
+	}
+	switch s {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, ok := yamlNumber(s); ok {
+		return n, nil
+	}
+	return s, nil
+}
+
+var yamlNumberPattern = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// yamlNumber returns a decimal number scalar like "+.5" or "12.50" as the
+// equivalent JSON number literal ("0.5", "12.50"), keeping its digits.
+func yamlNumber(s string) (json.Number, bool) {
+	if !yamlNumberPattern.MatchString(s) {
+		return "", false
+	}
+	sign := ""
+	switch s[0] {
+	case '-':
+		sign, s = "-", s[1:]
+	case '+':
+		s = s[1:]
+	}
+	mantissa, exponent := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exponent = s[:i], s[i:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(mantissa, ".")
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	number := sign + intPart
+	if hasFrac && fracPart != "" {
+		number += "." + fracPart
+	}
+	return json.Number(number + exponent), true
+}
@@ -0,0 +1,66 @@
+package latex
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestParseYAMLScalar(t *testing.T) {
+	tests := []struct {
+		scalar string
+		want   interface{}
+	}{
+		{"12.50", json.Number("12.50")},
+		{"42", json.Number("42")},
+		{"-7", json.Number("-7")},
+		{"+3", json.Number("3")},
+		{".5", json.Number("0.5")},
+		{"-.5", json.Number("-0.5")},
+		{"1.", json.Number("1")},
+		{"007", json.Number("7")},
+		{"1e3", json.Number("1e3")},
+		{"2.5E-2", json.Number("2.5E-2")},
+		{"0x1F", "0x1F"},
+		{"1_000", "1_000"},
+		{".inf", ".inf"},
+		{"1.2.3", "1.2.3"},
+		{`"12.50"`, "12.50"},
+		{"'42'", "42"},
+		{"true", true},
+		{"False", false},
+		{"~", nil},
+		{"null", nil},
+		{"text", "text"},
+		{"[1, a]", []interface{}{json.Number("1"), "a"}},
+	}
+	for _, test := range tests {
+		got, err := parseYAMLScalar(yamlLine{num: 1}, test.scalar)
+		if err != nil {
+			t.Errorf("parseYAMLScalar(%q) failed: %v", test.scalar, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseYAMLScalar(%q) = %#v, want %#v", test.scalar, got, test.want)
+		}
+	}
+}
+
+func TestYAMLDataFormatMoney(t *testing.T) {
+	data, err := parseYAML([]byte("total: 12.50\nitems:\n  - 0.10\n  - 0.20\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := template.Must(template.New("").Funcs(decimalFuncs()).Parse(
+		`{{ .total | formatMoney 2 "," "." }} {{ decSum .items | formatDecimal 2 }}`))
+	var b strings.Builder
+	err = tpl.Execute(&b, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "12,50 0.30"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}